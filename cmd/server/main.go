@@ -10,6 +10,8 @@ import (
 	"splitter/internal/config"
 	"splitter/internal/db"
 	"splitter/internal/federation"
+	"splitter/internal/handlers"
+	"splitter/internal/realtime"
 	"splitter/internal/repository"
 	"splitter/internal/server"
 
@@ -42,6 +44,234 @@ func main() {
 	// Ensure migration 023 is applied (remote actor encryption key for E2E DMs)
 	db.GetDB().Exec(context.Background(), "ALTER TABLE remote_actors ADD COLUMN IF NOT EXISTS encryption_public_key TEXT;")
 
+	// Ensure migration 027 is applied (remote Block / Flag handling)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS actor_blocks (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		blocker_did TEXT NOT NULL,
+		blocked_did TEXT NOT NULL,
+		activity_id TEXT,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		UNIQUE (blocker_did, blocked_did)
+	);`)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE reports ADD COLUMN IF NOT EXISTS target_did TEXT;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE reports ADD COLUMN IF NOT EXISTS source_domain TEXT;")
+
+	// Ensure migration 028 is applied (shared-inbox fan-out)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE remote_actors ADD COLUMN IF NOT EXISTS shared_inbox_url TEXT;")
+
+	// Ensure migration 030 is applied (content warnings, hashtags, mentions)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_warning TEXT;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE posts ADD COLUMN IF NOT EXISTS sensitive BOOLEAN NOT NULL DEFAULT false;")
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS post_hashtags (
+		post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (post_id, tag)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag ON post_hashtags (tag);")
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS post_mentions (
+		post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		mentioned_did TEXT NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		PRIMARY KEY (post_id, mentioned_did)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_post_mentions_mentioned ON post_mentions (mentioned_did, created_at DESC);")
+
+	// Ensure migration 031 is applied (sanitized HTML of remote content)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_html TEXT;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE users ADD COLUMN IF NOT EXISTS bio_html TEXT;")
+
+	// Ensure migration 032 is applied (federated replies)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE replies ADD COLUMN IF NOT EXISTS original_reply_uri TEXT;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE replies ADD COLUMN IF NOT EXISTS content_html TEXT;")
+	db.GetDB().Exec(context.Background(), "CREATE UNIQUE INDEX IF NOT EXISTS idx_replies_original_reply_uri ON replies (original_reply_uri) WHERE original_reply_uri IS NOT NULL;")
+
+	// Ensure migration 034 is applied (post edit history)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS post_revisions (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		content_html TEXT,
+		content_warning TEXT,
+		sensitive BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMPTZ NOT NULL,
+		recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions (post_id, created_at);")
+
+	// Ensure migration 036 is applied (account aliases and moves)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE users ADD COLUMN IF NOT EXISTS also_known_as TEXT[] NOT NULL DEFAULT '{}';")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE users ADD COLUMN IF NOT EXISTS moved_to TEXT;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE users ADD COLUMN IF NOT EXISTS moved_at TIMESTAMPTZ;")
+
+	// Ensure migration 037 is applied (polls)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS polls (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		post_id UUID NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+		multiple BOOLEAN NOT NULL DEFAULT false,
+		expires_at TIMESTAMPTZ,
+		closed_at TIMESTAMPTZ,
+		voters_count INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_polls_open_expiry ON polls (expires_at) WHERE closed_at IS NULL;")
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS poll_options (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		votes_count INTEGER NOT NULL DEFAULT 0,
+		UNIQUE (poll_id, position)
+	);`)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS poll_votes (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		option_id UUID NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+		voter_did TEXT NOT NULL,
+		original_vote_uri TEXT,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		UNIQUE (poll_id, option_id, voter_did)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_poll_votes_voter ON poll_votes (poll_id, voter_did);")
+
+	// Ensure migration 038 is applied (audience of non-public remote posts)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS post_audience (
+		post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		recipient_did TEXT NOT NULL,
+		PRIMARY KEY (post_id, recipient_did)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_post_audience_recipient ON post_audience (recipient_did);")
+
+	// Ensure migration 040 is applied (group conversations)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS is_group BOOLEAN NOT NULL DEFAULT false;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS federation_context TEXT;")
+	db.GetDB().Exec(context.Background(), "CREATE UNIQUE INDEX IF NOT EXISTS idx_message_threads_federation_context ON message_threads (federation_context) WHERE federation_context IS NOT NULL;")
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS message_thread_members (
+		thread_id UUID NOT NULL REFERENCES message_threads(id) ON DELETE CASCADE,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'member')),
+		joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_read_at TIMESTAMPTZ,
+		PRIMARY KEY (thread_id, user_id)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_message_thread_members_user ON message_thread_members (user_id);")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE messages ALTER COLUMN recipient_did DROP NOT NULL;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ALTER COLUMN participant_a DROP NOT NULL;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_threads ALTER COLUMN participant_b DROP NOT NULL;")
+
+	// Ensure migration 041 is applied (cursor-based message sync)
+	db.GetDB().Exec(context.Background(), "CREATE SEQUENCE IF NOT EXISTS message_change_seq;")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE messages ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('message_change_seq');")
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_messages_change_seq ON messages (change_seq);")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_thread_members ADD COLUMN IF NOT EXISTS read_change_seq BIGINT NOT NULL DEFAULT nextval('message_change_seq');")
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_message_thread_members_read_change_seq ON message_thread_members (read_change_seq);")
+	db.GetDB().Exec(context.Background(), `CREATE OR REPLACE FUNCTION bump_message_change_seq()
+	RETURNS TRIGGER AS $$
+	BEGIN
+		IF NEW.content IS DISTINCT FROM OLD.content
+			OR NEW.ciphertext IS DISTINCT FROM OLD.ciphertext
+			OR NEW.encrypted_keys IS DISTINCT FROM OLD.encrypted_keys
+			OR NEW.is_read IS DISTINCT FROM OLD.is_read
+			OR NEW.edited_at IS DISTINCT FROM OLD.edited_at
+			OR NEW.deleted_at IS DISTINCT FROM OLD.deleted_at THEN
+			NEW.change_seq = nextval('message_change_seq');
+		END IF;
+		RETURN NEW;
+	END;
+	$$ language 'plpgsql';`)
+	db.GetDB().Exec(context.Background(), "DROP TRIGGER IF EXISTS bump_messages_change_seq ON messages;")
+	db.GetDB().Exec(context.Background(), "CREATE TRIGGER bump_messages_change_seq BEFORE UPDATE ON messages FOR EACH ROW EXECUTE FUNCTION bump_message_change_seq();")
+	db.GetDB().Exec(context.Background(), `CREATE OR REPLACE FUNCTION bump_read_change_seq()
+	RETURNS TRIGGER AS $$
+	BEGIN
+		IF NEW.last_read_at IS DISTINCT FROM OLD.last_read_at THEN
+			NEW.read_change_seq = nextval('message_change_seq');
+		END IF;
+		RETURN NEW;
+	END;
+	$$ language 'plpgsql';`)
+	db.GetDB().Exec(context.Background(), "DROP TRIGGER IF EXISTS bump_message_thread_members_read_change_seq ON message_thread_members;")
+	db.GetDB().Exec(context.Background(), "CREATE TRIGGER bump_message_thread_members_read_change_seq BEFORE UPDATE ON message_thread_members FOR EACH ROW EXECUTE FUNCTION bump_read_change_seq();")
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS message_device_deliveries (
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		device_id TEXT NOT NULL,
+		delivered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (message_id, user_id, device_id)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_message_device_deliveries_device ON message_device_deliveries (user_id, device_id);")
+
+	// Ensure migration 042 is applied (federated message IDs)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE messages ADD COLUMN IF NOT EXISTS object_uri TEXT;")
+	db.GetDB().Exec(context.Background(), "CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_object_uri ON messages (object_uri) WHERE object_uri IS NOT NULL;")
+
+	// Ensure migration 043 is applied (device prekey bundles)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS device_signed_prekeys (
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		device_id TEXT NOT NULL,
+		key_id INTEGER NOT NULL,
+		public_key TEXT NOT NULL,
+		signature TEXT NOT NULL,
+		identity_key TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, device_id, key_id)
+	);`)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS device_one_time_prekeys (
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		device_id TEXT NOT NULL,
+		key_id INTEGER NOT NULL,
+		public_key TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		claimed_by TEXT,
+		claimed_at TIMESTAMPTZ,
+		PRIMARY KEY (user_id, device_id, key_id)
+	);`)
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_device_one_time_prekeys_available ON device_one_time_prekeys (user_id, device_id, created_at) WHERE claimed_at IS NULL;")
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_device_one_time_prekeys_claimed_by ON device_one_time_prekeys (user_id, claimed_by, claimed_at) WHERE claimed_at IS NOT NULL;")
+
+	// Ensure migration 044 is applied (commit-safe message sync cursors)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE messages ADD COLUMN IF NOT EXISTS change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();")
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_messages_change_xid_seq ON messages (change_xid, change_seq);")
+	db.GetDB().Exec(context.Background(), "ALTER TABLE message_thread_members ADD COLUMN IF NOT EXISTS read_change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();")
+	db.GetDB().Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_message_thread_members_read_change_xid_seq ON message_thread_members (read_change_xid, read_change_seq);")
+	db.GetDB().Exec(context.Background(), `CREATE OR REPLACE FUNCTION bump_message_change_seq()
+	RETURNS TRIGGER AS $$
+	BEGIN
+		IF NEW.content IS DISTINCT FROM OLD.content
+			OR NEW.ciphertext IS DISTINCT FROM OLD.ciphertext
+			OR NEW.encrypted_keys IS DISTINCT FROM OLD.encrypted_keys
+			OR NEW.is_read IS DISTINCT FROM OLD.is_read
+			OR NEW.edited_at IS DISTINCT FROM OLD.edited_at
+			OR NEW.deleted_at IS DISTINCT FROM OLD.deleted_at THEN
+			NEW.change_seq = nextval('message_change_seq');
+			NEW.change_xid = pg_current_xact_id();
+		END IF;
+		RETURN NEW;
+	END;
+	$$ language 'plpgsql';`)
+	db.GetDB().Exec(context.Background(), `CREATE OR REPLACE FUNCTION bump_read_change_seq()
+	RETURNS TRIGGER AS $$
+	BEGIN
+		IF NEW.last_read_at IS DISTINCT FROM OLD.last_read_at THEN
+			NEW.read_change_seq = nextval('message_change_seq');
+			NEW.read_change_xid = pg_current_xact_id();
+		END IF;
+		RETURN NEW;
+	END;
+	$$ language 'plpgsql';`)
+
+	// Ensure migration 045 is applied (stored mention links)
+	db.GetDB().Exec(context.Background(), `CREATE TABLE IF NOT EXISTS note_mention_links (
+		object_id TEXT NOT NULL,
+		handle TEXT NOT NULL,
+		href TEXT NOT NULL,
+		PRIMARY KEY (object_id, handle)
+	);`)
+
+	// Ensure migration 046 is applied (published time of federated messages)
+	db.GetDB().Exec(context.Background(), "ALTER TABLE messages ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;")
+
 	// Ensure encryption_public_key column exists on users table (may already exist from master schema)
 	db.GetDB().Exec(context.Background(), "ALTER TABLE users ADD COLUMN IF NOT EXISTS encryption_public_key TEXT DEFAULT '';")
 
@@ -99,9 +329,22 @@ func main() {
 		cfg.Worker.CircuitFailureThreshold,
 		time.Duration(cfg.Worker.CircuitCooldownSeconds)*time.Second,
 	)
+	federation.ConfigureInboxPolicy(cfg.Worker.InboxMaxAttempts)
+	federation.ConfigureBackfillPolicy(cfg.Federation.BackfillMaxDepth, cfg.Federation.BackfillMaxNotes)
+	federation.ConfigureRetentionPolicy(federation.RetentionPolicy{
+		OutboxTTL:      time.Duration(cfg.Worker.RetentionOutboxDays) * 24 * time.Hour,
+		InboxTTL:       time.Duration(cfg.Worker.RetentionInboxDays) * 24 * time.Hour,
+		DedupTTL:       time.Duration(cfg.Worker.RetentionDedupDays) * 24 * time.Hour,
+		ConnectionsTTL: time.Duration(cfg.Worker.RetentionConnectionsDays) * 24 * time.Hour,
+		BatchSize:      cfg.Worker.RetentionBatchSize,
+		DryRun:         cfg.Worker.RetentionDryRun,
+	})
 
 	srv := server.NewServer(cfg)
 
+	// Realtime events raised by worker processes
+	go realtime.GetHub().ListenForRelayedEvents(context.Background())
+
 	// --- Start background worker loops in-process (goroutine) ---
 	if cfg.Federation.Enabled {
 		go runWorkerLoops(cfg)
@@ -215,6 +458,9 @@ func runWorkerLoops(cfg *config.Config) {
 
 	retryInterval := time.Duration(cfg.Worker.RetryIntervalSeconds) * time.Second
 	reputationInterval := time.Duration(cfg.Worker.ReputationIntervalSeconds) * time.Second
+	inboxInterval := time.Duration(cfg.Worker.InboxIntervalSeconds) * time.Second
+	backfillInterval := time.Duration(cfg.Worker.BackfillIntervalSeconds) * time.Second
+	retentionInterval := time.Duration(cfg.Worker.RetentionIntervalSeconds) * time.Second
 
 	// Clamp minimum intervals to avoid tight loops if config is 0
 	if retryInterval < 10*time.Second {
@@ -223,15 +469,49 @@ func runWorkerLoops(cfg *config.Config) {
 	if reputationInterval < 10*time.Second {
 		reputationInterval = 60 * time.Second
 	}
+	if inboxInterval < time.Second {
+		inboxInterval = 5 * time.Second
+	}
+	if backfillInterval < time.Second {
+		backfillInterval = 10 * time.Second
+	}
+	if retentionInterval < time.Minute {
+		retentionInterval = time.Hour
+	}
 
 	retryTicker := time.NewTicker(retryInterval)
 	reputationTicker := time.NewTicker(reputationInterval)
+	inboxTicker := time.NewTicker(inboxInterval)
+	backfillTicker := time.NewTicker(backfillInterval)
 	migrationTicker := time.NewTicker(6 * time.Hour) // Check migration every 6 hours
+	pollTicker := time.NewTicker(time.Minute)        // Close expired polls
+	retentionTicker := time.NewTicker(retentionInterval)
 	defer retryTicker.Stop()
 	defer reputationTicker.Stop()
+	defer inboxTicker.Stop()
+	defer backfillTicker.Stop()
 	defer migrationTicker.Stop()
+	defer pollTicker.Stop()
+	defer retentionTicker.Stop()
+
+	log.Printf("[InProcessWorker] Started: retry every %s, reputation every %s, inbox every %s, backfill every %s, retention every %s, migration check every 6h", retryInterval, reputationInterval, inboxInterval, backfillInterval, retentionInterval)
 
-	log.Printf("[InProcessWorker] Started: retry every %s, reputation every %s, migration check every 6h", retryInterval, reputationInterval)
+	// Inbound activities are verified and queued by the HTTP inbox, then applied here
+	if err := federation.EnsureInboxQueueSchema(ctx); err != nil {
+		log.Printf("[InProcessWorker] Failed to ensure inbox queue schema: %v", err)
+	}
+	inboxProcessor := handlers.NewInboxHandler(repository.NewUserRepository(), repository.NewMessageRepository(), cfg)
+
+	// Remote threads opened by local users are backfilled here
+	if err := federation.EnsureThreadBackfillSchema(ctx); err != nil {
+		log.Printf("[InProcessWorker] Failed to ensure thread backfill schema: %v", err)
+	}
+	backfillStore := handlers.NewThreadBackfillStore(repository.NewPostRepository())
+
+	// Old federation bookkeeping rows are rolled up and deleted here
+	if err := federation.EnsureRetentionSchema(ctx); err != nil {
+		log.Printf("[InProcessWorker] Failed to ensure retention schema: %v", err)
+	}
 
 	// Ensure migration table exists
 	if err := federation.EnsureMigrationTable(ctx); err != nil {
@@ -258,8 +538,49 @@ func runWorkerLoops(cfg *config.Config) {
 			if err := federation.RecalculateInstanceReputation(ctx); err != nil {
 				log.Printf("[InProcessWorker] Reputation recalculation failed: %v", err)
 			}
+		case <-inboxTicker.C:
+			processed, failed, err := federation.ProcessInboxBatch(ctx, 50, inboxProcessor.ProcessActivity)
+			if err != nil {
+				log.Printf("[InProcessWorker] Inbox batch failed: %v", err)
+				continue
+			}
+			if processed > 0 {
+				log.Printf("[InProcessWorker] Inbox batch processed=%d failed=%d", processed, failed)
+			}
+		case <-backfillTicker.C:
+			processed, failed, err := federation.ProcessThreadBackfillBatch(ctx, 5, backfillStore)
+			if err != nil {
+				log.Printf("[InProcessWorker] Backfill batch failed: %v", err)
+				continue
+			}
+			if processed > 0 {
+				log.Printf("[InProcessWorker] Backfill batch processed=%d failed=%d", processed, failed)
+			}
 		case <-migrationTicker.C:
 			federation.CheckAndMigrateUsers(ctx, cfg.Federation.Domain)
+		case <-pollTicker.C:
+			closed, err := handlers.CloseExpiredPolls(ctx, repository.NewPostRepository(), repository.NewUserRepository(), cfg)
+			if err != nil {
+				log.Printf("[InProcessWorker] Closing expired polls failed: %v", err)
+				continue
+			}
+			if closed > 0 {
+				log.Printf("[InProcessWorker] Closed %d expired polls", closed)
+			}
+		case <-retentionTicker.C:
+			run, err := federation.RunRetention(ctx, cfg.Worker.RetentionDryRun)
+			if err != nil {
+				log.Printf("[InProcessWorker] Retention run failed: %v", err)
+				continue
+			}
+			if total := run.OutboxDeleted + run.InboxDeleted + run.DedupDeleted + run.ConnectionsDeleted; total > 0 {
+				verb := "deleted"
+				if run.DryRun {
+					verb = "would delete"
+				}
+				log.Printf("[InProcessWorker] Retention %s outbox=%d inbox=%d dedup=%d connections=%d", verb,
+					run.OutboxDeleted, run.InboxDeleted, run.DedupDeleted, run.ConnectionsDeleted)
+			}
 		}
 	}
 }
@@ -11,6 +11,9 @@ import (
 	"splitter/internal/config"
 	"splitter/internal/db"
 	"splitter/internal/federation"
+	"splitter/internal/handlers"
+	"splitter/internal/realtime"
+	"splitter/internal/repository"
 )
 
 func main() {
@@ -26,6 +29,45 @@ func main() {
 		cfg.Worker.CircuitFailureThreshold,
 		time.Duration(cfg.Worker.CircuitCooldownSeconds)*time.Second,
 	)
+	federation.ConfigureInboxPolicy(cfg.Worker.InboxMaxAttempts)
+	federation.ConfigureBackfillPolicy(cfg.Federation.BackfillMaxDepth, cfg.Federation.BackfillMaxNotes)
+	federation.ConfigureRetentionPolicy(federation.RetentionPolicy{
+		OutboxTTL:      time.Duration(cfg.Worker.RetentionOutboxDays) * 24 * time.Hour,
+		InboxTTL:       time.Duration(cfg.Worker.RetentionInboxDays) * 24 * time.Hour,
+		DedupTTL:       time.Duration(cfg.Worker.RetentionDedupDays) * 24 * time.Hour,
+		ConnectionsTTL: time.Duration(cfg.Worker.RetentionConnectionsDays) * 24 * time.Hour,
+		BatchSize:      cfg.Worker.RetentionBatchSize,
+		DryRun:         cfg.Worker.RetentionDryRun,
+	})
+
+	// Retried deliveries are signed with the instance or per-user keys
+	if cfg.Federation.Enabled {
+		federation.SetInstanceURL(cfg.Federation.URL)
+		federation.SetSecureMode(cfg.Federation.SecureMode)
+		federation.ConfigureSignaturePolicy(time.Duration(cfg.Federation.SignatureMaxSkewSeconds) * time.Second)
+		if err := federation.EnsureInstanceKeys(cfg.Federation.Domain); err != nil {
+			log.Printf("[Worker] Failed to load instance keys: %v", err)
+		}
+		if err := federation.EnsureInboxQueueSchema(context.Background()); err != nil {
+			log.Printf("[Worker] Failed to ensure inbox queue schema: %v", err)
+		}
+		if err := federation.EnsureThreadBackfillSchema(context.Background()); err != nil {
+			log.Printf("[Worker] Failed to ensure thread backfill schema: %v", err)
+		}
+		if err := federation.EnsureRelaysSchema(context.Background()); err != nil {
+			log.Printf("[Worker] Failed to ensure relay tables: %v", err)
+		}
+		if err := federation.EnsureRetentionSchema(context.Background()); err != nil {
+			log.Printf("[Worker] Failed to ensure retention tables: %v", err)
+		}
+	}
+
+	// Events raised while processing the inbox reach clients through the server
+	realtime.GetHub().RelayToServer()
+
+	inboxProcessor := handlers.NewInboxHandler(repository.NewUserRepository(), repository.NewMessageRepository(), cfg)
+	postRepo := repository.NewPostRepository()
+	backfillStore := handlers.NewThreadBackfillStore(postRepo)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -35,10 +77,31 @@ func main() {
 
 	retryTicker := time.NewTicker(time.Duration(cfg.Worker.RetryIntervalSeconds) * time.Second)
 	reputationTicker := time.NewTicker(time.Duration(cfg.Worker.ReputationIntervalSeconds) * time.Second)
+	inboxInterval := time.Duration(cfg.Worker.InboxIntervalSeconds) * time.Second
+	if inboxInterval < time.Second {
+		inboxInterval = 5 * time.Second
+	}
+	inboxTicker := time.NewTicker(inboxInterval)
+	backfillInterval := time.Duration(cfg.Worker.BackfillIntervalSeconds) * time.Second
+	if backfillInterval < time.Second {
+		backfillInterval = 10 * time.Second
+	}
+	backfillTicker := time.NewTicker(backfillInterval)
+	pollTicker := time.NewTicker(time.Minute)
+	retentionInterval := time.Duration(cfg.Worker.RetentionIntervalSeconds) * time.Second
+	if retentionInterval < time.Minute {
+		retentionInterval = time.Hour
+	}
+	retentionTicker := time.NewTicker(retentionInterval)
 	defer retryTicker.Stop()
 	defer reputationTicker.Stop()
+	defer inboxTicker.Stop()
+	defer backfillTicker.Stop()
+	defer pollTicker.Stop()
+	defer retentionTicker.Stop()
 
-	log.Printf("Worker started: retry every %ds, reputation every %ds", cfg.Worker.RetryIntervalSeconds, cfg.Worker.ReputationIntervalSeconds)
+	log.Printf("Worker started: retry every %ds, reputation every %ds, inbox every %s, backfill every %s, retention every %s",
+		cfg.Worker.RetryIntervalSeconds, cfg.Worker.ReputationIntervalSeconds, inboxInterval, backfillInterval, retentionInterval)
 
 	if cfg.Federation.Enabled {
 		if err := federation.RecalculateInstanceReputation(ctx); err != nil {
@@ -72,6 +135,57 @@ func main() {
 			if err := federation.RecalculateInstanceReputation(ctx); err != nil {
 				log.Printf("[Worker] Reputation recalculation failed: %v", err)
 			}
+		case <-inboxTicker.C:
+			if !cfg.Federation.Enabled {
+				continue
+			}
+			processed, failed, err := federation.ProcessInboxBatch(ctx, 50, inboxProcessor.ProcessActivity)
+			if err != nil {
+				log.Printf("[Worker] Inbox batch failed: %v", err)
+				continue
+			}
+			if processed > 0 {
+				log.Printf("[Worker] Inbox batch processed=%d failed=%d", processed, failed)
+			}
+		case <-backfillTicker.C:
+			if !cfg.Federation.Enabled {
+				continue
+			}
+			processed, failed, err := federation.ProcessThreadBackfillBatch(ctx, 5, backfillStore)
+			if err != nil {
+				log.Printf("[Worker] Backfill batch failed: %v", err)
+				continue
+			}
+			if processed > 0 {
+				log.Printf("[Worker] Backfill batch processed=%d failed=%d", processed, failed)
+			}
+		case <-pollTicker.C:
+			// Polls close even without federation; results are only delivered when it is enabled
+			closed, err := handlers.CloseExpiredPolls(ctx, postRepo, repository.NewUserRepository(), cfg)
+			if err != nil {
+				log.Printf("[Worker] Closing expired polls failed: %v", err)
+				continue
+			}
+			if closed > 0 {
+				log.Printf("[Worker] Closed %d expired polls", closed)
+			}
+		case <-retentionTicker.C:
+			if !cfg.Federation.Enabled {
+				continue
+			}
+			run, err := federation.RunRetention(ctx, cfg.Worker.RetentionDryRun)
+			if err != nil {
+				log.Printf("[Worker] Retention run failed: %v", err)
+				continue
+			}
+			if total := run.OutboxDeleted + run.InboxDeleted + run.DedupDeleted + run.ConnectionsDeleted; total > 0 {
+				verb := "deleted"
+				if run.DryRun {
+					verb = "would delete"
+				}
+				log.Printf("[Worker] Retention %s outbox=%d inbox=%d dedup=%d connections=%d", verb,
+					run.OutboxDeleted, run.InboxDeleted, run.DedupDeleted, run.ConnectionsDeleted)
+			}
 		}
 	}
 }
@@ -41,9 +41,10 @@ type DatabaseConfig struct {
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port    string
-	Env     string
-	BaseURL string
+	Port              string
+	Env               string
+	BaseURL           string
+	RegistrationsOpen bool // Whether new accounts can sign up; advertised in NodeInfo
 }
 
 // JWTConfig holds JWT-related configuration
@@ -54,9 +55,15 @@ type JWTConfig struct {
 
 // FederationConfig holds federation-related configuration
 type FederationConfig struct {
-	Domain  string // Instance domain identifier (e.g., "splitter-1")
-	URL     string // Full URL of this instance (e.g., "http://localhost:8000")
-	Enabled bool   // Whether federation is enabled
+	Domain     string // Instance domain identifier (e.g., "splitter-1")
+	URL        string // Full URL of this instance (e.g., "http://localhost:8000")
+	Enabled    bool   // Whether federation is enabled
+	SecureMode bool   // Require signed GETs for actors, outboxes, collections and notes (authorized fetch)
+
+	SignatureMaxSkewSeconds int // How far a signed Date / created timestamp may be from our clock
+
+	BackfillMaxDepth int // Ancestor and reply levels followed when backfilling a remote thread
+	BackfillMaxNotes int // Notes fetched per thread backfill
 }
 
 // WorkerConfig holds background worker configuration
@@ -66,6 +73,18 @@ type WorkerConfig struct {
 	CircuitCooldownSeconds    int
 	MaxRetryCount             int
 	CircuitFailureThreshold   int
+	InboxIntervalSeconds      int
+	InboxMaxAttempts          int
+	BackfillIntervalSeconds   int
+
+	// Retention of federation bookkeeping tables; TTLs are in days
+	RetentionIntervalSeconds int
+	RetentionOutboxDays      int
+	RetentionInboxDays       int
+	RetentionDedupDays       int
+	RetentionConnectionsDays int
+	RetentionBatchSize       int
+	RetentionDryRun          bool
 }
 
 // BotConfig holds configuration for the Split AI reply bot
@@ -89,15 +108,23 @@ func Load() *Config {
 			Port:    getEnv("PORT", "8080"),
 			Env:     getEnv("ENV", "development"),
 			BaseURL: getEnv("BASE_URL", "http://localhost:3000"),
+
+			RegistrationsOpen: getEnv("REGISTRATIONS_OPEN", "true") == "true",
 		},
 		JWT: JWTConfig{
 			Secret:     getEnv("JWT_SECRET", "your-secret-key"),
 			Expiration: 24, // 24 hours
 		},
 		Federation: FederationConfig{
-			Domain:  getEnv("FEDERATION_DOMAIN", "localhost"),
-			URL:     getEnv("FEDERATION_URL", "http://localhost:8000"),
-			Enabled: getEnv("FEDERATION_ENABLED", "true") == "true",
+			Domain:     getEnv("FEDERATION_DOMAIN", "localhost"),
+			URL:        getEnv("FEDERATION_URL", "http://localhost:8000"),
+			Enabled:    getEnv("FEDERATION_ENABLED", "true") == "true",
+			SecureMode: getEnv("FEDERATION_SECURE_MODE", "false") == "true",
+
+			SignatureMaxSkewSeconds: getEnvAsInt("FEDERATION_SIGNATURE_MAX_SKEW_SECONDS", 3600),
+
+			BackfillMaxDepth: getEnvAsInt("FEDERATION_BACKFILL_MAX_DEPTH", 16),
+			BackfillMaxNotes: getEnvAsInt("FEDERATION_BACKFILL_MAX_NOTES", 200),
 		},
 		Worker: WorkerConfig{
 			RetryIntervalSeconds:      getEnvAsInt("WORKER_RETRY_INTERVAL_SECONDS", 15),
@@ -105,6 +132,17 @@ func Load() *Config {
 			CircuitCooldownSeconds:    getEnvAsInt("WORKER_CIRCUIT_COOLDOWN_SECONDS", 300),
 			MaxRetryCount:             getEnvAsInt("WORKER_MAX_RETRY_COUNT", 6),
 			CircuitFailureThreshold:   getEnvAsInt("WORKER_CIRCUIT_FAILURE_THRESHOLD", 5),
+			InboxIntervalSeconds:      getEnvAsInt("WORKER_INBOX_INTERVAL_SECONDS", 5),
+			InboxMaxAttempts:          getEnvAsInt("WORKER_INBOX_MAX_ATTEMPTS", 8),
+			BackfillIntervalSeconds:   getEnvAsInt("WORKER_BACKFILL_INTERVAL_SECONDS", 10),
+
+			RetentionIntervalSeconds: getEnvAsInt("WORKER_RETENTION_INTERVAL_SECONDS", 3600),
+			RetentionOutboxDays:      getEnvAsInt("WORKER_RETENTION_OUTBOX_DAYS", 14),
+			RetentionInboxDays:       getEnvAsInt("WORKER_RETENTION_INBOX_DAYS", 14),
+			RetentionDedupDays:       getEnvAsInt("WORKER_RETENTION_DEDUP_DAYS", 7),
+			RetentionConnectionsDays: getEnvAsInt("WORKER_RETENTION_CONNECTIONS_DAYS", 90),
+			RetentionBatchSize:       getEnvAsInt("WORKER_RETENTION_BATCH_SIZE", 1000),
+			RetentionDryRun:          getEnv("WORKER_RETENTION_DRY_RUN", "false") == "true",
 		},
 		Bot: BotConfig{
 			ApiKey: getEnvWithFallback("SPLIT_BOT_API_KEY", "GEMINI_API_KEY"),
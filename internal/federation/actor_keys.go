@@ -0,0 +1,206 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"splitter/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EnsureActorKeyTable creates the actor_keys table if migration 025 has not been applied
+func EnsureActorKeyTable(ctx context.Context) error {
+	_, err := db.GetDB().Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS actor_keys (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			key_type TEXT NOT NULL DEFAULT 'rsa',
+			public_key_pem TEXT NOT NULL,
+			private_key_pem TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now()
+		)
+	`)
+	return err
+}
+
+// generateRSAKeyPair creates an RSA-2048 keypair and returns it with its PEM encodings
+func generateRSAKeyPair() (*rsa.PrivateKey, string, string, error) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+
+	privBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privKey)}
+	privPEM := string(pem.EncodeToMemory(privBlock))
+
+	pubBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	pubBlock := &pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}
+	pubPEM := string(pem.EncodeToMemory(pubBlock))
+
+	return privKey, privPEM, pubPEM, nil
+}
+
+// parseRSAPrivateKeyPEM decodes a PKCS1 RSA private key
+func parseRSAPrivateKeyPEM(privPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key PEM")
+	}
+	privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return privKey, nil
+}
+
+// EnsureActorKeys loads or generates the signing keypair for a local user.
+// Returns the private key and the public key in PEM format.
+func EnsureActorKeys(ctx context.Context, userID string) (*rsa.PrivateKey, string, error) {
+	var pubPEM, privPEM string
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT public_key_pem, private_key_pem FROM actor_keys WHERE user_id = $1`, userID,
+	).Scan(&pubPEM, &privPEM)
+	if err == nil {
+		privKey, parseErr := parseRSAPrivateKeyPEM(privPEM)
+		if parseErr != nil {
+			return nil, "", parseErr
+		}
+		return privKey, pubPEM, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, "", fmt.Errorf("failed to load actor keys: %w", err)
+	}
+
+	privKey, privPEM, pubPEM, err := generateRSAKeyPair()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Another request may have generated keys concurrently; keep whichever landed first.
+	err = db.GetDB().QueryRow(ctx,
+		`INSERT INTO actor_keys (user_id, key_type, public_key_pem, private_key_pem)
+		 VALUES ($1, 'rsa', $2, $3)
+		 ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		 RETURNING public_key_pem, private_key_pem`,
+		userID, pubPEM, privPEM,
+	).Scan(&pubPEM, &privPEM)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store actor keys: %w", err)
+	}
+
+	privKey, err = parseRSAPrivateKeyPEM(privPEM)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Printf("[Federation] Generated RSA keypair for user %s", userID)
+	return privKey, pubPEM, nil
+}
+
+// GetActorPublicKeyPEM returns the public signing key of a local user, generating one if missing
+func GetActorPublicKeyPEM(ctx context.Context, userID string) (string, error) {
+	_, pubPEM, err := EnsureActorKeys(ctx, userID)
+	return pubPEM, err
+}
+
+// BackfillActorKeys generates signing keys for every local user that does not have one yet.
+// Returns the number of keypairs created.
+func BackfillActorKeys(ctx context.Context, localDomain string) (int, error) {
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT u.id FROM users u
+		 LEFT JOIN actor_keys k ON k.user_id = u.id
+		 WHERE k.id IS NULL
+		   AND COALESCE(u.instance_domain, '') IN ($1, 'localhost', '')`,
+		localDomain,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list users without keys: %w", err)
+	}
+
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+
+	created := 0
+	for _, id := range userIDs {
+		if _, _, err := EnsureActorKeys(ctx, id); err != nil {
+			log.Printf("[Federation] Failed to backfill keys for user %s: %v", id, err)
+			continue
+		}
+		created++
+	}
+	return created, nil
+}
+
+// InstanceActorURI returns the URI of the instance (Application) actor
+func InstanceActorURI() string {
+	return InstanceBaseURL() + "/ap/actor"
+}
+
+// IsLocalURI reports whether an ActivityPub object URI belongs to this instance
+func IsLocalURI(uri string) bool {
+	return isLocalActorURI(uri)
+}
+
+// isLocalActorURI reports whether an actor URI belongs to this instance
+func isLocalActorURI(actorURI string) bool {
+	base := InstanceBaseURL()
+	if base != "" && strings.HasPrefix(actorURI, base+"/") {
+		return true
+	}
+	domain := GetInstanceDomain()
+	return domain != "" && extractDomainFromURI(actorURI) == domain
+}
+
+// localUserSigningKey loads (or creates) the key of the local user with the given username
+var localUserSigningKey = func(ctx context.Context, username string) (*rsa.PrivateKey, error) {
+	var userID string
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT id FROM users
+		 WHERE username = $1 AND COALESCE(instance_domain, '') IN ($2, 'localhost', '')`,
+		username, GetInstanceDomain(),
+	).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	privKey, _, err := EnsureActorKeys(ctx, userID)
+	return privKey, err
+}
+
+// signingKeyForActor picks the key used to sign a delivery on behalf of actorURI.
+// Local users sign with their own key; everything else falls back to the instance actor.
+func signingKeyForActor(ctx context.Context, actorURI string) (*rsa.PrivateKey, string) {
+	if actorURI != "" && isLocalActorURI(actorURI) {
+		if parsed, err := url.Parse(actorURI); err == nil {
+			parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+			if len(parts) == 3 && parts[0] == "ap" && parts[1] == "users" && parts[2] != "" {
+				privKey, keyErr := localUserSigningKey(ctx, parts[2])
+				if keyErr == nil {
+					return privKey, actorURI + "#main-key"
+				}
+				log.Printf("[Federation] Warning: could not load keys for %s: %v", actorURI, keyErr)
+			}
+		}
+	}
+
+	if privKey := GetInstancePrivateKey(); privKey != nil {
+		return privKey, InstanceActorURI() + "#main-key"
+	}
+	return nil, ""
+}
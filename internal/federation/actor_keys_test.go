@@ -0,0 +1,105 @@
+package federation
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// withLocalInstance configures the instance as https://splitter.test with its own key
+// and serves local users' keys from userKeys for the duration of the test
+func withLocalInstance(t *testing.T, userKeys map[string]*rsa.PrivateKey) *rsa.PrivateKey {
+	t.Helper()
+	instanceKey, _, instancePEM, err := generateRSAKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate instance key: %v", err)
+	}
+
+	keyMu.Lock()
+	oldKey, oldPEM, oldDomain, oldURL := instancePrivateKey, instancePublicPEM, instanceDomain, instanceURL
+	instancePrivateKey, instancePublicPEM = instanceKey, instancePEM
+	instanceDomain, instanceURL = "splitter.test", "https://splitter.test"
+	keyMu.Unlock()
+	oldLookup := localUserSigningKey
+	localUserSigningKey = func(ctx context.Context, username string) (*rsa.PrivateKey, error) {
+		if key, ok := userKeys[username]; ok {
+			return key, nil
+		}
+		return nil, errors.New("no such user")
+	}
+
+	t.Cleanup(func() {
+		keyMu.Lock()
+		instancePrivateKey, instancePublicPEM = oldKey, oldPEM
+		instanceDomain, instanceURL = oldDomain, oldURL
+		keyMu.Unlock()
+		localUserSigningKey = oldLookup
+	})
+	return instanceKey
+}
+
+func TestGenerateRSAKeyPairRoundTrip(t *testing.T) {
+	privKey, privPEM, pubPEM, err := generateRSAKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	parsed, err := parseRSAPrivateKeyPEM(privPEM)
+	if err != nil {
+		t.Fatalf("failed to parse generated private key: %v", err)
+	}
+	if !parsed.Equal(privKey) {
+		t.Fatalf("expected the parsed private key to match the generated one")
+	}
+	if !strings.HasPrefix(pubPEM, "-----BEGIN PUBLIC KEY-----") {
+		t.Fatalf("expected a PKIX public key PEM, got %q", pubPEM)
+	}
+}
+
+func TestSigningKeyForActorUsesPerUserKeys(t *testing.T) {
+	aliceKey, _, alicePEM, err := generateRSAKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate user key: %v", err)
+	}
+	instanceKey := withLocalInstance(t, map[string]*rsa.PrivateKey{"alice": aliceKey})
+
+	tests := []struct {
+		name      string
+		actor     string
+		wantKey   *rsa.PrivateKey
+		wantKeyID string
+	}{
+		{"local user", "https://splitter.test/ap/users/alice", aliceKey, "https://splitter.test/ap/users/alice#main-key"},
+		{"unknown local user", "https://splitter.test/ap/users/ghost", instanceKey, "https://splitter.test/ap/actor#main-key"},
+		{"instance actor", "https://splitter.test/ap/actor", instanceKey, "https://splitter.test/ap/actor#main-key"},
+		{"remote actor", "https://remote.test/ap/users/alice", instanceKey, "https://splitter.test/ap/actor#main-key"},
+		{"no actor", "", instanceKey, "https://splitter.test/ap/actor#main-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, keyID := signingKeyForActor(context.Background(), tt.actor)
+			if key != tt.wantKey || keyID != tt.wantKeyID {
+				t.Fatalf("expected keyId %s, got %s (same key: %v)", tt.wantKeyID, keyID, key == tt.wantKey)
+			}
+		})
+	}
+
+	// A delivery signed for alice verifies against her published key, not the instance key
+	key, keyID := signingKeyForActor(context.Background(), "https://splitter.test/ap/users/alice")
+	req, _ := http.NewRequest(http.MethodPost, "https://remote.test/inbox", strings.NewReader(testActivityBody))
+	if err := SignRequest(req, key, keyID); err != nil {
+		t.Fatalf("failed to sign request: %v", err)
+	}
+	if got := SignatureKeyID(req); got != keyID {
+		t.Fatalf("expected keyId %s on the request, got %s", keyID, got)
+	}
+	if err := VerifyRequest(req, alicePEM); err != nil {
+		t.Fatalf("expected the signature to verify with alice's key, got %v", err)
+	}
+	if err := VerifyRequest(req, GetInstancePublicKeyPEM()); err == nil {
+		t.Fatalf("expected the instance key not to verify alice's signature")
+	}
+}
@@ -0,0 +1,175 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"splitter/internal/db"
+)
+
+// FollowersURI returns the followers collection of an actor
+func FollowersURI(actorURI string) string {
+	return strings.TrimRight(actorURI, "/") + "/followers"
+}
+
+// IsFollowersCollection reports whether recipient is the followers collection of actorURI.
+// Mastodon, Pleroma, Misskey and GoToSocial all serve it at <actor>/followers.
+func IsFollowersCollection(recipient, actorURI string) bool {
+	if recipient == FollowersURI(actorURI) {
+		return true
+	}
+	return strings.HasSuffix(recipient, "/followers") && extractDomainFromURI(recipient) == extractDomainFromURI(actorURI)
+}
+
+// IsPublicAddress reports whether recipient is the special Public collection
+func IsPublicAddress(recipient string) bool {
+	return recipient == publicCollection || recipient == "as:Public" || recipient == "Public"
+}
+
+// NoteVisibility classifies the addressing of an inbound Note the way Mastodon does:
+// "public" when it is addressed to the Public collection (in to or cc), "followers" when
+// addressed to the author's followers collection, "direct" when it carries encrypted
+// content or mentions every actor it is addressed to, and "circle" (limited) otherwise.
+func NoteVisibility(actorURI string, recipients, mentions []string, encrypted bool) string {
+	followers := false
+	var actors []string
+	for _, recipient := range recipients {
+		switch {
+		case IsPublicAddress(recipient):
+			return "public"
+		case IsFollowersCollection(recipient, actorURI):
+			followers = true
+		default:
+			actors = append(actors, recipient)
+		}
+	}
+	if followers {
+		return "followers"
+	}
+	if encrypted {
+		return "direct"
+	}
+
+	mentioned := make(map[string]bool, len(mentions))
+	for _, mention := range mentions {
+		mentioned[mention] = true
+	}
+	for _, actor := range actors {
+		if !mentioned[actor] {
+			return "circle"
+		}
+	}
+	return "direct"
+}
+
+// activityNote returns the Note carried by a Create or Update, including the Note of a Question
+func activityNote(activity *Activity) (Note, bool) {
+	switch object := activity.Object.(type) {
+	case Note:
+		return object, true
+	case Question:
+		return object.Note, true
+	}
+	return Note{}, false
+}
+
+// setAudience replaces the to/cc addressing of an activity and of the Note it carries
+func setAudience(activity *Activity, to, cc []string) {
+	activity.To = to
+	activity.CC = cc
+	switch object := activity.Object.(type) {
+	case Note:
+		object.To, object.CC = to, cc
+		activity.Object = object
+	case Question:
+		object.To, object.CC = to, cc
+		activity.Object = object
+	}
+}
+
+// AddressToFollowers turns a public activity into a followers-only one: it is addressed
+// to the author's followers collection, with the mentioned actors kept in cc.
+func AddressToFollowers(activity *Activity, actorURI string) {
+	var cc []string
+	if note, ok := activityNote(activity); ok {
+		cc = note.CC
+	}
+	setAudience(activity, []string{FollowersURI(actorURI)}, cc)
+}
+
+// AddressToActors addresses an activity to the given actors only, with nothing in cc
+func AddressToActors(activity *Activity, actorURIs []string) {
+	setAudience(activity, actorURIs, nil)
+}
+
+// circleMember is a remote account in a local user's circle
+type circleMember struct {
+	ActorURI string
+	Inbox    string
+}
+
+// circleMembers returns the remote members of ownerDID's circle with the inbox that reaches them.
+// Remote users are stored by actor URI or as did:web:<domain>:<username>.
+func circleMembers(ctx context.Context, ownerDID string) ([]circleMember, error) {
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT DISTINCT ra.actor_uri, COALESCE(ra.inbox_url, ''), COALESCE(ra.shared_inbox_url, '')
+		 FROM circle_members cm
+		 JOIN users owner ON owner.id = cm.owner_id
+		 JOIN users m ON m.id = cm.member_id
+		 JOIN remote_actors ra
+		   ON ra.actor_uri = m.did
+		   OR m.did = 'did:web:' || ra.domain || ':' || ra.username
+		 WHERE owner.did = $1`,
+		ownerDID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query circle members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []circleMember
+	for rows.Next() {
+		var member circleMember
+		var inbox, sharedInbox string
+		if err := rows.Scan(&member.ActorURI, &inbox, &sharedInbox); err != nil {
+			continue
+		}
+		if member.Inbox = deliveryInbox(inbox, sharedInbox); member.Inbox != "" {
+			members = append(members, member)
+		}
+	}
+	return members, rows.Err()
+}
+
+// DeliverToCircle addresses an activity to the remote members of ownerDID's circle and
+// delivers it to them only. Members on the same server share one delivery when it has a
+// shared inbox; the explicit addressing keeps everyone else on that server out.
+func DeliverToCircle(activity *Activity, ownerDID string) {
+	members, err := circleMembers(context.Background(), ownerDID)
+	if err != nil {
+		log.Printf("[Federation] Failed to load circle members of %s: %v", ownerDID, err)
+		return
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	actors := make([]string, 0, len(members))
+	inboxes := make(map[string]bool)
+	for _, member := range members {
+		actors = append(actors, member.ActorURI)
+		inboxes[member.Inbox] = true
+	}
+	AddressToActors(activity, actors)
+
+	for inbox := range inboxes {
+		go func(inboxURL string) {
+			if err := DeliverActivity(activity, inboxURL); err != nil {
+				log.Printf("[Federation] Failed to deliver circle post to %s: %v", inboxURL, err)
+			}
+		}(inbox)
+	}
+	log.Printf("[Federation] Delivering circle post to %d members via %d inboxes", len(actors), len(inboxes))
+}
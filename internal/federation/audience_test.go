@@ -0,0 +1,147 @@
+package federation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoteVisibility(t *testing.T) {
+	const actor = "https://remote.test/users/alice"
+	tests := []struct {
+		name       string
+		recipients []string
+		mentions   []string
+		encrypted  bool
+		want       string
+	}{
+		{"public in to", []string{publicCollection}, nil, false, "public"},
+		{"unlisted has public in cc", []string{actor + "/followers", "as:Public"}, nil, false, "public"},
+		{"followers only", []string{actor + "/followers", "https://local.test/ap/users/bob"}, []string{"https://local.test/ap/users/bob"}, false, "followers"},
+		{"misskey followers collection", []string{"https://remote.test/users/9abc/followers"}, nil, false, "followers"},
+		{"direct message mentions every recipient", []string{"https://local.test/ap/users/bob"}, []string{"https://local.test/ap/users/bob"}, false, "direct"},
+		{"encrypted message", []string{"https://local.test/ap/users/bob"}, nil, true, "direct"},
+		{"limited post to circle members", []string{"https://local.test/ap/users/bob", "https://other.test/users/carol"}, []string{"https://local.test/ap/users/bob"}, false, "circle"},
+		{"another server's followers collection is not ours", []string{"https://other.test/users/carol/followers"}, nil, false, "circle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NoteVisibility(actor, tt.recipients, tt.mentions, tt.encrypted); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAddressToFollowers(t *testing.T) {
+	const actor = "https://local.test/ap/users/alice"
+	activity := BuildCreateNoteActivity(actor, "p1", "hi bob", time.Now(), "", "", "", false)
+	note := activity.Object.(Note)
+	note.CC = []string{"https://remote.test/users/bob"}
+	activity.Object = note
+	AsQuestion(activity, QuestionPoll{Options: []string{"a", "b"}})
+	AddressToFollowers(activity, actor)
+
+	question, ok := activity.Object.(Question)
+	if !ok {
+		t.Fatalf("expected the Question to be kept, got %T", activity.Object)
+	}
+	for _, audience := range [][]string{activity.To, question.To} {
+		if len(audience) != 1 || audience[0] != actor+"/followers" {
+			t.Fatalf("expected the followers collection only in to, got %v", audience)
+		}
+	}
+	if len(question.CC) != 1 || question.CC[0] != "https://remote.test/users/bob" {
+		t.Fatalf("expected the mention in cc, got %v", question.CC)
+	}
+}
+
+func TestAddressToActors(t *testing.T) {
+	activity := BuildCreateNoteActivity("https://local.test/ap/users/alice", "p1", "hi bob", time.Now(), "", "", "", false)
+	activity.CC = []string{"https://remote.test/users/bob"}
+	AddressToActors(activity, []string{"https://remote.test/users/carol"})
+
+	note := activity.Object.(Note)
+	if len(note.To) != 1 || note.To[0] != "https://remote.test/users/carol" || len(note.CC) != 0 || len(activity.CC) != 0 {
+		t.Fatalf("expected only the circle member to be addressed: to=%v cc=%v", note.To, note.CC)
+	}
+}
+
+func TestBuildCreateGroupDMActivity(t *testing.T) {
+	const actor = "https://local.test/ap/users/alice"
+	const contextURI = "https://local.test/ap/threads/t1"
+	recipients := []string{actor, "https://remote.test/users/bob", "https://other.test/users/carol"}
+	activity := BuildCreateGroupDMActivity(actor, "m1", contextURI, recipients, "hi all", "", nil)
+	note := activity.Object.(Note)
+
+	if len(note.To) != 2 || len(activity.To) != 2 {
+		t.Fatalf("expected both other participants to be addressed, got note=%v activity=%v", note.To, activity.To)
+	}
+	for _, to := range note.To {
+		if to == actor {
+			t.Fatalf("expected the sender not to address itself, got %v", note.To)
+		}
+	}
+	if note.Conversation != contextURI {
+		t.Fatalf("expected context %s, got %q", contextURI, note.Conversation)
+	}
+
+	mentions := make([]string, 0, len(note.Tag))
+	for _, tag := range note.Tag {
+		mentions = append(mentions, tag.Href)
+	}
+	if got := NoteVisibility(actor, note.To, mentions, false); got != "direct" {
+		t.Fatalf("expected a group DM to be direct, got %s", got)
+	}
+}
+
+func TestMessageNoteURI(t *testing.T) {
+	const messageID = "3f1c2b8e-5d6a-4e7f-9a0b-1c2d3e4f5a6b"
+	noteURI := MessageNoteURI(messageID)
+
+	activity := BuildCreateDMActivity("https://local.test/ap/users/alice", messageID, "https://remote.test/users/bob", "hi", "", nil)
+	if note := activity.Object.(Note); note.ID != noteURI {
+		t.Fatalf("expected the DM Note to be identified by its message, got %s", note.ID)
+	}
+
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{"our message", noteURI, messageID},
+		{"not a message ID", MessageNoteURI("../posts/1"), ""},
+		{"a post", "https://remote.test/posts/" + messageID, ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MessageIDFromNoteURI(tt.uri); got != tt.want {
+				t.Fatalf("MessageIDFromNoteURI(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildDMChangeActivities(t *testing.T) {
+	const actor = "https://local.test/ap/users/alice"
+	const messageID = "3f1c2b8e-5d6a-4e7f-9a0b-1c2d3e4f5a6b"
+	recipients := []string{"https://remote.test/users/bob"}
+	editedAt := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	update := BuildUpdateDMActivity(actor, messageID, recipients, "fixed", "", editedAt)
+	note := update.Object.(Note)
+	if update.Type != "Update" || note.ID != MessageNoteURI(messageID) || note.Content != "fixed" || note.Updated != "2026-10-17T09:00:00Z" {
+		t.Fatalf("expected an Update of the message Note, got %+v", update)
+	}
+
+	remove := BuildDeleteDMActivity(actor, messageID, recipients)
+	if remove.Type != "Delete" || remove.Object != MessageNoteURI(messageID) || len(remove.To) != 1 || remove.To[0] != recipients[0] {
+		t.Fatalf("expected a Delete addressed to the participant only, got %+v", remove)
+	}
+
+	read := BuildReadActivity(actor, "https://remote.test/notes/9", recipients[0])
+	if read.Type != "Read" || read.Object != "https://remote.test/notes/9" || len(read.To) != 1 {
+		t.Fatalf("expected a Read of the remote Note, got %+v", read)
+	}
+}
@@ -0,0 +1,40 @@
+package federation
+
+import "fmt"
+
+// OrderedCollection returns the root of a paged OrderedCollection of total items,
+// linking to its first page and, when it is not empty, to its last one
+func OrderedCollection(id string, total, pageSize int) map[string]interface{} {
+	collection := map[string]interface{}{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         id,
+		"type":       "OrderedCollection",
+		"totalItems": total,
+		"first":      id + "?page=1",
+	}
+	if total > 0 {
+		lastPage := (total + pageSize - 1) / pageSize
+		collection["last"] = fmt.Sprintf("%s?page=%d", id, lastPage)
+	}
+	return collection
+}
+
+// OrderedCollectionPage returns page (1-based) of a paged OrderedCollection with its
+// items, linking to the pages before and after it
+func OrderedCollectionPage(collectionID string, page, total, pageSize int, items interface{}) map[string]interface{} {
+	collectionPage := map[string]interface{}{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           fmt.Sprintf("%s?page=%d", collectionID, page),
+		"type":         "OrderedCollectionPage",
+		"partOf":       collectionID,
+		"totalItems":   total,
+		"orderedItems": items,
+	}
+	if page*pageSize < total {
+		collectionPage["next"] = fmt.Sprintf("%s?page=%d", collectionID, page+1)
+	}
+	if page > 1 {
+		collectionPage["prev"] = fmt.Sprintf("%s?page=%d", collectionID, page-1)
+	}
+	return collectionPage
+}
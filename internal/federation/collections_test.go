@@ -0,0 +1,33 @@
+package federation
+
+import "testing"
+
+func TestOrderedCollectionLinksPages(t *testing.T) {
+	const outbox = "https://splitter.test/ap/users/alice/outbox"
+
+	empty := OrderedCollection(outbox, 0, 20)
+	if empty["first"] != outbox+"?page=1" || empty["last"] != nil {
+		t.Fatalf("expected an empty collection to link only its first page, got %v", empty)
+	}
+
+	root := OrderedCollection(outbox, 41, 20)
+	if root["totalItems"] != 41 || root["last"] != outbox+"?page=3" {
+		t.Fatalf("expected 41 items over 3 pages, got %v", root)
+	}
+
+	tests := []struct {
+		page     int
+		wantNext interface{}
+		wantPrev interface{}
+	}{
+		{1, outbox + "?page=2", nil},
+		{2, outbox + "?page=3", outbox + "?page=1"},
+		{3, nil, outbox + "?page=2"},
+	}
+	for _, tt := range tests {
+		page := OrderedCollectionPage(outbox, tt.page, 41, 20, []interface{}{})
+		if page["partOf"] != outbox || page["next"] != tt.wantNext || page["prev"] != tt.wantPrev {
+			t.Fatalf("page %d: unexpected links %v", tt.page, page)
+		}
+	}
+}
@@ -20,6 +20,7 @@ type Activity struct {
 	Type    string      `json:"type"`
 	Actor   string      `json:"actor"`
 	Object  interface{} `json:"object"`
+	Target  string      `json:"target,omitempty"`
 	To      []string    `json:"to,omitempty"`
 	CC      []string    `json:"cc,omitempty"`
 }
@@ -30,12 +31,19 @@ type Note struct {
 	ID            string            `json:"id"`
 	Type          string            `json:"type"`
 	AttributedTo  string            `json:"attributedTo"`
+	Name          string            `json:"name,omitempty"` // Chosen option when the Note is a poll vote
 	Content       string            `json:"content"`
 	Ciphertext    string            `json:"ciphertext,omitempty"`
 	EncryptedKeys map[string]string `json:"encrypted_keys,omitempty"`
 	InReplyTo     string            `json:"inReplyTo,omitempty"`
+	Summary       string            `json:"summary,omitempty"` // Content warning
+	Sensitive     bool              `json:"sensitive"`
+	URL           string            `json:"url,omitempty"`
+	Tag           []NoteTag         `json:"tag,omitempty"`
 	Attachment    []Attachment      `json:"attachment,omitempty"`
 	Published     string            `json:"published"`
+	Updated       string            `json:"updated,omitempty"` // Set once the Note has been edited
+	Conversation  string            `json:"context,omitempty"` // Group DM the Note belongs to
 	To            []string          `json:"to,omitempty"`
 	CC            []string          `json:"cc,omitempty"`
 }
@@ -96,10 +104,12 @@ func deliverOutboxPayload(ctx context.Context, outboxID, activityType string, pa
 	req.Header.Set("Content-Type", "application/activity+json")
 	req.Header.Set("Accept", "application/activity+json")
 
-	privKey := GetInstancePrivateKey()
-	domain := GetInstanceDomain()
-	if privKey != nil {
-		keyID := fmt.Sprintf("%s/ap/users/%s#main-key", resolveInstanceURL(domain), "admin")
+	// Sign with the sending actor's own key when it is a local user
+	var envelope struct {
+		Actor string `json:"actor"`
+	}
+	_ = json.Unmarshal(payload, &envelope)
+	if privKey, keyID := signingKeyForActor(ctx, envelope.Actor); privKey != nil {
 		if err := SignRequest(req, privKey, keyID); err != nil {
 			log.Printf("[Federation] Warning: failed to sign request: %v", err)
 		}
@@ -148,80 +158,20 @@ func DeliverToActor(activity *Activity, actorURI string) error {
 	return DeliverActivity(activity, actor.InboxURL)
 }
 
-// DeliverToFollowers delivers an activity to all remote followers of a user
-// For public posts, also delivers to all known instance shared inboxes
+// DeliverToFollowers delivers an activity to all remote followers of a user.
+// Followers hosted on the same server are collapsed into a single delivery to
+// that server's shared inbox when it advertises one.
 func DeliverToFollowers(activity *Activity, authorDID string) {
 	ctx := context.Background()
-	domain := GetInstanceDomain()
-	log.Printf("[Federation] DeliverToFollowers: authorDID=%s, domain=%s", authorDID, domain)
-
-	var inboxes []string
-
-	// Get remote followers (followers from other instances)
-	rows, err := db.GetDB().Query(ctx,
-		`SELECT DISTINCT ra.inbox_url
-		 FROM follows f
-		 JOIN remote_actors ra ON ra.actor_uri = (
-			SELECT actor_uri FROM remote_actors WHERE username || '@' || domain = 
-			  SUBSTRING(f.follower_did FROM 'did:key:(.+)')
-		 )
-		 WHERE f.following_did = $1 AND f.status = 'accepted'`, authorDID)
+	log.Printf("[Federation] DeliverToFollowers: authorDID=%s, domain=%s", authorDID, GetInstanceDomain())
 
+	inboxes, err := followerInboxes(ctx, authorDID)
 	if err != nil {
-		log.Printf("[Federation] Complex follower query failed: %v", err)
-	} else {
-		defer rows.Close()
-		for rows.Next() {
-			var inbox string
-			if err := rows.Scan(&inbox); err == nil {
-				inboxes = append(inboxes, inbox)
-			}
-		}
-	}
-
-	// For public posts (addressed to Public), also deliver to all known instance shared inboxes
-	isPublic := false
-	if activity.To != nil {
-		for _, to := range activity.To {
-			if to == "https://www.w3.org/ns/activitystreams#Public" {
-				isPublic = true
-				break
-			}
-		}
-	}
-
-	if isPublic {
-		for otherDomain, otherURL := range InstanceURLMap {
-			if otherDomain != domain {
-				sharedInbox := otherURL + "/ap/shared-inbox"
-				log.Printf("[Federation] Adding shared inbox for %s: %s", otherDomain, sharedInbox)
-				inboxes = append(inboxes, sharedInbox)
-			}
-		}
-	}
-
-	// Also get inboxes from remote_actors table
-	actorRows, err := db.GetDB().Query(ctx,
-		`SELECT DISTINCT inbox_url FROM remote_actors WHERE domain != $1 AND domain != '' AND inbox_url != ''`, domain)
-	if err == nil {
-		defer actorRows.Close()
-		for actorRows.Next() {
-			var inbox string
-			if err := actorRows.Scan(&inbox); err == nil {
-				inboxes = append(inboxes, inbox)
-			}
-		}
+		log.Printf("[Federation] Failed to load follower inboxes: %v", err)
+		return
 	}
 
-	// Deduplicate and deliver
-	seen := make(map[string]bool)
-	deliveryCount := 0
 	for _, inbox := range inboxes {
-		if seen[inbox] {
-			continue
-		}
-		seen[inbox] = true
-		deliveryCount++
 		go func(inboxURL string) {
 			if err := DeliverActivity(activity, inboxURL); err != nil {
 				log.Printf("[Federation] Failed to deliver to %s: %v", inboxURL, err)
@@ -229,56 +179,58 @@ func DeliverToFollowers(activity *Activity, authorDID string) {
 		}(inbox)
 	}
 
-	log.Printf("[Federation] Delivering to %d unique inboxes", deliveryCount)
+	log.Printf("[Federation] Delivering to %d unique inboxes", len(inboxes))
 }
 
-// deliverToAllKnownInboxes delivers to all unique remote inboxes
-// Simpler approach for local testing with 2 instances
-func deliverToAllKnownInboxes(activity *Activity, authorDID string) {
-	ctx := context.Background()
-	domain := GetInstanceDomain()
-	log.Printf("[Federation] deliverToAllKnownInboxes: domain=%s, authorDID=%s", domain, authorDID)
-
-	// Get all remote actors from OTHER instances
+// followerInboxes returns the distinct inboxes that reach every accepted remote follower of authorDID.
+// Remote followers are stored either by actor URI or as did:web:<domain>:<username>.
+func followerInboxes(ctx context.Context, authorDID string) ([]string, error) {
 	rows, err := db.GetDB().Query(ctx,
-		`SELECT DISTINCT inbox_url FROM remote_actors WHERE domain != $1 AND domain != ''`, domain)
+		`SELECT COALESCE(ra.inbox_url, ''), COALESCE(ra.shared_inbox_url, '')
+		 FROM follows f
+		 JOIN remote_actors ra
+		   ON ra.actor_uri = f.follower_did
+		   OR f.follower_did = 'did:web:' || ra.domain || ':' || ra.username
+		 WHERE f.following_did = $1
+		   AND f.status = 'accepted'`,
+		authorDID,
+	)
 	if err != nil {
-		log.Printf("[Federation] Failed to get remote inboxes: %v", err)
-		return
+		return nil, fmt.Errorf("failed to query follower inboxes: %w", err)
 	}
 	defer rows.Close()
 
 	var inboxes []string
 	for rows.Next() {
-		var inbox string
-		if err := rows.Scan(&inbox); err == nil {
-			inboxes = append(inboxes, inbox)
+		var inbox, sharedInbox string
+		if err := rows.Scan(&inbox, &sharedInbox); err == nil {
+			inboxes = append(inboxes, deliveryInbox(inbox, sharedInbox))
 		}
 	}
+	return uniqueInboxes(inboxes), rows.Err()
+}
 
-	// Also try delivering to the other instance's shared inbox
-	for otherDomain, otherURL := range InstanceURLMap {
-		if otherDomain != domain {
-			sharedInbox := otherURL + "/ap/shared-inbox"
-			log.Printf("[Federation] Adding shared inbox for %s: %s", otherDomain, sharedInbox)
-			inboxes = append(inboxes, sharedInbox)
-		}
+// deliveryInbox returns the inbox a delivery to an actor goes to: the shared inbox of
+// its server when it advertises one, so one POST reaches every recipient there
+func deliveryInbox(inbox, sharedInbox string) string {
+	if sharedInbox != "" {
+		return sharedInbox
 	}
+	return inbox
+}
 
-	// Deduplicate
-	log.Printf("[Federation] Total inboxes to deliver to: %d", len(inboxes))
-	seen := make(map[string]bool)
+// uniqueInboxes drops empty and repeated inboxes, keeping the first occurrence of each
+func uniqueInboxes(inboxes []string) []string {
+	seen := make(map[string]bool, len(inboxes))
+	unique := make([]string, 0, len(inboxes))
 	for _, inbox := range inboxes {
-		if seen[inbox] {
+		if inbox == "" || seen[inbox] {
 			continue
 		}
 		seen[inbox] = true
-		go func(inboxURL string) {
-			if err := DeliverActivity(activity, inboxURL); err != nil {
-				log.Printf("[Federation] Failed to deliver to %s: %v", inboxURL, err)
-			}
-		}(inbox)
+		unique = append(unique, inbox)
 	}
+	return unique
 }
 
 // SendFollow sends a Follow activity to a remote actor
@@ -295,22 +247,43 @@ func SendFollow(localActorURI string, remoteActor *RemoteActor) error {
 }
 
 // BuildCreateNoteActivity creates a Create activity wrapping a Note.
+// content is the plain post text; it is rendered to HTML with linked hashtags, and mentions
+// linked as recorded by RecordMentionLinks when the post was written.
 // mediaURL is the absolute URL to attached media (empty if none).
 // inReplyTo is the URI of the parent post/note (empty if not a reply).
-func BuildCreateNoteActivity(actorURI, postID, content string, createdAt time.Time, mediaURL, inReplyTo string) *Activity {
+// summary is the content warning (empty if none); sensitive marks the media as sensitive.
+func BuildCreateNoteActivity(actorURI, postID, content string, createdAt time.Time, mediaURL, inReplyTo, summary string, sensitive bool) *Activity {
 	domain := GetInstanceDomain()
 	baseURL := resolveInstanceURL(domain)
+	noteID := fmt.Sprintf("%s/posts/%s", baseURL, postID)
+
+	var hrefs map[string]string
+	if len(ParseMentions(content)) > 0 {
+		hrefs = loadMentionLinks(context.Background(), postID)
+	}
+	htmlContent, tags := RenderNoteContent(content, hrefs)
 
 	note := Note{
-		ID:           fmt.Sprintf("%s/posts/%s", baseURL, postID),
+		ID:           noteID,
 		Type:         "Note",
 		AttributedTo: actorURI,
-		Content:      content,
+		Content:      htmlContent,
 		InReplyTo:    inReplyTo,
+		Summary:      summary,
+		Sensitive:    sensitive || summary != "",
+		URL:          noteID,
+		Tag:          tags,
 		Published:    createdAt.UTC().Format(time.RFC3339),
 		To:           []string{"https://www.w3.org/ns/activitystreams#Public"},
 	}
 
+	// Mentioned actors are addressed directly, as Mastodon does
+	for _, tag := range tags {
+		if tag.Type == "Mention" {
+			note.CC = append(note.CC, tag.Href)
+		}
+	}
+
 	if mediaURL != "" {
 		note.Attachment = []Attachment{{
 			Type:      "Document",
@@ -326,9 +299,42 @@ func BuildCreateNoteActivity(actorURI, postID, content string, createdAt time.Ti
 		Actor:   actorURI,
 		Object:  note,
 		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		CC:      note.CC,
 	}
 }
 
+// BuildUpdateNoteActivity creates an Update activity carrying the full edited Note.
+// The arguments are those of BuildCreateNoteActivity plus the time of the edit; the
+// Note keeps its ID and audience, so servers that received the Create replace it.
+func BuildUpdateNoteActivity(actorURI, postID, content string, createdAt, updatedAt time.Time, mediaURL, inReplyTo, summary string, sensitive bool) *Activity {
+	activity := BuildCreateNoteActivity(actorURI, postID, content, createdAt, mediaURL, inReplyTo, summary, sensitive)
+	note := activity.Object.(Note)
+	note.Updated = updatedAt.UTC().Format(time.RFC3339)
+
+	baseURL := resolveInstanceURL(GetInstanceDomain())
+	activity.ID = fmt.Sprintf("%s/activities/update-%s-%d", baseURL, postID, updatedAt.UnixNano())
+	activity.Type = "Update"
+	activity.Object = note
+	return activity
+}
+
+// ReplyNoteURI returns the Note ID of a local reply. Replies live in their own
+// table, so their Notes are served from /replies/:id rather than /posts/:id.
+func ReplyNoteURI(replyID string) string {
+	return fmt.Sprintf("%s/replies/%s", resolveInstanceURL(GetInstanceDomain()), replyID)
+}
+
+// BuildCreateReplyActivity creates a Create activity for a local reply.
+// inReplyTo is the Note URI of the parent reply, or of the post for top-level replies.
+func BuildCreateReplyActivity(actorURI, replyID, content string, createdAt time.Time, inReplyTo string) *Activity {
+	activity := BuildCreateNoteActivity(actorURI, replyID, content, createdAt, "", inReplyTo, "", false)
+	note := activity.Object.(Note)
+	note.ID = ReplyNoteURI(replyID)
+	note.URL = note.ID
+	activity.Object = note
+	return activity
+}
+
 func BuildLikeActivity(actorURI, objectURI string) *Activity {
 	domain := GetInstanceDomain()
 	baseURL := resolveInstanceURL(domain)
@@ -419,6 +425,35 @@ func BuildUpdateActorActivity(actorURI, username, displayName, summary, avatarUR
 	}
 }
 
+// SetActorAliases adds alsoKnownAs and, for a moved account, movedTo to the Person of an Update activity
+func SetActorAliases(activity *Activity, alsoKnownAs []string, movedTo string) {
+	object, ok := activity.Object.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(alsoKnownAs) > 0 {
+		object["alsoKnownAs"] = alsoKnownAs
+	}
+	if movedTo != "" {
+		object["movedTo"] = movedTo
+	}
+}
+
+// BuildMoveActivity creates a Move of a local account to targetURI. Receiving servers
+// check that the target lists actorURI in its alsoKnownAs before re-pointing follows.
+func BuildMoveActivity(actorURI, targetURI string) *Activity {
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/move-%d", actorURI, time.Now().UnixNano()),
+		Type:    "Move",
+		Actor:   actorURI,
+		Object:  actorURI,
+		Target:  targetURI,
+		To:      []string{actorURI + "/followers"},
+		CC:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+	}
+}
+
 // storeOutboxActivity stores an activity in the outbox table
 func storeOutboxActivity(ctx context.Context, activityType string, payload []byte, targetInbox string) (string, error) {
 	var id string
@@ -0,0 +1,91 @@
+package federation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildCreateReplyActivity(t *testing.T) {
+	parent := "https://mastodon.test/users/alice/statuses/1"
+	activity := BuildCreateReplyActivity("https://splitter.test/ap/users/bob", "reply-1", "thanks!", time.Now(), parent)
+
+	note, ok := activity.Object.(Note)
+	if !ok {
+		t.Fatalf("expected a Note object, got %T", activity.Object)
+	}
+	if !strings.HasSuffix(note.ID, "/replies/reply-1") || note.ID != ReplyNoteURI("reply-1") {
+		t.Fatalf("expected reply Note ID, got %s", note.ID)
+	}
+	if note.URL != note.ID {
+		t.Fatalf("expected URL %s, got %s", note.ID, note.URL)
+	}
+	if note.InReplyTo != parent {
+		t.Fatalf("expected inReplyTo %s, got %s", parent, note.InReplyTo)
+	}
+	if activity.Type != "Create" || note.Content != "<p>thanks!</p>" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+}
+
+func TestBuildUpdateNoteActivity(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	activity := BuildUpdateNoteActivity("https://splitter.test/ap/users/bob", "post-1", "edited", created, updated, "", "", "cw", false)
+
+	note, ok := activity.Object.(Note)
+	if !ok {
+		t.Fatalf("expected a Note object, got %T", activity.Object)
+	}
+	create := BuildCreateNoteActivity("https://splitter.test/ap/users/bob", "post-1", "edited", created, "", "", "cw", false)
+	if activity.Type != "Update" || activity.ID == create.ID {
+		t.Fatalf("expected a distinct Update activity, got %s %s", activity.Type, activity.ID)
+	}
+	if note.ID != create.Object.(Note).ID {
+		t.Fatalf("expected the Note ID of the original Create, got %s", note.ID)
+	}
+	if note.Published != "2026-01-02T03:04:05Z" || note.Updated != "2026-01-02T04:04:05Z" {
+		t.Fatalf("unexpected timestamps published=%s updated=%s", note.Published, note.Updated)
+	}
+	if note.Summary != "cw" || !note.Sensitive || note.Content != "<p>edited</p>" {
+		t.Fatalf("unexpected note %+v", note)
+	}
+}
+
+func TestBuildMoveActivity(t *testing.T) {
+	activity := BuildMoveActivity("https://splitter.test/ap/users/bob", "https://remote.test/users/bob")
+	if activity.Type != "Move" || activity.Object != activity.Actor || activity.Target != "https://remote.test/users/bob" {
+		t.Fatalf("unexpected move %+v", activity)
+	}
+
+	update := BuildUpdateActorActivity("https://splitter.test/ap/users/bob", "bob", "Bob", "", "", "pem", "")
+	SetActorAliases(update, []string{"https://remote.test/users/bob"}, "https://remote.test/users/bob")
+	person := update.Object.(map[string]interface{})
+	aliases, _ := person["alsoKnownAs"].([]string)
+	if len(aliases) != 1 || person["movedTo"] != "https://remote.test/users/bob" {
+		t.Fatalf("expected alsoKnownAs and movedTo on the actor, got %v", person)
+	}
+}
+
+func TestFollowerInboxesShareServerInbox(t *testing.T) {
+	followers := []struct{ inbox, sharedInbox string }{
+		{"https://mastodon.test/users/alice/inbox", "https://mastodon.test/inbox"},
+		{"https://mastodon.test/users/bob/inbox", "https://mastodon.test/inbox"},
+		{"https://gts.test/users/carol/inbox", ""},
+		{"https://gts.test/users/carol/inbox", ""},
+		{"https://misskey.test/users/dave/inbox", "https://misskey.test/inbox"},
+		{"", ""},
+	}
+
+	var inboxes []string
+	for _, f := range followers {
+		inboxes = append(inboxes, deliveryInbox(f.inbox, f.sharedInbox))
+	}
+
+	got := uniqueInboxes(inboxes)
+	want := []string{"https://mastodon.test/inbox", "https://gts.test/users/carol/inbox", "https://misskey.test/inbox"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected one delivery per shared inbox %v, got %v", want, got)
+	}
+}
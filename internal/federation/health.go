@@ -64,11 +64,16 @@ func IsPeerHealthy(domain string) bool {
 
 // ProbePeerHealth performs a single health check against a peer instance.
 func ProbePeerHealth(domain, baseURL string) *InstanceHealth {
+	return probePeer(domain, baseURL, "/api/v1/federation/public-users?limit=1")
+}
+
+// probePeer checks that baseURL+path answers and updates the peer's health state
+func probePeer(domain, baseURL, path string) *InstanceHealth {
 	start := time.Now()
 	client := &http.Client{Timeout: 10 * time.Second}
 
 	healthy := false
-	resp, err := client.Get(baseURL + "/api/v1/federation/public-users?limit=1")
+	resp, err := client.Get(baseURL + path)
 	if err == nil {
 		if resp.StatusCode >= 200 && resp.StatusCode < 400 {
 			healthy = true
@@ -130,11 +135,23 @@ func RunHealthCheckLoop(ctx context.Context, selfDomain string) {
 }
 
 func probeAllPeers(selfDomain string) {
-	for domain, baseURL := range InstanceURLMap {
-		if domain == selfDomain {
-			continue
+	ctx := context.Background()
+	for domain, baseURL := range KnownPeers(ctx, selfDomain) {
+		software := knownInstanceSoftware(ctx, domain)
+		if software == "" {
+			software = DetectInstanceSoftware(baseURL)
+		}
+
+		// Only Splitter peers serve the federation API; probe everything else via NodeInfo
+		var h *InstanceHealth
+		if software == "" || software == "splitter" {
+			h = ProbePeerHealth(domain, baseURL)
+		} else {
+			h = probePeer(domain, baseURL, "/.well-known/nodeinfo")
+		}
+		if h.IsHealthy {
+			RecordKnownInstance(ctx, domain, baseURL, software)
 		}
-		h := ProbePeerHealth(domain, baseURL)
 		if h.IsHealthy {
 			log.Printf("[HealthCheck] %s (%s) is HEALTHY (latency: %dms)", domain, baseURL, h.Latency.Milliseconds())
 		} else {
@@ -1,17 +1,24 @@
 package federation
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -50,7 +57,7 @@ func SignRequest(req *http.Request, privateKey *rsa.PrivateKey, keyID string) er
 	for _, h := range headers {
 		switch h {
 		case "(request-target)":
-			signingParts = append(signingParts, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.Path))
+			signingParts = append(signingParts, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
 		case "host":
 			signingParts = append(signingParts, fmt.Sprintf("host: %s", req.Host))
 		case "date":
@@ -80,14 +87,68 @@ func SignRequest(req *http.Request, privateKey *rsa.PrivateKey, keyID string) er
 	return nil
 }
 
-// VerifyRequest verifies the HTTP Signature on an incoming request
+// ErrSignatureMismatch is returned when a signature is well-formed but does not verify
+// against the given key, i.e. the case where refetching a rotated key may help.
+var ErrSignatureMismatch = errors.New("signature verification failed")
+
+var (
+	signaturePolicyMu sync.RWMutex
+	signatureMaxSkew  = time.Hour
+)
+
+// ConfigureSignaturePolicy sets how far a signed Date / created timestamp may drift from our clock
+func ConfigureSignaturePolicy(maxSkew time.Duration) {
+	signaturePolicyMu.Lock()
+	defer signaturePolicyMu.Unlock()
+	if maxSkew > 0 {
+		signatureMaxSkew = maxSkew
+	}
+}
+
+// signatureNow is the clock signed timestamps are checked against
+var signatureNow = time.Now
+
+func currentSignatureMaxSkew() time.Duration {
+	signaturePolicyMu.RLock()
+	defer signaturePolicyMu.RUnlock()
+	return signatureMaxSkew
+}
+
+// SignatureKeyID returns the keyId named by a request's signature, in either the
+// draft-cavage Signature header or RFC 9421 Signature-Input.
+func SignatureKeyID(req *http.Request) string {
+	if input := req.Header.Get("Signature-Input"); input != "" {
+		if _, _, params, err := parseSignatureInput(input, req.Header.Get("Signature")); err == nil {
+			return params["keyid"]
+		}
+		return ""
+	}
+	return parseSignatureHeader(req.Header.Get("Signature"))["keyId"]
+}
+
+// VerifyRequest verifies the HTTP Signature on an incoming request.
+// Supports draft-cavage Signature headers (rsa-sha256, hs2019) and RFC 9421 HTTP Message
+// Signatures, with RSA or Ed25519 keys. The signature must cover the method, target and
+// host, a Date or created timestamp within the allowed skew and, for requests with a body,
+// a matching digest.
 func VerifyRequest(req *http.Request, publicKeyPEM string) error {
+	pubKey, err := parsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	if req.Header.Get("Signature-Input") != "" {
+		return verifyMessageSignature(req, pubKey)
+	}
+	return verifyCavageSignature(req, pubKey)
+}
+
+// verifyCavageSignature checks a draft-cavage "Signature: keyId=...,headers=...,signature=..." header
+func verifyCavageSignature(req *http.Request, pubKey crypto.PublicKey) error {
 	sigHeader := req.Header.Get("Signature")
 	if sigHeader == "" {
 		return fmt.Errorf("no Signature header")
 	}
 
-	// Parse signature header
 	params := parseSignatureHeader(sigHeader)
 	sigB64, ok := params["signature"]
 	if !ok {
@@ -98,57 +159,460 @@ func VerifyRequest(req *http.Request, publicKeyPEM string) error {
 		return fmt.Errorf("missing headers param")
 	}
 
-	// Decode signature
 	sigBytes, err := base64.StdEncoding.DecodeString(sigB64)
 	if err != nil {
 		return fmt.Errorf("failed to decode signature: %w", err)
 	}
 
-	// Build signing string from the listed headers
-	headerList := strings.Split(headersStr, " ")
+	headerList := strings.Fields(strings.ToLower(headersStr))
+	covered := make(map[string]bool, len(headerList))
 	var signingParts []string
 	for _, h := range headerList {
+		covered[h] = true
 		switch h {
 		case "(request-target)":
-			signingParts = append(signingParts, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.Path))
+			signingParts = append(signingParts, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
+		case "(created)", "(expires)":
+			value := params[strings.Trim(h, "()")]
+			if value == "" {
+				return fmt.Errorf("signature covers %s but has no value for it", h)
+			}
+			signingParts = append(signingParts, fmt.Sprintf("%s: %s", h, value))
 		case "host":
-			host := req.Host
-			if host == "" {
-				host = req.Header.Get("Host")
+			signingParts = append(signingParts, fmt.Sprintf("host: %s", requestHost(req)))
+		default:
+			values := req.Header.Values(h)
+			if len(values) == 0 {
+				return fmt.Errorf("signed header %s is missing", h)
 			}
-			signingParts = append(signingParts, fmt.Sprintf("host: %s", host))
-		case "date":
-			signingParts = append(signingParts, fmt.Sprintf("date: %s", req.Header.Get("Date")))
-		case "digest":
-			signingParts = append(signingParts, fmt.Sprintf("digest: %s", req.Header.Get("Digest")))
+			signingParts = append(signingParts, fmt.Sprintf("%s: %s", h, joinHeaderValues(values)))
 		}
 	}
-	signingString := strings.Join(signingParts, "\n")
 
-	// Parse public key
+	// The signature must be bound to a point in time
+	switch {
+	case covered["(created)"]:
+		if err := checkSignatureTimestamp(params["created"], params["expires"]); err != nil {
+			return err
+		}
+	case covered["date"]:
+		if err := checkDateHeader(req.Header.Get("Date")); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("signature must cover date or (created)")
+	}
+
+	// The signature must be bound to this endpoint on this host, or it could be replayed elsewhere
+	if !covered["(request-target)"] || !covered["host"] {
+		return fmt.Errorf("signature must cover (request-target) and host")
+	}
+
+	if requestHasBody(req) {
+		if !covered["digest"] && !covered["content-digest"] {
+			return fmt.Errorf("signature must cover the body digest")
+		}
+		if err := verifyBodyDigest(req); err != nil {
+			return err
+		}
+	}
+
+	var alg string
+	switch algorithm := strings.ToLower(params["algorithm"]); algorithm {
+	case "", "hs2019":
+		alg = "" // derived from the key type
+	case "rsa-sha256":
+		alg = "rsa-v1_5-sha256"
+	case "ed25519":
+		alg = "ed25519"
+	default:
+		return fmt.Errorf("unsupported signature algorithm %s", algorithm)
+	}
+
+	return verifySignatureBytes(pubKey, alg, []byte(strings.Join(signingParts, "\n")), sigBytes)
+}
+
+// verifyMessageSignature checks an RFC 9421 Signature-Input / Signature pair
+func verifyMessageSignature(req *http.Request, pubKey crypto.PublicKey) error {
+	components, rawParams, params, err := parseSignatureInput(req.Header.Get("Signature-Input"), req.Header.Get("Signature"))
+	if err != nil {
+		return err
+	}
+
+	base, err := messageSignatureBase(req, components, rawParams)
+	if err != nil {
+		return err
+	}
+	covered := make(map[string]bool, len(components))
+	for _, component := range components {
+		covered[component] = true
+	}
+
+	if params["created"] != "" {
+		if err := checkSignatureTimestamp(params["created"], params["expires"]); err != nil {
+			return err
+		}
+	} else if covered["date"] {
+		if err := checkDateHeader(req.Header.Get("Date")); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("signature must carry created or cover date")
+	}
+
+	// The signature must be bound to this endpoint on this host, or it could be replayed elsewhere
+	if !covered["@method"] {
+		return fmt.Errorf("signature must cover @method")
+	}
+	if !covered["@target-uri"] && !(covered["@authority"] && (covered["@path"] || covered["@request-target"])) {
+		return fmt.Errorf("signature must cover @target-uri, or @authority and the path")
+	}
+
+	if requestHasBody(req) {
+		if !covered["content-digest"] && !covered["digest"] {
+			return fmt.Errorf("signature must cover the body digest")
+		}
+		if err := verifyBodyDigest(req); err != nil {
+			return err
+		}
+	}
+
+	return verifySignatureBytes(pubKey, params["alg"], []byte(base), []byte(params["signature"]))
+}
+
+// messageSignatureBase builds the RFC 9421 signature base for the covered components
+func messageSignatureBase(req *http.Request, components []string, rawParams string) (string, error) {
+	var lines []string
+	for _, component := range components {
+		var value string
+		switch component {
+		case "@method":
+			value = strings.ToUpper(req.Method)
+		case "@target-uri":
+			value = fmt.Sprintf("%s://%s%s", requestScheme(req), requestHost(req), req.URL.RequestURI())
+		case "@authority":
+			value = strings.ToLower(requestHost(req))
+		case "@scheme":
+			value = requestScheme(req)
+		case "@request-target":
+			value = req.URL.RequestURI()
+		case "@path":
+			value = req.URL.EscapedPath()
+		case "@query":
+			value = "?" + req.URL.RawQuery
+		default:
+			if strings.HasPrefix(component, "@") {
+				return "", fmt.Errorf("unsupported derived component %s", component)
+			}
+			values := req.Header.Values(component)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %s is missing", component)
+			}
+			value = joinHeaderValues(values)
+		}
+		lines = append(lines, fmt.Sprintf("%q: %s", component, value))
+	}
+	lines = append(lines, fmt.Sprintf("%q: %s", "@signature-params", rawParams))
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseSignatureInput picks the first signature label present in both Signature-Input and
+// Signature. Returns the covered components, the raw serialized parameters (for the
+// @signature-params line) and the parameters; params["signature"] holds the raw signature.
+func parseSignatureInput(input, signature string) ([]string, string, map[string]string, error) {
+	signatures := make(map[string]string)
+	for _, member := range splitStructuredList(signature) {
+		eq := strings.Index(member, "=")
+		if eq < 0 {
+			continue
+		}
+		value := strings.TrimSpace(member[eq+1:])
+		if !strings.HasPrefix(value, ":") || !strings.HasSuffix(value, ":") || len(value) < 2 {
+			continue
+		}
+		sigBytes, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to decode signature: %w", err)
+		}
+		signatures[strings.TrimSpace(member[:eq])] = string(sigBytes)
+	}
+
+	for _, member := range splitStructuredList(input) {
+		eq := strings.Index(member, "=")
+		if eq < 0 {
+			continue
+		}
+		label := strings.TrimSpace(member[:eq])
+		sig, ok := signatures[label]
+		if !ok {
+			continue
+		}
+
+		rawParams := strings.TrimSpace(member[eq+1:])
+		if !strings.HasPrefix(rawParams, "(") {
+			return nil, "", nil, fmt.Errorf("malformed Signature-Input")
+		}
+		closeIdx := strings.Index(rawParams, ")")
+		if closeIdx < 0 {
+			return nil, "", nil, fmt.Errorf("malformed Signature-Input")
+		}
+
+		var components []string
+		for _, item := range strings.Fields(rawParams[1:closeIdx]) {
+			if strings.Contains(item, ";") {
+				return nil, "", nil, fmt.Errorf("component parameters are not supported: %s", item)
+			}
+			components = append(components, strings.ToLower(strings.Trim(item, `"`)))
+		}
+
+		params := map[string]string{"signature": sig}
+		for _, param := range strings.Split(rawParams[closeIdx+1:], ";") {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 {
+				params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+			}
+		}
+		return components, rawParams, params, nil
+	}
+
+	return nil, "", nil, fmt.Errorf("no matching signature label in Signature-Input")
+}
+
+// splitStructuredList splits a structured-field dictionary on top-level commas
+func splitStructuredList(value string) []string {
+	var members []string
+	depth, inQuotes, start := 0, false, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case '(':
+			if !inQuotes {
+				depth++
+			}
+		case ')':
+			if !inQuotes {
+				depth--
+			}
+		case ',':
+			if !inQuotes && depth == 0 {
+				members = append(members, strings.TrimSpace(value[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(value[start:]); rest != "" {
+		members = append(members, rest)
+	}
+	return members
+}
+
+// verifySignatureBytes checks sig over data with the given algorithm ("" = derive from key)
+func verifySignatureBytes(pubKey crypto.PublicKey, alg string, data, sig []byte) error {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "", "rsa-v1_5-sha256":
+			hashed := sha256.Sum256(data)
+			if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err == nil {
+				return nil
+			}
+			if alg == "" {
+				// hs2019 leaves the RSA padding to the key metadata; some servers use PSS
+				hashed512 := sha512.Sum512(data)
+				if rsa.VerifyPSS(key, crypto.SHA512, hashed512[:], sig, nil) == nil {
+					return nil
+				}
+			}
+			return ErrSignatureMismatch
+		case "rsa-pss-sha512":
+			hashed := sha512.Sum512(data)
+			if rsa.VerifyPSS(key, crypto.SHA512, hashed[:], sig, nil) != nil {
+				return ErrSignatureMismatch
+			}
+			return nil
+		}
+		return fmt.Errorf("algorithm %s does not match RSA key", alg)
+	case ed25519.PublicKey:
+		if alg != "" && alg != "ed25519" {
+			return fmt.Errorf("algorithm %s does not match Ed25519 key", alg)
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return ErrSignatureMismatch
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pubKey)
+}
+
+// parsePublicKeyPEM decodes an RSA or Ed25519 public key
+func parsePublicKeyPEM(publicKeyPEM string) (crypto.PublicKey, error) {
 	block, _ := pem.Decode([]byte(publicKeyPEM))
 	if block == nil {
-		return fmt.Errorf("failed to decode public key PEM")
+		return nil, fmt.Errorf("failed to decode public key PEM")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
 	}
 	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse public key: %w", err)
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
-	rsaPubKey, ok := pubKey.(*rsa.PublicKey)
-	if !ok {
-		return fmt.Errorf("public key is not RSA")
+	switch pubKey.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return pubKey, nil
 	}
+	return nil, fmt.Errorf("unsupported public key type %T", pubKey)
+}
 
-	// Verify
-	hashed := sha256.Sum256([]byte(signingString))
-	err = rsa.VerifyPKCS1v15(rsaPubKey, crypto.SHA256, hashed[:], sigBytes)
+// checkDateHeader rejects missing or out-of-window Date headers
+func checkDateHeader(date string) error {
+	if date == "" {
+		return fmt.Errorf("missing Date header")
+	}
+	t, err := http.ParseTime(date)
 	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
+		return fmt.Errorf("invalid Date header: %w", err)
 	}
+	return checkSkew(t)
+}
 
+// checkSignatureTimestamp validates created/expires signature parameters (unix seconds)
+func checkSignatureTimestamp(created, expires string) error {
+	createdUnix, err := strconv.ParseInt(strings.SplitN(created, ".", 2)[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid created timestamp")
+	}
+	if err := checkSkew(time.Unix(createdUnix, 0)); err != nil {
+		return err
+	}
+	if expires != "" {
+		expiresUnix, err := strconv.ParseInt(strings.SplitN(expires, ".", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid expires timestamp")
+		}
+		if signatureNow().After(time.Unix(expiresUnix, 0)) {
+			return fmt.Errorf("signature expired")
+		}
+	}
 	return nil
 }
 
+func checkSkew(t time.Time) error {
+	skew := signatureNow().Sub(t)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > currentSignatureMaxSkew() {
+		return fmt.Errorf("signature timestamp outside allowed window (%s off)", skew.Round(time.Second))
+	}
+	return nil
+}
+
+// verifyBodyDigest checks Digest (RFC 3230) or Content-Digest (RFC 9530) against the body
+func verifyBodyDigest(req *http.Request) error {
+	body, err := readAndRestoreBody(req)
+	if err != nil {
+		return err
+	}
+
+	type digestEntry struct{ alg, value string }
+	var entries []digestEntry
+	if header := req.Header.Get("Content-Digest"); header != "" {
+		for _, member := range splitStructuredList(header) {
+			kv := strings.SplitN(member, "=", 2)
+			if len(kv) == 2 {
+				entries = append(entries, digestEntry{strings.ToLower(strings.TrimSpace(kv[0])), strings.Trim(strings.TrimSpace(kv[1]), ":")})
+			}
+		}
+	}
+	if header := req.Header.Get("Digest"); header != "" {
+		for _, member := range strings.Split(header, ",") {
+			kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+			if len(kv) == 2 {
+				entries = append(entries, digestEntry{strings.ToLower(kv[0]), kv[1]})
+			}
+		}
+	}
+
+	checked := 0
+	for _, entry := range entries {
+		var expected []byte
+		switch entry.alg {
+		case "sha-256":
+			sum := sha256.Sum256(body)
+			expected = sum[:]
+		case "sha-512":
+			sum := sha512.Sum512(body)
+			expected = sum[:]
+		default:
+			continue
+		}
+		got, err := base64.StdEncoding.DecodeString(entry.value)
+		if err != nil || !hmac.Equal(got, expected) {
+			return fmt.Errorf("body digest mismatch")
+		}
+		checked++
+	}
+	if checked == 0 {
+		return fmt.Errorf("missing SHA-256 or SHA-512 body digest")
+	}
+	return nil
+}
+
+// readAndRestoreBody reads the request body and puts it back so it can be read again
+func readAndRestoreBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func requestHasBody(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		return host
+	}
+	return req.URL.Host
+}
+
+func requestScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return req.URL.Scheme
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func joinHeaderValues(values []string) string {
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", ")
+}
+
 // parseSignatureHeader parses a Signature header into key-value pairs
 func parseSignatureHeader(header string) map[string]string {
 	params := make(map[string]string)
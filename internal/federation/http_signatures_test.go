@@ -0,0 +1,664 @@
+package federation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testActivityBody = `{"type":"Follow","actor":"https://remote.test/users/alice","object":"https://splitter.test/ap/users/bob"}`
+
+type testKey struct {
+	signer crypto.Signer
+	pem    string
+}
+
+func newRSATestKey(t *testing.T) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return testKey{signer: key, pem: publicKeyToPEM(t, key.Public())}
+}
+
+func newEd25519TestKey(t *testing.T) testKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return testKey{signer: key, pem: publicKeyToPEM(t, key.Public())}
+}
+
+func publicKeyToPEM(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func (k testKey) sign(t *testing.T, data string) string {
+	t.Helper()
+	var sig []byte
+	var err error
+	switch signer := k.signer.(type) {
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(data))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, hashed[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(signer, []byte(data))
+	}
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func newInboxRequest(date time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/ap/users/bob/inbox", strings.NewReader(testActivityBody))
+	req.Host = "splitter.test"
+	req.Header.Set("Content-Type", "application/activity+json")
+	req.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	hash := sha256.Sum256([]byte(testActivityBody))
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(hash[:]))
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(hash[:])+":")
+	return req
+}
+
+// signCavage signs req in the draft-cavage format used by Mastodon (rsa-sha256) and GoToSocial (hs2019)
+func signCavage(t *testing.T, req *http.Request, key testKey, keyID, algorithm string, headers []string) {
+	t.Helper()
+	var parts []string
+	for _, h := range headers {
+		switch h {
+		case "(request-target)":
+			parts = append(parts, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
+		case "host":
+			parts = append(parts, "host: "+req.Host)
+		default:
+			parts = append(parts, fmt.Sprintf("%s: %s", h, req.Header.Get(h)))
+		}
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		keyID, algorithm, strings.Join(headers, " "), key.sign(t, strings.Join(parts, "\n"))))
+}
+
+// signMessage signs req as an RFC 9421 HTTP Message Signature
+func signMessage(t *testing.T, req *http.Request, key testKey, keyID, alg string, created time.Time) {
+	t.Helper()
+	signMessageComponents(t, req, key, keyID, alg, created, []string{"@method", "@target-uri", "content-digest", "content-type"})
+}
+
+// signMessageComponents signs req as an RFC 9421 HTTP Message Signature over the given components
+func signMessageComponents(t *testing.T, req *http.Request, key testKey, keyID, alg string, created time.Time, components []string) {
+	t.Helper()
+	var quoted []string
+	var lines []string
+	for _, c := range components {
+		quoted = append(quoted, `"`+c+`"`)
+		var value string
+		switch c {
+		case "@method":
+			value = req.Method
+		case "@target-uri":
+			value = "https://" + req.Host + req.URL.RequestURI()
+		case "@authority":
+			value = req.Host
+		case "@path":
+			value = req.URL.EscapedPath()
+		default:
+			value = req.Header.Get(c)
+		}
+		lines = append(lines, fmt.Sprintf("%q: %s", c, value))
+	}
+	params := fmt.Sprintf(`(%s);created=%d;keyid="%s";alg="%s"`, strings.Join(quoted, " "), created.Unix(), keyID, alg)
+	lines = append(lines, `"@signature-params": `+params)
+
+	req.Header.Set("Signature-Input", "sig1="+params)
+	req.Header.Set("Signature", "sig1=:"+key.sign(t, strings.Join(lines, "\n"))+":")
+	req.Header.Set("X-Forwarded-Proto", "https")
+}
+
+func TestVerifyRequest(t *testing.T) {
+	rsaKey := newRSATestKey(t)
+	edKey := newEd25519TestKey(t)
+	otherKey := newRSATestKey(t)
+	now := time.Now()
+
+	mastodonHeaders := []string{"(request-target)", "host", "date", "digest", "content-type"}
+
+	tests := []struct {
+		name    string
+		key     testKey
+		build   func(t *testing.T) *http.Request
+		wantErr bool
+	}{
+		{
+			name: "mastodon rsa-sha256",
+			key:  rsaKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256", mastodonHeaders)
+				return req
+			},
+		},
+		{
+			name: "gotosocial hs2019",
+			key:  rsaKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice/main-key", "hs2019",
+					[]string{"(request-target)", "host", "date", "digest"})
+				return req
+			},
+		},
+		{
+			name: "hs2019 ed25519",
+			key:  edKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "hs2019", mastodonHeaders)
+				return req
+			},
+		},
+		{
+			name: "rfc9421 rsa-v1_5-sha256",
+			key:  rsaKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-v1_5-sha256", now)
+				return req
+			},
+		},
+		{
+			name: "rfc9421 ed25519",
+			key:  edKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessage(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now)
+				return req
+			},
+		},
+		{
+			name: "signed GET without digest",
+			key:  rsaKey,
+			build: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/ap/users/bob/outbox?page=true", nil)
+				req.Host = "splitter.test"
+				req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+				signCavage(t, req, rsaKey, "https://remote.test/actor#main-key", "rsa-sha256",
+					[]string{"(request-target)", "host", "date"})
+				return req
+			},
+		},
+		{
+			name:    "wrong key",
+			key:     otherKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256", mastodonHeaders)
+				return req
+			},
+		},
+		{
+			name:    "stale date",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now.Add(-3 * time.Hour))
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256", mastodonHeaders)
+				return req
+			},
+		},
+		{
+			name:    "date not signed",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256",
+					[]string{"(request-target)", "host", "digest"})
+				return req
+			},
+		},
+		{
+			name:    "digest not signed on POST",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256",
+					[]string{"(request-target)", "host", "date"})
+				return req
+			},
+		},
+		{
+			name:    "body does not match digest",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256", mastodonHeaders)
+				req.Body = http.NoBody
+				return req
+			},
+		},
+		{
+			name:    "tampered request target",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256", mastodonHeaders)
+				req.URL.Path = "/ap/users/carol/inbox"
+				return req
+			},
+		},
+		{
+			name:    "request target not signed",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256",
+					[]string{"host", "date", "digest"})
+				return req
+			},
+		},
+		{
+			name:    "host not signed",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signCavage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "rsa-sha256",
+					[]string{"(request-target)", "date", "digest"})
+				return req
+			},
+		},
+		{
+			name: "rfc9421 authority and path",
+			key:  edKey,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessageComponents(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now,
+					[]string{"@method", "@authority", "@path", "content-digest"})
+				return req
+			},
+		},
+		{
+			name:    "rfc9421 method not signed",
+			key:     edKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessageComponents(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now,
+					[]string{"@target-uri", "content-digest"})
+				return req
+			},
+		},
+		{
+			name:    "rfc9421 target not signed",
+			key:     edKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessageComponents(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now,
+					[]string{"@method", "@authority", "content-digest"})
+				return req
+			},
+		},
+		{
+			name:    "rfc9421 authority not signed",
+			key:     edKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessageComponents(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now,
+					[]string{"@method", "@path", "content-digest"})
+				return req
+			},
+		},
+		{
+			name:    "rfc9421 stale created",
+			key:     edKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessage(t, req, edKey, "https://remote.test/users/alice#ed25519-key", "ed25519", now.Add(-2*time.Hour))
+				return req
+			},
+		},
+		{
+			name:    "rfc9421 algorithm does not match key",
+			key:     rsaKey,
+			wantErr: true,
+			build: func(t *testing.T) *http.Request {
+				req := newInboxRequest(now)
+				signMessage(t, req, rsaKey, "https://remote.test/users/alice#main-key", "ed25519", now)
+				return req
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyRequest(tt.build(t), tt.key.pem)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected verification to fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected verification to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignRequestRoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://remote.test/inbox?x=1", strings.NewReader(testActivityBody))
+	if err := SignRequest(req, key, "https://splitter.test/ap/users/bob#main-key"); err != nil {
+		t.Fatalf("failed to sign request: %v", err)
+	}
+	if err := VerifyRequest(req, publicKeyToPEM(t, key.Public())); err != nil {
+		t.Fatalf("expected our own signature to verify, got %v", err)
+	}
+}
+
+func TestSignatureKeyID(t *testing.T) {
+	key := newEd25519TestKey(t)
+	now := time.Now()
+
+	cavage := newInboxRequest(now)
+	signCavage(t, cavage, key, "https://remote.test/users/alice/main-key", "hs2019", []string{"date"})
+	if got := SignatureKeyID(cavage); got != "https://remote.test/users/alice/main-key" {
+		t.Fatalf("unexpected cavage keyId %q", got)
+	}
+
+	message := newInboxRequest(now)
+	signMessage(t, message, key, "https://remote.test/users/alice#ed25519-key", "ed25519", now)
+	if got := SignatureKeyID(message); got != "https://remote.test/users/alice#ed25519-key" {
+		t.Fatalf("unexpected RFC 9421 keyId %q", got)
+	}
+}
+
+func TestVerifyRequestSignatureRefetchesRotatedKey(t *testing.T) {
+	forgetVerifiedKeys()
+	defer forgetVerifiedKeys()
+
+	oldKey := newRSATestKey(t)
+	newKey := newRSATestKey(t)
+	const keyID = "https://remote.test/users/alice#main-key"
+	const owner = "https://remote.test/users/alice"
+
+	current := oldKey
+	var lookups, refreshes int
+	lookup := func(ctx context.Context, id string, refresh bool) (string, string, error) {
+		if id != keyID {
+			return "", "", errors.New("unexpected keyId")
+		}
+		lookups++
+		if refresh {
+			refreshes++
+		}
+		return owner, current.pem, nil
+	}
+
+	sign := func(key testKey) *http.Request {
+		req := newInboxRequest(time.Now())
+		signCavage(t, req, key, keyID, "rsa-sha256", []string{"(request-target)", "host", "date", "digest"})
+		return req
+	}
+
+	signer, err := VerifyRequestSignature(context.Background(), sign(oldKey), lookup)
+	if err != nil || signer != owner {
+		t.Fatalf("expected first request to verify as %s, got %q, %v", owner, signer, err)
+	}
+	if _, err := VerifyRequestSignature(context.Background(), sign(oldKey), lookup); err != nil {
+		t.Fatalf("expected cached key to verify, got %v", err)
+	}
+	if lookups != 1 {
+		t.Fatalf("expected verified key to be cached, got %d lookups", lookups)
+	}
+
+	// The actor rotates its key; the cached copy fails and is refetched once
+	current = newKey
+	if _, err := VerifyRequestSignature(context.Background(), sign(newKey), lookup); err != nil {
+		t.Fatalf("expected rotated key to verify after refetch, got %v", err)
+	}
+	if refreshes != 1 {
+		t.Fatalf("expected exactly one refetch, got %d", refreshes)
+	}
+
+	// A bad signature refetches once and still fails
+	if _, err := VerifyRequestSignature(context.Background(), sign(oldKey), lookup); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("expected signature mismatch, got %v", err)
+	}
+	if refreshes != 2 {
+		t.Fatalf("expected one refetch per failed verification, got %d", refreshes)
+	}
+
+	// Structural failures such as a stale Date do not trigger a refetch
+	stale := newInboxRequest(time.Now().Add(-3 * time.Hour))
+	signCavage(t, stale, newKey, keyID, "rsa-sha256", []string{"(request-target)", "host", "date", "digest"})
+	if _, err := VerifyRequestSignature(context.Background(), stale, lookup); err == nil {
+		t.Fatalf("expected stale request to fail")
+	}
+	if refreshes != 2 {
+		t.Fatalf("expected no refetch for a stale request, got %d", refreshes)
+	}
+}
+
+// readSignatureFixture parses a raw HTTP request from testdata/signatures
+func readSignatureFixture(t *testing.T, name string) *http.Request {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "signatures", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("failed to parse fixture %s: %v", name, err)
+	}
+	return req
+}
+
+func readFixtureKey(t *testing.T, name string) string {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "signatures", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture key: %v", err)
+	}
+	return string(raw)
+}
+
+// withSignatureClock pins the clock signatures are checked against for the rest of the test
+func withSignatureClock(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := signatureNow
+	signatureNow = func() time.Time { return now }
+	t.Cleanup(func() { signatureNow = previous })
+}
+
+// The draft-cavage fixtures are the published test vectors of draft-cavage-http-signatures-12
+// (appendix C), which the httpsig libraries behind Mastodon and GoToSocial are tested against;
+// the same signature is sent with Mastodon's rsa-sha256 and GoToSocial's hs2019 algorithm names.
+func TestVerifyRequestCavageFixtures(t *testing.T) {
+	withSignatureClock(t, time.Date(2014, time.January, 5, 21, 35, 0, 0, time.UTC))
+	publicKeyPEM := readFixtureKey(t, "draft-cavage-test-key.pem")
+
+	tests := []struct {
+		fixture string
+		wantErr bool
+	}{
+		{"cavage-rsa-sha256.http", false},
+		{"cavage-hs2019.http", false},
+		// Appendix C.2 leaves the body digest unsigned
+		{"cavage-basic-no-digest.http", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			err := VerifyRequest(readSignatureFixture(t, tt.fixture), publicKeyPEM)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	replayed := readSignatureFixture(t, "cavage-hs2019.http")
+	replayed.Host = "other.example"
+	if err := VerifyRequest(replayed, publicKeyPEM); err == nil {
+		t.Fatalf("expected a request replayed against another host to fail")
+	}
+}
+
+// The RFC 9421 fixture is the Ed25519 example of RFC 9421 appendix B.2.6
+func TestVerifyRequestMessageSignatureFixture(t *testing.T) {
+	withSignatureClock(t, time.Unix(1618884473, 0))
+	req := readSignatureFixture(t, "rfc9421-b26-ed25519.http")
+	pubKey, err := parsePublicKeyPEM(readFixtureKey(t, "rfc9421-test-key-ed25519.pem"))
+	if err != nil {
+		t.Fatalf("failed to parse fixture key: %v", err)
+	}
+
+	components, rawParams, params, err := parseSignatureInput(req.Header.Get("Signature-Input"), req.Header.Get("Signature"))
+	if err != nil {
+		t.Fatalf("failed to parse Signature-Input: %v", err)
+	}
+	base, err := messageSignatureBase(req, components, rawParams)
+	if err != nil {
+		t.Fatalf("failed to build signature base: %v", err)
+	}
+	if err := verifySignatureBytes(pubKey, params["alg"], []byte(base), []byte(params["signature"])); err != nil {
+		t.Fatalf("expected the RFC example signature to verify, got %v\n%s", err, base)
+	}
+
+	// The example signs Content-Length rather than Content-Digest, which is not enough for an inbox
+	if err := verifyMessageSignature(req, pubKey); err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Fatalf("expected the unsigned body digest to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyActivitySignatureBindsActor(t *testing.T) {
+	forgetVerifiedKeys()
+	defer forgetVerifiedKeys()
+	defer func(lookup func(string) (string, error)) { instanceActorLookup = lookup }(instanceActorLookup)
+	instanceActorLookup = func(host string) (string, error) {
+		if host != "remote.test" {
+			return "", errors.New("unknown host")
+		}
+		return "https://remote.test/actor", nil
+	}
+
+	keys := map[string]testKey{
+		"https://remote.test/users/alice": newRSATestKey(t),
+		"https://remote.test/actor":       newRSATestKey(t),
+	}
+	lookup := func(ctx context.Context, id string, refresh bool) (string, string, error) {
+		owner := strings.TrimSuffix(id, "#main-key")
+		return owner, keys[owner].pem, nil
+	}
+
+	tests := []struct {
+		name    string
+		signer  string
+		actor   string
+		wantErr error
+	}{
+		{"own activity", "https://remote.test/users/alice", "https://remote.test/users/alice", nil},
+		{"instance actor signing for a user on its host", "https://remote.test/actor", "https://remote.test/users/carol", nil},
+		{"user signing for another user on its host", "https://remote.test/users/alice", "https://remote.test/users/carol", ErrSignerNotActor},
+		{"activity claiming an actor on another server", "https://remote.test/users/alice", "https://other.test/users/bob", ErrSignerNotActor},
+		{"activity claiming a look-alike host", "https://remote.test/users/alice", "https://remote.test.evil/users/bob", ErrSignerNotActor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newInboxRequest(time.Now())
+			signCavage(t, req, keys[tt.signer], tt.signer+"#main-key", "rsa-sha256", []string{"(request-target)", "host", "date", "digest"})
+			_, err := VerifyActivitySignature(context.Background(), req, tt.actor, lookup)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected %s to be accepted, got %v", tt.actor, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestForgetActorKeysDropsReplacedKey(t *testing.T) {
+	forgetVerifiedKeys()
+	defer forgetVerifiedKeys()
+
+	oldKey := newRSATestKey(t)
+	newKey := newRSATestKey(t)
+	const keyID = "https://remote.test/users/alice#main-key"
+	const owner = "https://remote.test/users/alice"
+
+	var lookups int
+	lookup := func(ctx context.Context, id string, refresh bool) (string, string, error) {
+		lookups++
+		return owner, oldKey.pem, nil
+	}
+	sign := func() *http.Request {
+		req := newInboxRequest(time.Now())
+		signCavage(t, req, oldKey, keyID, "rsa-sha256", []string{"(request-target)", "host", "date", "digest"})
+		return req
+	}
+
+	if _, err := VerifyRequestSignature(context.Background(), sign(), lookup); err != nil {
+		t.Fatalf("expected the first request to verify, got %v", err)
+	}
+	// Announcing the same key keeps the cache
+	ForgetActorKeys(owner, oldKey.pem)
+	if _, err := VerifyRequestSignature(context.Background(), sign(), lookup); err != nil || lookups != 1 {
+		t.Fatalf("expected the cached key to verify without a lookup, got %v after %d lookups", err, lookups)
+	}
+
+	// Update(Person) replaces the key: the old one must be looked up again
+	ForgetActorKeys(owner, newKey.pem)
+	if _, err := VerifyRequestSignature(context.Background(), sign(), lookup); err != nil || lookups != 2 {
+		t.Fatalf("expected the replaced key to be looked up again, got %v after %d lookups", err, lookups)
+	}
+}
+
+func TestVerifiedKeyCacheIsBounded(t *testing.T) {
+	forgetVerifiedKeys()
+	defer forgetVerifiedKeys()
+
+	for i := 0; i < maxVerifiedKeys+10; i++ {
+		rememberVerifiedKey(fmt.Sprintf("https://remote.test/users/u%d#main-key", i), verifiedKey{owner: "https://remote.test/users/u"})
+	}
+	verifiedKeysMu.RLock()
+	size := len(verifiedKeys)
+	verifiedKeysMu.RUnlock()
+	if size != maxVerifiedKeys {
+		t.Fatalf("expected the cache to hold %d keys, got %d", maxVerifiedKeys, size)
+	}
+}
@@ -0,0 +1,319 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"splitter/internal/db"
+)
+
+// Inbox activity states
+const (
+	InboxStatusPending    = "pending"
+	InboxStatusProcessing = "processing"
+	InboxStatusFailed     = "failed"
+	InboxStatusProcessed  = "processed"
+	InboxStatusDead       = "dead"
+)
+
+// inboxClaimLease is how long a claimed activity stays locked before another worker may retry it
+const inboxClaimLease = 5 * time.Minute
+
+var (
+	inboxPolicyMu    sync.RWMutex
+	inboxMaxAttempts = 8
+)
+
+// InboxProcessor applies a single verified inbound activity to local state
+type InboxProcessor func(ctx context.Context, activity map[string]interface{}) error
+
+// permanentInboxError marks a failure that retrying cannot fix (e.g. malformed payload)
+type permanentInboxError struct {
+	err error
+}
+
+func (e *permanentInboxError) Error() string { return e.err.Error() }
+func (e *permanentInboxError) Unwrap() error { return e.err }
+
+// PermanentInboxError wraps an error so the activity is dead-lettered without further retries
+func PermanentInboxError(format string, args ...interface{}) error {
+	return &permanentInboxError{err: fmt.Errorf(format, args...)}
+}
+
+// InboxQueueEntry is an inbox_activities row as shown to admins
+type InboxQueueEntry struct {
+	ID             string          `json:"id"`
+	ActivityID     string          `json:"activity_id"`
+	ActorURI       string          `json:"actor_uri"`
+	ActivityType   string          `json:"activity_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeadLetteredAt *time.Time      `json:"dead_lettered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+}
+
+// ConfigureInboxPolicy sets how many processing attempts an activity gets before it is dead-lettered.
+func ConfigureInboxPolicy(maxAttempts int) {
+	inboxPolicyMu.Lock()
+	defer inboxPolicyMu.Unlock()
+	if maxAttempts > 0 {
+		inboxMaxAttempts = maxAttempts
+	}
+}
+
+func currentInboxMaxAttempts() int {
+	inboxPolicyMu.RLock()
+	defer inboxPolicyMu.RUnlock()
+	return inboxMaxAttempts
+}
+
+// EnsureInboxQueueSchema adds the processing-state columns from migration 026 if missing
+func EnsureInboxQueueSchema(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'processed'`,
+		`ALTER TABLE inbox_activities ALTER COLUMN status SET DEFAULT 'pending'`,
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS last_error TEXT`,
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ DEFAULT now()`,
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ`,
+		`ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMPTZ`,
+		`CREATE INDEX IF NOT EXISTS idx_inbox_status_next_attempt ON inbox_activities (status, next_attempt_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.GetDB().Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to ensure inbox queue schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// EnqueueInboxActivity persists a verified activity for asynchronous processing.
+// Returns false when an activity with the same ID was already received.
+func EnqueueInboxActivity(ctx context.Context, activityID, actorURI, activityType string, payload []byte) (bool, error) {
+	tag, err := db.GetDB().Exec(ctx,
+		`INSERT INTO inbox_activities (activity_id, actor_uri, activity_type, payload, status, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, 'pending', now())
+		 ON CONFLICT (activity_id) DO NOTHING`,
+		activityID, actorURI, activityType, payload,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to enqueue inbox activity: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+type claimedInboxActivity struct {
+	id         string
+	activityID string
+	payload    []byte
+	attempts   int
+}
+
+// ProcessInboxBatch claims due inbox activities and runs them through processor.
+// Failures are retried with exponential backoff until the attempt limit, then dead-lettered.
+func ProcessInboxBatch(ctx context.Context, batchSize int, processor InboxProcessor) (int, int, error) {
+	if batchSize <= 0 {
+		batchSize = 25
+	}
+
+	// Claim rows atomically so several workers can share the queue. Rows stuck in
+	// 'processing' past their lease (crashed worker) are picked up again.
+	rows, err := db.GetDB().Query(ctx, `
+		UPDATE inbox_activities
+		SET status = 'processing',
+		    attempts = attempts + 1,
+		    next_attempt_at = now() + $2::interval
+		WHERE id IN (
+			SELECT id FROM inbox_activities
+			WHERE status IN ('pending', 'failed', 'processing')
+			  AND COALESCE(next_attempt_at, now()) <= now()
+			ORDER BY received_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id::text, activity_id, payload, attempts
+	`, batchSize, formatBackoffInterval(inboxClaimLease))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to claim inbox activities: %w", err)
+	}
+
+	var claimed []claimedInboxActivity
+	for rows.Next() {
+		var item claimedInboxActivity
+		if scanErr := rows.Scan(&item.id, &item.activityID, &item.payload, &item.attempts); scanErr != nil {
+			continue
+		}
+		claimed = append(claimed, item)
+	}
+	rows.Close()
+
+	processed := 0
+	failed := 0
+	for _, item := range claimed {
+		processed++
+
+		procErr := processInboxPayload(ctx, processor, item.payload)
+		if procErr == nil {
+			markInboxProcessed(ctx, item.id, item.activityID)
+			continue
+		}
+
+		failed++
+		markInboxFailure(ctx, item, procErr)
+	}
+
+	return processed, failed, nil
+}
+
+// processInboxPayload decodes a queued activity and runs it through processor.
+// A payload that is not a JSON object can never succeed and fails permanently.
+func processInboxPayload(ctx context.Context, processor InboxProcessor, payload []byte) error {
+	var activity map[string]interface{}
+	if err := json.Unmarshal(payload, &activity); err != nil {
+		return PermanentInboxError("invalid payload: %v", err)
+	}
+	return runInboxProcessor(ctx, processor, activity)
+}
+
+// runInboxProcessor calls processor, turning a panic into a retryable error
+func runInboxProcessor(ctx context.Context, processor InboxProcessor, activity map[string]interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("processor panic: %v", r)
+		}
+	}()
+	return processor(ctx, activity)
+}
+
+func markInboxProcessed(ctx context.Context, id, activityID string) {
+	_, err := db.GetDB().Exec(ctx,
+		`UPDATE inbox_activities
+		 SET status = 'processed', processed_at = now(), last_error = NULL, next_attempt_at = NULL
+		 WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		log.Printf("[FederationWorker] Failed to mark inbox activity %s processed: %v", id, err)
+	}
+	if activityID != "" {
+		MarkActivityProcessed(ctx, activityID)
+	}
+}
+
+// shouldDeadLetterInbox reports whether a failed activity is given up on: the failure is
+// permanent, or the activity has used up its attempts
+func shouldDeadLetterInbox(attempts int, procErr error) bool {
+	var permanent *permanentInboxError
+	return errors.As(procErr, &permanent) || attempts >= currentInboxMaxAttempts()
+}
+
+func markInboxFailure(ctx context.Context, item claimedInboxActivity, procErr error) {
+	if shouldDeadLetterInbox(item.attempts, procErr) {
+		_, err := db.GetDB().Exec(ctx,
+			`UPDATE inbox_activities
+			 SET status = 'dead', last_error = $2, dead_lettered_at = now(), next_attempt_at = NULL
+			 WHERE id = $1`,
+			item.id, procErr.Error(),
+		)
+		if err != nil {
+			log.Printf("[FederationWorker] Failed to dead-letter inbox activity %s: %v", item.id, err)
+		}
+		log.Printf("[FederationWorker] Inbox activity %s dead-lettered after %d attempts: %v", item.activityID, item.attempts, procErr)
+		return
+	}
+
+	delay := calculateRetryDelay(item.attempts)
+	_, err := db.GetDB().Exec(ctx,
+		`UPDATE inbox_activities
+		 SET status = 'failed', last_error = $2, next_attempt_at = now() + $3::interval
+		 WHERE id = $1`,
+		item.id, procErr.Error(), formatBackoffInterval(delay),
+	)
+	if err != nil {
+		log.Printf("[FederationWorker] Failed to record inbox failure %s: %v", item.id, err)
+	}
+	log.Printf("[FederationWorker] Inbox activity %s failed (attempt %d, retry in %s): %v", item.activityID, item.attempts, delay, procErr)
+}
+
+// ListInboxActivities returns inbox rows in the given status, newest first.
+// An empty status lists every row that is not yet processed.
+func ListInboxActivities(ctx context.Context, status string, limit, offset int) ([]InboxQueueEntry, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT id::text, activity_id, actor_uri, activity_type, status, attempts, COALESCE(last_error, ''),
+		       received_at, next_attempt_at, dead_lettered_at, payload
+		FROM inbox_activities
+		WHERE ($1 = '' AND status <> 'processed') OR status = $1
+		ORDER BY received_at DESC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inbox activities: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []InboxQueueEntry{}
+	for rows.Next() {
+		var entry InboxQueueEntry
+		var payload []byte
+		if err := rows.Scan(
+			&entry.ID, &entry.ActivityID, &entry.ActorURI, &entry.ActivityType, &entry.Status,
+			&entry.Attempts, &entry.LastError, &entry.ReceivedAt, &entry.NextAttemptAt,
+			&entry.DeadLetteredAt, &payload,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan inbox activity: %w", err)
+		}
+		entry.Payload = json.RawMessage(payload)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetInboxQueueStats returns the number of inbox rows per status
+func GetInboxQueueStats(ctx context.Context) (map[string]int, error) {
+	rows, err := db.GetDB().Query(ctx, `SELECT status, COUNT(*) FROM inbox_activities GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inbox stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := map[string]int{
+		InboxStatusPending:    0,
+		InboxStatusProcessing: 0,
+		InboxStatusFailed:     0,
+		InboxStatusProcessed:  0,
+		InboxStatusDead:       0,
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err == nil {
+			stats[status] = count
+		}
+	}
+	return stats, nil
+}
+
+// ReplayInboxActivity resets a dead-lettered activity so workers process it again
+func ReplayInboxActivity(ctx context.Context, id string) error {
+	tag, err := db.GetDB().Exec(ctx,
+		`UPDATE inbox_activities
+		 SET status = 'pending', attempts = 0, next_attempt_at = now(), dead_lettered_at = NULL
+		 WHERE id::text = $1 AND status = 'dead'`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to replay inbox activity: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("dead-lettered activity not found")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestProcessInboxPayload(t *testing.T) {
+	var seen map[string]interface{}
+	record := func(ctx context.Context, activity map[string]interface{}) error {
+		seen = activity
+		return nil
+	}
+	if err := processInboxPayload(context.Background(), record, []byte(`{"type":"Follow"}`)); err != nil || seen["type"] != "Follow" {
+		t.Fatalf("expected the activity to reach the processor, got %v, %v", seen, err)
+	}
+
+	var permanent *permanentInboxError
+	if err := processInboxPayload(context.Background(), record, []byte(`["not", "an", "activity"]`)); !errors.As(err, &permanent) {
+		t.Fatalf("expected an undecodable payload to fail permanently, got %v", err)
+	}
+
+	panics := func(ctx context.Context, activity map[string]interface{}) error {
+		panic("boom")
+	}
+	err := processInboxPayload(context.Background(), panics, []byte(`{"type":"Create"}`))
+	if err == nil || errors.As(err, &permanent) {
+		t.Fatalf("expected a processor panic to be retried, got %v", err)
+	}
+}
+
+func TestShouldDeadLetterInbox(t *testing.T) {
+	defer ConfigureInboxPolicy(currentInboxMaxAttempts())
+	ConfigureInboxPolicy(3)
+
+	transient := fmt.Errorf("remote actor unreachable")
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		want     bool
+	}{
+		{"transient failure is retried", 1, transient, false},
+		{"last attempt before the limit is retried", 2, transient, false},
+		{"attempt limit reached", 3, transient, true},
+		{"permanent failure on first attempt", 1, PermanentInboxError("invalid Move from %s", "https://remote.test/users/a"), true},
+		{"wrapped permanent failure", 1, fmt.Errorf("handling Move: %w", PermanentInboxError("bad")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldDeadLetterInbox(tt.attempts, tt.err); got != tt.want {
+				t.Fatalf("shouldDeadLetterInbox(%d, %v) = %v, want %v", tt.attempts, tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"splitter/internal/db"
+)
+
+// SoftwareName is the software identity advertised in NodeInfo
+const SoftwareName = "splitter"
+
+// SoftwareVersion is the version advertised in NodeInfo. Release builds set it with
+// -ldflags "-X splitter/internal/federation.SoftwareVersion=<version>"; otherwise it is
+// taken from the build info recorded by the Go toolchain.
+var SoftwareVersion string
+
+func init() {
+	if SoftwareVersion == "" {
+		SoftwareVersion = buildVersion()
+	}
+}
+
+// buildVersion returns the module version of the binary, or the VCS revision it was
+// built from, or "dev"
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if version := info.Main.Version; version != "" && version != "(devel)" {
+		return version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "dev+" + setting.Value[:12]
+		}
+	}
+	return "dev"
+}
+
+// NodeInfoSchema is the NodeInfo version we publish
+const NodeInfoSchema = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+
+// NodeInfoUsage holds the usage statistics published in our NodeInfo document
+type NodeInfoUsage struct {
+	TotalUsers     int
+	ActiveMonth    int
+	ActiveHalfyear int
+	LocalPosts     int
+}
+
+// BuildNodeInfo returns our NodeInfo 2.1 document
+func BuildNodeInfo(nodeName string, openRegistrations bool, usage NodeInfoUsage) map[string]interface{} {
+	return map[string]interface{}{
+		"version": "2.1",
+		"software": map[string]interface{}{
+			"name":    SoftwareName,
+			"version": SoftwareVersion,
+		},
+		"protocols": []string{"activitypub"},
+		"services": map[string]interface{}{
+			"inbound":  []string{},
+			"outbound": []string{},
+		},
+		"openRegistrations": openRegistrations,
+		"usage": map[string]interface{}{
+			"users": map[string]int{
+				"total":          usage.TotalUsers,
+				"activeMonth":    usage.ActiveMonth,
+				"activeHalfyear": usage.ActiveHalfyear,
+			},
+			"localPosts": usage.LocalPosts,
+		},
+		"metadata": map[string]interface{}{
+			"nodeName": nodeName,
+		},
+	}
+}
+
+// KnownInstance is a peer server recorded in the known_instances registry
+type KnownInstance struct {
+	Domain      string    `json:"domain"`
+	BaseURL     string    `json:"base_url"`
+	Software    string    `json:"software"`
+	Pinned      bool      `json:"pinned"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// EnsureKnownInstancesTable creates the known_instances table if migration 029 has not been applied
+func EnsureKnownInstancesTable(ctx context.Context) error {
+	_, err := db.GetDB().Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS known_instances (
+			domain TEXT PRIMARY KEY,
+			base_url TEXT NOT NULL,
+			software TEXT NOT NULL DEFAULT '',
+			pinned BOOLEAN NOT NULL DEFAULT false,
+			first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	return err
+}
+
+// SeedKnownInstances imports the configured InstanceURLMap (as pinned peers) and every
+// domain already present in remote_actors into the registry.
+func SeedKnownInstances(ctx context.Context, selfDomain string) error {
+	for domain, baseURL := range InstanceURLMap {
+		if domain == selfDomain {
+			continue
+		}
+		_, err := db.GetDB().Exec(ctx,
+			`INSERT INTO known_instances (domain, base_url, pinned)
+			 VALUES ($1, $2, true)
+			 ON CONFLICT (domain) DO NOTHING`,
+			domain, strings.TrimRight(baseURL, "/"),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to seed known instance %s: %w", domain, err)
+		}
+	}
+
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT DISTINCT ON (domain) domain, actor_uri FROM remote_actors
+		 WHERE COALESCE(domain, '') NOT IN ('', $1)
+		 ORDER BY domain, last_fetched_at DESC`,
+		selfDomain,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list remote actor domains: %w", err)
+	}
+	type seed struct{ domain, baseURL string }
+	var seeds []seed
+	for rows.Next() {
+		var domain, actorURI string
+		if err := rows.Scan(&domain, &actorURI); err != nil {
+			continue
+		}
+		if baseURL := baseURLFromURI(actorURI); baseURL != "" {
+			seeds = append(seeds, seed{domain, baseURL})
+		}
+	}
+	rows.Close()
+
+	for _, s := range seeds {
+		if _, err := db.GetDB().Exec(ctx,
+			`INSERT INTO known_instances (domain, base_url) VALUES ($1, $2)
+			 ON CONFLICT (domain) DO NOTHING`,
+			s.domain, s.baseURL,
+		); err != nil {
+			return fmt.Errorf("failed to seed known instance %s: %w", s.domain, err)
+		}
+	}
+	return nil
+}
+
+// RecordKnownInstance adds a peer to the registry or refreshes its last_seen_at.
+// An empty software value keeps whatever was detected previously.
+func RecordKnownInstance(ctx context.Context, domain, baseURL, software string) {
+	domain = strings.TrimSpace(domain)
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if domain == "" || baseURL == "" || domain == GetInstanceDomain() {
+		return
+	}
+	var inserted bool
+	err := db.GetDB().QueryRow(ctx,
+		`INSERT INTO known_instances (domain, base_url, software)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (domain) DO UPDATE SET
+		   last_seen_at = now(),
+		   software = COALESCE(NULLIF(EXCLUDED.software, ''), known_instances.software)
+		 RETURNING (xmax = 0)`,
+		domain, baseURL, software,
+	).Scan(&inserted)
+	if err != nil {
+		log.Printf("[Federation] Failed to record known instance %s: %v", domain, err)
+		return
+	}
+
+	// Newly discovered peer: identify its software from NodeInfo in the background
+	if inserted && software == "" {
+		go func() {
+			detected := DetectInstanceSoftware(baseURL)
+			if detected == "" {
+				return
+			}
+			if _, err := db.GetDB().Exec(context.Background(),
+				`UPDATE known_instances SET software = $2 WHERE domain = $1`, domain, detected,
+			); err != nil {
+				log.Printf("[Federation] Failed to record software for %s: %v", domain, err)
+				return
+			}
+			log.Printf("[Federation] Discovered peer %s running %s", domain, detected)
+		}()
+	}
+}
+
+// RecordInstanceFromActor registers the server hosting actorURI
+func RecordInstanceFromActor(ctx context.Context, actorURI string) {
+	if actorURI == "" || isLocalActorURI(actorURI) {
+		return
+	}
+	domain := extractDomainFromURI(actorURI)
+	baseURL, ok := InstanceURLMap[domain]
+	if !ok {
+		baseURL = baseURLFromURI(actorURI)
+	}
+	RecordKnownInstance(ctx, domain, baseURL, "")
+}
+
+// ListKnownInstances returns every registered peer, pinned first
+func ListKnownInstances(ctx context.Context) ([]KnownInstance, error) {
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT domain, base_url, software, pinned, first_seen_at, last_seen_at
+		 FROM known_instances
+		 ORDER BY pinned DESC, last_seen_at DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list known instances: %w", err)
+	}
+	defer rows.Close()
+
+	instances := []KnownInstance{}
+	for rows.Next() {
+		var inst KnownInstance
+		if err := rows.Scan(&inst.Domain, &inst.BaseURL, &inst.Software, &inst.Pinned, &inst.FirstSeenAt, &inst.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan known instance: %w", err)
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// KnownPeers returns domain → base URL for every registered peer other than selfDomain.
+// Falls back to InstanceURLMap if the registry cannot be read.
+func KnownPeers(ctx context.Context, selfDomain string) map[string]string {
+	return knownPeers(ctx, selfDomain, false)
+}
+
+// SplitterPeers returns the peers that serve Splitter's own API (pinned or detected as splitter),
+// used by the federated timeline and directory which query /api/v1 endpoints directly.
+func SplitterPeers(ctx context.Context, selfDomain string) map[string]string {
+	return knownPeers(ctx, selfDomain, true)
+}
+
+func knownPeers(ctx context.Context, selfDomain string, splitterOnly bool) map[string]string {
+	peers := make(map[string]string)
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT domain, base_url FROM known_instances
+		 WHERE domain <> $1 AND (NOT $2 OR pinned OR software IN ('', 'splitter'))`,
+		selfDomain, splitterOnly,
+	)
+	if err != nil {
+		log.Printf("[Federation] Known instance registry unavailable, using configured peers: %v", err)
+		for domain, baseURL := range InstanceURLMap {
+			if domain != selfDomain {
+				peers[domain] = baseURL
+			}
+		}
+		return peers
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain, baseURL string
+		if err := rows.Scan(&domain, &baseURL); err == nil {
+			peers[domain] = baseURL
+		}
+	}
+	return peers
+}
+
+// SetKnownInstancePinned pins or unpins a registered peer
+func SetKnownInstancePinned(ctx context.Context, domain string, pinned bool) error {
+	tag, err := db.GetDB().Exec(ctx,
+		`UPDATE known_instances SET pinned = $2 WHERE domain = $1`, domain, pinned,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update known instance: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("known instance not found")
+	}
+	return nil
+}
+
+// RemoveKnownInstance deletes a peer from the registry.
+// It will be re-registered if the instance contacts us again.
+func RemoveKnownInstance(ctx context.Context, domain string) error {
+	tag, err := db.GetDB().Exec(ctx, `DELETE FROM known_instances WHERE domain = $1`, domain)
+	if err != nil {
+		return fmt.Errorf("failed to remove known instance: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("known instance not found")
+	}
+	return nil
+}
+
+// knownInstanceSoftware returns the recorded software of a peer ("" if unknown)
+func knownInstanceSoftware(ctx context.Context, domain string) string {
+	var software string
+	_ = db.GetDB().QueryRow(ctx,
+		`SELECT software FROM known_instances WHERE domain = $1`, domain,
+	).Scan(&software)
+	return software
+}
+
+// DetectInstanceSoftware identifies the software a peer runs via NodeInfo,
+// falling back to probing Splitter's federation API.
+func DetectInstanceSoftware(baseURL string) string {
+	if info, err := FetchNodeInfo(baseURL); err == nil && info.SoftwareName != "" {
+		return info.SoftwareName
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if resp, err := client.Get(baseURL + "/api/v1/federation/public-users?limit=1"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return "splitter"
+		}
+	}
+	return ""
+}
+
+// baseURLFromURI returns scheme://host of a URI
+func baseURLFromURI(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,39 @@
+package federation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildNodeInfoAdvertisesRegistrations(t *testing.T) {
+	for _, open := range []bool{true, false} {
+		var ts *httptest.Server
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/.well-known/nodeinfo":
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"links": []map[string]string{{"rel": NodeInfoSchema, "href": ts.URL + "/nodeinfo/2.1"}},
+				})
+			case "/nodeinfo/2.1":
+				_ = json.NewEncoder(w).Encode(BuildNodeInfo("splitter.test", open, NodeInfoUsage{TotalUsers: 3, LocalPosts: 12}))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		info, err := FetchNodeInfo(ts.URL)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("failed to fetch our own NodeInfo: %v", err)
+		}
+		if info.OpenRegistrations != open {
+			t.Fatalf("expected openRegistrations %v, got %v", open, info.OpenRegistrations)
+		}
+		if info.SoftwareName != SoftwareName || info.SoftwareVersion != SoftwareVersion || info.SoftwareVersion == "" {
+			t.Fatalf("unexpected software %s %s", info.SoftwareName, info.SoftwareVersion)
+		}
+	}
+}
@@ -2,12 +2,10 @@ package federation
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 
 	"splitter/internal/db"
@@ -17,10 +15,13 @@ var (
 	instancePrivateKey *rsa.PrivateKey
 	instancePublicPEM  string
 	instanceDomain     string
+	instanceURL        string
 	keyMu              sync.Mutex
 )
 
-// EnsureInstanceKeys generates or loads RSA-2048 keypair for this instance
+// EnsureInstanceKeys generates or loads RSA-2048 keypair for this instance.
+// The instance keypair belongs to the instance (Application) actor; local users
+// sign with their own keys from actor_keys.
 func EnsureInstanceKeys(domain string) error {
 	keyMu.Lock()
 	defer keyMu.Unlock()
@@ -36,13 +37,9 @@ func EnsureInstanceKeys(domain string) error {
 
 	if err == nil {
 		// Keys exist — load them
-		block, _ := pem.Decode([]byte(privPEM))
-		if block == nil {
-			return fmt.Errorf("failed to decode private key PEM")
-		}
-		privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		privKey, err := parseRSAPrivateKeyPEM(privPEM)
 		if err != nil {
-			return fmt.Errorf("failed to parse private key: %w", err)
+			return err
 		}
 		instancePrivateKey = privKey
 		instancePublicPEM = pubPEM
@@ -52,24 +49,11 @@ func EnsureInstanceKeys(domain string) error {
 
 	// Generate new RSA-2048 keypair
 	log.Printf("[Federation] Generating new RSA-2048 keypair for domain '%s'...", domain)
-	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privKey, privPEM, pubPEM, err := generateRSAKeyPair()
 	if err != nil {
-		return fmt.Errorf("failed to generate RSA key: %w", err)
+		return err
 	}
 
-	// Encode private key to PEM
-	privBytes := x509.MarshalPKCS1PrivateKey(privKey)
-	privBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes}
-	privPEM = string(pem.EncodeToMemory(privBlock))
-
-	// Encode public key to PEM
-	pubBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
-	if err != nil {
-		return fmt.Errorf("failed to marshal public key: %w", err)
-	}
-	pubBlock := &pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}
-	pubPEM = string(pem.EncodeToMemory(pubBlock))
-
 	// Store in DB
 	_, err = db.GetDB().Exec(ctx,
 		`INSERT INTO instance_keys (domain, public_key_pem, private_key_pem)
@@ -107,3 +91,24 @@ func GetInstanceDomain() string {
 	defer keyMu.Unlock()
 	return instanceDomain
 }
+
+// SetInstanceURL records the public base URL of this instance (e.g. https://splitter-1.example)
+func SetInstanceURL(baseURL string) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	instanceURL = strings.TrimRight(baseURL, "/")
+}
+
+// InstanceBaseURL returns the configured base URL, falling back to the resolved domain URL
+func InstanceBaseURL() string {
+	keyMu.Lock()
+	base, domain := instanceURL, instanceDomain
+	keyMu.Unlock()
+	if base != "" {
+		return base
+	}
+	if domain == "" {
+		return ""
+	}
+	return resolveInstanceURL(domain)
+}
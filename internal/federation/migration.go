@@ -45,29 +45,47 @@ func EnsureMigrationTable(ctx context.Context) error {
 	return err
 }
 
-// CheckAndMigrateUsers checks all peer domains for permanent failure and migrates
+// CheckAndMigrateUsers checks the Splitter peers for permanent failure and migrates
 // their users to this instance. Should be called periodically from the worker loop.
 func CheckAndMigrateUsers(ctx context.Context, selfDomain string) {
-	for domain := range InstanceURLMap {
-		if domain == selfDomain {
-			continue
+	instances, err := ListKnownInstances(ctx)
+	if err != nil {
+		log.Printf("[Migration] Known instance registry unavailable, using configured peers: %v", err)
+		instances = nil
+		for domain := range InstanceURLMap {
+			instances = append(instances, KnownInstance{Domain: domain, Pinned: true})
 		}
+	}
 
-		downDuration := GetPeerDownDuration(domain)
-		if downDuration == 0 {
-			// Also check DB for cross-restart persistence
-			downDuration = GetPeerDownDurationFromDB(ctx, domain)
+	downFor := func(domain string) time.Duration {
+		if downDuration := GetPeerDownDuration(domain); downDuration > 0 {
+			return downDuration
 		}
+		// Also check DB for cross-restart persistence
+		return GetPeerDownDurationFromDB(ctx, domain)
+	}
+
+	for _, domain := range migrationCandidates(instances, selfDomain, downFor) {
+		log.Printf("[Migration] Peer %s has been down for over 30 days, checking for user migration...", domain)
+		migrateUsersFromDomain(ctx, domain, selfDomain)
+	}
+}
 
-		if downDuration < PermanentFailureThreshold {
+// migrationCandidates returns the peers whose users should be migrated: Splitter
+// instances (pinned, or detected as splitter) down for PermanentFailureThreshold or
+// longer. Accounts on other software are never migrated, however long their server is
+// unreachable, since they cannot continue on this instance.
+func migrationCandidates(instances []KnownInstance, selfDomain string, downFor func(domain string) time.Duration) []string {
+	var domains []string
+	for _, inst := range instances {
+		if inst.Domain == selfDomain || (!inst.Pinned && inst.Software != SoftwareName) {
 			continue
 		}
-
-		log.Printf("[Migration] Peer %s has been down for %s (>30 days), checking for user migration...",
-			domain, downDuration.Round(time.Hour))
-
-		migrateUsersFromDomain(ctx, domain, selfDomain)
+		if downFor(inst.Domain) >= PermanentFailureThreshold {
+			domains = append(domains, inst.Domain)
+		}
 	}
+	return domains
 }
 
 // migrateUsersFromDomain migrates all ghost users from a failed domain to the local instance
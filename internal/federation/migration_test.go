@@ -0,0 +1,31 @@
+package federation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMigrationCandidatesOnlySplitterPeers(t *testing.T) {
+	instances := []KnownInstance{
+		{Domain: "self.example"},
+		{Domain: "pinned.example", Pinned: true},
+		{Domain: "splitter.example", Software: "splitter"},
+		{Domain: "mastodon.example", Software: "mastodon"},
+		{Domain: "misskey.example", Software: "misskey"},
+		{Domain: "unknown.example"},
+		{Domain: "recent.example", Software: "splitter"},
+	}
+	downFor := func(domain string) time.Duration {
+		if domain == "recent.example" {
+			return time.Hour
+		}
+		return PermanentFailureThreshold + time.Hour
+	}
+
+	got := migrationCandidates(instances, "self.example", downFor)
+	want := []string{"pinned.example", "splitter.example"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("migrationCandidates() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,263 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"splitter/internal/db"
+)
+
+// NoteTag is an entry of a Note's tag array: a Mention or a Hashtag
+type NoteTag struct {
+	Type string `json:"type"`
+	Href string `json:"href,omitempty"`
+	Name string `json:"name"`
+}
+
+// NoteMention is an @username or @username@domain reference in post text
+type NoteMention struct {
+	Username string
+	Domain   string // empty for local mentions
+}
+
+// Handle returns the mention as username@domain (or just username when local)
+func (m NoteMention) Handle() string {
+	if m.Domain == "" {
+		return m.Username
+	}
+	return m.Username + "@" + m.Domain
+}
+
+var (
+	// Same tag alphabet as the hashtag queries in PostRepository
+	hashtagPattern = regexp.MustCompile(`(^|[^\w&/#])#([A-Za-z0-9_]+)`)
+	mentionPattern = regexp.MustCompile(`(^|[^\w/@])@([A-Za-z0-9_][A-Za-z0-9_.-]*[A-Za-z0-9_]|[A-Za-z0-9_])(?:@([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*(?::[0-9]+)?))?`)
+)
+
+// ParseHashtags returns the distinct lowercased hashtags in plain post text
+func ParseHashtags(content string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, match := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag := strings.ToLower(match[2])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ParseMentions returns the distinct mentions in plain post text
+func ParseMentions(content string) []NoteMention {
+	seen := make(map[string]bool)
+	var mentions []NoteMention
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		mention := NoteMention{Username: match[2], Domain: strings.ToLower(match[3])}
+		if mention.Domain == GetInstanceDomain() || mention.Domain == "localhost" {
+			mention.Domain = ""
+		}
+		key := strings.ToLower(mention.Handle())
+		if !seen[key] {
+			seen[key] = true
+			mentions = append(mentions, mention)
+		}
+	}
+	return mentions
+}
+
+// mentionResolver maps a mention to the actor URI it links to ("" leaves it as text)
+type mentionResolver func(NoteMention) string
+
+// RenderNoteContent turns plain post text into the HTML content of a Note and its tag array.
+// Mentions link to the actor URIs in hrefs, keyed by lowercased handle, as recorded by
+// RecordMentionLinks; unknown mentions stay text. Hashtags link to the instance's tag
+// page. The markup is Mastodon's so remote servers render it natively.
+func RenderNoteContent(content string, hrefs map[string]string) (string, []NoteTag) {
+	return renderNoteContent(content, InstanceBaseURL(), func(mention NoteMention) string {
+		return hrefs[strings.ToLower(mention.Handle())]
+	})
+}
+
+func renderNoteContent(content, baseURL string, resolve mentionResolver) (string, []NoteTag) {
+	var tags []NoteTag
+
+	hrefs := make(map[string]string)
+	for _, mention := range ParseMentions(content) {
+		href := resolve(mention)
+		if href == "" {
+			continue
+		}
+		hrefs[strings.ToLower(mention.Handle())] = href
+		name := "@" + mention.Username + "@" + mention.Domain
+		if mention.Domain == "" {
+			name = "@" + mention.Username + "@" + GetInstanceDomain()
+		}
+		tags = append(tags, NoteTag{Type: "Mention", Href: href, Name: name})
+	}
+	for _, tag := range ParseHashtags(content) {
+		tags = append(tags, NoteTag{Type: "Hashtag", Href: fmt.Sprintf("%s/tags/%s", baseURL, tag), Name: "#" + tag})
+	}
+
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		text := html.EscapeString(paragraph)
+
+		text = mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := mentionPattern.FindStringSubmatch(match)
+			mention := NoteMention{Username: parts[2], Domain: strings.ToLower(parts[3])}
+			if mention.Domain == GetInstanceDomain() || mention.Domain == "localhost" {
+				mention.Domain = ""
+			}
+			href, ok := hrefs[strings.ToLower(mention.Handle())]
+			if !ok {
+				return match
+			}
+			return fmt.Sprintf(`%s<span class="h-card"><a href="%s" class="u-url mention">@<span>%s</span></a></span>`,
+				parts[1], html.EscapeString(href), parts[2])
+		})
+		text = hashtagPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := hashtagPattern.FindStringSubmatch(match)
+			return fmt.Sprintf(`%s<a href="%s/tags/%s" class="mention hashtag" rel="tag">#<span>%s</span></a>`,
+				parts[1], baseURL, strings.ToLower(parts[2]), parts[2])
+		})
+
+		paragraphs = append(paragraphs, "<p>"+strings.ReplaceAll(text, "\n", "<br>")+"</p>")
+	}
+
+	return strings.Join(paragraphs, ""), tags
+}
+
+// resolveMentionHref returns the actor URI for a mention, or "" if the account is unknown.
+// Remote accounts not yet cached are looked up with WebFinger.
+func resolveMentionHref(ctx context.Context, mention NoteMention) string {
+	if mention.Domain == "" {
+		var exists bool
+		err := db.GetDB().QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM users
+			 WHERE username = $1 AND COALESCE(instance_domain, '') IN ($2, 'localhost', ''))`,
+			mention.Username, GetInstanceDomain(),
+		).Scan(&exists)
+		if err != nil || !exists {
+			return ""
+		}
+		return fmt.Sprintf("%s/ap/users/%s", InstanceBaseURL(), mention.Username)
+	}
+
+	// Any cached copy will do for a link; only unknown accounts need WebFinger
+	if cached, err := getRemoteActorFromCache(ctx, mention.Username, mention.Domain); err == nil && cached.ActorURI != "" {
+		return cached.ActorURI
+	}
+	actor, err := ResolveRemoteUser(mention.Handle())
+	if err != nil || actor == nil {
+		return ""
+	}
+	return actor.ActorURI
+}
+
+// RecordMentionLinks resolves the mentions in the text of a local post or reply and stores
+// the actor URIs they link to, replacing those stored for an earlier version. It runs when
+// the text is written so that serving the Note never has to resolve accounts.
+func RecordMentionLinks(ctx context.Context, objectID, content string) error {
+	hrefs := make(map[string]string)
+	for _, mention := range ParseMentions(content) {
+		if href := resolveMentionHref(ctx, mention); href != "" {
+			hrefs[strings.ToLower(mention.Handle())] = href
+		}
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM note_mention_links WHERE object_id = $1`, objectID); err != nil {
+		return fmt.Errorf("failed to clear mention links: %w", err)
+	}
+	for handle, href := range hrefs {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO note_mention_links (object_id, handle, href) VALUES ($1, $2, $3)`,
+			objectID, handle, href,
+		); err != nil {
+			return fmt.Errorf("failed to store mention link: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// loadMentionLinks returns the stored mention links of a local post or reply, keyed by
+// lowercased handle
+func loadMentionLinks(ctx context.Context, objectID string) map[string]string {
+	hrefs := make(map[string]string)
+	rows, err := db.GetDB().Query(ctx, `SELECT handle, href FROM note_mention_links WHERE object_id = $1`, objectID)
+	if err != nil {
+		log.Printf("[Federation] Failed to load mention links of %s: %v", objectID, err)
+		return hrefs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var handle, href string
+		if err := rows.Scan(&handle, &href); err == nil {
+			hrefs[handle] = href
+		}
+	}
+	return hrefs
+}
+
+// ParseNoteTags splits a Note's tag field (an array or a single object) into
+// mentioned actor URIs and lowercased hashtag names.
+func ParseNoteTags(raw interface{}) (mentions []string, hashtags []string) {
+	var items []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = []interface{}{v}
+	}
+
+	for _, item := range items {
+		tag, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tagType, _ := tag["type"].(string)
+		switch tagType {
+		case "Mention":
+			if href, _ := tag["href"].(string); href != "" {
+				mentions = append(mentions, href)
+			}
+		case "Hashtag":
+			name, _ := tag["name"].(string)
+			name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+			if name != "" {
+				hashtags = append(hashtags, name)
+			}
+		}
+	}
+	return mentions, hashtags
+}
+
+// DeliverToMentioned delivers a Create(Note) to the inboxes of the remote actors it mentions
+func DeliverToMentioned(activity *Activity) {
+	note, ok := activityNote(activity)
+	if !ok {
+		return
+	}
+	for _, tag := range note.Tag {
+		if tag.Type != "Mention" || tag.Href == "" || isLocalActorURI(tag.Href) {
+			continue
+		}
+		if err := DeliverToActor(activity, tag.Href); err != nil {
+			log.Printf("[Federation] Failed to deliver mention to %s: %v", tag.Href, err)
+		}
+	}
+}
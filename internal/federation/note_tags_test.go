@@ -0,0 +1,104 @@
+package federation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderNoteContentLinksMentionsAndHashtags(t *testing.T) {
+	resolve := func(m NoteMention) string {
+		switch m.Handle() {
+		case "bob":
+			return "https://splitter.test/ap/users/bob"
+		case "alice@mastodon.test":
+			return "https://mastodon.test/users/alice"
+		}
+		return ""
+	}
+
+	html, tags := renderNoteContent("Hi @bob and @alice@mastodon.test, see #Go <3\n\n@nobody #go again", "https://splitter.test", resolve)
+
+	for _, want := range []string{
+		`<span class="h-card"><a href="https://splitter.test/ap/users/bob" class="u-url mention">@<span>bob</span></a></span>`,
+		`<a href="https://mastodon.test/users/alice" class="u-url mention">@<span>alice</span></a>`,
+		`<a href="https://splitter.test/tags/go" class="mention hashtag" rel="tag">#<span>Go</span></a>`,
+		`&lt;3</p><p>@nobody `,
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("expected content to contain %q, got %s", want, html)
+		}
+	}
+	if !strings.HasPrefix(html, "<p>") || !strings.HasSuffix(html, "</p>") {
+		t.Fatalf("expected paragraphs, got %s", html)
+	}
+
+	var mentions, hashtags int
+	for _, tag := range tags {
+		switch tag.Type {
+		case "Mention":
+			mentions++
+		case "Hashtag":
+			hashtags++
+			if tag.Name != "#go" || tag.Href != "https://splitter.test/tags/go" {
+				t.Fatalf("unexpected hashtag %+v", tag)
+			}
+		}
+	}
+	if mentions != 2 || hashtags != 1 {
+		t.Fatalf("expected 2 mentions and 1 hashtag, got %d and %d", mentions, hashtags)
+	}
+}
+
+func TestRenderNoteContentUsesStoredLinks(t *testing.T) {
+	// Only the stored links are used: an unknown mention is left as text, never looked up
+	html, tags := RenderNoteContent("cc @Alice@Mastodon.test and @stranger@elsewhere.test", map[string]string{
+		"alice@mastodon.test": "https://mastodon.test/users/alice",
+	})
+	if len(tags) != 1 || tags[0].Href != "https://mastodon.test/users/alice" || tags[0].Name != "@Alice@mastodon.test" {
+		t.Fatalf("expected one mention of alice, got %+v", tags)
+	}
+	if !strings.Contains(html, `<a href="https://mastodon.test/users/alice" class="u-url mention">@<span>Alice</span></a>`) {
+		t.Fatalf("expected alice to be linked, got %s", html)
+	}
+	if !strings.Contains(html, "@stranger@elsewhere.test") {
+		t.Fatalf("expected the unknown mention to stay text, got %s", html)
+	}
+
+	if _, tags := RenderNoteContent("hi @alice@mastodon.test", nil); len(tags) != 0 {
+		t.Fatalf("expected no mentions without stored links, got %+v", tags)
+	}
+}
+
+func TestRenderNoteContentIgnoresEntitiesAndEmails(t *testing.T) {
+	html, tags := renderNoteContent(`Tom & "Jerry" mail me at tom@example.test`, "https://splitter.test", func(NoteMention) string {
+		return "https://example.test/users/x"
+	})
+	if len(tags) != 0 {
+		t.Fatalf("expected no tags, got %+v", tags)
+	}
+	if strings.Contains(html, "hashtag") || strings.Contains(html, "mention") {
+		t.Fatalf("expected no links, got %s", html)
+	}
+}
+
+func TestParseNoteTags(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{"type": "Mention", "href": "https://splitter.test/ap/users/bob", "name": "@bob@splitter.test"},
+		map[string]interface{}{"type": "Hashtag", "href": "https://mastodon.test/tags/fediverse", "name": "#Fediverse"},
+		map[string]interface{}{"type": "Emoji", "name": ":blob:"},
+	}
+
+	mentions, hashtags := ParseNoteTags(raw)
+	if len(mentions) != 1 || mentions[0] != "https://splitter.test/ap/users/bob" {
+		t.Fatalf("unexpected mentions %v", mentions)
+	}
+	if len(hashtags) != 1 || hashtags[0] != "fediverse" {
+		t.Fatalf("unexpected hashtags %v", hashtags)
+	}
+
+	// GoToSocial may send a single object instead of an array
+	mentions, _ = ParseNoteTags(map[string]interface{}{"type": "Mention", "href": "https://gts.test/users/carol"})
+	if len(mentions) != 1 {
+		t.Fatalf("expected single tag object to be parsed, got %v", mentions)
+	}
+}
@@ -0,0 +1,92 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"splitter/internal/models"
+)
+
+// ErrPrekeysUnsupported is returned when a remote actor does not advertise prekey bundles
+var ErrPrekeysUnsupported = errors.New("remote actor does not publish prekey bundles")
+
+// maxPrekeyResponseBytes bounds the bundle document read from a remote server
+const maxPrekeyResponseBytes = 1 << 20
+
+// ClaimRemotePrekeyBundles claims prekey bundles of a remote actor from the prekeys
+// endpoint of their actor document. The request is signed as claimantActorURI and names
+// the claiming device, so the remote server hands each of our devices its own one-time
+// prekeys. The DID of the returned bundles is left for the caller to set.
+func ClaimRemotePrekeyBundles(ctx context.Context, actorURI, claimantActorURI, deviceID string) ([]*models.PrekeyBundle, error) {
+	actor, err := fetchActor(actorURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch actor %s: %w", actorURI, err)
+	}
+	prekeysURL := actor.PrekeysURL
+	if prekeysURL == "" {
+		return nil, ErrPrekeysUnsupported
+	}
+	// Only the actor's own server may hand out its keys
+	domain := extractDomainFromURI(actorURI)
+	if !isHTTPURI(prekeysURL) || extractDomainFromURI(prekeysURL) != domain {
+		return nil, fmt.Errorf("prekeys endpoint %s is not on %s", prekeysURL, domain)
+	}
+	if IsDomainBlocked(ctx, domain) {
+		return nil, fmt.Errorf("%s: %w", domain, ErrFetchDomainBlocked)
+	}
+
+	body, err := json.Marshal(map[string]string{"device_id": deviceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode prekey claim: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", prekeysURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	privKey, keyID := signingKeyForActor(ctx, claimantActorURI)
+	if privKey == nil {
+		return nil, fmt.Errorf("no signing key for %s", claimantActorURI)
+	}
+	if err := SignRequest(req, privKey, keyID); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("prekey claim returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var doc struct {
+		Bundles []*models.PrekeyBundle `json:"bundles"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPrekeyResponseBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode prekey bundles: %w", err)
+	}
+
+	bundles := make([]*models.PrekeyBundle, 0, len(doc.Bundles))
+	for _, bundle := range doc.Bundles {
+		if bundle == nil || bundle.DeviceID == "" || bundle.IdentityKey == "" ||
+			bundle.SignedPrekey == nil || bundle.SignedPrekey.PublicKey == "" || bundle.SignedPrekey.Signature == "" {
+			continue
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles, nil
+}
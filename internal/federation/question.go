@@ -0,0 +1,162 @@
+package federation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuestionPoll is the poll carried by a Question: option names with their vote counts
+type QuestionPoll struct {
+	Options     []string
+	Counts      []int
+	Multiple    bool
+	EndTime     *time.Time
+	ClosedAt    *time.Time
+	VotersCount int
+}
+
+// Question is a Note with a poll attached (ActivityStreams Question)
+type Question struct {
+	Note
+	OneOf       []QuestionOption `json:"oneOf,omitempty"`
+	AnyOf       []QuestionOption `json:"anyOf,omitempty"`
+	EndTime     string           `json:"endTime,omitempty"`
+	Closed      string           `json:"closed,omitempty"`
+	VotersCount int              `json:"votersCount"`
+}
+
+// QuestionOption is one answer of a Question; replies.totalItems is its vote count
+type QuestionOption struct {
+	Type    string          `json:"type"`
+	Name    string          `json:"name"`
+	Replies QuestionReplies `json:"replies"`
+}
+
+// QuestionReplies is the vote counter of a QuestionOption
+type QuestionReplies struct {
+	Type       string `json:"type"`
+	TotalItems int    `json:"totalItems"`
+}
+
+// NewQuestion turns a Note into a Question carrying poll
+func NewQuestion(note Note, poll QuestionPoll) Question {
+	note.Type = "Question"
+	question := Question{Note: note, VotersCount: poll.VotersCount}
+
+	options := make([]QuestionOption, len(poll.Options))
+	for i, name := range poll.Options {
+		count := 0
+		if i < len(poll.Counts) {
+			count = poll.Counts[i]
+		}
+		options[i] = QuestionOption{
+			Type:    "Note",
+			Name:    name,
+			Replies: QuestionReplies{Type: "Collection", TotalItems: count},
+		}
+	}
+	if poll.Multiple {
+		question.AnyOf = options
+	} else {
+		question.OneOf = options
+	}
+
+	if poll.EndTime != nil {
+		question.EndTime = poll.EndTime.UTC().Format(time.RFC3339)
+	}
+	if poll.ClosedAt != nil {
+		question.Closed = poll.ClosedAt.UTC().Format(time.RFC3339)
+	}
+	return question
+}
+
+// AsQuestion replaces the Note of a Create or Update activity with a Question carrying poll
+func AsQuestion(activity *Activity, poll QuestionPoll) {
+	if note, ok := activity.Object.(Note); ok {
+		activity.Object = NewQuestion(note, poll)
+	}
+}
+
+// ParseQuestion reads the poll of an inbound Question object
+func ParseQuestion(object map[string]interface{}) (QuestionPoll, bool) {
+	var poll QuestionPoll
+	choices, ok := object["oneOf"].([]interface{})
+	if !ok {
+		choices, ok = object["anyOf"].([]interface{})
+		poll.Multiple = ok
+	}
+	if !ok {
+		return poll, false
+	}
+
+	for _, choice := range choices {
+		option, ok := choice.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := option["name"].(string)
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		count := 0
+		if replies, ok := option["replies"].(map[string]interface{}); ok {
+			if total, ok := replies["totalItems"].(float64); ok && total > 0 {
+				count = int(total)
+			}
+		}
+		poll.Options = append(poll.Options, name)
+		poll.Counts = append(poll.Counts, count)
+	}
+	if len(poll.Options) == 0 {
+		return poll, false
+	}
+
+	if voters, ok := object["votersCount"].(float64); ok && voters > 0 {
+		poll.VotersCount = int(voters)
+	}
+	if endTime, _ := object["endTime"].(string); endTime != "" {
+		if t, err := time.Parse(time.RFC3339, endTime); err == nil {
+			poll.EndTime = &t
+		}
+	}
+	// closed is a timestamp, though some servers send true
+	switch closed := object["closed"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, closed); err == nil {
+			poll.ClosedAt = &t
+		}
+	case bool:
+		if closed {
+			now := time.Now().UTC()
+			poll.ClosedAt = &now
+		}
+	}
+	return poll, true
+}
+
+// BuildPollVoteActivity creates the Create(Note) that casts a vote on a remote Question.
+// The vote is a Note named after the chosen option, replying to the Question and
+// addressed only to its author.
+func BuildPollVoteActivity(actorURI, questionURI, questionAuthorURI, choice string) *Activity {
+	now := time.Now().UTC()
+	noteID := fmt.Sprintf("%s#votes/%d", actorURI, now.UnixNano())
+	note := Note{
+		ID:           noteID,
+		Type:         "Note",
+		AttributedTo: actorURI,
+		Name:         choice,
+		InReplyTo:    questionURI,
+		Published:    now.Format(time.RFC3339),
+		To:           []string{questionAuthorURI},
+	}
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      noteID + "/activity",
+		Type:    "Create",
+		Actor:   actorURI,
+		Object:  note,
+		To:      []string{questionAuthorURI},
+	}
+}
@@ -0,0 +1,110 @@
+package federation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewQuestionRoundTrip(t *testing.T) {
+	end := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		multiple bool
+		field    string
+	}{
+		{"single choice", false, "oneOf"},
+		{"multiple choice", true, "anyOf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := BuildCreateNoteActivity("https://local.test/users/alice", "p1", "Lunch?", time.Now(), "", "", "", false)
+			AsQuestion(activity, QuestionPoll{
+				Options:     []string{"Pizza", "Sushi"},
+				Counts:      []int{3, 1},
+				Multiple:    tt.multiple,
+				EndTime:     &end,
+				VotersCount: 4,
+			})
+
+			data, err := json.Marshal(activity.Object)
+			if err != nil {
+				t.Fatalf("marshal failed: %v", err)
+			}
+			var object map[string]interface{}
+			if err := json.Unmarshal(data, &object); err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if object["type"] != "Question" {
+				t.Fatalf("expected Question, got %v", object["type"])
+			}
+			if _, ok := object[tt.field]; !ok {
+				t.Fatalf("expected %s in %s", tt.field, data)
+			}
+
+			poll, ok := ParseQuestion(object)
+			if !ok {
+				t.Fatalf("expected the Question to parse")
+			}
+			if poll.Multiple != tt.multiple || len(poll.Options) != 2 || poll.Options[1] != "Sushi" || poll.Counts[0] != 3 {
+				t.Fatalf("unexpected poll %+v", poll)
+			}
+			if poll.VotersCount != 4 || poll.EndTime == nil || !poll.EndTime.Equal(end) || poll.ClosedAt != nil {
+				t.Fatalf("unexpected poll metadata %+v", poll)
+			}
+		})
+	}
+}
+
+func TestParseQuestionClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		closed interface{}
+		want   bool
+	}{
+		{"timestamp", "2026-01-02T03:04:05Z", true},
+		{"boolean true", true, true},
+		{"boolean false", false, false},
+		{"absent", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := map[string]interface{}{
+				"oneOf": []interface{}{map[string]interface{}{"name": "Yes"}},
+			}
+			if tt.closed != nil {
+				object["closed"] = tt.closed
+			}
+			poll, ok := ParseQuestion(object)
+			if !ok {
+				t.Fatalf("expected the Question to parse")
+			}
+			if (poll.ClosedAt != nil) != tt.want {
+				t.Fatalf("expected closed=%v, got %v", tt.want, poll.ClosedAt)
+			}
+		})
+	}
+}
+
+func TestParseQuestionWithoutOptions(t *testing.T) {
+	if _, ok := ParseQuestion(map[string]interface{}{"type": "Question"}); ok {
+		t.Fatalf("expected a Question without options to be rejected")
+	}
+}
+
+func TestBuildPollVoteActivity(t *testing.T) {
+	activity := BuildPollVoteActivity("https://local.test/users/bob", "https://remote.test/q/1", "https://remote.test/users/carol", "Sushi")
+
+	note, ok := activity.Object.(Note)
+	if !ok {
+		t.Fatalf("expected a Note object, got %T", activity.Object)
+	}
+	if activity.Type != "Create" || note.Name != "Sushi" || note.InReplyTo != "https://remote.test/q/1" {
+		t.Fatalf("unexpected vote %+v", note)
+	}
+	if len(activity.To) != 1 || activity.To[0] != "https://remote.test/users/carol" || len(note.CC) != 0 {
+		t.Fatalf("vote should only be addressed to the poll author: %+v", activity)
+	}
+}
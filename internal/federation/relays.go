@@ -0,0 +1,342 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"splitter/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Relay subscription states
+const (
+	RelayStatusPending      = "pending"
+	RelayStatusAccepted     = "accepted"
+	RelayStatusRejected     = "rejected"
+	RelayStatusUnsubscribed = "unsubscribed"
+)
+
+// Relay traffic directions
+const (
+	relayTrafficReceived  = "received"
+	relayTrafficForwarded = "forwarded"
+)
+
+// publicCollection is the ActivityStreams public audience. Mastodon-style relays are
+// followed through it when they do not publish an actor document.
+const publicCollection = "https://www.w3.org/ns/activitystreams#Public"
+
+// Relay is a relays row together with its traffic counters
+type Relay struct {
+	ID              string     `json:"id"`
+	InboxURL        string     `json:"inbox_url"`
+	ActorURI        string     `json:"actor_uri,omitempty"`
+	Domain          string     `json:"domain"`
+	Status          string     `json:"status"`
+	FollowID        string     `json:"follow_activity_id"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	AcceptedAt      *time.Time `json:"accepted_at,omitempty"`
+	UnsubscribedAt  *time.Time `json:"unsubscribed_at,omitempty"`
+	ReceivedCount   int64      `json:"received_count"`
+	ForwardedCount  int64      `json:"forwarded_count"`
+	LastReceivedAt  *time.Time `json:"last_received_at,omitempty"`
+	LastForwardedAt *time.Time `json:"last_forwarded_at,omitempty"`
+}
+
+// EnsureRelaysSchema creates the relays and relay_traffic tables from migration 035 if missing
+func EnsureRelaysSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS relays (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			inbox_url TEXT NOT NULL UNIQUE,
+			actor_uri TEXT,
+			domain TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			follow_activity_id TEXT NOT NULL,
+			last_error TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			accepted_at TIMESTAMPTZ,
+			unsubscribed_at TIMESTAMPTZ
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_relays_actor_uri ON relays (actor_uri)`,
+		`CREATE TABLE IF NOT EXISTS relay_traffic (
+			relay_id UUID NOT NULL REFERENCES relays(id) ON DELETE CASCADE,
+			direction TEXT NOT NULL,
+			activity_count BIGINT NOT NULL DEFAULT 0,
+			last_activity_at TIMESTAMPTZ,
+			PRIMARY KEY (relay_id, direction)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.GetDB().Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to ensure relay schema: %w", err)
+		}
+	}
+	return nil
+}
+
+const relaySelect = `
+	SELECT r.id::text, r.inbox_url, COALESCE(r.actor_uri, ''), r.domain, r.status, r.follow_activity_id,
+	       COALESCE(r.last_error, ''), r.created_at, r.accepted_at, r.unsubscribed_at,
+	       COALESCE(rx.activity_count, 0), COALESCE(tx.activity_count, 0), rx.last_activity_at, tx.last_activity_at
+	FROM relays r
+	LEFT JOIN relay_traffic rx ON rx.relay_id = r.id AND rx.direction = 'received'
+	LEFT JOIN relay_traffic tx ON tx.relay_id = r.id AND tx.direction = 'forwarded'`
+
+func scanRelay(row pgx.Row) (*Relay, error) {
+	var r Relay
+	err := row.Scan(&r.ID, &r.InboxURL, &r.ActorURI, &r.Domain, &r.Status, &r.FollowID,
+		&r.LastError, &r.CreatedAt, &r.AcceptedAt, &r.UnsubscribedAt,
+		&r.ReceivedCount, &r.ForwardedCount, &r.LastReceivedAt, &r.LastForwardedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListRelays returns every relay subscription, newest first
+func ListRelays(ctx context.Context) ([]*Relay, error) {
+	rows, err := db.GetDB().Query(ctx, relaySelect+` ORDER BY r.created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relays: %w", err)
+	}
+	defer rows.Close()
+
+	relays := []*Relay{}
+	for rows.Next() {
+		relay, err := scanRelay(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan relay: %w", err)
+		}
+		relays = append(relays, relay)
+	}
+	return relays, nil
+}
+
+// GetRelay returns a relay subscription by ID
+func GetRelay(ctx context.Context, id string) (*Relay, error) {
+	relay, err := scanRelay(db.GetDB().QueryRow(ctx, relaySelect+` WHERE r.id::text = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("relay not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relay: %w", err)
+	}
+	return relay, nil
+}
+
+// SubscribeRelay follows a relay as the instance actor. relayURL is either the relay's
+// actor (LitePub) or its inbox (Mastodon-style). Subscribing again to a known relay
+// sends a fresh Follow; the subscription stays pending until the relay accepts it.
+func SubscribeRelay(ctx context.Context, relayURL string) (*Relay, error) {
+	relayURL = strings.TrimSpace(relayURL)
+	if !isHTTPURI(relayURL) {
+		return nil, fmt.Errorf("relay URL must be an http(s) URL")
+	}
+	if isLocalActorURI(relayURL) {
+		return nil, fmt.Errorf("cannot subscribe to a local URL")
+	}
+	domain := extractDomainFromURI(relayURL)
+	if IsDomainBlocked(ctx, domain) {
+		return nil, fmt.Errorf("relay domain %s is blocked", domain)
+	}
+
+	actorURI, inboxURL := "", relayURL
+	if actor, err := fetchActor(relayURL); err == nil && actor.InboxURL != "" {
+		actorURI, inboxURL = actor.ActorURI, actor.InboxURL
+		if actorURI == "" {
+			actorURI = relayURL
+		}
+	}
+
+	follow := buildRelayFollow(actorURI)
+	var id string
+	err := db.GetDB().QueryRow(ctx,
+		`INSERT INTO relays (inbox_url, actor_uri, domain, follow_activity_id)
+		 VALUES ($1, NULLIF($2, ''), $3, $4)
+		 ON CONFLICT (inbox_url) DO UPDATE
+		 SET actor_uri = COALESCE(EXCLUDED.actor_uri, relays.actor_uri),
+		     status = 'pending', follow_activity_id = EXCLUDED.follow_activity_id,
+		     last_error = NULL, unsubscribed_at = NULL
+		 RETURNING id::text`,
+		inboxURL, actorURI, domain, follow.ID,
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store relay: %w", err)
+	}
+
+	if err := DeliverActivity(follow, inboxURL); err != nil {
+		setRelayError(ctx, id, err.Error())
+		return nil, fmt.Errorf("failed to send follow to relay: %w", err)
+	}
+
+	log.Printf("[Federation] Subscribed to relay %s", inboxURL)
+	return GetRelay(ctx, id)
+}
+
+// UnsubscribeRelay undoes the instance actor's Follow of a relay. The row and its
+// counters are kept; subscribing again reuses them.
+func UnsubscribeRelay(ctx context.Context, id string) (*Relay, error) {
+	relay, err := GetRelay(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if relay.Status == RelayStatusUnsubscribed {
+		return relay, nil
+	}
+
+	if _, err := db.GetDB().Exec(ctx,
+		`UPDATE relays SET status = 'unsubscribed', unsubscribed_at = now() WHERE id = $1`,
+		relay.ID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to unsubscribe relay: %w", err)
+	}
+
+	// A relay that never accepted has nothing to undo, but telling it is harmless
+	undo := buildRelayUndo(relay)
+	go func() {
+		if err := DeliverActivity(undo, relay.InboxURL); err != nil {
+			log.Printf("[Federation] Failed to send Undo to relay %s: %v", relay.InboxURL, err)
+		}
+	}()
+
+	return GetRelay(ctx, id)
+}
+
+// buildRelayFollow builds the instance actor's Follow of a relay. LitePub relays are
+// followed directly; without an actor the Follow targets the public collection.
+func buildRelayFollow(relayActorURI string) *Activity {
+	object := relayActorURI
+	if object == "" {
+		object = publicCollection
+	}
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/relay-follow-%d", InstanceBaseURL(), time.Now().UnixNano()),
+		Type:    "Follow",
+		Actor:   InstanceActorURI(),
+		Object:  object,
+		To:      []string{object},
+	}
+}
+
+// buildRelayUndo builds the Undo of the Follow recorded for a relay
+func buildRelayUndo(relay *Relay) *Activity {
+	object := relay.ActorURI
+	if object == "" {
+		object = publicCollection
+	}
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/relay-undo-%d", InstanceBaseURL(), time.Now().UnixNano()),
+		Type:    "Undo",
+		Actor:   InstanceActorURI(),
+		Object: map[string]interface{}{
+			"id":     relay.FollowID,
+			"type":   "Follow",
+			"actor":  InstanceActorURI(),
+			"object": object,
+		},
+		To: []string{object},
+	}
+}
+
+// HandleRelayResponse applies an Accept or Reject from a relay to the pending subscription
+// it answers. Once the relay's actor is known only that actor may answer; before then the
+// answer must name our Follow and come from the relay's domain. Returns false when the
+// activity does not concern a relay.
+func HandleRelayResponse(ctx context.Context, actorURI, followID string, accepted bool) (bool, error) {
+	status := RelayStatusRejected
+	if accepted {
+		status = RelayStatusAccepted
+	}
+	tag, err := db.GetDB().Exec(ctx,
+		`UPDATE relays
+		 SET status = $3,
+		     actor_uri = COALESCE(actor_uri, $1),
+		     accepted_at = CASE WHEN $3 = 'accepted' THEN now() ELSE accepted_at END,
+		     last_error = NULL
+		 WHERE status = 'pending'
+		   AND (actor_uri = $1 OR (actor_uri IS NULL AND follow_activity_id = $2 AND $2 <> '' AND domain = $4))`,
+		actorURI, followID, status, extractDomainFromURI(actorURI),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update relay subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	log.Printf("[Federation] Relay %s %s our subscription", actorURI, status)
+	return true, nil
+}
+
+// RelayForActor returns the subscription of a relay actor, or nil when actorURI is not a relay
+func RelayForActor(ctx context.Context, actorURI string) *Relay {
+	if actorURI == "" {
+		return nil
+	}
+	relay, err := scanRelay(db.GetDB().QueryRow(ctx, relaySelect+` WHERE r.actor_uri = $1 ORDER BY r.created_at DESC LIMIT 1`, actorURI))
+	if err != nil {
+		return nil
+	}
+	return relay
+}
+
+// RecordRelayReceived counts an activity received from a relay
+func RecordRelayReceived(ctx context.Context, relayID string) {
+	recordRelayTraffic(ctx, relayID, relayTrafficReceived)
+}
+
+func recordRelayTraffic(ctx context.Context, relayID, direction string) {
+	_, err := db.GetDB().Exec(ctx,
+		`INSERT INTO relay_traffic (relay_id, direction, activity_count, last_activity_at)
+		 VALUES ($1, $2, 1, now())
+		 ON CONFLICT (relay_id, direction) DO UPDATE
+		 SET activity_count = relay_traffic.activity_count + 1, last_activity_at = now()`,
+		relayID, direction,
+	)
+	if err != nil {
+		log.Printf("[Federation] Failed to record relay traffic for %s: %v", relayID, err)
+	}
+}
+
+func setRelayError(ctx context.Context, relayID, lastError string) {
+	if _, err := db.GetDB().Exec(ctx, `UPDATE relays SET last_error = $2 WHERE id = $1`, relayID, lastError); err != nil {
+		log.Printf("[Federation] Failed to record relay error for %s: %v", relayID, err)
+	}
+}
+
+// DeliverToRelays forwards an activity about a local public post to every accepted relay
+func DeliverToRelays(activity *Activity) {
+	ctx := context.Background()
+	rows, err := db.GetDB().Query(ctx, `SELECT id::text, inbox_url FROM relays WHERE status = 'accepted'`)
+	if err != nil {
+		log.Printf("[Federation] Failed to load relays: %v", err)
+		return
+	}
+	type target struct{ id, inbox string }
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.inbox); err == nil {
+			targets = append(targets, t)
+		}
+	}
+	rows.Close()
+
+	for _, t := range targets {
+		go func(t target) {
+			if err := DeliverActivity(activity, t.inbox); err != nil {
+				log.Printf("[Federation] Failed to forward %s to relay %s: %v", activity.Type, t.inbox, err)
+				setRelayError(context.Background(), t.id, err.Error())
+				return
+			}
+			recordRelayTraffic(context.Background(), t.id, relayTrafficForwarded)
+		}(t)
+	}
+}
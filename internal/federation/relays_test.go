@@ -0,0 +1,34 @@
+package federation
+
+import "testing"
+
+func TestBuildRelayFollow(t *testing.T) {
+	tests := []struct {
+		name       string
+		relayActor string
+		wantObject string
+	}{
+		{"litepub relay is followed directly", "https://relay.test/actor", "https://relay.test/actor"},
+		{"mastodon relay is followed through the public collection", "", publicCollection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			follow := buildRelayFollow(tt.relayActor)
+			if follow.Type != "Follow" || follow.Actor != InstanceActorURI() {
+				t.Fatalf("expected a Follow from the instance actor, got %s from %s", follow.Type, follow.Actor)
+			}
+			if follow.Object != tt.wantObject {
+				t.Fatalf("expected object %s, got %v", tt.wantObject, follow.Object)
+			}
+
+			undo := buildRelayUndo(&Relay{ActorURI: tt.relayActor, FollowID: follow.ID})
+			inner, ok := undo.Object.(map[string]interface{})
+			if !ok || undo.Type != "Undo" {
+				t.Fatalf("expected an Undo wrapping the Follow, got %s %T", undo.Type, undo.Object)
+			}
+			if inner["id"] != follow.ID || inner["object"] != tt.wantObject {
+				t.Fatalf("undo does not reference the original follow: %v", inner)
+			}
+		})
+	}
+}
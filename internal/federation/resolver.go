@@ -3,15 +3,19 @@ package federation
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"splitter/internal/db"
+	"splitter/internal/sanitize"
 )
 
 // RemoteActor represents a cached remote user from another instance
@@ -21,22 +25,35 @@ type RemoteActor struct {
 	Username            string    `json:"username"`
 	Domain              string    `json:"domain"`
 	InboxURL            string    `json:"inbox_url"`
+	SharedInboxURL      string    `json:"shared_inbox_url,omitempty"`
 	OutboxURL           string    `json:"outbox_url"`
 	PublicKeyPEM        string    `json:"public_key_pem"`
 	EncryptionPublicKey string    `json:"encryption_public_key"`
 	DisplayName         string    `json:"display_name"`
 	AvatarURL           string    `json:"avatar_url"`
+	AlsoKnownAs         []string  `json:"also_known_as,omitempty"` // Only set on live fetches, not cached
+	PrekeysURL          string    `json:"prekeys_url,omitempty"`   // Only set on live fetches, not cached
 	LastFetchedAt       time.Time `json:"last_fetched_at"`
 	CreatedAt           time.Time `json:"created_at"`
 }
 
+// RemoteNodeInfo is the subset of a peer's NodeInfo document we record
+type RemoteNodeInfo struct {
+	SoftwareName      string
+	SoftwareVersion   string
+	OpenRegistrations bool
+}
+
 // RemoteNote represents a fetched remote ActivityPub Note used for thread context.
 type RemoteNote struct {
 	ID           string
 	AttributedTo string
 	Content      string
 	InReplyTo    string
+	Replies      string // URI of the Note's replies collection, if offered
+	Context      string // URI of the conversation collection (context, or conversation when dereferenceable)
 	PublishedAt  time.Time
+	Public       bool // Addressed to the public collection
 	Deleted      bool
 }
 
@@ -93,17 +110,42 @@ func ResolveRemoteUser(handle string) (*RemoteActor, error) {
 
 	// 2. WebFinger lookup
 	baseURL := resolveInstanceURL(domain)
+	actorURI, err := webfingerActorURI(baseURL, username, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Fetch Actor JSON
+	log.Printf("[Federation] Fetching actor: %s", actorURI)
+	actor, err = fetchActor(actorURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch actor: %w", err)
+	}
+	actor.Domain = domain
+
+	// 4. Cache
+	err = upsertRemoteActor(ctx, actor)
+	if err != nil {
+		log.Printf("[Federation] Warning: failed to cache actor: %v", err)
+	}
+	RecordKnownInstance(ctx, domain, baseURL, "")
+
+	return actor, nil
+}
+
+// webfingerActorURI looks up acct:username@domain on baseURL and returns its ActivityPub actor link
+func webfingerActorURI(baseURL, username, domain string) (string, error) {
 	webfingerURL := fmt.Sprintf("%s/.well-known/webfinger?resource=acct:%s@%s", baseURL, username, domain)
 
 	log.Printf("[Federation] WebFinger lookup: %s", webfingerURL)
 	resp, err := httpGet(webfingerURL)
 	if err != nil {
-		return nil, fmt.Errorf("webfinger lookup failed: %w", err)
+		return "", fmt.Errorf("webfinger lookup failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("webfinger returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("webfinger returned status %d", resp.StatusCode)
 	}
 
 	var jrd struct {
@@ -115,45 +157,62 @@ func ResolveRemoteUser(handle string) (*RemoteActor, error) {
 		} `json:"links"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&jrd); err != nil {
-		return nil, fmt.Errorf("failed to decode webfinger response: %w", err)
+		return "", fmt.Errorf("failed to decode webfinger response: %w", err)
 	}
 
 	// Find actor link
-	var actorURI string
 	for _, link := range jrd.Links {
 		if link.Rel == "self" && link.Type == "application/activity+json" {
-			actorURI = link.Href
-			break
+			return link.Href, nil
 		}
 	}
-	if actorURI == "" {
-		return nil, fmt.Errorf("no actor link found in webfinger response")
-	}
+	return "", fmt.Errorf("no actor link found in webfinger response")
+}
 
-	// 3. Fetch Actor JSON
-	log.Printf("[Federation] Fetching actor: %s", actorURI)
-	actor, err = fetchActor(actorURI)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch actor: %w", err)
+type instanceActorEntry struct {
+	actorURI  string
+	fetchedAt time.Time
+}
+
+// instanceActors caches host → instance actor URI for an hour
+var (
+	instanceActorsMu sync.Mutex
+	instanceActors   = make(map[string]instanceActorEntry)
+)
+
+// ResolveInstanceActor returns the URI of the instance actor of host, as advertised by the
+// host's WebFinger for acct:host@host. Only actors on host itself are accepted.
+func ResolveInstanceActor(host string) (string, error) {
+	instanceActorsMu.Lock()
+	entry, ok := instanceActors[host]
+	instanceActorsMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < time.Hour {
+		return entry.actorURI, nil
 	}
-	actor.Domain = domain
 
-	// 4. Cache
-	err = upsertRemoteActor(ctx, actor)
+	actorURI, err := webfingerActorURI(resolveInstanceURL(host), host, host)
 	if err != nil {
-		log.Printf("[Federation] Warning: failed to cache actor: %v", err)
+		return "", fmt.Errorf("failed to resolve instance actor of %s: %w", host, err)
+	}
+	if extractDomainFromURI(actorURI) != host {
+		return "", fmt.Errorf("instance actor %s is not on %s", actorURI, host)
 	}
 
-	return actor, nil
+	instanceActorsMu.Lock()
+	if len(instanceActors) >= maxVerifiedKeys {
+		instanceActors = make(map[string]instanceActorEntry)
+	}
+	instanceActors[host] = instanceActorEntry{actorURI: actorURI, fetchedAt: time.Now()}
+	instanceActorsMu.Unlock()
+	return actorURI, nil
 }
 
 // fetchActor fetches and parses an ActivityPub Actor document
 func fetchActor(actorURI string) (*RemoteActor, error) {
-	req, err := http.NewRequest("GET", actorURI, nil)
+	req, err := newFetchRequest(actorURI, "application/activity+json")
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Accept", "application/activity+json")
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -168,14 +227,19 @@ func fetchActor(actorURI string) (*RemoteActor, error) {
 	}
 
 	var actorJSON struct {
-		ID                  string `json:"id"`
-		Type                string `json:"type"`
-		PreferredUsername   string `json:"preferredUsername"`
-		Name                string `json:"name"`
-		Inbox               string `json:"inbox"`
-		Outbox              string `json:"outbox"`
-		EncryptionPublicKey string `json:"encryption_public_key"`
-		Icon                *struct {
+		ID                  string      `json:"id"`
+		Type                string      `json:"type"`
+		PreferredUsername   string      `json:"preferredUsername"`
+		Name                string      `json:"name"`
+		Inbox               string      `json:"inbox"`
+		Outbox              string      `json:"outbox"`
+		EncryptionPublicKey string      `json:"encryption_public_key"`
+		AlsoKnownAs         interface{} `json:"alsoKnownAs"`
+		Prekeys             string      `json:"prekeys"`
+		Endpoints           *struct {
+			SharedInbox string `json:"sharedInbox"`
+		} `json:"endpoints"`
+		Icon *struct {
 			URL string `json:"url"`
 		} `json:"icon"`
 		PublicKey *struct {
@@ -195,7 +259,8 @@ func fetchActor(actorURI string) (*RemoteActor, error) {
 		InboxURL:            actorJSON.Inbox,
 		OutboxURL:           actorJSON.Outbox,
 		EncryptionPublicKey: actorJSON.EncryptionPublicKey,
-		DisplayName:         actorJSON.Name,
+		DisplayName:         sanitize.Text(actorJSON.Name),
+		PrekeysURL:          actorJSON.Prekeys,
 	}
 	if actorJSON.PublicKey != nil {
 		actor.PublicKeyPEM = actorJSON.PublicKey.PublicKeyPEM
@@ -203,10 +268,146 @@ func fetchActor(actorURI string) (*RemoteActor, error) {
 	if actorJSON.Icon != nil {
 		actor.AvatarURL = actorJSON.Icon.URL
 	}
+	if actorJSON.Endpoints != nil {
+		actor.SharedInboxURL = actorJSON.Endpoints.SharedInbox
+	}
+	switch aliases := actorJSON.AlsoKnownAs.(type) {
+	case string:
+		actor.AlsoKnownAs = []string{aliases}
+	case []interface{}:
+		for _, alias := range aliases {
+			if aliasURI, ok := alias.(string); ok && aliasURI != "" {
+				actor.AlsoKnownAs = append(actor.AlsoKnownAs, aliasURI)
+			}
+		}
+	}
 
 	return actor, nil
 }
 
+// FetchActorAliases returns the alsoKnownAs URIs a remote actor currently advertises.
+// Always fetched live so Move activities are checked against fresh data.
+func FetchActorAliases(actorURI string) ([]string, error) {
+	actor, err := fetchActor(actorURI)
+	if err != nil {
+		return nil, err
+	}
+	return actor.AlsoKnownAs, nil
+}
+
+// ParseMove returns the account a Move activity moves away from and the account it moves to.
+// Accounts can only announce their own moves, so the origin must be the activity's actor.
+func ParseMove(activity map[string]interface{}) (originURI, targetURI string, err error) {
+	actorURI, _ := activity["actor"].(string)
+	originURI, _ = activity["object"].(string)
+	targetURI, _ = activity["target"].(string)
+
+	if originURI == "" {
+		originURI = actorURI
+	}
+	if actorURI == "" || originURI != actorURI || strings.TrimSpace(targetURI) == "" {
+		return "", "", PermanentInboxError("invalid Move from %s", actorURI)
+	}
+	return originURI, targetURI, nil
+}
+
+// VerifyMoveTarget checks that a remote move target lists the origin in its alsoKnownAs,
+// which is how the target account confirms the move
+func VerifyMoveTarget(targetURI, originURI string) error {
+	aliases, err := FetchActorAliases(targetURI)
+	if err != nil {
+		return fmt.Errorf("failed to fetch move target %s: %w", targetURI, err)
+	}
+	for _, alias := range aliases {
+		if alias == originURI {
+			return nil
+		}
+	}
+	return PermanentInboxError("move target %s does not list %s as an alias", targetURI, originURI)
+}
+
+// FetchActorPublicKeyPEM fetches an actor document directly and returns its publicKeyPem.
+// Used for key owners that are not users (e.g. instance actors) and to refresh stale cached keys.
+func FetchActorPublicKeyPEM(actorURI string) (string, error) {
+	actor, err := fetchActor(actorURI)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(actor.PublicKeyPEM) == "" {
+		return "", fmt.Errorf("actor %s has no public key", actorURI)
+	}
+	return actor.PublicKeyPEM, nil
+}
+
+// FetchPublicKey dereferences an HTTP Signature keyId and returns the key owner and PEM.
+// Handles both keyIds that are actor fragments (Mastodon: actor#main-key) and keys
+// served as their own documents (GoToSocial: actor/main-key).
+func FetchPublicKey(keyID string) (owner string, publicKeyPEM string, err error) {
+	req, err := newFetchRequest(keyID, "application/activity+json")
+	if err != nil {
+		return "", "", err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("key fetch returned %d", resp.StatusCode)
+	}
+
+	var keyJSON struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPEM string `json:"publicKeyPem"`
+		PublicKey    *struct {
+			ID           string `json:"id"`
+			Owner        string `json:"owner"`
+			PublicKeyPEM string `json:"publicKeyPem"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&keyJSON); err != nil {
+		return "", "", fmt.Errorf("failed to decode key document: %w", err)
+	}
+
+	switch {
+	case keyJSON.PublicKey != nil && keyJSON.PublicKey.PublicKeyPEM != "":
+		// Actor document embedding its key
+		owner = keyJSON.PublicKey.Owner
+		if owner == "" {
+			owner = keyJSON.ID
+		}
+		publicKeyPEM = keyJSON.PublicKey.PublicKeyPEM
+	case keyJSON.PublicKeyPEM != "":
+		// Standalone key document
+		owner = keyJSON.Owner
+		publicKeyPEM = keyJSON.PublicKeyPEM
+	default:
+		return "", "", fmt.Errorf("no public key at %s", keyID)
+	}
+	if owner == "" {
+		return "", "", fmt.Errorf("key %s has no owner", keyID)
+	}
+	if extractDomainFromURI(owner) != extractDomainFromURI(keyID) {
+		return "", "", fmt.Errorf("key %s is owned by foreign actor %s", keyID, owner)
+	}
+	return owner, strings.TrimSpace(publicKeyPEM), nil
+}
+
+// RefreshRemoteActorKey updates the cached public key of a remote actor
+func RefreshRemoteActorKey(ctx context.Context, actorURI, publicKeyPEM string) {
+	_, err := db.GetDB().Exec(ctx,
+		`UPDATE remote_actors SET public_key_pem = $1, last_fetched_at = now() WHERE actor_uri = $2`,
+		publicKeyPEM, actorURI,
+	)
+	if err != nil {
+		log.Printf("[Federation] Failed to refresh cached key for %s: %v", actorURI, err)
+	}
+}
+
 // resolveInstanceURL maps a domain name to its actual URL
 func resolveInstanceURL(domain string) string {
 	if url, ok := InstanceURLMap[domain]; ok {
@@ -220,13 +421,13 @@ func resolveInstanceURL(domain string) string {
 func getRemoteActorFromCache(ctx context.Context, username, domain string) (*RemoteActor, error) {
 	var actor RemoteActor
 	err := db.GetDB().QueryRow(ctx,
-		`SELECT id, actor_uri, username, domain, inbox_url, COALESCE(outbox_url,''),
+		`SELECT id, actor_uri, username, domain, inbox_url, COALESCE(shared_inbox_url,''), COALESCE(outbox_url,''),
 		        COALESCE(public_key_pem,''), COALESCE(encryption_public_key, ''), COALESCE(display_name,''), COALESCE(avatar_url,''),
 		        last_fetched_at, created_at
 		 FROM remote_actors WHERE username = $1 AND domain = $2`,
 		username, domain,
 	).Scan(&actor.ID, &actor.ActorURI, &actor.Username, &actor.Domain,
-		&actor.InboxURL, &actor.OutboxURL, &actor.PublicKeyPEM, &actor.EncryptionPublicKey,
+		&actor.InboxURL, &actor.SharedInboxURL, &actor.OutboxURL, &actor.PublicKeyPEM, &actor.EncryptionPublicKey,
 		&actor.DisplayName, &actor.AvatarURL, &actor.LastFetchedAt, &actor.CreatedAt)
 
 	if err != nil {
@@ -254,13 +455,15 @@ func upsertRemoteActor(ctx context.Context, actor *RemoteActor) error {
 	}
 
 	_, err := db.GetDB().Exec(ctx,
-		`INSERT INTO remote_actors (actor_uri, username, domain, instance_domain, inbox_url, outbox_url, public_key, public_key_pem, encryption_public_key, display_name, avatar_url, last_fetched_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now())
+		`INSERT INTO remote_actors (actor_uri, username, domain, instance_domain, inbox_url, outbox_url, public_key, public_key_pem, encryption_public_key, display_name, avatar_url, shared_inbox_url, last_fetched_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), now())
 		 ON CONFLICT (actor_uri) DO UPDATE SET
 		   inbox_url = $5, outbox_url = $6, public_key = $7, public_key_pem = $8,
-		   encryption_public_key = $9, display_name = $10, avatar_url = $11, instance_domain = $4, last_fetched_at = now()`,
+		   encryption_public_key = $9, display_name = $10, avatar_url = $11, instance_domain = $4,
+		   shared_inbox_url = NULLIF($12, ''), last_fetched_at = now()`,
 		actor.ActorURI, actor.Username, actor.Domain, instanceDomain, actor.InboxURL,
 		outboxURL, publicKey, actor.PublicKeyPEM, actor.EncryptionPublicKey, actor.DisplayName, actor.AvatarURL,
+		actor.SharedInboxURL,
 	)
 	return err
 }
@@ -268,7 +471,7 @@ func upsertRemoteActor(ctx context.Context, actor *RemoteActor) error {
 // GetAllRemoteActors returns all cached remote actors
 func GetAllRemoteActors(ctx context.Context) ([]*RemoteActor, error) {
 	rows, err := db.GetDB().Query(ctx,
-		`SELECT id, actor_uri, username, domain, inbox_url, COALESCE(outbox_url,''),
+		`SELECT id, actor_uri, username, domain, inbox_url, COALESCE(shared_inbox_url,''), COALESCE(outbox_url,''),
 		        COALESCE(public_key_pem,''), COALESCE(encryption_public_key, ''), COALESCE(display_name,''), COALESCE(avatar_url,''),
 		        last_fetched_at, created_at
 		 FROM remote_actors ORDER BY username`)
@@ -281,7 +484,7 @@ func GetAllRemoteActors(ctx context.Context) ([]*RemoteActor, error) {
 	for rows.Next() {
 		var a RemoteActor
 		if err := rows.Scan(&a.ID, &a.ActorURI, &a.Username, &a.Domain,
-			&a.InboxURL, &a.OutboxURL, &a.PublicKeyPEM, &a.EncryptionPublicKey,
+			&a.InboxURL, &a.SharedInboxURL, &a.OutboxURL, &a.PublicKeyPEM, &a.EncryptionPublicKey,
 			&a.DisplayName, &a.AvatarURL, &a.LastFetchedAt, &a.CreatedAt); err != nil {
 			return nil, err
 		}
@@ -290,43 +493,96 @@ func GetAllRemoteActors(ctx context.Context) ([]*RemoteActor, error) {
 	return actors, nil
 }
 
-// httpGet is a helper for simple GET requests with timeout
-func httpGet(url string) (*http.Response, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	return client.Get(url)
-}
+// FetchNodeInfo discovers and fetches a peer's NodeInfo document via /.well-known/nodeinfo
+func FetchNodeInfo(baseURL string) (*RemoteNodeInfo, error) {
+	resp, err := httpGet(strings.TrimRight(baseURL, "/") + "/.well-known/nodeinfo")
+	if err != nil {
+		return nil, fmt.Errorf("nodeinfo discovery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nodeinfo discovery returned status %d", resp.StatusCode)
+	}
 
-// FetchRemoteNote fetches an ActivityPub note URI and normalizes fields needed for local caching.
-func FetchRemoteNote(noteURI string) (*RemoteNote, error) {
-	if strings.TrimSpace(noteURI) == "" {
-		return nil, fmt.Errorf("note URI is required")
+	var index struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode nodeinfo discovery: %w", err)
+	}
+
+	// Prefer the newest schema the peer advertises
+	href, bestRel := "", ""
+	for _, link := range index.Links {
+		if strings.HasPrefix(link.Rel, "http://nodeinfo.diaspora.software/ns/schema/") && link.Href != "" && link.Rel > bestRel {
+			href, bestRel = link.Href, link.Rel
+		}
+	}
+	if href == "" {
+		return nil, fmt.Errorf("no nodeinfo link advertised")
 	}
 
-	req, err := http.NewRequest("GET", noteURI, nil)
+	nodeResp, err := httpGet(href)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("nodeinfo fetch failed: %w", err)
+	}
+	defer nodeResp.Body.Close()
+	if nodeResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nodeinfo fetch returned status %d", nodeResp.StatusCode)
 	}
-	req.Header.Set("Accept", "application/activity+json, application/ld+json")
 
-	client := &http.Client{Timeout: 12 * time.Second}
-	resp, err := client.Do(req)
+	var doc struct {
+		Software struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"software"`
+		OpenRegistrations bool `json:"openRegistrations"`
+	}
+	if err := json.NewDecoder(nodeResp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode nodeinfo: %w", err)
+	}
+
+	return &RemoteNodeInfo{
+		SoftwareName:      strings.ToLower(doc.Software.Name),
+		SoftwareVersion:   doc.Software.Version,
+		OpenRegistrations: doc.OpenRegistrations,
+	}, nil
+}
+
+// httpGet is a helper for simple GET requests with timeout (signed in secure mode)
+func httpGet(url string) (*http.Response, error) {
+	req, err := newFetchRequest(url, "")
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
 
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
-		return &RemoteNote{ID: noteURI, Deleted: true}, nil
-	}
+// ErrNoteOriginMismatch is returned when a fetched note is not served and authored on one host
+var ErrNoteOriginMismatch = errors.New("note is not served by its origin")
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return nil, fmt.Errorf("remote note fetch failed: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+// FetchRemoteNote fetches an ActivityPub note URI and normalizes fields needed for local caching.
+// The note must be served from the host it names as its id and be attributed to an actor on
+// that host; a copy served under another URI is fetched again from its id.
+func FetchRemoteNote(noteURI string) (*RemoteNote, error) {
+	return fetchRemoteNote(noteURI, true)
+}
+
+func fetchRemoteNote(noteURI string, followID bool) (*RemoteNote, error) {
+	if strings.TrimSpace(noteURI) == "" {
+		return nil, fmt.Errorf("note URI is required")
 	}
 
-	var payload map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("failed to decode remote note: %w", err)
+	payload, status, err := fetchActivityObject(noteURI)
+	if status == http.StatusNotFound || status == http.StatusGone {
+		return &RemoteNote{ID: noteURI, Deleted: true}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	activityType, _ := payload["type"].(string)
@@ -348,9 +604,16 @@ func FetchRemoteNote(noteURI string) (*RemoteNote, error) {
 	}
 
 	id, _ := objectPayload["id"].(string)
-	if strings.TrimSpace(id) == "" {
+	id = strings.TrimSpace(id)
+	if id == "" {
 		id = noteURI
 	}
+	if id != noteURI {
+		if !followID || !isHTTPURI(id) {
+			return nil, fmt.Errorf("%w: %s fetched as %s", ErrNoteOriginMismatch, id, noteURI)
+		}
+		return fetchRemoteNote(id, false)
+	}
 
 	attributedTo, _ := objectPayload["attributedTo"].(string)
 	if strings.TrimSpace(attributedTo) == "" {
@@ -360,9 +623,22 @@ func FetchRemoteNote(noteURI string) (*RemoteNote, error) {
 		attributedTo = activityActor
 	}
 
+	if !sameHost(attributedTo, noteURI) {
+		return nil, fmt.Errorf("%w: %s attributed to %s", ErrNoteOriginMismatch, noteURI, attributedTo)
+	}
+
 	content, _ := objectPayload["content"].(string)
 	inReplyTo, _ := objectPayload["inReplyTo"].(string)
 
+	// Mastodon's conversation is usually a tag: URI; only follow it when it can be fetched
+	conversation := objectReference(objectPayload["context"])
+	if !isHTTPURI(conversation) {
+		conversation = objectReference(objectPayload["conversation"])
+	}
+	if !isHTTPURI(conversation) {
+		conversation = ""
+	}
+
 	publishedAt := time.Now().UTC()
 	if published, _ := objectPayload["published"].(string); strings.TrimSpace(published) != "" {
 		if parsed, parseErr := time.Parse(time.RFC3339, published); parseErr == nil {
@@ -371,11 +647,90 @@ func FetchRemoteNote(noteURI string) (*RemoteNote, error) {
 	}
 
 	return &RemoteNote{
-		ID:           strings.TrimSpace(id),
+		ID:           id,
 		AttributedTo: strings.TrimSpace(attributedTo),
 		Content:      strings.TrimSpace(content),
 		InReplyTo:    strings.TrimSpace(inReplyTo),
+		Replies:      objectReference(objectPayload["replies"]),
+		Context:      conversation,
 		PublishedAt:  publishedAt,
+		Public:       addressedToPublic(objectPayload) || (objectPayload["to"] == nil && addressedToPublic(payload)),
 		Deleted:      false,
 	}, nil
 }
+
+// addressedToPublic reports whether an object's to or cc includes the public collection
+func addressedToPublic(object map[string]interface{}) bool {
+	for _, field := range []string{"to", "cc"} {
+		var audience []interface{}
+		switch v := object[field].(type) {
+		case string:
+			audience = []interface{}{v}
+		case []interface{}:
+			audience = v
+		}
+		for _, entry := range audience {
+			switch objectReference(entry) {
+			case publicCollection, "as:Public", "Public":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxActivityObjectBytes bounds the size of fetched Notes and collection pages
+const maxActivityObjectBytes = 1 << 20
+
+// fetchActivityObject GETs an ActivityPub object and decodes it. The HTTP status is
+// returned alongside any error so callers can tell a deleted object from a failed fetch.
+func fetchActivityObject(uri string) (map[string]interface{}, int, error) {
+	req, err := newFetchRequest(uri, "application/activity+json, application/ld+json")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	client := &http.Client{Timeout: 12 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, resp.StatusCode, fmt.Errorf("remote object fetch failed: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxActivityObjectBytes)).Decode(&payload); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to decode remote object: %w", err)
+	}
+	return payload, resp.StatusCode, nil
+}
+
+// objectReference returns the ID of a property that is either a URI or an embedded object
+func objectReference(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		id, _ := v["id"].(string)
+		return strings.TrimSpace(id)
+	}
+	return ""
+}
+
+// sameHost reports whether two URIs are served by the same host (and port)
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(strings.TrimSpace(a))
+	ub, errB := url.Parse(strings.TrimSpace(b))
+	if errA != nil || errB != nil || ua.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+func isHTTPURI(uri string) bool {
+	return strings.HasPrefix(uri, "https://") || strings.HasPrefix(uri, "http://")
+}
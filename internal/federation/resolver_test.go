@@ -1,26 +1,36 @@
 package federation
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
-func TestFetchRemoteNoteFromNoteObject(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// newNoteServer serves body with {{origin}} replaced by the server's own URL
+func newNoteServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/activity+json")
-		_, _ = w.Write([]byte(`{
-			"id":"https://remote.test/posts/abc",
-			"type":"Note",
-			"attributedTo":"https://remote.test/ap/users/alice",
-			"content":"hello from remote",
-			"inReplyTo":"https://remote.test/posts/parent-1",
-			"published":"2026-02-23T10:11:12Z"
-		}`))
+		_, _ = w.Write([]byte(strings.ReplaceAll(body, "{{origin}}", ts.URL)))
 	}))
-	defer ts.Close()
+	t.Cleanup(ts.Close)
+	return ts
+}
 
-	note, err := FetchRemoteNote(ts.URL)
+func TestFetchRemoteNoteFromNoteObject(t *testing.T) {
+	ts := newNoteServer(t, `{
+		"id":"{{origin}}/posts/abc",
+		"type":"Note",
+		"attributedTo":"{{origin}}/ap/users/alice",
+		"content":"hello from remote",
+		"inReplyTo":"https://remote.test/posts/parent-1",
+		"published":"2026-02-23T10:11:12Z"
+	}`)
+
+	note, err := FetchRemoteNote(ts.URL + "/posts/abc")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -30,10 +40,10 @@ func TestFetchRemoteNoteFromNoteObject(t *testing.T) {
 	if note.Deleted {
 		t.Fatalf("expected non-deleted note")
 	}
-	if note.ID != "https://remote.test/posts/abc" {
+	if note.ID != ts.URL+"/posts/abc" {
 		t.Fatalf("expected note id to be parsed")
 	}
-	if note.AttributedTo != "https://remote.test/ap/users/alice" {
+	if note.AttributedTo != ts.URL+"/ap/users/alice" {
 		t.Fatalf("expected attributedTo to be parsed")
 	}
 	if note.InReplyTo != "https://remote.test/posts/parent-1" {
@@ -42,30 +52,26 @@ func TestFetchRemoteNoteFromNoteObject(t *testing.T) {
 }
 
 func TestFetchRemoteNoteFromCreateActivity(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/activity+json")
-		_, _ = w.Write([]byte(`{
-			"id":"https://remote.test/activities/create-1",
-			"type":"Create",
-			"actor":"https://remote.test/ap/users/bob",
-			"object":{
-				"id":"https://remote.test/posts/reply-2",
-				"type":"Note",
-				"content":"reply payload",
-				"inReplyTo":"https://remote.test/posts/parent-2"
-			}
-		}`))
-	}))
-	defer ts.Close()
+	ts := newNoteServer(t, `{
+		"id":"{{origin}}/activities/create-1",
+		"type":"Create",
+		"actor":"{{origin}}/ap/users/bob",
+		"object":{
+			"id":"{{origin}}/posts/reply-2",
+			"type":"Note",
+			"content":"reply payload",
+			"inReplyTo":"https://remote.test/posts/parent-2"
+		}
+	}`)
 
-	note, err := FetchRemoteNote(ts.URL)
+	note, err := FetchRemoteNote(ts.URL + "/posts/reply-2")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	if note == nil {
 		t.Fatalf("expected note, got nil")
 	}
-	if note.AttributedTo != "https://remote.test/ap/users/bob" {
+	if note.AttributedTo != ts.URL+"/ap/users/bob" {
 		t.Fatalf("expected actor fallback for attributedTo")
 	}
 	if note.InReplyTo != "https://remote.test/posts/parent-2" {
@@ -73,6 +79,53 @@ func TestFetchRemoteNoteFromCreateActivity(t *testing.T) {
 	}
 }
 
+func TestFetchRemoteNoteRejectsForgedOrigin(t *testing.T) {
+	// A server hands out a Note claiming to be another server's post by another server's actor
+	forger := newNoteServer(t, `{
+		"id":"https://victim.test/posts/1",
+		"type":"Note",
+		"attributedTo":"https://victim.test/users/alice",
+		"content":"forged"
+	}`)
+	if _, err := FetchRemoteNote(forger.URL + "/posts/1"); err == nil {
+		t.Fatalf("expected a cross-origin note id to be rejected")
+	}
+
+	// Its own id, but attributed to an actor elsewhere
+	impersonator := newNoteServer(t, `{
+		"id":"{{origin}}/posts/2",
+		"type":"Note",
+		"attributedTo":"https://victim.test/users/alice",
+		"content":"forged"
+	}`)
+	if _, err := FetchRemoteNote(impersonator.URL + "/posts/2"); !errors.Is(err, ErrNoteOriginMismatch) {
+		t.Fatalf("expected a cross-origin attributedTo to be rejected, got %v", err)
+	}
+}
+
+func TestFetchRemoteNoteRefetchesFromID(t *testing.T) {
+	origin := newNoteServer(t, `{
+		"id":"{{origin}}/posts/3",
+		"type":"Note",
+		"attributedTo":"{{origin}}/users/alice",
+		"content":"the real note"
+	}`)
+	mirror := newNoteServer(t, `{
+		"id":"`+origin.URL+`/posts/3",
+		"type":"Note",
+		"attributedTo":"`+origin.URL+`/users/alice",
+		"content":"a tampered copy"
+	}`)
+
+	note, err := FetchRemoteNote(mirror.URL + "/copies/3")
+	if err != nil {
+		t.Fatalf("expected the note to be fetched from its id, got %v", err)
+	}
+	if note.ID != origin.URL+"/posts/3" || note.Content != "the real note" {
+		t.Fatalf("expected the origin's copy, got %+v", note)
+	}
+}
+
 func TestFetchRemoteNoteHandlesMissingOrDeleted(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
@@ -87,3 +140,134 @@ func TestFetchRemoteNoteHandlesMissingOrDeleted(t *testing.T) {
 		t.Fatalf("expected deleted marker note for 404")
 	}
 }
+
+func TestAddressedToPublic(t *testing.T) {
+	tests := []struct {
+		name   string
+		object map[string]interface{}
+		want   bool
+	}{
+		{"public in to", map[string]interface{}{"to": []interface{}{"https://www.w3.org/ns/activitystreams#Public"}}, true},
+		{"compact form in cc", map[string]interface{}{"cc": "as:Public"}, true},
+		{"followers only", map[string]interface{}{"to": []interface{}{"https://remote.test/users/alice/followers"}}, false},
+		{"no audience", map[string]interface{}{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addressedToPublic(tt.object); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveInstanceActor(t *testing.T) {
+	var href string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") != "acct:peer.test@peer.test" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jrd+json")
+		_, _ = w.Write([]byte(`{"links":[{"rel":"self","type":"application/activity+json","href":"` + href + `"}]}`))
+	}))
+	defer ts.Close()
+
+	defer func(m map[string]string) { InstanceURLMap = m }(InstanceURLMap)
+	InstanceURLMap = map[string]string{"peer.test": ts.URL}
+	reset := func() {
+		instanceActorsMu.Lock()
+		instanceActors = make(map[string]instanceActorEntry)
+		instanceActorsMu.Unlock()
+	}
+	defer reset()
+
+	// An instance actor advertised on another host is not the host's own
+	reset()
+	href = "https://elsewhere.test/actor"
+	if _, err := ResolveInstanceActor("peer.test"); err == nil {
+		t.Fatalf("expected an instance actor on another host to be rejected")
+	}
+
+	reset()
+	href = ts.URL + "/actor"
+	got, err := ResolveInstanceActor("peer.test")
+	if err != nil || got != href {
+		t.Fatalf("expected %s, got %q, %v", href, got, err)
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		activity map[string]interface{}
+		wantErr  bool
+	}{
+		{"actor moves itself", map[string]interface{}{"actor": "https://old.test/users/a", "object": "https://old.test/users/a", "target": "https://new.test/users/a"}, false},
+		{"object defaults to the actor", map[string]interface{}{"actor": "https://old.test/users/a", "target": "https://new.test/users/a"}, false},
+		{"actor moves someone else", map[string]interface{}{"actor": "https://old.test/users/b", "object": "https://old.test/users/a", "target": "https://new.test/users/a"}, true},
+		{"no target", map[string]interface{}{"actor": "https://old.test/users/a", "object": "https://old.test/users/a"}, true},
+		{"no actor", map[string]interface{}{"target": "https://new.test/users/a"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, target, err := ParseMove(tt.activity)
+			if tt.wantErr {
+				var permanent *permanentInboxError
+				if !errors.As(err, &permanent) {
+					t.Fatalf("expected a permanent error, got %v", err)
+				}
+				return
+			}
+			if err != nil || origin != "https://old.test/users/a" || target != "https://new.test/users/a" {
+				t.Fatalf("unexpected result %q, %q, %v", origin, target, err)
+			}
+		})
+	}
+}
+
+func TestVerifyMoveTarget(t *testing.T) {
+	const origin = "https://old.test/users/a"
+	ts := newNoteServer(t, `{"id":"{{origin}}/users/a","type":"Person","alsoKnownAs":["`+origin+`"]}`)
+	if err := VerifyMoveTarget(ts.URL+"/users/a", origin); err != nil {
+		t.Fatalf("expected a target listing the origin to be accepted, got %v", err)
+	}
+
+	var permanent *permanentInboxError
+	err := VerifyMoveTarget(ts.URL+"/users/a", "https://old.test/users/b")
+	if !errors.As(err, &permanent) {
+		t.Fatalf("expected a target not listing the origin to be refused for good, got %v", err)
+	}
+
+	// An unreachable target may come back, so the activity is retried
+	err = VerifyMoveTarget("http://127.0.0.1:1/users/a", origin)
+	if err == nil || errors.As(err, &permanent) {
+		t.Fatalf("expected a retryable error for an unreachable target, got %v", err)
+	}
+}
+
+func TestRejectedFollower(t *testing.T) {
+	const follower = "https://splitter.test/ap/users/alice"
+	tests := []struct {
+		name   string
+		object interface{}
+		want   string
+		wantOK bool
+	}{
+		{"embedded Follow", map[string]interface{}{"type": "Follow", "actor": follower, "object": "https://remote.test/users/bob"}, follower, true},
+		{"Follow by ID", follower + "/activities/follow-3", follower + "/activities/follow-3", true},
+		{"embedded object without type", map[string]interface{}{"actor": follower}, follower, true},
+		{"not a Follow", map[string]interface{}{"type": "Note", "actor": follower}, "", false},
+		{"no object", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RejectedFollower(map[string]interface{}{"type": "Reject", "actor": "https://remote.test/users/bob", "object": tt.object})
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("RejectedFollower() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"splitter/internal/db"
+)
+
+// RetentionPolicy is how long each federation bookkeeping table keeps its rows
+type RetentionPolicy struct {
+	OutboxTTL      time.Duration // sent deliveries and deliveries that used up their retries
+	InboxTTL       time.Duration // processed and dead-lettered inbound activities
+	DedupTTL       time.Duration // activity_deduplication entries past their expiry
+	ConnectionsTTL time.Duration // federation_connections edges not seen since
+	BatchSize      int           // rows deleted per statement
+	DryRun         bool          // only count what would be deleted
+}
+
+// RetentionRun is one pass of the retention job: what it deleted, or would delete in a dry run
+type RetentionRun struct {
+	ID                 string     `json:"id"`
+	DryRun             bool       `json:"dry_run"`
+	OutboxDeleted      int64      `json:"outbox_deleted"`
+	InboxDeleted       int64      `json:"inbox_deleted"`
+	DedupDeleted       int64      `json:"dedup_deleted"`
+	ConnectionsDeleted int64      `json:"connections_deleted"`
+	LastError          string     `json:"last_error,omitempty"`
+	StartedAt          time.Time  `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+}
+
+// RetentionTableSize is the on-disk footprint of a table the retention job manages
+type RetentionTableSize struct {
+	Table         string `json:"table"`
+	EstimatedRows int64  `json:"estimated_rows"`
+	TotalBytes    int64  `json:"total_bytes"`
+}
+
+// DeliveryCounts are the successful and failed deliveries to or from one domain
+type DeliveryCounts struct {
+	Success int64
+	Failure int64
+}
+
+// RetentionTables are the tables reported by the retention status, rollups included
+var RetentionTables = []string{
+	"outbox_activities",
+	"inbox_activities",
+	"activity_deduplication",
+	"federation_connections",
+	"federation_delivery_daily",
+}
+
+const defaultRetentionBatchSize = 1000
+
+var (
+	retentionPolicyMu sync.RWMutex
+	retentionPolicy   = RetentionPolicy{
+		OutboxTTL:      14 * 24 * time.Hour,
+		InboxTTL:       14 * 24 * time.Hour,
+		DedupTTL:       7 * 24 * time.Hour,
+		ConnectionsTTL: 90 * 24 * time.Hour,
+		BatchSize:      defaultRetentionBatchSize,
+	}
+)
+
+// inboxDomainSQL and outboxDomainSQL extract the remote host (with port) of a row
+const (
+	inboxDomainSQL  = `substring(actor_uri from '^https?://([^/]+)')`
+	outboxDomainSQL = `substring(target_inbox from '^https?://([^/]+)')`
+)
+
+// Rows each table gives up. Pending and retryable rows are never removed: outbox rows
+// only once sent or out of retries, inbox rows only once processed or dead-lettered.
+const (
+	outboxRetentionWhere = `created_at < now() - $1::interval
+		AND (status = 'sent' OR (status = 'failed' AND retry_count >= $2))`
+	inboxRetentionWhere = `received_at < now() - $1::interval
+		AND status IN ('processed', 'dead')`
+	dedupRetentionWhere = `processed_at < now() - $1::interval
+		AND (expires_at IS NULL OR expires_at < now())`
+	connectionsRetentionWhere = `last_seen < now() - $1::interval`
+)
+
+// ConfigureRetentionPolicy sets the per-table TTLs, batch size and dry-run mode of the
+// retention job. Zero values keep the current setting.
+func ConfigureRetentionPolicy(policy RetentionPolicy) {
+	retentionPolicyMu.Lock()
+	defer retentionPolicyMu.Unlock()
+	if policy.OutboxTTL > 0 {
+		retentionPolicy.OutboxTTL = policy.OutboxTTL
+	}
+	if policy.InboxTTL > 0 {
+		retentionPolicy.InboxTTL = policy.InboxTTL
+	}
+	if policy.DedupTTL > 0 {
+		retentionPolicy.DedupTTL = policy.DedupTTL
+	}
+	if policy.ConnectionsTTL > 0 {
+		retentionPolicy.ConnectionsTTL = policy.ConnectionsTTL
+	}
+	if policy.BatchSize > 0 {
+		retentionPolicy.BatchSize = policy.BatchSize
+	}
+	retentionPolicy.DryRun = policy.DryRun
+}
+
+// CurrentRetentionPolicy returns the retention policy in effect
+func CurrentRetentionPolicy() RetentionPolicy {
+	retentionPolicyMu.RLock()
+	defer retentionPolicyMu.RUnlock()
+	return retentionPolicy
+}
+
+// EnsureRetentionSchema creates the rollup and run-log tables from migration 039 if missing
+func EnsureRetentionSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS federation_delivery_daily (
+			day DATE NOT NULL,
+			domain TEXT NOT NULL,
+			direction TEXT NOT NULL CHECK (direction IN ('inbound', 'outbound')),
+			success_count BIGINT NOT NULL DEFAULT 0,
+			failure_count BIGINT NOT NULL DEFAULT 0,
+			last_activity_at TIMESTAMPTZ,
+			PRIMARY KEY (day, domain, direction)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_federation_delivery_daily_domain ON federation_delivery_daily (domain, day)`,
+		`CREATE TABLE IF NOT EXISTS retention_runs (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			dry_run BOOLEAN NOT NULL DEFAULT false,
+			outbox_deleted BIGINT NOT NULL DEFAULT 0,
+			inbox_deleted BIGINT NOT NULL DEFAULT 0,
+			dedup_deleted BIGINT NOT NULL DEFAULT 0,
+			connections_deleted BIGINT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at TIMESTAMPTZ
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_retention_runs_started ON retention_runs (started_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_created ON outbox_activities (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_inbox_received ON inbox_activities (received_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_activity_dedup_expires ON activity_deduplication (expires_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.GetDB().Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to ensure retention schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// RunRetention applies the retention policy once and records the run. Outbox and inbox
+// rows are summed into federation_delivery_daily in the statement that deletes them.
+// With dryRun set nothing is deleted; the run records how many rows would have been.
+func RunRetention(ctx context.Context, dryRun bool) (*RetentionRun, error) {
+	policy := CurrentRetentionPolicy()
+	maxRetries, _, _ := currentDeliveryPolicy()
+
+	run := &RetentionRun{DryRun: dryRun}
+	err := db.GetDB().QueryRow(ctx,
+		`INSERT INTO retention_runs (dry_run) VALUES ($1) RETURNING id::text, started_at`,
+		dryRun,
+	).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record retention run: %w", err)
+	}
+
+	runErr := func() error {
+		var err error
+		if run.OutboxDeleted, err = compactOutbox(ctx, policy, maxRetries, dryRun); err != nil {
+			return err
+		}
+		if run.InboxDeleted, err = compactInbox(ctx, policy, dryRun); err != nil {
+			return err
+		}
+		if run.DedupDeleted, err = pruneTable(ctx, "activity_deduplication", "activity_id", dedupRetentionWhere, policy.DedupTTL, policy.BatchSize, dryRun); err != nil {
+			return err
+		}
+		run.ConnectionsDeleted, err = pruneTable(ctx, "federation_connections", "id", connectionsRetentionWhere, policy.ConnectionsTTL, policy.BatchSize, dryRun)
+		return err
+	}()
+	if runErr != nil {
+		run.LastError = runErr.Error()
+	}
+
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	_, err = db.GetDB().Exec(ctx,
+		`UPDATE retention_runs
+		 SET outbox_deleted = $2, inbox_deleted = $3, dedup_deleted = $4, connections_deleted = $5,
+		     last_error = NULLIF($6, ''), finished_at = $7
+		 WHERE id = $1`,
+		run.ID, run.OutboxDeleted, run.InboxDeleted, run.DedupDeleted, run.ConnectionsDeleted, run.LastError, now,
+	)
+	if err != nil {
+		return run, fmt.Errorf("failed to record retention run: %w", err)
+	}
+	return run, runErr
+}
+
+// compactOutbox archives then deletes finished deliveries, one batch per statement
+func compactOutbox(ctx context.Context, policy RetentionPolicy, maxRetries int, dryRun bool) (int64, error) {
+	ttl := formatBackoffInterval(policy.OutboxTTL)
+	if dryRun {
+		var count int64
+		err := db.GetDB().QueryRow(ctx,
+			`SELECT COUNT(*) FROM outbox_activities WHERE `+outboxRetentionWhere, ttl, maxRetries,
+		).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count expired outbox activities: %w", err)
+		}
+		return count, nil
+	}
+
+	query := `
+		WITH expired AS (
+			SELECT id FROM outbox_activities
+			WHERE ` + outboxRetentionWhere + `
+			ORDER BY created_at
+			LIMIT $3
+		), deleted AS (
+			DELETE FROM outbox_activities o USING expired e
+			WHERE o.id = e.id
+			RETURNING o.target_inbox, o.status, o.created_at
+		), archived AS (
+			INSERT INTO federation_delivery_daily (day, domain, direction, success_count, failure_count, last_activity_at)
+			SELECT (created_at AT TIME ZONE 'UTC')::date, COALESCE(` + outboxDomainSQL + `, ''), 'outbound',
+				COUNT(*) FILTER (WHERE status = 'sent'), COUNT(*) FILTER (WHERE status = 'failed'), MAX(created_at)
+			FROM deleted
+			GROUP BY 1, 2
+			ON CONFLICT (day, domain, direction) DO UPDATE SET
+				success_count = federation_delivery_daily.success_count + EXCLUDED.success_count,
+				failure_count = federation_delivery_daily.failure_count + EXCLUDED.failure_count,
+				last_activity_at = GREATEST(federation_delivery_daily.last_activity_at, EXCLUDED.last_activity_at)
+		)
+		SELECT COUNT(*) FROM deleted`
+	return deleteInBatches(ctx, "outbox_activities", policy.BatchSize, func(batch int) (int64, error) {
+		var count int64
+		err := db.GetDB().QueryRow(ctx, query, ttl, maxRetries, batch).Scan(&count)
+		return count, err
+	})
+}
+
+// compactInbox archives then deletes processed and dead-lettered inbound activities
+func compactInbox(ctx context.Context, policy RetentionPolicy, dryRun bool) (int64, error) {
+	ttl := formatBackoffInterval(policy.InboxTTL)
+	if dryRun {
+		var count int64
+		err := db.GetDB().QueryRow(ctx,
+			`SELECT COUNT(*) FROM inbox_activities WHERE `+inboxRetentionWhere, ttl,
+		).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count expired inbox activities: %w", err)
+		}
+		return count, nil
+	}
+
+	query := `
+		WITH expired AS (
+			SELECT id FROM inbox_activities
+			WHERE ` + inboxRetentionWhere + `
+			ORDER BY received_at
+			LIMIT $2
+		), deleted AS (
+			DELETE FROM inbox_activities i USING expired e
+			WHERE i.id = e.id
+			RETURNING i.actor_uri, i.status, i.received_at
+		), archived AS (
+			INSERT INTO federation_delivery_daily (day, domain, direction, success_count, failure_count, last_activity_at)
+			SELECT (received_at AT TIME ZONE 'UTC')::date, COALESCE(` + inboxDomainSQL + `, ''), 'inbound',
+				COUNT(*) FILTER (WHERE status = 'processed'), COUNT(*) FILTER (WHERE status = 'dead'), MAX(received_at)
+			FROM deleted
+			GROUP BY 1, 2
+			ON CONFLICT (day, domain, direction) DO UPDATE SET
+				success_count = federation_delivery_daily.success_count + EXCLUDED.success_count,
+				failure_count = federation_delivery_daily.failure_count + EXCLUDED.failure_count,
+				last_activity_at = GREATEST(federation_delivery_daily.last_activity_at, EXCLUDED.last_activity_at)
+		)
+		SELECT COUNT(*) FROM deleted`
+	return deleteInBatches(ctx, "inbox_activities", policy.BatchSize, func(batch int) (int64, error) {
+		var count int64
+		err := db.GetDB().QueryRow(ctx, query, ttl, batch).Scan(&count)
+		return count, err
+	})
+}
+
+// pruneTable deletes expired rows that need no archiving
+func pruneTable(ctx context.Context, table, key, where string, ttl time.Duration, batchSize int, dryRun bool) (int64, error) {
+	interval := formatBackoffInterval(ttl)
+	if dryRun {
+		var count int64
+		err := db.GetDB().QueryRow(ctx, `SELECT COUNT(*) FROM `+table+` WHERE `+where, interval).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count expired %s rows: %w", table, err)
+		}
+		return count, nil
+	}
+
+	query := `DELETE FROM ` + table + ` WHERE ` + key + ` IN (
+		SELECT ` + key + ` FROM ` + table + ` WHERE ` + where + ` LIMIT $2
+	)`
+	return deleteInBatches(ctx, table, batchSize, func(batch int) (int64, error) {
+		tag, err := db.GetDB().Exec(ctx, query, interval, batch)
+		return tag.RowsAffected(), err
+	})
+}
+
+// deleteInBatches runs deleteBatch until a batch comes back short, so no single
+// statement holds locks on a large part of the table
+func deleteInBatches(ctx context.Context, table string, batchSize int, deleteBatch func(batch int) (int64, error)) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+	var total int64
+	for {
+		deleted, err := deleteBatch(batchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to compact %s: %w", table, err)
+		}
+		total += deleted
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// OutboundDeliveryCounts returns the sent and failed deliveries per remote domain since
+// the given time, from outbox_activities plus the daily rollups of deleted rows. Rollups
+// are per day, so they count from the start of since's day.
+func OutboundDeliveryCounts(ctx context.Context, since time.Time) (map[string]DeliveryCounts, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT domain, SUM(success)::bigint, SUM(failure)::bigint
+		FROM (
+			SELECT `+outboxDomainSQL+` AS domain,
+				COUNT(*) FILTER (WHERE status = 'sent') AS success,
+				COUNT(*) FILTER (WHERE status = 'failed') AS failure
+			FROM outbox_activities
+			WHERE created_at > $1::timestamptz
+			GROUP BY 1
+			UNION ALL
+			SELECT domain, success_count, failure_count
+			FROM federation_delivery_daily
+			WHERE direction = 'outbound' AND day >= ($1::timestamptz AT TIME ZONE 'UTC')::date
+		) d
+		WHERE COALESCE(domain, '') <> ''
+		GROUP BY domain
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count outbound deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]DeliveryCounts)
+	for rows.Next() {
+		var domain string
+		var c DeliveryCounts
+		if err := rows.Scan(&domain, &c.Success, &c.Failure); err == nil {
+			counts[domain] = c
+		}
+	}
+	return counts, rows.Err()
+}
+
+// GetRetentionTableSizes reports the estimated row count and total size (with indexes
+// and TOAST) of each table the retention job manages
+func GetRetentionTableSizes(ctx context.Context) ([]RetentionTableSize, error) {
+	sizes := make([]RetentionTableSize, 0, len(RetentionTables))
+	for _, table := range RetentionTables {
+		size := RetentionTableSize{Table: table}
+		err := db.GetDB().QueryRow(ctx, `
+			SELECT GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid)
+			FROM pg_class c
+			WHERE c.oid = to_regclass($1)
+		`, table).Scan(&size.EstimatedRows, &size.TotalBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of %s: %w", table, err)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// GetLastRetentionRun returns the most recent retention run, or the most recent one that
+// actually deleted rows when compactionOnly is set. It returns nil when there is none.
+func GetLastRetentionRun(ctx context.Context, compactionOnly bool) (*RetentionRun, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT id::text, dry_run, outbox_deleted, inbox_deleted, dedup_deleted, connections_deleted,
+		       COALESCE(last_error, ''), started_at, finished_at
+		FROM retention_runs
+		WHERE NOT ($1 AND dry_run)
+		ORDER BY started_at DESC
+		LIMIT 1
+	`, compactionOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last retention run: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var run RetentionRun
+	if err := rows.Scan(&run.ID, &run.DryRun, &run.OutboxDeleted, &run.InboxDeleted, &run.DedupDeleted,
+		&run.ConnectionsDeleted, &run.LastError, &run.StartedAt, &run.FinishedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan retention run: %w", err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,90 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfigureRetentionPolicyKeepsUnsetValues(t *testing.T) {
+	saved := CurrentRetentionPolicy()
+	defer func() {
+		retentionPolicyMu.Lock()
+		retentionPolicy = saved
+		retentionPolicyMu.Unlock()
+	}()
+
+	ConfigureRetentionPolicy(RetentionPolicy{InboxTTL: 3 * 24 * time.Hour, DryRun: true})
+
+	policy := CurrentRetentionPolicy()
+	if policy.InboxTTL != 3*24*time.Hour || !policy.DryRun {
+		t.Fatalf("expected the inbox TTL and dry run to be set, got %+v", policy)
+	}
+	if policy.OutboxTTL != saved.OutboxTTL || policy.DedupTTL != saved.DedupTTL ||
+		policy.ConnectionsTTL != saved.ConnectionsTTL || policy.BatchSize != saved.BatchSize {
+		t.Fatalf("expected unset values to be kept, got %+v", policy)
+	}
+}
+
+func TestDeleteInBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining int64
+		batchSize int
+		wantTotal int64
+		wantCalls int
+	}{
+		{"nothing to delete", 0, 10, 0, 1},
+		{"less than one batch", 7, 10, 7, 1},
+		{"exact multiple of the batch", 20, 10, 20, 3},
+		{"several batches", 25, 10, 25, 3},
+		{"default batch size", 5, 0, 5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining := tt.remaining
+			calls := 0
+			total, err := deleteInBatches(context.Background(), "test", tt.batchSize, func(batch int) (int64, error) {
+				calls++
+				deleted := min(remaining, int64(batch))
+				remaining -= deleted
+				return deleted, nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total != tt.wantTotal || calls != tt.wantCalls {
+				t.Fatalf("expected %d rows in %d calls, got %d in %d", tt.wantTotal, tt.wantCalls, total, calls)
+			}
+		})
+	}
+}
+
+func TestDeleteInBatchesStopsOnError(t *testing.T) {
+	calls := 0
+	total, err := deleteInBatches(context.Background(), "test", 10, func(batch int) (int64, error) {
+		calls++
+		if calls == 2 {
+			return 0, errors.New("lock timeout")
+		}
+		return int64(batch), nil
+	})
+	if err == nil || total != 10 || calls != 2 {
+		t.Fatalf("expected to stop after the failing batch with 10 rows, got total=%d calls=%d err=%v", total, calls, err)
+	}
+}
+
+func TestDeleteInBatchesStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := deleteInBatches(ctx, "test", 10, func(batch int) (int64, error) {
+		calls++
+		cancel()
+		return int64(batch), nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Fatalf("expected the run to stop after cancellation, got calls=%d err=%v", calls, err)
+	}
+}
@@ -0,0 +1,84 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"splitter/internal/db"
+)
+
+// ErrFetchDomainBlocked is returned by VerifyFetchRequest when the signer's domain is blocked
+var ErrFetchDomainBlocked = errors.New("domain is blocked")
+
+var (
+	secureModeMu sync.RWMutex
+	secureMode   bool
+)
+
+// SetSecureMode enables authorized fetch: outbound ActivityPub GETs are signed with the
+// instance actor key and inbound GETs on actors, outboxes, collections and notes must be signed.
+func SetSecureMode(enabled bool) {
+	secureModeMu.Lock()
+	defer secureModeMu.Unlock()
+	secureMode = enabled
+}
+
+// IsSecureMode reports whether authorized fetch is enabled
+func IsSecureMode() bool {
+	secureModeMu.RLock()
+	defer secureModeMu.RUnlock()
+	return secureMode
+}
+
+// newFetchRequest builds a GET request, signed as the instance actor when secure mode is on
+func newFetchRequest(targetURL, accept string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if IsSecureMode() {
+		if privKey := GetInstancePrivateKey(); privKey != nil {
+			if err := SignRequest(req, privKey, InstanceActorURI()+"#main-key"); err != nil {
+				log.Printf("[Federation] Warning: failed to sign fetch of %s: %v", targetURL, err)
+			}
+		}
+	}
+	return req, nil
+}
+
+// VerifyFetchRequest checks the HTTP Signature on an inbound GET and returns the signing actor.
+// Fails if the request is unsigned, the signer's domain is blocked, or the signature is invalid.
+func VerifyFetchRequest(ctx context.Context, req *http.Request) (string, error) {
+	keyID := SignatureKeyID(req)
+	if keyID == "" {
+		return "", fmt.Errorf("signature required")
+	}
+
+	signerDomain := extractDomainFromURI(keyID)
+	if signerDomain == "" {
+		return "", fmt.Errorf("invalid keyId %s", keyID)
+	}
+	if IsDomainBlocked(ctx, signerDomain) {
+		return "", fmt.Errorf("%s: %w", signerDomain, ErrFetchDomainBlocked)
+	}
+
+	return VerifyRequestSignature(ctx, req, LookupActorKey)
+}
+
+// cachedActorPublicKeyPEM returns the cached public key of a remote actor, or "" if unknown
+func cachedActorPublicKeyPEM(ctx context.Context, actorURI string) string {
+	var publicKeyPEM string
+	_ = db.GetDB().QueryRow(ctx,
+		`SELECT COALESCE(public_key_pem, '') FROM remote_actors WHERE actor_uri = $1`, actorURI,
+	).Scan(&publicKeyPEM)
+	return strings.TrimSpace(publicKeyPEM)
+}
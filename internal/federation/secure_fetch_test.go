@@ -0,0 +1,46 @@
+package federation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewFetchRequestSignsInSecureMode(t *testing.T) {
+	withLocalInstance(t, nil)
+	defer SetSecureMode(IsSecureMode())
+
+	SetSecureMode(false)
+	req, err := newFetchRequest("https://remote.test/users/bob", "application/activity+json")
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if req.Header.Get("Accept") != "application/activity+json" || SignatureKeyID(req) != "" {
+		t.Fatalf("expected an unsigned fetch outside secure mode, got headers %v", req.Header)
+	}
+
+	SetSecureMode(true)
+	req, err = newFetchRequest("https://remote.test/users/bob", "application/activity+json")
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if got := SignatureKeyID(req); got != "https://splitter.test/ap/actor#main-key" {
+		t.Fatalf("expected the fetch to be signed by the instance actor, got keyId %q", got)
+	}
+	if err := VerifyRequest(req, GetInstancePublicKeyPEM()); err != nil {
+		t.Fatalf("expected the signature to verify with the instance key, got %v", err)
+	}
+}
+
+func TestVerifyFetchRequestRequiresSignature(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://splitter.test/ap/users/alice", nil)
+	if _, err := VerifyFetchRequest(context.Background(), req); err == nil {
+		t.Fatalf("expected an unsigned fetch to be refused")
+	}
+
+	req.Header.Set("Signature", `keyId="not-a-uri",algorithm="rsa-sha256",headers="(request-target) host date",signature="AAAA"`)
+	if _, err := VerifyFetchRequest(context.Background(), req); err == nil {
+		t.Fatalf("expected a keyId without a domain to be refused")
+	}
+}
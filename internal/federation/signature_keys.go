@@ -0,0 +1,158 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// KeyLookup resolves a signature keyId to the owning actor and its public key PEM.
+// refresh asks for a fresh copy from the origin rather than any cached one.
+type KeyLookup func(ctx context.Context, keyID string, refresh bool) (owner string, publicKeyPEM string, err error)
+
+type verifiedKey struct {
+	owner        string
+	publicKeyPEM string
+}
+
+// maxVerifiedKeys bounds the verified key cache; past it an arbitrary entry is evicted
+const maxVerifiedKeys = 4096
+
+// verifiedKeys caches keyId → key for keys that have produced a valid signature
+var (
+	verifiedKeysMu sync.RWMutex
+	verifiedKeys   = make(map[string]verifiedKey)
+)
+
+// instanceActorLookup resolves the instance actor of a host; tests swap it out
+var instanceActorLookup = ResolveInstanceActor
+
+// VerifyRequestSignature verifies the HTTP Signature on req and returns the actor owning the key.
+// Keys that verify are cached per keyId; on a signature mismatch the key is fetched again once
+// so that remote key rotation does not lock the sender out.
+func VerifyRequestSignature(ctx context.Context, req *http.Request, lookup KeyLookup) (string, error) {
+	keyID := SignatureKeyID(req)
+	if keyID == "" {
+		return "", fmt.Errorf("signature required")
+	}
+	if lookup == nil {
+		lookup = LookupActorKey
+	}
+
+	verifiedKeysMu.RLock()
+	cached, ok := verifiedKeys[keyID]
+	verifiedKeysMu.RUnlock()
+
+	if !ok {
+		owner, publicKeyPEM, err := lookup(ctx, keyID, false)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve key %s: %w", keyID, err)
+		}
+		cached = verifiedKey{owner: owner, publicKeyPEM: strings.TrimSpace(publicKeyPEM)}
+	}
+
+	err := VerifyRequest(req, cached.publicKeyPEM)
+	if err == nil {
+		rememberVerifiedKey(keyID, cached)
+		return cached.owner, nil
+	}
+	if !errors.Is(err, ErrSignatureMismatch) {
+		return "", err
+	}
+
+	// The signer may have rotated keys since we cached them; refetch once
+	owner, freshKey, fetchErr := lookup(ctx, keyID, true)
+	if fetchErr != nil || strings.TrimSpace(freshKey) == cached.publicKeyPEM {
+		return "", err
+	}
+	fresh := verifiedKey{owner: owner, publicKeyPEM: strings.TrimSpace(freshKey)}
+	if err := VerifyRequest(req, fresh.publicKeyPEM); err != nil {
+		return "", err
+	}
+	rememberVerifiedKey(keyID, fresh)
+	return fresh.owner, nil
+}
+
+// ErrSignerNotActor is returned when an activity is signed by a key that may not speak for its actor
+var ErrSignerNotActor = errors.New("signing key does not belong to the activity's actor")
+
+// VerifyActivitySignature verifies the HTTP Signature on an inbox delivery and checks that the
+// signing key may speak for actorURI: it must belong to the actor itself, or to the instance
+// actor its host advertises through WebFinger. Other users on the same host may not sign for it.
+func VerifyActivitySignature(ctx context.Context, req *http.Request, actorURI string, lookup KeyLookup) (string, error) {
+	signer, err := VerifyRequestSignature(ctx, req, lookup)
+	if err != nil {
+		return "", err
+	}
+	if signer == actorURI {
+		return signer, nil
+	}
+	domain := extractDomainFromURI(signer)
+	if domain == "" || domain != extractDomainFromURI(actorURI) {
+		return "", fmt.Errorf("%w: %s signed for %s", ErrSignerNotActor, signer, actorURI)
+	}
+	instanceActor, err := instanceActorLookup(domain)
+	if err != nil || instanceActor != signer {
+		return "", fmt.Errorf("%w: %s signed for %s", ErrSignerNotActor, signer, actorURI)
+	}
+	return signer, nil
+}
+
+func rememberVerifiedKey(keyID string, key verifiedKey) {
+	verifiedKeysMu.Lock()
+	defer verifiedKeysMu.Unlock()
+	if _, ok := verifiedKeys[keyID]; !ok && len(verifiedKeys) >= maxVerifiedKeys {
+		for evict := range verifiedKeys {
+			delete(verifiedKeys, evict)
+			break
+		}
+	}
+	verifiedKeys[keyID] = key
+}
+
+// ForgetActorKeys drops cached keys of actorURI that differ from publicKeyPEM, so that a key
+// replaced through Update(Person) stops verifying at once
+func ForgetActorKeys(actorURI, publicKeyPEM string) {
+	publicKeyPEM = strings.TrimSpace(publicKeyPEM)
+	verifiedKeysMu.Lock()
+	defer verifiedKeysMu.Unlock()
+	for keyID, key := range verifiedKeys {
+		if key.owner == actorURI && key.publicKeyPEM != publicKeyPEM {
+			delete(verifiedKeys, keyID)
+		}
+	}
+}
+
+// forgetVerifiedKeys clears the verified key cache
+func forgetVerifiedKeys() {
+	verifiedKeysMu.Lock()
+	defer verifiedKeysMu.Unlock()
+	verifiedKeys = make(map[string]verifiedKey)
+}
+
+// LookupActorKey is the default KeyLookup: the remote_actors cache first, then the key document.
+// Refreshed keys are written back to remote_actors.
+func LookupActorKey(ctx context.Context, keyID string, refresh bool) (string, string, error) {
+	actorURI := keyID
+	if idx := strings.Index(actorURI, "#"); idx >= 0 {
+		actorURI = actorURI[:idx]
+	}
+
+	if !refresh {
+		if publicKeyPEM := cachedActorPublicKeyPEM(ctx, actorURI); publicKeyPEM != "" {
+			return actorURI, publicKeyPEM, nil
+		}
+	}
+
+	owner, publicKeyPEM, err := FetchPublicKey(keyID)
+	if err != nil {
+		return "", "", err
+	}
+	if refresh {
+		RefreshRemoteActorKey(ctx, owner, publicKeyPEM)
+	}
+	return owner, publicKeyPEM, nil
+}
@@ -0,0 +1,412 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"splitter/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Thread backfill states
+const (
+	BackfillStatusPending    = "pending"
+	BackfillStatusProcessing = "processing"
+	BackfillStatusFailed     = "failed"
+	BackfillStatusDone       = "done"
+)
+
+const (
+	// backfillMaxAttempts is how often a backfill whose root Note cannot be fetched is retried
+	backfillMaxAttempts = 3
+	// backfillClaimLease is how long a claimed backfill stays locked before another worker may take it
+	backfillClaimLease = 10 * time.Minute
+	// backfillRefreshAfter is how old a finished backfill must be before the thread is walked again
+	backfillRefreshAfter = 15 * time.Minute
+	// backfillMaxPages bounds the pages followed in a single replies or context collection
+	backfillMaxPages = 10
+)
+
+var (
+	backfillPolicyMu sync.RWMutex
+	backfillMaxDepth = 16
+	backfillMaxNotes = 200
+)
+
+// ThreadNoteStore caches a Note fetched while backfilling a thread
+type ThreadNoteStore func(ctx context.Context, note *RemoteNote) error
+
+// ThreadBackfill is a thread_backfills row
+type ThreadBackfill struct {
+	ID           string     `json:"id"`
+	NoteURI      string     `json:"note_uri"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	FetchedCount int        `json:"fetched_count"`
+	LastError    string     `json:"last_error,omitempty"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// ConfigureBackfillPolicy sets how many ancestor and reply levels a backfill follows
+// and how many Notes it fetches per thread.
+func ConfigureBackfillPolicy(maxDepth, maxNotes int) {
+	backfillPolicyMu.Lock()
+	defer backfillPolicyMu.Unlock()
+	if maxDepth > 0 {
+		backfillMaxDepth = maxDepth
+	}
+	if maxNotes > 0 {
+		backfillMaxNotes = maxNotes
+	}
+}
+
+func currentBackfillPolicy() (int, int) {
+	backfillPolicyMu.RLock()
+	defer backfillPolicyMu.RUnlock()
+	return backfillMaxDepth, backfillMaxNotes
+}
+
+// EnsureThreadBackfillSchema creates the thread_backfills table from migration 033 if missing
+func EnsureThreadBackfillSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS thread_backfills (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			note_uri TEXT NOT NULL UNIQUE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			fetched_count INT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			next_attempt_at TIMESTAMPTZ DEFAULT now(),
+			completed_at TIMESTAMPTZ
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_thread_backfills_status_next_attempt ON thread_backfills (status, next_attempt_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.GetDB().Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to ensure thread backfill schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// EnqueueThreadBackfill schedules a backfill of the thread around a remote Note.
+// A thread that was walked recently, or is already queued, is left as it is.
+func EnqueueThreadBackfill(ctx context.Context, noteURI string) (*ThreadBackfill, error) {
+	if !isHTTPURI(noteURI) || isLocalActorURI(noteURI) {
+		return nil, fmt.Errorf("not a remote note: %s", noteURI)
+	}
+
+	_, err := db.GetDB().Exec(ctx,
+		`INSERT INTO thread_backfills (note_uri) VALUES ($1)
+		 ON CONFLICT (note_uri) DO UPDATE
+		 SET status = 'pending', attempts = 0, last_error = NULL, requested_at = now(), next_attempt_at = now()
+		 WHERE thread_backfills.status IN ('done', 'failed')
+		   AND thread_backfills.attempts >= CASE WHEN thread_backfills.status = 'failed' THEN $2 ELSE 0 END
+		   AND COALESCE(thread_backfills.completed_at, thread_backfills.requested_at) < now() - $3::interval`,
+		noteURI, backfillMaxAttempts, formatBackoffInterval(backfillRefreshAfter),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue thread backfill: %w", err)
+	}
+	return GetThreadBackfill(ctx, noteURI)
+}
+
+// GetThreadBackfill returns the backfill state of a thread root
+func GetThreadBackfill(ctx context.Context, noteURI string) (*ThreadBackfill, error) {
+	var job ThreadBackfill
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT id::text, note_uri, status, attempts, fetched_count, COALESCE(last_error, ''), requested_at, completed_at
+		 FROM thread_backfills WHERE note_uri = $1`,
+		noteURI,
+	).Scan(&job.ID, &job.NoteURI, &job.Status, &job.Attempts, &job.FetchedCount, &job.LastError, &job.RequestedAt, &job.CompletedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("thread backfill not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread backfill: %w", err)
+	}
+	return &job, nil
+}
+
+// ProcessThreadBackfillBatch claims due backfills and walks their threads, storing Notes through store.
+func ProcessThreadBackfillBatch(ctx context.Context, batchSize int, store ThreadNoteStore) (int, int, error) {
+	if batchSize <= 0 {
+		batchSize = 5
+	}
+
+	rows, err := db.GetDB().Query(ctx, `
+		UPDATE thread_backfills
+		SET status = 'processing',
+		    attempts = attempts + 1,
+		    next_attempt_at = now() + $2::interval
+		WHERE id IN (
+			SELECT id FROM thread_backfills
+			WHERE status IN ('pending', 'failed', 'processing')
+			  AND attempts < $3
+			  AND COALESCE(next_attempt_at, now()) <= now()
+			ORDER BY requested_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id::text, note_uri, attempts
+	`, batchSize, formatBackoffInterval(backfillClaimLease), backfillMaxAttempts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to claim thread backfills: %w", err)
+	}
+
+	type claimedBackfill struct {
+		id       string
+		noteURI  string
+		attempts int
+	}
+	var claimed []claimedBackfill
+	for rows.Next() {
+		var item claimedBackfill
+		if scanErr := rows.Scan(&item.id, &item.noteURI, &item.attempts); scanErr == nil {
+			claimed = append(claimed, item)
+		}
+	}
+	rows.Close()
+
+	processed := 0
+	failed := 0
+	for _, item := range claimed {
+		processed++
+
+		fetched, walkErr := BackfillThread(ctx, item.noteURI, store)
+		if walkErr == nil {
+			_, err := db.GetDB().Exec(ctx,
+				`UPDATE thread_backfills
+				 SET status = 'done', fetched_count = $2, last_error = NULL, completed_at = now(), next_attempt_at = NULL
+				 WHERE id = $1`,
+				item.id, fetched,
+			)
+			if err != nil {
+				log.Printf("[Backfill] Failed to mark backfill %s done: %v", item.id, err)
+			}
+			log.Printf("[Backfill] Thread of %s backfilled: %d notes", item.noteURI, fetched)
+			continue
+		}
+
+		failed++
+		_, err := db.GetDB().Exec(ctx,
+			`UPDATE thread_backfills
+			 SET status = 'failed', last_error = $2, next_attempt_at = now() + $3::interval
+			 WHERE id = $1`,
+			item.id, walkErr.Error(), formatBackoffInterval(calculateRetryDelay(item.attempts)),
+		)
+		if err != nil {
+			log.Printf("[Backfill] Failed to record backfill failure %s: %v", item.id, err)
+		}
+		log.Printf("[Backfill] Thread of %s failed (attempt %d): %v", item.noteURI, item.attempts, walkErr)
+	}
+
+	return processed, failed, nil
+}
+
+// BackfillThread fetches the conversation around a remote Note: its ancestors, the
+// context collection when the origin offers one, and the replies collections below it,
+// within the configured depth and Note limits. Returns the number of Notes stored.
+// Only a failure to fetch the root Note is an error; other misses are skipped.
+func BackfillThread(ctx context.Context, noteURI string, store ThreadNoteStore) (int, error) {
+	maxDepth, maxNotes := currentBackfillPolicy()
+	walker := &threadWalker{
+		maxDepth:        maxDepth,
+		maxNotes:        maxNotes,
+		fetchNote:       FetchRemoteNote,
+		fetchCollection: FetchCollectionItems,
+		allowed: func(uri string) bool {
+			return !isLocalActorURI(uri) && !IsDomainBlocked(ctx, extractDomainFromURI(uri))
+		},
+		store:   store,
+		visited: make(map[string]bool),
+	}
+	return walker.run(ctx, noteURI)
+}
+
+// threadWalker holds the state of one backfill; the fetchers are swappable for tests
+type threadWalker struct {
+	maxDepth        int
+	maxNotes        int
+	fetchNote       func(uri string) (*RemoteNote, error)
+	fetchCollection func(uri string, limit int) ([]string, error)
+	allowed         func(uri string) bool
+	store           ThreadNoteStore
+
+	visited map[string]bool
+	fetched int
+	stored  int
+}
+
+func (w *threadWalker) run(ctx context.Context, rootURI string) (int, error) {
+	if !w.allowed(rootURI) {
+		return 0, nil
+	}
+	w.visited[rootURI] = true
+	w.fetched++
+	root, err := w.fetchNote(rootURI)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch %s: %w", rootURI, err)
+	}
+	if root == nil || root.Deleted {
+		return 0, nil
+	}
+	w.save(ctx, root)
+
+	// Ancestors, up to a local post or the first Note that cannot be fetched
+	parentURI := root.InReplyTo
+	for depth := 0; depth < w.maxDepth && parentURI != ""; depth++ {
+		parent := w.fetch(ctx, parentURI)
+		if parent == nil {
+			break
+		}
+		parentURI = parent.InReplyTo
+	}
+
+	// The whole conversation, where the origin publishes it
+	if root.Context != "" && !w.full() {
+		items, err := w.fetchCollection(root.Context, w.maxNotes-w.fetched)
+		if err != nil {
+			log.Printf("[Backfill] Failed to fetch context %s: %v", root.Context, err)
+		}
+		for _, uri := range items {
+			if w.full() {
+				break
+			}
+			w.fetch(ctx, uri)
+		}
+	}
+
+	// Descendants, breadth-first through replies collections
+	type queued struct {
+		note  *RemoteNote
+		depth int
+	}
+	queue := []queued{{note: root}}
+	for len(queue) > 0 && !w.full() {
+		item := queue[0]
+		queue = queue[1:]
+		if item.note.Replies == "" || item.depth >= w.maxDepth {
+			continue
+		}
+
+		items, err := w.fetchCollection(item.note.Replies, w.maxNotes-w.fetched)
+		if err != nil {
+			log.Printf("[Backfill] Failed to fetch replies %s: %v", item.note.Replies, err)
+			continue
+		}
+		for _, uri := range items {
+			if w.full() {
+				break
+			}
+			if reply := w.fetch(ctx, uri); reply != nil {
+				queue = append(queue, queued{note: reply, depth: item.depth + 1})
+			}
+		}
+	}
+
+	return w.stored, nil
+}
+
+func (w *threadWalker) full() bool {
+	return w.fetched >= w.maxNotes
+}
+
+// fetch retrieves and stores a Note, returning nil if it was skipped or unavailable
+func (w *threadWalker) fetch(ctx context.Context, uri string) *RemoteNote {
+	if uri == "" || w.visited[uri] || w.full() || !isHTTPURI(uri) || !w.allowed(uri) {
+		return nil
+	}
+	w.visited[uri] = true
+	w.fetched++
+
+	note, err := w.fetchNote(uri)
+	if err != nil {
+		log.Printf("[Backfill] Failed to fetch %s: %v", uri, err)
+		return nil
+	}
+	if note == nil || note.Deleted {
+		return nil
+	}
+	w.visited[note.ID] = true
+	w.save(ctx, note)
+	return note
+}
+
+func (w *threadWalker) save(ctx context.Context, note *RemoteNote) {
+	if w.store == nil {
+		return
+	}
+	if err := w.store(ctx, note); err != nil {
+		log.Printf("[Backfill] Failed to store %s: %v", note.ID, err)
+		return
+	}
+	w.stored++
+}
+
+// FetchCollectionItems returns up to limit item IDs of a Collection or OrderedCollection,
+// following its first and next pages. Items may be URIs or embedded objects.
+func FetchCollectionItems(collectionURI string, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	page, _, err := fetchActivityObject(collectionURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []string
+	seenPages := map[string]bool{collectionURI: true}
+	for pages := 0; page != nil && pages < backfillMaxPages && len(items) < limit; pages++ {
+		items = append(items, collectionItemIDs(page)...)
+
+		next := page["next"]
+		if first, ok := page["first"]; ok && first != nil {
+			next = first
+		}
+		switch v := next.(type) {
+		case map[string]interface{}:
+			page = v // embedded page, as Mastodon does for replies
+		case string:
+			if v == "" || seenPages[v] {
+				page = nil
+				continue
+			}
+			seenPages[v] = true
+			if page, _, err = fetchActivityObject(v); err != nil {
+				log.Printf("[Backfill] Failed to fetch collection page %s: %v", v, err)
+				page = nil
+			}
+		default:
+			page = nil
+		}
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// collectionItemIDs returns the IDs listed in a collection page
+func collectionItemIDs(page map[string]interface{}) []string {
+	var ids []string
+	for _, key := range []string{"orderedItems", "items"} {
+		list, ok := page[key].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			if id := objectReference(item); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
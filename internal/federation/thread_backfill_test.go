@@ -0,0 +1,133 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// fakeThread is a remote conversation: root has two ancestors, two replies and a nested reply
+func fakeThread() (map[string]*RemoteNote, map[string][]string) {
+	notes := map[string]*RemoteNote{
+		"https://a.test/n/grandparent": {ID: "https://a.test/n/grandparent"},
+		"https://a.test/n/parent":      {ID: "https://a.test/n/parent", InReplyTo: "https://a.test/n/grandparent"},
+		"https://a.test/n/root": {
+			ID: "https://a.test/n/root", InReplyTo: "https://a.test/n/parent",
+			Replies: "https://a.test/n/root/replies", Context: "https://a.test/ctx/1",
+		},
+		"https://b.test/n/reply1":  {ID: "https://b.test/n/reply1", InReplyTo: "https://a.test/n/root", Replies: "https://b.test/n/reply1/replies"},
+		"https://c.test/n/reply2":  {ID: "https://c.test/n/reply2", InReplyTo: "https://a.test/n/root"},
+		"https://a.test/n/nested":  {ID: "https://a.test/n/nested", InReplyTo: "https://b.test/n/reply1"},
+		"https://d.test/n/sibling": {ID: "https://d.test/n/sibling", InReplyTo: "https://a.test/n/grandparent"},
+	}
+	collections := map[string][]string{
+		"https://a.test/n/root/replies":   {"https://b.test/n/reply1", "https://c.test/n/reply2"},
+		"https://b.test/n/reply1/replies": {"https://a.test/n/nested"},
+		"https://a.test/ctx/1":            {"https://a.test/n/grandparent", "https://a.test/n/root", "https://d.test/n/sibling"},
+	}
+	return notes, collections
+}
+
+func newTestWalker(maxDepth, maxNotes int, allowed func(string) bool) (*threadWalker, *[]string) {
+	notes, collections := fakeThread()
+	var stored []string
+	return &threadWalker{
+		maxDepth: maxDepth,
+		maxNotes: maxNotes,
+		fetchNote: func(uri string) (*RemoteNote, error) {
+			if note, ok := notes[uri]; ok {
+				return note, nil
+			}
+			return nil, fmt.Errorf("not found")
+		},
+		fetchCollection: func(uri string, limit int) ([]string, error) {
+			items := collections[uri]
+			if len(items) > limit {
+				items = items[:limit]
+			}
+			return items, nil
+		},
+		allowed: allowed,
+		store: func(ctx context.Context, note *RemoteNote) error {
+			stored = append(stored, note.ID)
+			return nil
+		},
+		visited: make(map[string]bool),
+	}, &stored
+}
+
+func allowAll(string) bool { return true }
+
+func TestThreadWalkerFetchesWholeConversation(t *testing.T) {
+	walker, stored := newTestWalker(16, 100, allowAll)
+
+	count, err := walker.run(context.Background(), "https://a.test/n/root")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := append([]string(nil), *stored...)
+	sort.Strings(got)
+	want := []string{
+		"https://a.test/n/grandparent",
+		"https://a.test/n/nested",
+		"https://a.test/n/parent",
+		"https://a.test/n/root",
+		"https://b.test/n/reply1",
+		"https://c.test/n/reply2",
+		"https://d.test/n/sibling",
+	}
+	if count != len(want) || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v (%d), got %v (%d)", want, len(want), got, count)
+	}
+}
+
+func TestThreadWalkerRespectsLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		maxNotes int
+		allowed  func(string) bool
+		want     int
+	}{
+		{"note limit", 16, 3, allowAll, 3},
+		{"depth limit stops nested replies", 1, 100, allowAll, 6},
+		{"disallowed domains are skipped", 16, 100, func(uri string) bool { return extractDomainFromURI(uri) != "b.test" }, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walker, stored := newTestWalker(tt.maxDepth, tt.maxNotes, tt.allowed)
+			count, err := walker.run(context.Background(), "https://a.test/n/root")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != tt.want {
+				t.Fatalf("expected %d notes, got %d: %v", tt.want, count, *stored)
+			}
+		})
+	}
+}
+
+func TestThreadWalkerFailsWhenRootIsUnavailable(t *testing.T) {
+	walker, _ := newTestWalker(16, 100, allowAll)
+	if _, err := walker.run(context.Background(), "https://a.test/n/missing"); err == nil {
+		t.Fatalf("expected an error for an unavailable root")
+	}
+}
+
+func TestCollectionItemIDs(t *testing.T) {
+	page := map[string]interface{}{
+		"orderedItems": []interface{}{
+			"https://a.test/n/1",
+			map[string]interface{}{"id": "https://a.test/n/2", "type": "Note"},
+			map[string]interface{}{"type": "Note"},
+			42,
+		},
+	}
+	got := collectionItemIDs(page)
+	if fmt.Sprint(got) != "[https://a.test/n/1 https://a.test/n/2]" {
+		t.Fatalf("unexpected items %v", got)
+	}
+}
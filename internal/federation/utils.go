@@ -12,6 +12,8 @@ import (
 
 	"splitter/internal/db"
 	"splitter/internal/models"
+
+	"github.com/google/uuid"
 )
 
 // EnsureRemoteUser ensures a remote actor exists in the local users table
@@ -85,16 +87,31 @@ func EnsureRemoteUser(ctx context.Context, actorURI string) (*models.User, error
 	return &user, nil
 }
 
+// MessageNoteURI returns the Note ID of a local direct message. Edits, deletions and
+// read receipts of the message refer to it.
+func MessageNoteURI(messageID string) string {
+	return fmt.Sprintf("%s/messages/%s", resolveInstanceURL(GetInstanceDomain()), messageID)
+}
+
+// MessageIDFromNoteURI returns the ID of the local message a Note ID refers to, or ""
+func MessageIDFromNoteURI(noteURI string) string {
+	messageID, ok := strings.CutPrefix(noteURI, MessageNoteURI(""))
+	if !ok {
+		return ""
+	}
+	if _, err := uuid.Parse(messageID); err != nil {
+		return ""
+	}
+	return messageID
+}
+
 // BuildCreateDMActivity creates a Create activity wrapping a Note (DM)
-func BuildCreateDMActivity(actorURI, recipientURI, content, ciphertext string, encryptedKeys map[string]string) *Activity {
+func BuildCreateDMActivity(actorURI, messageID, recipientURI, content, ciphertext string, encryptedKeys map[string]string) *Activity {
 	domain := GetInstanceDomain()
 	baseURL := resolveInstanceURL(domain)
 
-	// Generate IDs
-	postID := fmt.Sprintf("%d", time.Now().UnixNano())
-
 	note := Note{
-		ID:            fmt.Sprintf("%s/posts/%s", baseURL, postID),
+		ID:            MessageNoteURI(messageID),
 		Type:          "Note",
 		AttributedTo:  actorURI,
 		Content:       content,
@@ -102,11 +119,14 @@ func BuildCreateDMActivity(actorURI, recipientURI, content, ciphertext string, e
 		EncryptedKeys: encryptedKeys,
 		Published:     time.Now().UTC().Format(time.RFC3339),
 		To:            []string{recipientURI}, // Addressed to specific user only
+		// Mentioning every recipient is what marks a privately addressed Note as a
+		// direct message rather than a limited (circle) post
+		Tag: []NoteTag{{Type: "Mention", Href: recipientURI}},
 	}
 
 	return &Activity{
 		Context: "https://www.w3.org/ns/activitystreams",
-		ID:      fmt.Sprintf("%s/activities/create-%s", baseURL, postID),
+		ID:      fmt.Sprintf("%s/activities/create-%s", baseURL, messageID),
 		Type:    "Create",
 		Actor:   actorURI,
 		Object:  note,
@@ -114,6 +134,119 @@ func BuildCreateDMActivity(actorURI, recipientURI, content, ciphertext string, e
 	}
 }
 
+// BuildCreateGroupDMActivity creates a Create activity for a message to a group conversation.
+// The Note is addressed to and mentions every other participant, and carries the
+// conversation's context URI so each server files it into the same group thread.
+func BuildCreateGroupDMActivity(actorURI, messageID, contextURI string, recipientURIs []string, content, ciphertext string, encryptedKeys map[string]string) *Activity {
+	domain := GetInstanceDomain()
+	baseURL := resolveInstanceURL(domain)
+
+	to := make([]string, 0, len(recipientURIs))
+	tags := make([]NoteTag, 0, len(recipientURIs))
+	for _, uri := range recipientURIs {
+		if uri == "" || uri == actorURI {
+			continue
+		}
+		to = append(to, uri)
+		tags = append(tags, NoteTag{Type: "Mention", Href: uri})
+	}
+
+	note := Note{
+		ID:            MessageNoteURI(messageID),
+		Type:          "Note",
+		AttributedTo:  actorURI,
+		Content:       content,
+		Ciphertext:    ciphertext,
+		EncryptedKeys: encryptedKeys,
+		Published:     time.Now().UTC().Format(time.RFC3339),
+		To:            to,
+		Tag:           tags,
+		Conversation:  contextURI,
+	}
+
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/create-%s", baseURL, messageID),
+		Type:    "Create",
+		Actor:   actorURI,
+		Object:  note,
+		To:      to,
+	}
+}
+
+// BuildUpdateDMActivity creates an Update activity carrying the edited Note of a direct
+// message, addressed to the remote participants of its conversation
+func BuildUpdateDMActivity(actorURI, messageID string, recipientURIs []string, content, ciphertext string, editedAt time.Time) *Activity {
+	baseURL := resolveInstanceURL(GetInstanceDomain())
+
+	note := Note{
+		ID:           MessageNoteURI(messageID),
+		Type:         "Note",
+		AttributedTo: actorURI,
+		Content:      content,
+		Ciphertext:   ciphertext,
+		Updated:      editedAt.UTC().Format(time.RFC3339),
+		To:           recipientURIs,
+	}
+
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/update-%s-%d", baseURL, messageID, editedAt.UnixNano()),
+		Type:    "Update",
+		Actor:   actorURI,
+		Object:  note,
+		To:      recipientURIs,
+	}
+}
+
+// BuildDeleteDMActivity creates a Delete activity for a direct message deleted for everyone.
+// Unlike BuildDeleteActivity it is addressed to the participants only.
+func BuildDeleteDMActivity(actorURI, messageID string, recipientURIs []string) *Activity {
+	baseURL := resolveInstanceURL(GetInstanceDomain())
+
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/delete-%s", baseURL, messageID),
+		Type:    "Delete",
+		Actor:   actorURI,
+		Object:  MessageNoteURI(messageID),
+		To:      recipientURIs,
+	}
+}
+
+// BuildReadActivity creates a read receipt: the actor has read noteURI, the newest
+// direct message they received from recipientURI, and everything before it
+func BuildReadActivity(actorURI, noteURI, recipientURI string) *Activity {
+	baseURL := resolveInstanceURL(GetInstanceDomain())
+
+	return &Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("%s/activities/read-%d", baseURL, time.Now().UnixNano()),
+		Type:    "Read",
+		Actor:   actorURI,
+		Object:  noteURI,
+		To:      []string{recipientURI},
+	}
+}
+
+// RejectedFollower returns the local actor whose Follow a Reject activity refuses.
+// The object is the original Follow, either embedded or by ID; our Follow IDs are
+// <local actor URI>/activities/follow-<n>, so the ID leads back to the follower.
+// Returns false when the Reject is not about a Follow.
+func RejectedFollower(activity map[string]interface{}) (string, bool) {
+	switch obj := activity["object"].(type) {
+	case map[string]interface{}:
+		if objType, _ := obj["type"].(string); objType != "" && objType != "Follow" {
+			return "", false
+		}
+		followerURI, _ := obj["actor"].(string)
+		return followerURI, followerURI != ""
+	case string:
+		return obj, obj != ""
+	}
+	return "", false
+}
+
 // resolveActorFromURI resolves a remote actor from their URI
 func resolveActorFromURI(actorURI string) (*RemoteActor, error) {
 	username := extractUsernameFromURI(actorURI)
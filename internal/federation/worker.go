@@ -185,18 +185,25 @@ func RetryOutboxBatch(ctx context.Context, batchSize int) (int, int, error) {
 }
 
 // RecalculateInstanceReputation recomputes domain reputation using spam + failure signals.
+// Delivery signals come from the last 24 hours of outbox_activities plus the daily rollups
+// of rows the retention job has already removed.
 func RecalculateInstanceReputation(ctx context.Context) error {
+	deliveries, err := OutboundDeliveryCounts(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+
 	domainsRows, err := db.GetDB().Query(ctx, `
 		WITH outbox_domains AS (
-			SELECT DISTINCT regexp_replace(target_inbox, '^https?://([^/]+)/?.*$', '\\1') AS domain
+			SELECT DISTINCT `+outboxDomainSQL+` AS domain
 			FROM outbox_activities
-			WHERE target_inbox ILIKE 'http%'
 		)
 		SELECT DISTINCT domain FROM (
 			SELECT domain FROM remote_actors WHERE COALESCE(domain, '') <> ''
 			UNION SELECT domain FROM blocked_domains
 			UNION SELECT domain FROM federation_failures
 			UNION SELECT domain FROM outbox_domains WHERE COALESCE(domain, '') <> ''
+			UNION SELECT domain FROM federation_delivery_daily WHERE direction = 'outbound'
 		) d
 		WHERE COALESCE(domain, '') <> ''
 	`)
@@ -212,8 +219,8 @@ func RecalculateInstanceReputation(ctx context.Context) error {
 		}
 
 		var spamSignals int
-		var failureSignals int
-		var successSignals int
+		failureSignals := int(deliveries[domain].Failure)
+		successSignals := int(deliveries[domain].Success)
 
 		_ = db.GetDB().QueryRow(ctx, `
 			SELECT COUNT(*)
@@ -224,22 +231,6 @@ func RecalculateInstanceReputation(ctx context.Context) error {
 			  AND created_at > now() - interval '30 days'
 		`, domain).Scan(&spamSignals)
 
-		_ = db.GetDB().QueryRow(ctx, `
-			SELECT COUNT(*)
-			FROM outbox_activities
-			WHERE target_inbox ILIKE '%' || $1 || '%'
-			  AND status = 'failed'
-			  AND created_at > now() - interval '24 hours'
-		`, domain).Scan(&failureSignals)
-
-		_ = db.GetDB().QueryRow(ctx, `
-			SELECT COUNT(*)
-			FROM outbox_activities
-			WHERE target_inbox ILIKE '%' || $1 || '%'
-			  AND status = 'sent'
-			  AND created_at > now() - interval '24 hours'
-		`, domain).Scan(&successSignals)
-
 		score := 100 - (spamSignals * 20) - (failureSignals * 5) + (successSignals * 2)
 		if score < 0 {
 			score = 0
@@ -14,13 +14,14 @@ import (
 
 // ActorHandler handles ActivityPub Actor endpoints
 type ActorHandler struct {
-	userRepo *repository.UserRepository
-	cfg      *config.Config
+	userRepo   *repository.UserRepository
+	prekeyRepo *repository.PrekeyRepository
+	cfg        *config.Config
 }
 
 // NewActorHandler creates a new ActorHandler
 func NewActorHandler(userRepo *repository.UserRepository, cfg *config.Config) *ActorHandler {
-	return &ActorHandler{userRepo: userRepo, cfg: cfg}
+	return &ActorHandler{userRepo: userRepo, prekeyRepo: repository.NewPrekeyRepository(), cfg: cfg}
 }
 
 // ActorResponse represents an ActivityPub Actor (Person) object
@@ -32,10 +33,14 @@ type ActorResponse struct {
 	Name              string          `json:"name"`
 	Summary           string          `json:"summary,omitempty"`
 	Inbox             string          `json:"inbox"`
-	Outbox            string          `json:"outbox"`
-	Followers         string          `json:"followers"`
-	Following         string          `json:"following"`
+	Outbox            string          `json:"outbox,omitempty"`
+	Followers         string          `json:"followers,omitempty"`
+	Following         string          `json:"following,omitempty"`
 	EncryptionPubKey  string          `json:"encryption_public_key,omitempty"`
+	Prekeys           string          `json:"prekeys,omitempty"` // Device prekey bundles; POST claims one-time prekeys
+	AlsoKnownAs       []string        `json:"alsoKnownAs,omitempty"`
+	MovedTo           string          `json:"movedTo,omitempty"` // Set once the account has moved; the actor is then a tombstone
+	Endpoints         *ActorEndpoints `json:"endpoints,omitempty"`
 	Icon              *ActorIcon      `json:"icon,omitempty"`
 	PublicKey         *ActorPublicKey `json:"publicKey"`
 }
@@ -47,6 +52,11 @@ type ActorIcon struct {
 	URL       string `json:"url"`
 }
 
+// ActorEndpoints lists instance-wide endpoints such as the shared inbox
+type ActorEndpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
 // ActorPublicKey represents the actor's public key for signature verification
 type ActorPublicKey struct {
 	ID           string `json:"id"`
@@ -71,7 +81,7 @@ func (h *ActorHandler) GetActor(c echo.Context) error {
 	}
 
 	// Look up local user
-	user, _, err := h.userRepo.GetByUsername(c.Request().Context(), username)
+	user, err := h.userRepo.GetLocalByUsername(c.Request().Context(), username, h.cfg.Federation.Domain)
 	if err != nil || user == nil {
 		return c.JSON(http.StatusNotFound, map[string]string{
 			"error": "user not found",
@@ -81,8 +91,13 @@ func (h *ActorHandler) GetActor(c echo.Context) error {
 	baseURL := h.cfg.Federation.URL
 	actorID := fmt.Sprintf("%s/ap/users/%s", baseURL, username)
 
-	// Use instance public key for federation signatures
-	publicKeyPEM := federation.GetInstancePublicKeyPEM()
+	// Each local user signs deliveries with their own keypair
+	publicKeyPEM, err := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to load actor key",
+		})
+	}
 
 	actor := ActorResponse{
 		Context: []interface{}{
@@ -99,6 +114,10 @@ func (h *ActorHandler) GetActor(c echo.Context) error {
 		Followers:         fmt.Sprintf("%s/ap/users/%s/followers", baseURL, username),
 		Following:         fmt.Sprintf("%s/ap/users/%s/following", baseURL, username),
 		EncryptionPubKey:  user.EncryptionPublicKey,
+		Prekeys:           actorID + "/prekeys",
+		AlsoKnownAs:       user.AlsoKnownAs,
+		MovedTo:           user.MovedTo,
+		Endpoints:         &ActorEndpoints{SharedInbox: baseURL + "/ap/shared-inbox"},
 		PublicKey: &ActorPublicKey{
 			ID:           actorID + "#main-key",
 			Owner:        actorID,
@@ -117,3 +136,31 @@ func (h *ActorHandler) GetActor(c echo.Context) error {
 	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
 	return c.JSON(http.StatusOK, actor)
 }
+
+// GetInstanceActor returns the instance-level Application actor.
+// It owns the instance keypair and signs requests not made on behalf of a user.
+// GET /ap/actor
+func (h *ActorHandler) GetInstanceActor(c echo.Context) error {
+	baseURL := h.cfg.Federation.URL
+	actorID := baseURL + "/ap/actor"
+
+	actor := ActorResponse{
+		Context: []interface{}{
+			"https://www.w3.org/ns/activitystreams",
+			"https://w3id.org/security/v1",
+		},
+		ID:                actorID,
+		Type:              "Application",
+		PreferredUsername: h.cfg.Federation.Domain,
+		Name:              h.cfg.Federation.Domain,
+		Inbox:             baseURL + "/ap/shared-inbox",
+		PublicKey: &ActorPublicKey{
+			ID:           actorID + "#main-key",
+			Owner:        actorID,
+			PublicKeyPEM: federation.GetInstancePublicKeyPEM(),
+		},
+	}
+
+	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+	return c.JSON(http.StatusOK, actor)
+}
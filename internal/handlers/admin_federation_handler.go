@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"splitter/internal/federation"
+	"splitter/internal/helpers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetInboxQueue lists inbound activities waiting, retrying or dead-lettered in the inbox queue.
+// Filter with ?status=pending|processing|failed|dead|processed (default: everything not processed).
+// GET /api/v1/admin/federation/inbox
+func (h *AdminHandler) GetInboxQueue(c echo.Context) error {
+	if err := h.requireModOrAdmin(c); err != nil {
+		return err
+	}
+
+	status := strings.TrimSpace(strings.ToLower(c.QueryParam("status")))
+	switch status {
+	case "", federation.InboxStatusPending, federation.InboxStatusProcessing, federation.InboxStatusFailed,
+		federation.InboxStatusDead, federation.InboxStatusProcessed:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid status filter"})
+	}
+
+	limit, offset := helpers.ParsePagination(c.QueryParam("limit"), c.QueryParam("offset"))
+
+	items, err := federation.ListInboxActivities(c.Request().Context(), status, limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch inbox queue: " + err.Error()})
+	}
+
+	stats, err := federation.GetInboxQueueStats(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch inbox stats: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items":  items,
+		"counts": stats,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// ReplayInboxActivity re-queues a dead-lettered inbound activity for processing
+// POST /api/v1/admin/federation/inbox/:id/replay
+func (h *AdminHandler) ReplayInboxActivity(c echo.Context) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Activity ID required"})
+	}
+
+	if err := federation.ReplayInboxActivity(c.Request().Context(), id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Dead-lettered activity not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to replay activity: " + err.Error()})
+	}
+
+	adminID := c.Get("user_id").(string)
+	h.logAdminAction(adminID, "replay_inbox_activity", id, "")
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Activity re-queued: " + id})
+}
+
+// GetKnownInstances lists the peer servers in the known_instances registry
+// GET /api/v1/admin/federation/instances
+func (h *AdminHandler) GetKnownInstances(c echo.Context) error {
+	if err := h.requireModOrAdmin(c); err != nil {
+		return err
+	}
+
+	instances, err := federation.ListKnownInstances(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch known instances: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"instances": instances,
+		"total":     len(instances),
+	})
+}
+
+// PinKnownInstance pins a peer so it is always probed and queried by the federated timeline
+// PUT /api/v1/admin/federation/instances/:domain/pin
+func (h *AdminHandler) PinKnownInstance(c echo.Context) error {
+	return h.setKnownInstancePinned(c, true)
+}
+
+// UnpinKnownInstance clears the pinned flag of a peer
+// DELETE /api/v1/admin/federation/instances/:domain/pin
+func (h *AdminHandler) UnpinKnownInstance(c echo.Context) error {
+	return h.setKnownInstancePinned(c, false)
+}
+
+func (h *AdminHandler) setKnownInstancePinned(c echo.Context, pinned bool) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	domain := strings.TrimSpace(strings.ToLower(c.Param("domain")))
+	if domain == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Domain required"})
+	}
+
+	if err := federation.SetKnownInstancePinned(c.Request().Context(), domain, pinned); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Instance not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update instance: " + err.Error()})
+	}
+
+	action := "unpin_instance"
+	if pinned {
+		action = "pin_instance"
+	}
+	adminID := c.Get("user_id").(string)
+	h.logAdminAction(adminID, action, domain, "")
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"domain": domain, "pinned": pinned})
+}
+
+// RemoveKnownInstance deletes a peer from the registry. The instance is
+// registered again if it contacts us later; use domain blocking to refuse it.
+// DELETE /api/v1/admin/federation/instances/:domain
+func (h *AdminHandler) RemoveKnownInstance(c echo.Context) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	domain := strings.TrimSpace(strings.ToLower(c.Param("domain")))
+	if domain == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Domain required"})
+	}
+
+	if err := federation.RemoveKnownInstance(c.Request().Context(), domain); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Instance not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove instance: " + err.Error()})
+	}
+
+	adminID := c.Get("user_id").(string)
+	h.logAdminAction(adminID, "remove_instance", domain, "")
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Instance removed: " + domain})
+}
+
+// GetRelays lists relay subscriptions with their traffic counters
+// GET /api/v1/admin/federation/relays
+func (h *AdminHandler) GetRelays(c echo.Context) error {
+	if err := h.requireModOrAdmin(c); err != nil {
+		return err
+	}
+
+	relays, err := federation.ListRelays(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch relays: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"relays": relays,
+		"total":  len(relays),
+	})
+}
+
+// SubscribeRelay follows an ActivityPub relay as the instance actor
+// POST /api/v1/admin/federation/relays
+func (h *AdminHandler) SubscribeRelay(c echo.Context) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Relay URL required"})
+	}
+
+	relay, err := federation.SubscribeRelay(c.Request().Context(), req.URL)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to subscribe to relay: " + err.Error()})
+	}
+
+	adminID := c.Get("user_id").(string)
+	h.logAdminAction(adminID, "subscribe_relay", relay.InboxURL, "")
+
+	return c.JSON(http.StatusCreated, relay)
+}
+
+// UnsubscribeRelay undoes the Follow of a relay; its counters are kept
+// DELETE /api/v1/admin/federation/relays/:id
+func (h *AdminHandler) UnsubscribeRelay(c echo.Context) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Relay ID required"})
+	}
+
+	relay, err := federation.UnsubscribeRelay(c.Request().Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Relay not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unsubscribe relay: " + err.Error()})
+	}
+
+	adminID := c.Get("user_id").(string)
+	h.logAdminAction(adminID, "unsubscribe_relay", relay.InboxURL, "")
+
+	return c.JSON(http.StatusOK, relay)
+}
+
+// GetRetentionStatus reports the retention policy, the size of the federation
+// bookkeeping tables, the last retention run and the last run that deleted rows
+// GET /api/v1/admin/federation/retention
+func (h *AdminHandler) GetRetentionStatus(c echo.Context) error {
+	if err := h.requireModOrAdmin(c); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	tables, err := federation.GetRetentionTableSizes(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch table sizes: " + err.Error()})
+	}
+	lastRun, err := federation.GetLastRetentionRun(ctx, false)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch last retention run: " + err.Error()})
+	}
+	lastCompaction, err := federation.GetLastRetentionRun(ctx, true)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch last compaction: " + err.Error()})
+	}
+
+	policy := federation.CurrentRetentionPolicy()
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"policy": map[string]interface{}{
+			"outbox_ttl_days":      int(policy.OutboxTTL.Hours() / 24),
+			"inbox_ttl_days":       int(policy.InboxTTL.Hours() / 24),
+			"dedup_ttl_days":       int(policy.DedupTTL.Hours() / 24),
+			"connections_ttl_days": int(policy.ConnectionsTTL.Hours() / 24),
+			"batch_size":           policy.BatchSize,
+			"dry_run":              policy.DryRun,
+		},
+		"tables":          tables,
+		"last_run":        lastRun,
+		"last_compaction": lastCompaction,
+	})
+}
+
+// RunRetention runs the retention job now. It is a dry run that only counts unless
+// ?dry_run=false is given.
+// POST /api/v1/admin/federation/retention/run
+func (h *AdminHandler) RunRetention(c echo.Context) error {
+	if err := h.requireAdmin(c); err != nil {
+		return err
+	}
+
+	dryRun := strings.TrimSpace(strings.ToLower(c.QueryParam("dry_run"))) != "false"
+	run, err := federation.RunRetention(c.Request().Context(), dryRun)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Retention run failed: " + err.Error()})
+	}
+
+	if !dryRun {
+		adminID := c.Get("user_id").(string)
+		h.logAdminAction(adminID, "run_retention", run.ID, "")
+	}
+
+	return c.JSON(http.StatusOK, run)
+}
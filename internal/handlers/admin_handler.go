@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"splitter/internal/db"
+	"splitter/internal/federation"
 	"splitter/internal/repository"
 	"splitter/internal/security"
 
@@ -458,7 +459,7 @@ func (h *AdminHandler) GetModerationQueue(c echo.Context) error {
 			r.created_at
 		FROM reports r
 		LEFT JOIN posts p ON p.id = r.post_id
-		LEFT JOIN users u ON u.did = p.author_did
+		LEFT JOIN users u ON u.did = COALESCE(p.author_did, r.target_did)
 		WHERE COALESCE(r.status, 'pending') = 'pending'
 		ORDER BY r.created_at DESC
 		LIMIT 200
@@ -737,8 +738,36 @@ func (h *AdminHandler) GetFederationInspector(c echo.Context) error {
 		ReputationScore int
 	}
 
+	// Weekly delivery totals outlive the raw outbox rows through the rollups
+	weekly, err := federation.OutboundDeliveryCounts(ctx, time.Now().Add(-7*24*time.Hour))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch delivery history: " + err.Error()})
+	}
+
+	// Traffic is grouped by the host of each row in one pass per table. Last-seen times
+	// also come from the daily rollups of rows the retention job has removed.
 	serverRows, err := db.GetDB().Query(ctx, `
-		WITH domains AS (
+		WITH inbound AS (
+			SELECT
+				substring(actor_uri from '^https?://([^/]+)') AS domain,
+				MAX(received_at) AS last_at,
+				COUNT(*) FILTER (WHERE received_at > now() - interval '1 minute') AS incoming_m
+			FROM inbox_activities
+			GROUP BY 1
+		), outbound AS (
+			SELECT
+				substring(target_inbox from '^https?://([^/]+)') AS domain,
+				MAX(created_at) AS last_at,
+				COUNT(*) FILTER (WHERE created_at > now() - interval '1 minute') AS outgoing_m,
+				COUNT(*) FILTER (WHERE status = 'failed' AND created_at > now() - interval '1 hour') AS failed_h,
+				COUNT(*) FILTER (WHERE status IN ('pending','failed')) AS retry_queue
+			FROM outbox_activities
+			GROUP BY 1
+		), archived AS (
+			SELECT domain, MAX(last_activity_at) AS last_at
+			FROM federation_delivery_daily
+			GROUP BY domain
+		), domains AS (
 			SELECT DISTINCT domain FROM remote_actors WHERE domain IS NOT NULL AND domain != ''
 			UNION
 			SELECT DISTINCT domain FROM blocked_domains
@@ -747,25 +776,27 @@ func (h *AdminHandler) GetFederationInspector(c echo.Context) error {
 			UNION
 			SELECT DISTINCT domain FROM federation_failures
 			UNION
-			SELECT DISTINCT regexp_replace(target_inbox, '^https?://([^/]+)/?.*$', '\\1') AS domain
-			FROM outbox_activities
-			WHERE target_inbox ILIKE 'http%'
+			SELECT domain FROM outbound
 		)
 		SELECT
 			d.domain,
 			EXISTS(SELECT 1 FROM blocked_domains b WHERE b.domain = d.domain) AS blocked,
 			GREATEST(
-				COALESCE((SELECT MAX(i.received_at) FROM inbox_activities i WHERE i.actor_uri ILIKE '%' || d.domain || '%'), 'epoch'::timestamptz),
-				COALESCE((SELECT MAX(o.created_at) FROM outbox_activities o WHERE o.target_inbox ILIKE '%' || d.domain || '%'), 'epoch'::timestamptz),
+				COALESCE(i.last_at, 'epoch'::timestamptz),
+				COALESCE(o.last_at, 'epoch'::timestamptz),
+				COALESCE(a.last_at, 'epoch'::timestamptz),
 				COALESCE((SELECT MAX(r.last_fetched_at) FROM remote_actors r WHERE r.domain = d.domain), 'epoch'::timestamptz)
 			) AS last_seen,
-			COALESCE((SELECT COUNT(*) FROM inbox_activities i WHERE i.actor_uri ILIKE '%' || d.domain || '%' AND i.received_at > now() - interval '1 minute'), 0) AS incoming_m,
-			COALESCE((SELECT COUNT(*) FROM outbox_activities o WHERE o.target_inbox ILIKE '%' || d.domain || '%' AND o.created_at > now() - interval '1 minute'), 0) AS outgoing_m,
-			COALESCE((SELECT COUNT(*) FROM outbox_activities o WHERE o.target_inbox ILIKE '%' || d.domain || '%' AND o.status = 'failed' AND o.created_at > now() - interval '1 hour'), 0) AS failed_h,
-			COALESCE((SELECT COUNT(*) FROM outbox_activities o WHERE o.target_inbox ILIKE '%' || d.domain || '%' AND o.status IN ('pending','failed')), 0) AS retry_queue,
+			COALESCE(i.incoming_m, 0) AS incoming_m,
+			COALESCE(o.outgoing_m, 0) AS outgoing_m,
+			COALESCE(o.failed_h, 0) AS failed_h,
+			COALESCE(o.retry_queue, 0) AS retry_queue,
 			COALESCE((SELECT ff.circuit_open_until > now() FROM federation_failures ff WHERE ff.domain = d.domain), false) AS circuit_open,
 			COALESCE((SELECT ir.reputation_score FROM instance_reputation ir WHERE ir.domain = d.domain), 100) AS reputation_score
 		FROM domains d
+		LEFT JOIN inbound i ON i.domain = d.domain
+		LEFT JOIN outbound o ON o.domain = d.domain
+		LEFT JOIN archived a ON a.domain = d.domain
 		WHERE d.domain IS NOT NULL AND d.domain != ''
 		ORDER BY d.domain
 	`)
@@ -807,20 +838,21 @@ func (h *AdminHandler) GetFederationInspector(c echo.Context) error {
 			"failed_h":         row.FailedH,
 			"circuit_open":     row.CircuitOpen,
 			"activities_m":     row.IncomingM + row.OutgoingM,
+			"sent_7d":          weekly[row.Domain].Success,
+			"failed_7d":        weekly[row.Domain].Failure,
 		})
 	}
 
 	failingRows, err := db.GetDB().Query(ctx, `
 		WITH parsed AS (
 			SELECT
-				regexp_replace(target_inbox, '^https?://([^/]+)/?.*$', '\\1') AS domain,
+				substring(target_inbox from '^https?://([^/]+)') AS domain,
 				retry_count,
 				status,
 				next_retry_at,
 				last_error
 			FROM outbox_activities
-			WHERE target_inbox ILIKE 'http%'
-			  AND status IN ('pending','failed')
+			WHERE status IN ('pending','failed')
 		)
 		SELECT
 			domain,
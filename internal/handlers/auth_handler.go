@@ -24,6 +24,7 @@ import (
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
 	userRepo   *repository.UserRepository
+	prekeyRepo *repository.PrekeyRepository
 	cfg        *config.Config
 	jwtSecret  string
 	challenges map[string]*models.AuthChallenge // In-memory challenge store
@@ -34,6 +35,7 @@ type AuthHandler struct {
 func NewAuthHandler(userRepo *repository.UserRepository, cfg *config.Config) *AuthHandler {
 	handler := &AuthHandler{
 		userRepo:   userRepo,
+		prekeyRepo: repository.NewPrekeyRepository(),
 		cfg:        cfg,
 		jwtSecret:  cfg.JWT.Secret,
 		challenges: make(map[string]*models.AuthChallenge),
@@ -47,6 +49,12 @@ func NewAuthHandler(userRepo *repository.UserRepository, cfg *config.Config) *Au
 
 // Register handles user registration with username/email/password
 func (h *AuthHandler) Register(c echo.Context) error {
+	if h.cfg != nil && !h.cfg.Server.RegistrationsOpen {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Registrations are closed on this instance",
+		})
+	}
+
 	var req models.UserCreate
 
 	contentType := c.Request().Header.Get("Content-Type")
@@ -198,6 +206,13 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		user = updatedUser
 	}
 
+	// Every local actor signs its federated activities with its own keypair
+	if h.cfg != nil && h.cfg.Federation.Enabled {
+		if _, _, err := federation.EnsureActorKeys(c.Request().Context(), user.ID); err != nil {
+			log.Printf("[Federation] Warning: failed to generate signing keys for %s: %v", user.Username, err)
+		}
+	}
+
 	// Generate JWT token
 	token, err := auth.GenerateToken(user.ID, user.DID, user.Username, user.Role, h.jwtSecret)
 	if err != nil {
@@ -505,6 +520,7 @@ func (h *AuthHandler) RotateKey(c echo.Context) error {
 	// Propagate rotation via ActivityPub
 	if h.cfg != nil && h.cfg.Federation.Enabled {
 		actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+		signingKeyPEM, _ := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
 		// encryptionPublicKey is optional, using existing if not provided
 		activity := federation.BuildUpdateActorActivity(
 			actorURI,
@@ -512,9 +528,10 @@ func (h *AuthHandler) RotateKey(c echo.Context) error {
 			user.DisplayName,
 			user.Bio,
 			user.AvatarURL,
-			req.NewPublicKey, // New signing key
+			signingKeyPEM,
 			user.EncryptionPublicKey,
 		)
+		federation.SetActorAliases(activity, user.AlsoKnownAs, user.MovedTo)
 		go federation.DeliverToFollowers(activity, user.DID)
 	}
 
@@ -747,16 +764,18 @@ func (h *AuthHandler) RevokeKey(c echo.Context) error {
 	// Propagate revocation via ActivityPub
 	if h.cfg != nil && h.cfg.Federation.Enabled {
 		actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
-		// For revocation, publicKeyPEM is empty/revoked
+		signingKeyPEM, _ := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
+		// The revoked DID key is not the HTTP signing key, so publicKey stays intact
 		activity := federation.BuildUpdateActorActivity(
 			actorURI,
 			user.Username,
 			user.DisplayName,
 			user.Bio,
 			user.AvatarURL,
-			"", // Revoked key (empty)
+			signingKeyPEM,
 			user.EncryptionPublicKey,
 		)
+		federation.SetActorAliases(activity, user.AlsoKnownAs, user.MovedTo)
 		go federation.DeliverToFollowers(activity, user.DID)
 	}
 
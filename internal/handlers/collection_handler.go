@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"splitter/internal/config"
+	"splitter/internal/federation"
+	"splitter/internal/models"
+	"splitter/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// collectionPageSize is the number of items per OrderedCollectionPage
+const collectionPageSize = 20
+
+// CollectionHandler serves the followers/following collections of local actors
+type CollectionHandler struct {
+	userRepo   *repository.UserRepository
+	followRepo *repository.FollowRepository
+	cfg        *config.Config
+}
+
+// NewCollectionHandler creates a new CollectionHandler
+func NewCollectionHandler(userRepo *repository.UserRepository, followRepo *repository.FollowRepository, cfg *config.Config) *CollectionHandler {
+	return &CollectionHandler{userRepo: userRepo, followRepo: followRepo, cfg: cfg}
+}
+
+// GetFollowers returns the followers collection of a local actor
+// GET /ap/users/:username/followers
+func (h *CollectionHandler) GetFollowers(c echo.Context) error {
+	return h.serveCollection(c, "followers", h.followRepo.GetFollowers)
+}
+
+// GetFollowing returns the following collection of a local actor
+// GET /ap/users/:username/following
+func (h *CollectionHandler) GetFollowing(c echo.Context) error {
+	return h.serveCollection(c, "following", h.followRepo.GetFollowing)
+}
+
+type collectionFetcher func(ctx context.Context, userDID string, limit, offset int) ([]*models.User, error)
+
+// serveCollection renders the collection root, or a single page when ?page=N is given.
+// Totals are always public; items are only listed for accounts that are not locked.
+func (h *CollectionHandler) serveCollection(c echo.Context, name string, fetch collectionFetcher) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+
+	user, err := h.userRepo.GetLocalByUsername(ctx, username, h.cfg.Federation.Domain)
+	if err != nil || user == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "user not found",
+		})
+	}
+
+	stats, err := h.followRepo.GetStats(ctx, user.DID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to get collection",
+		})
+	}
+	total := stats[name]
+
+	collectionID := fmt.Sprintf("%s/ap/users/%s/%s", h.cfg.Federation.URL, username, name)
+	showItems := !user.IsLocked
+
+	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+
+	pageParam := c.QueryParam("page")
+	if pageParam == "" || !showItems {
+		collection := federation.OrderedCollection(collectionID, total, collectionPageSize)
+		if !showItems {
+			// Locked accounts only publish their totals
+			delete(collection, "first")
+			delete(collection, "last")
+		}
+		return c.JSON(http.StatusOK, collection)
+	}
+
+	page, err := strconv.Atoi(pageParam)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	users, err := fetch(ctx, user.DID, collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to get collection",
+		})
+	}
+
+	items := make([]string, 0, len(users))
+	for _, u := range users {
+		if actorURI := h.actorURIForUser(u); actorURI != "" {
+			items = append(items, actorURI)
+		}
+	}
+
+	return c.JSON(http.StatusOK, federation.OrderedCollectionPage(collectionID, page, total, collectionPageSize, items))
+}
+
+// actorURIForUser maps a local or ghost user row to its ActivityPub actor URI
+func (h *CollectionHandler) actorURIForUser(u *models.User) string {
+	if u.IsLocalTo(h.cfg.Federation.Domain) {
+		return fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, u.Username)
+	}
+	// Ghost users created for remote actors keep the actor URI as their DID
+	if strings.HasPrefix(u.DID, "http://") || strings.HasPrefix(u.DID, "https://") {
+		return u.DID
+	}
+	return ""
+}
@@ -14,6 +14,7 @@ import (
 	"splitter/internal/db"
 	"splitter/internal/federation"
 	"splitter/internal/repository"
+	"splitter/internal/sanitize"
 
 	"github.com/labstack/echo/v4"
 )
@@ -130,11 +131,7 @@ func (h *FederationHandler) SearchRemoteUsers(c echo.Context) error {
 		}
 
 		// Also search known remote instances directly (with failover)
-		for remoteDomain, baseURL := range federation.InstanceURLMap {
-			if remoteDomain == h.cfg.Federation.Domain {
-				continue
-			}
-
+		for remoteDomain, baseURL := range federation.SplitterPeers(c.Request().Context(), h.cfg.Federation.Domain) {
 			var remoteUsers []map[string]interface{}
 			if federation.IsPeerHealthy(remoteDomain) {
 				remoteUsers = federation.FetchAndCachePeerUsers(remoteDomain, baseURL)
@@ -371,33 +368,8 @@ func (h *FederationHandler) GetFederatedTimeline(c echo.Context) error {
 		addPost(post)
 	}
 
-	// Phase 2: Live fetch from known peers (InstanceURLMap + domains discovered via remote_actors)
-	peerMap := make(map[string]string) // domain → baseURL
-	for d, u := range federation.InstanceURLMap {
-		if d != h.cfg.Federation.Domain {
-			peerMap[d] = u
-		}
-	}
-	// Also include any domains we've cached actors for but aren't in InstanceURLMap
-	actorDomainRows, adErr := db.GetDB().Query(ctx,
-		`SELECT DISTINCT domain, actor_uri FROM remote_actors
-		 WHERE domain != '' AND domain != $1 AND inbox_url != ''
-		 LIMIT 20`, h.cfg.Federation.Domain)
-	if adErr == nil {
-		defer actorDomainRows.Close()
-		for actorDomainRows.Next() {
-			var adDomain, actorURI string
-			if sErr := actorDomainRows.Scan(&adDomain, &actorURI); sErr != nil {
-				continue
-			}
-			if _, exists := peerMap[adDomain]; !exists {
-				// Build base URL from actor URI
-				if parsed, pErr := url.Parse(actorURI); pErr == nil {
-					peerMap[adDomain] = parsed.Scheme + "://" + parsed.Host
-				}
-			}
-		}
-	}
+	// Phase 2: Live fetch from known Splitter peers in the instance registry
+	peerMap := federation.SplitterPeers(ctx, h.cfg.Federation.Domain)
 
 	for domain, baseURL := range peerMap {
 
@@ -432,6 +404,10 @@ func (h *FederationHandler) GetFederatedTimeline(c echo.Context) error {
 			repostCount, _ := remotePost["repost_count"].(float64)
 			originalURI, _ := remotePost["original_post_uri"].(string)
 
+			// Peer HTML is sanitized like inbound Notes: a safe copy for rendering and
+			// the plain-text rendering as the post content
+			contentHTML, content := sanitize.Remote(content)
+
 			if authorDID == "" && username != "" {
 				authorDID = fmt.Sprintf("%s/ap/users/%s", baseURL, username)
 			}
@@ -452,13 +428,13 @@ func (h *FederationHandler) GetFederatedTimeline(c echo.Context) error {
 					`WITH existing AS (
 						SELECT id::text FROM posts WHERE original_post_uri = $1 AND deleted_at IS NULL LIMIT 1
 					), inserted AS (
-						INSERT INTO posts (author_did, content, visibility, is_remote, original_post_uri, created_at)
-						SELECT $2, $3, 'public', true, $1, $4
+						INSERT INTO posts (author_did, content, content_html, visibility, is_remote, original_post_uri, created_at)
+						SELECT $2, $3, NULLIF($5, ''), 'public', true, $1, $4
 						WHERE NOT EXISTS (SELECT 1 FROM existing)
 						RETURNING id::text
 					)
 					SELECT id FROM inserted UNION ALL SELECT id FROM existing LIMIT 1`,
-					originalURI, authorDID, content, parsedTime,
+					originalURI, authorDID, content, parsedTime, contentHTML,
 				).Scan(&localID)
 				if cacheErr == nil && localID != "" {
 					id = localID
@@ -486,6 +462,7 @@ func (h *FederationHandler) GetFederatedTimeline(c echo.Context) error {
 				"id":                id,
 				"author_did":        authorDID,
 				"content":           content,
+				"content_html":      contentHTML,
 				"visibility":        visibility,
 				"is_remote":         true,
 				"original_post_uri": originalURI,
@@ -584,11 +561,7 @@ func (h *FederationHandler) GetAllFederatedUsers(c echo.Context) error {
 	}
 
 	// Remote users from other known instances (with failover)
-	for domain, baseURL := range federation.InstanceURLMap {
-		if domain == h.cfg.Federation.Domain {
-			continue
-		}
-
+	for domain, baseURL := range federation.SplitterPeers(ctx, h.cfg.Federation.Domain) {
 		var remoteUsers []map[string]interface{}
 		if federation.IsPeerHealthy(domain) {
 			remoteUsers = federation.FetchAndCachePeerUsers(domain, baseURL)
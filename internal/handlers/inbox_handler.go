@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -13,7 +19,9 @@ import (
 	"splitter/internal/db"
 	"splitter/internal/federation"
 	"splitter/internal/models"
+	"splitter/internal/realtime"
 	"splitter/internal/repository"
+	"splitter/internal/sanitize"
 	"splitter/internal/security"
 
 	"github.com/jackc/pgx/v5"
@@ -22,17 +30,21 @@ import (
 
 // InboxHandler handles incoming ActivityPub activities
 type InboxHandler struct {
-	userRepo *repository.UserRepository
-	msgRepo  *repository.MessageRepository
-	cfg      *config.Config
+	userRepo  *repository.UserRepository
+	msgRepo   *repository.MessageRepository
+	postRepo  *repository.PostRepository
+	replyRepo *repository.ReplyRepository
+	cfg       *config.Config
 }
 
 // NewInboxHandler creates a new InboxHandler
 func NewInboxHandler(userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, cfg *config.Config) *InboxHandler {
 	return &InboxHandler{
-		userRepo: userRepo,
-		msgRepo:  msgRepo,
-		cfg:      cfg,
+		userRepo:  userRepo,
+		msgRepo:   msgRepo,
+		postRepo:  repository.NewPostRepository(),
+		replyRepo: repository.NewReplyRepository(),
+		cfg:       cfg,
 	}
 }
 
@@ -43,7 +55,13 @@ func (h *InboxHandler) Handle(c echo.Context) error {
 	guard := security.GetMessagingGuard()
 
 	const maxInboxPayloadBytes int64 = 256 * 1024
-	if c.Request().ContentLength > maxInboxPayloadBytes {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxInboxPayloadBytes+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "failed to read request body",
+		})
+	}
+	if int64(len(body)) > maxInboxPayloadBytes {
 		guard.RecordInboxRejected("unknown", "payload too large", map[string]interface{}{
 			"content_length": c.Request().ContentLength,
 			"max":            maxInboxPayloadBytes,
@@ -52,10 +70,12 @@ func (h *InboxHandler) Handle(c echo.Context) error {
 			"error": "payload too large",
 		})
 	}
+	// Signature verification checks the digest against the body, so put it back
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
 
 	// Parse the activity
 	var activity map[string]interface{}
-	if err := json.NewDecoder(c.Request().Body).Decode(&activity); err != nil {
+	if err := json.Unmarshal(body, &activity); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "invalid activity JSON",
 		})
@@ -86,22 +106,15 @@ func (h *InboxHandler) Handle(c echo.Context) error {
 		})
 	}
 
-	verificationKey := strings.TrimSpace(remoteActor.PublicKeyPEM)
-	if sigKeyID := parseSignatureKeyID(c.Request().Header.Get("Signature")); sigKeyID != "" {
-		if resolvedSigner, signerErr := resolveActorFromURI(stripFragment(sigKeyID)); signerErr == nil && resolvedSigner != nil && strings.TrimSpace(resolvedSigner.PublicKeyPEM) != "" {
-			verificationKey = strings.TrimSpace(resolvedSigner.PublicKeyPEM)
-		}
-	}
-
-	if verificationKey == "" {
-		guard.RecordInboxRejected(actorURI, "missing verification key", map[string]interface{}{"domain": remoteActor.Domain})
+	signerURI, verifyErr := federation.VerifyActivitySignature(ctx, c.Request(), actorURI, federation.LookupActorKey)
+	if errors.Is(verifyErr, federation.ErrSignerNotActor) {
+		guard.RecordInboxRejected(actorURI, "signer mismatch", map[string]interface{}{"error": verifyErr.Error()})
 		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "missing remote signature key",
+			"error": "signer does not match actor",
 		})
 	}
-
-	if err := federation.VerifyRequest(c.Request(), verificationKey); err != nil {
-		guard.RecordInboxRejected(actorURI, "invalid signature", map[string]interface{}{"error": err.Error()})
+	if verifyErr != nil {
+		guard.RecordInboxRejected(actorURI, "invalid signature", map[string]interface{}{"error": verifyErr.Error()})
 		return c.JSON(http.StatusUnauthorized, map[string]string{
 			"error": "invalid signature",
 		})
@@ -130,6 +143,9 @@ func (h *InboxHandler) Handle(c echo.Context) error {
 		})
 	}
 
+	// Any server that sends us a validly signed activity becomes a known peer
+	federation.RecordInstanceFromActor(ctx, signerURI)
+
 	// Deduplication
 	if activityID != "" && federation.IsActivityProcessed(ctx, activityID) {
 		log.Printf("[Inbox] Duplicate activity: %s", activityID)
@@ -138,76 +154,78 @@ func (h *InboxHandler) Handle(c echo.Context) error {
 		})
 	}
 
-	// Store in inbox_activities
+	// Persist for asynchronous processing by the inbox workers
 	payload, _ := json.Marshal(activity)
-	_, err = db.GetDB().Exec(ctx,
-		`INSERT INTO inbox_activities (activity_id, actor_uri, activity_type, payload)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (activity_id) DO NOTHING`,
-		activityID, actorURI, activityType, payload,
-	)
+	if strings.TrimSpace(activityID) == "" {
+		// activity_id is unique; derive a stable one for activities without an id
+		payloadHash := sha256.Sum256(payload)
+		activityID = "urn:splitter:inbox:" + hex.EncodeToString(payloadHash[:])
+	}
+	queued, err := federation.EnqueueInboxActivity(ctx, activityID, actorURI, activityType, payload)
 	if err != nil {
-		log.Printf("[Inbox] Warning: failed to store activity: %v", err)
+		log.Printf("[Inbox] Failed to store activity: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to store activity",
+		})
 	}
+	if !queued {
+		log.Printf("[Inbox] Duplicate activity: %s", activityID)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": "queued",
+	})
+}
+
+// ProcessActivity applies a verified, persisted inbox activity to local state.
+// It runs in the inbox workers; returned errors are retried with backoff.
+func (h *InboxHandler) ProcessActivity(ctx context.Context, activity map[string]interface{}) error {
+	activityType, _ := activity["type"].(string)
 
-	// Process by type
 	switch activityType {
 	case "Follow":
-		return h.handleFollow(c, activity)
+		return h.handleFollow(ctx, activity)
 	case "Accept":
-		return h.handleAccept(c, activity)
+		return h.handleAccept(ctx, activity)
 	case "Create":
-		return h.handleCreate(c, activity)
+		return h.handleCreate(ctx, activity)
 	case "Like":
-		return h.handleLike(c, activity)
+		return h.handleLike(ctx, activity)
 	case "Announce":
-		return h.handleAnnounce(c, activity)
+		return h.handleAnnounce(ctx, activity)
 	case "Update":
-		return h.handleUpdate(c, activity)
+		return h.handleUpdate(ctx, activity)
 	case "Delete":
-		return h.handleDelete(c, activity)
+		return h.handleDelete(ctx, activity)
 	case "Undo":
-		return h.handleUndo(c, activity)
+		return h.handleUndo(ctx, activity)
+	case "Block":
+		return h.handleBlock(ctx, activity)
+	case "Flag":
+		return h.handleFlag(ctx, activity)
+	case "Reject":
+		return h.handleReject(ctx, activity)
+	case "Move":
+		return h.handleMove(ctx, activity)
+	case "Read":
+		return h.handleRead(ctx, activity)
 	default:
 		log.Printf("[Inbox] Unhandled activity type: %s", activityType)
-		return c.JSON(http.StatusOK, map[string]string{
-			"status": "accepted",
-		})
-	}
-}
-
-func parseSignatureKeyID(signatureHeader string) string {
-	if strings.TrimSpace(signatureHeader) == "" {
-		return ""
-	}
-	parts := strings.Split(signatureHeader, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if !strings.HasPrefix(part, "keyId=") {
-			continue
-		}
-		value := strings.TrimPrefix(part, "keyId=")
-		value = strings.Trim(value, `"`)
-		return strings.TrimSpace(value)
-	}
-	return ""
-}
-
-func stripFragment(uri string) string {
-	if idx := strings.Index(uri, "#"); idx >= 0 {
-		return uri[:idx]
+		return nil
 	}
-	return uri
 }
 
 // handleAnnounce processes incoming Announce (repost/boost) activities
-func (h *InboxHandler) handleAnnounce(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleAnnounce(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
+	if relay := federation.RelayForActor(ctx, actorURI); relay != nil {
+		return h.handleRelayAnnounce(ctx, relay, activity)
+	}
+
 	objectURI, _ := activity["object"].(string)
 
 	if strings.TrimSpace(objectURI) == "" {
-		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+		return nil
 	}
 
 	_, err := db.GetDB().Exec(ctx,
@@ -217,35 +235,217 @@ func (h *InboxHandler) handleAnnounce(c echo.Context, activity map[string]interf
 		actorURI, objectURI, extractPostIDFromURI(objectURI),
 	)
 	if err != nil {
-		log.Printf("[Inbox] Failed to process announce: %v", err)
+		return fmt.Errorf("failed to process announce: %w", err)
 	}
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
+	return nil
+}
+
+// handleRelayAnnounce accepts a public Note shared by a subscribed relay into the federated timeline.
+// The Note is always fetched from its origin rather than trusted from the relay, and
+// FetchRemoteNote rejects copies not served and authored on one host.
+func (h *InboxHandler) handleRelayAnnounce(ctx context.Context, relay *federation.Relay, activity map[string]interface{}) error {
+	if relay.Status != federation.RelayStatusAccepted {
+		log.Printf("[Inbox] Ignoring Announce from relay %s (%s)", relay.InboxURL, relay.Status)
+		return nil
+	}
+	federation.RecordRelayReceived(ctx, relay.ID)
+
+	noteURI := ""
+	switch obj := activity["object"].(type) {
+	case string:
+		noteURI = obj
+	case map[string]interface{}:
+		noteURI, _ = obj["id"].(string)
+	}
+	if strings.TrimSpace(noteURI) == "" || federation.IsLocalURI(noteURI) {
+		return nil
+	}
+	if federation.IsDomainBlocked(ctx, extractDomainFromURI(noteURI)) {
+		return nil
+	}
+	if cached, err := h.postRepo.GetByOriginalURI(ctx, noteURI); err == nil && cached != nil {
+		return nil
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "announced"})
+	note, err := federation.FetchRemoteNote(noteURI)
+	if err != nil {
+		return fmt.Errorf("failed to fetch relayed note %s: %w", noteURI, err)
+	}
+	if note.Deleted || !note.Public || note.AttributedTo == "" {
+		return nil
+	}
+	if federation.IsDomainBlocked(ctx, extractDomainFromURI(note.AttributedTo)) {
+		return nil
+	}
+
+	if _, err := cacheRemoteNote(ctx, h.postRepo, note); err != nil {
+		return fmt.Errorf("failed to store relayed note: %w", err)
+	}
+	return nil
 }
 
 // handleUpdate processes incoming Update activities for actor metadata
-func (h *InboxHandler) handleUpdate(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleUpdate(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
 	obj, ok := activity["object"].(map[string]interface{})
 	if !ok {
-		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+		return nil
 	}
 
 	objType, _ := obj["type"].(string)
-	if objType != "Person" {
-		if id, _ := activity["id"].(string); id != "" {
-			federation.MarkActivityProcessed(ctx, id)
+	switch objType {
+	case "Person":
+		return h.handleUpdatePerson(ctx, actorURI, obj)
+	case "Note":
+		return h.handleUpdateNote(ctx, actorURI, obj)
+	case "Question":
+		if err := h.handleUpdateNote(ctx, actorURI, obj); err != nil {
+			return err
+		}
+		return h.handleUpdatePoll(ctx, actorURI, obj)
+	default:
+		return nil
+	}
+}
+
+// handleUpdateNote applies an edit of a remote Note to the cached post or stored reply
+func (h *InboxHandler) handleUpdateNote(ctx context.Context, actorURI string, obj map[string]interface{}) error {
+	noteID, _ := obj["id"].(string)
+	if noteID == "" {
+		return federation.PermanentInboxError("missing note id")
+	}
+	// Only the original author may edit a Note
+	if attributedTo, _ := obj["attributedTo"].(string); attributedTo != actorURI {
+		return federation.PermanentInboxError("note %s is not attributed to %s", noteID, actorURI)
+	}
+
+	content, _ := obj["content"].(string)
+	summary, _ := obj["summary"].(string)
+	sensitive, _ := obj["sensitive"].(bool)
+	contentHTML, content := sanitize.Remote(content)
+	summary = sanitize.Text(summary)
+
+	updatedAt := time.Now()
+	if updated, _ := obj["updated"].(string); updated != "" {
+		if t, err := time.Parse(time.RFC3339, updated); err == nil {
+			updatedAt = t
+		}
+	}
+
+	// A direct message keeps the same 3-hour edit window as local edits
+	ciphertext, _ := obj["ciphertext"].(string)
+	if edited, err := h.msgRepo.EditRemoteMessage(ctx, noteID, actorURI, content, ciphertext); edited || err != nil {
+		if err == nil {
+			log.Printf("[Inbox] Applied edit of message %s from %s", noteID, actorURI)
+		}
+		return remoteMessageChangeError(noteID, err)
+	}
+
+	updatedPost, err := h.postRepo.UpdateRemote(ctx, noteID, actorURI, content, contentHTML, summary, sensitive || summary != "", updatedAt)
+	if err != nil {
+		return err
+	}
+	updatedReply, err := h.replyRepo.UpdateRemote(ctx, noteID, actorURI, content, contentHTML, updatedAt)
+	if err != nil {
+		return err
+	}
+
+	if updatedPost || updatedReply {
+		log.Printf("[Inbox] Applied edit of %s from %s", noteID, actorURI)
+	}
+	return nil
+}
+
+// addressList reads an ActivityPub to/cc field, which may be a single URI or a list
+func addressList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if uri, ok := item.(string); ok {
+				list = append(list, uri)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// handleUpdatePoll refreshes the counts of a cached remote poll, typically when the author's
+// server sends the results of a vote or of the poll closing
+func (h *InboxHandler) handleUpdatePoll(ctx context.Context, actorURI string, obj map[string]interface{}) error {
+	noteID, _ := obj["id"].(string)
+	post, err := h.postRepo.GetByOriginalURI(ctx, noteID)
+	if err != nil || post.AuthorDID != actorURI {
+		return nil
+	}
+	question, ok := federation.ParseQuestion(obj)
+	if !ok {
+		return nil
+	}
+	if err := h.postRepo.UpsertRemotePoll(ctx, post.ID, remotePoll(question)); err != nil {
+		return err
+	}
+	log.Printf("[Inbox] Refreshed poll results of %s", noteID)
+	return nil
+}
+
+// handlePollVote records a remote vote: a Note named after one of the options, replying to
+// a local post that has a poll. Returns false when the Note is not such a vote.
+func (h *InboxHandler) handlePollVote(ctx context.Context, actorURI string, object map[string]interface{}) (bool, error) {
+	name, _ := object["name"].(string)
+	inReplyTo, _ := object["inReplyTo"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" || inReplyTo == "" {
+		return false, nil
+	}
+	postID := h.localPostID(ctx, inReplyTo)
+	if postID == "" {
+		return false, nil
+	}
+	poll, err := h.postRepo.GetPoll(ctx, postID, "")
+	if errors.Is(err, repository.ErrPollNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	noteID, _ := object["id"].(string)
+	if attributedTo, _ := object["attributedTo"].(string); attributedTo != actorURI {
+		return true, federation.PermanentInboxError("vote %s is not attributed to %s", noteID, actorURI)
+	}
+	choice := -1
+	for i, option := range poll.Options {
+		if option.Title == name {
+			choice = i
+			break
 		}
-		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+	}
+	if choice < 0 {
+		return true, federation.PermanentInboxError("vote %s names no option of poll %s", noteID, postID)
 	}
 
+	err = h.postRepo.VotePoll(ctx, postID, actorURI, []int{choice}, noteID)
+	switch {
+	case errors.Is(err, repository.ErrPollClosed), errors.Is(err, repository.ErrPollAlreadyVoted), errors.Is(err, repository.ErrPollInvalidChoice):
+		return true, federation.PermanentInboxError("rejected vote %s: %v", noteID, err)
+	case err != nil:
+		return true, err
+	}
+	log.Printf("[Inbox] Recorded vote of %s on poll %s", actorURI, postID)
+	return true, nil
+}
+
+// handleUpdatePerson refreshes the cached profile of a remote actor
+func (h *InboxHandler) handleUpdatePerson(ctx context.Context, actorURI string, obj map[string]interface{}) error {
 	name, _ := obj["name"].(string)
 	summary, _ := obj["summary"].(string)
+	name = sanitize.Text(name)
+	bioHTML, bio := sanitize.Remote(summary)
 	encryptionKey, _ := obj["encryption_public_key"].(string)
 	avatarURL := ""
 	if icon, ok := obj["icon"].(map[string]interface{}); ok {
@@ -255,6 +455,9 @@ func (h *InboxHandler) handleUpdate(c echo.Context, activity map[string]interfac
 	if pkObj, ok := obj["publicKey"].(map[string]interface{}); ok {
 		publicKeyPEM, _ = pkObj["publicKeyPem"].(string)
 	}
+	if strings.TrimSpace(publicKeyPEM) != "" {
+		federation.ForgetActorKeys(actorURI, publicKeyPEM)
+	}
 
 	if _, err := federation.EnsureRemoteUser(ctx, actorURI); err != nil {
 		log.Printf("[Inbox] Failed to ensure remote user during update: %v", err)
@@ -264,12 +467,13 @@ func (h *InboxHandler) handleUpdate(c echo.Context, activity map[string]interfac
 		`UPDATE users
 		 SET display_name = COALESCE(NULLIF($1, ''), display_name),
 		     bio = COALESCE(NULLIF($2, ''), bio),
-		     avatar_url = COALESCE(NULLIF($3, ''), avatar_url),
-		     public_key = COALESCE(NULLIF($4, ''), public_key),
-		     encryption_public_key = COALESCE(NULLIF($5, ''), encryption_public_key),
+		     bio_html = COALESCE(NULLIF($3, ''), bio_html),
+		     avatar_url = COALESCE(NULLIF($4, ''), avatar_url),
+		     public_key = COALESCE(NULLIF($5, ''), public_key),
+		     encryption_public_key = COALESCE(NULLIF($6, ''), encryption_public_key),
 		     updated_at = NOW()
-		 WHERE did = $6`,
-		name, summary, avatarURL, publicKeyPEM, encryptionKey, actorURI,
+		 WHERE did = $7`,
+		name, bio, bioHTML, avatarURL, publicKeyPEM, encryptionKey, actorURI,
 	)
 
 	_, _ = db.GetDB().Exec(ctx,
@@ -282,16 +486,11 @@ func (h *InboxHandler) handleUpdate(c echo.Context, activity map[string]interfac
 		name, avatarURL, publicKeyPEM, actorURI,
 	)
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
-	}
-
-	return c.JSON(http.StatusOK, map[string]string{"status": "updated"})
+	return nil
 }
 
 // handleFollow processes incoming Follow requests
-func (h *InboxHandler) handleFollow(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleFollow(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
 	objectURI, _ := activity["object"].(string)
 
@@ -307,13 +506,13 @@ func (h *InboxHandler) handleFollow(c echo.Context, activity map[string]interfac
 	// Extract local username from object URI
 	localUsername := extractUsernameFromURI(objectURI)
 	if localUsername == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid follow target"})
+		return federation.PermanentInboxError("invalid follow target: %s", objectURI)
 	}
 
 	// Look up local user
-	localUser, _, err := h.userRepo.GetByUsername(ctx, localUsername)
+	localUser, err := h.userRepo.GetLocalByUsername(ctx, localUsername, h.cfg.Federation.Domain)
 	if err != nil || localUser == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		return federation.PermanentInboxError("follow target %s not found", localUsername)
 	}
 
 	// Store follow relationship
@@ -323,14 +522,19 @@ func (h *InboxHandler) handleFollow(c echo.Context, activity map[string]interfac
 		followerDID = fmt.Sprintf("did:web:%s:%s", remoteActor.Domain, remoteActor.Username)
 	}
 
-	_, err = db.GetDB().Exec(ctx,
+	var follow repository.Follow
+	err = db.GetDB().QueryRow(ctx,
 		`INSERT INTO follows (follower_did, following_did, status)
 		 VALUES ($1, $2, 'accepted')
-		 ON CONFLICT DO NOTHING`,
+		 ON CONFLICT DO NOTHING
+		 RETURNING id, follower_did, following_did, status, created_at::text`,
 		followerDID, localUser.DID,
-	)
-	if err != nil {
-		log.Printf("[Inbox] Failed to create follow: %v", err)
+	).Scan(&follow.ID, &follow.FollowerDID, &follow.FollowingDID, &follow.Status, &follow.CreatedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("failed to create follow: %w", err)
+	}
+	if err == nil {
+		realtime.GetHub().Publish([]string{localUser.ID}, realtime.EventFollowCreated, &follow)
 	}
 
 	// Auto-accept: send Accept back
@@ -350,17 +554,15 @@ func (h *InboxHandler) handleFollow(c echo.Context, activity map[string]interfac
 		}()
 	}
 
-	// Mark as processed
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
-	}
-
-	return c.JSON(http.StatusOK, map[string]string{"status": "accepted"})
+	return nil
 }
 
 // handleAccept processes Accept responses to our Follow requests
-func (h *InboxHandler) handleAccept(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleAccept(ctx context.Context, activity map[string]interface{}) error {
+	if handled, err := h.handleRelayResponse(ctx, activity, true); handled || err != nil {
+		return err
+	}
+
 	log.Printf("[Inbox] Follow accepted")
 
 	// Mark the original follow as accepted
@@ -392,28 +594,54 @@ func (h *InboxHandler) handleAccept(c echo.Context, activity map[string]interfac
 		}
 	}
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
+	return nil
+}
+
+// handleRelayResponse applies an Accept or Reject of the instance actor's Follow of a relay.
+// Returns false when the activity answers some other Follow.
+func (h *InboxHandler) handleRelayResponse(ctx context.Context, activity map[string]interface{}, accepted bool) (bool, error) {
+	actorURI, _ := activity["actor"].(string)
+
+	followID := ""
+	switch obj := activity["object"].(type) {
+	case map[string]interface{}:
+		if followActor, _ := obj["actor"].(string); followActor != federation.InstanceActorURI() {
+			return false, nil
+		}
+		followID, _ = obj["id"].(string)
+	case string:
+		followID = obj
+		if !strings.HasPrefix(followID, federation.InstanceBaseURL()+"/activities/relay-follow-") {
+			return false, nil
+		}
+	default:
+		return false, nil
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "accepted"})
+	return federation.HandleRelayResponse(ctx, actorURI, followID, accepted)
 }
 
 // handleCreate processes incoming Create activities (new posts)
-func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleCreate(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
 
 	// Parse the Note object
 	object, ok := activity["object"].(map[string]interface{})
 	if !ok {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing object"})
+		return federation.PermanentInboxError("missing object")
 	}
 
 	objType, _ := object["type"].(string)
-	if objType != "Note" {
+	if objType != "Note" && objType != "Question" {
 		log.Printf("[Inbox] Ignoring Create of type %s", objType)
-		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+		return nil
+	}
+
+	// Votes on our polls are Notes addressed to the poll's author, not DMs or replies
+	if objType == "Note" {
+		if handled, err := h.handlePollVote(ctx, actorURI, object); handled || err != nil {
+			return err
+		}
 	}
 
 	content, _ := object["content"].(string)
@@ -422,60 +650,42 @@ func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interfac
 	noteID, _ := object["id"].(string)
 	published, _ := object["published"].(string)
 	inReplyTo, _ := object["inReplyTo"].(string)
+	summary, _ := object["summary"].(string)
+	sensitive, _ := object["sensitive"].(bool)
+	mentions, hashtags := federation.ParseNoteTags(object["tag"])
 
-	// Collect all possible recipients from ActivityPub fields
-	recipients := []interface{}{}
-
-	if v, ok := object["to"].([]interface{}); ok {
-		recipients = append(recipients, v...)
-	}
-	if v, ok := object["cc"].([]interface{}); ok {
-		recipients = append(recipients, v...)
-	}
+	// Remote HTML is never stored as-is: keep a sanitized copy for rendering and
+	// use the plain-text rendering as the post content
+	contentHTML, content := sanitize.Remote(content)
+	summary = sanitize.Text(summary)
 
+	// Collect all possible recipients from ActivityPub fields
+	recipients := append(addressList(object["to"]), addressList(object["cc"])...)
 	if len(recipients) == 0 {
-		if v, ok := activity["to"].([]interface{}); ok {
-			recipients = append(recipients, v...)
-		}
-		if v, ok := activity["cc"].([]interface{}); ok {
-			recipients = append(recipients, v...)
-		}
+		recipients = append(addressList(activity["to"]), addressList(activity["cc"])...)
 	}
 
-	isPublic := false
-	var targetLocalUser *models.User
+	visibility := federation.NoteVisibility(actorURI, recipients, mentions, ciphertext != "" || len(encryptedKeys) > 0)
 
-	for _, t := range recipients {
-		recipient, ok := t.(string)
-		if !ok {
-			continue
-		}
-		if recipient == "https://www.w3.org/ns/activitystreams#Public" || recipient == "as:Public" {
-			isPublic = true
-			break
-		}
-		// Check if recipient is local user
-		if domain := extractDomainFromURI(recipient); domain == h.cfg.Federation.Domain || domain == "localhost" {
+	// Local users a non-public Note is addressed to: the recipient of a DM, or the
+	// audience of a followers-only or circle post
+	var localRecipients []*models.User
+	if visibility != "public" {
+		seen := make(map[string]bool)
+		for _, recipient := range recipients {
+			domain := extractDomainFromURI(recipient)
+			if domain != h.cfg.Federation.Domain && domain != "localhost" {
+				continue
+			}
 			username := extractUsernameFromURI(recipient)
-			if username != "" {
-				// Resolve local user by username first (more robust than instance_domain matching),
-				// while still preferring non-ghost local accounts when duplicates exist.
-				var u models.User
-				err := db.GetDB().QueryRow(ctx,
-					`SELECT id, username, COALESCE(encryption_public_key, '')
-					 FROM users
-					 WHERE username = $1
-					 ORDER BY CASE
-					   WHEN instance_domain = $2 OR instance_domain = 'localhost' OR COALESCE(instance_domain, '') = '' THEN 0
-					   ELSE 1
-					 END,
-					 updated_at DESC
-					 LIMIT 1`,
-					username, h.cfg.Federation.Domain,
-				).Scan(&u.ID, &u.Username, &u.EncryptionPublicKey)
-				if err == nil {
-					targetLocalUser = &u
-				}
+			if username == "" {
+				continue
+			}
+			// Only accounts of this server count, never a remote ghost with the same name
+			u, err := h.userRepo.GetLocalByUsername(ctx, username, h.cfg.Federation.Domain)
+			if err == nil && u != nil && !seen[u.ID] {
+				seen[u.ID] = true
+				localRecipients = append(localRecipients, u)
 			}
 		}
 	}
@@ -487,7 +697,25 @@ func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interfac
 		}
 	}
 
-	if !isPublic && targetLocalUser != nil {
+	if visibility == "direct" {
+		if len(localRecipients) == 0 {
+			log.Printf("[Inbox] Ignoring direct Note %s from %s: no local recipient", noteID, actorURI)
+			return nil
+		}
+		if noteID != "" {
+			if existingID, err := h.msgRepo.GetMessageIDByObjectURI(ctx, noteID); err != nil || existingID != "" {
+				return err
+			}
+		}
+
+		// A DM to more than one participant, or into one of our group threads, is a group message
+		contextURI := noteConversation(object)
+		remoteParticipants := h.remoteParticipants(recipients, actorURI)
+		if len(localRecipients)+len(remoteParticipants) > 1 || strings.HasPrefix(contextURI, h.groupThreadURIPrefix()) {
+			return h.storeGroupDM(ctx, actorURI, noteID, contextURI, localRecipients, remoteParticipants, content, ciphertext, encryptedKeys, publishedTime)
+		}
+		targetLocalUser := localRecipients[0]
+
 		// THIS IS A DM
 		log.Printf("[Inbox] Handling DM from %s to %s", actorURI, targetLocalUser.Username)
 
@@ -495,14 +723,14 @@ func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interfac
 		senderUser, err := federation.EnsureRemoteUser(ctx, actorURI)
 		if err != nil {
 			log.Printf("[Inbox] Failed to ensure remote user %s: %v", actorURI, err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to process sender"})
+			return fmt.Errorf("failed to process sender: %w", err)
 		}
 
 		// 2. Get/Create Thread
 		thread, err := h.msgRepo.GetOrCreateThreadForInbound(ctx, senderUser.ID, targetLocalUser.ID)
 		if err != nil {
 			log.Printf("[Inbox] Failed to get thread: %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get thread"})
+			return fmt.Errorf("failed to get thread: %w", err)
 		}
 
 		encryptedKeysJSON := ""
@@ -512,43 +740,81 @@ func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interfac
 			}
 		}
 
-		// 3. Insert Message
-		_, err = h.msgRepo.SendMessage(ctx, thread.ID, senderUser.ID, targetLocalUser.ID, content, ciphertext, encryptedKeysJSON)
+		// 3. Insert Message, with the Note ID later edits, deletions and receipts refer to
+		_, created, err := h.msgRepo.ReceiveRemoteMessage(ctx, thread.ID, senderUser.ID, targetLocalUser.ID, noteID, publishedTime, content, ciphertext, encryptedKeysJSON)
 		if err != nil {
 			log.Printf("[Inbox] Failed to save message: %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save message"})
+			return fmt.Errorf("failed to save message: %w", err)
 		}
-
-		if id, _ := activity["id"].(string); id != "" {
-			federation.MarkActivityProcessed(ctx, id)
+		if !created {
+			log.Printf("[Inbox] DM %s already stored", noteID)
+			return nil
 		}
 
 		log.Printf("[Inbox] DM saved successfully")
-		return c.JSON(http.StatusOK, map[string]string{"status": "created"})
+		return nil
 	}
 
-	// PUBLIC POST Handling
-	log.Printf("[Inbox] Remote post from %s: %s", actorURI, truncate(content, 50))
+	// A limited Note that names nobody here has no audience on this server
+	if visibility == "circle" && len(localRecipients) == 0 {
+		log.Printf("[Inbox] Ignoring limited Note %s from %s: no local recipient", noteID, actorURI)
+		return nil
+	}
+
+	// Public replies into one of our threads are stored like local replies; the
+	// replies table has no visibility, so non-public replies are kept as posts
+	if visibility == "public" && inReplyTo != "" && noteID != "" {
+		if target, depth := h.resolveReplyTarget(ctx, inReplyTo); target != nil {
+			return h.storeRemoteReply(ctx, actorURI, noteID, content, contentHTML, publishedTime, target, depth)
+		}
+	}
+
+	// POST Handling: public posts, and followers-only or circle posts with their audience
+	log.Printf("[Inbox] Remote %s post from %s: %s", visibility, actorURI, truncate(content, 50))
 
 	// Store as remote post
 	log.Printf("[Inbox] DEBUG: Inserting remote post values: author_did=%s, content=%s, original_post_uri=%s, published=%v", actorURI, content, noteID, publishedTime)
 
 	var postID string
 	err := db.GetDB().QueryRow(ctx,
-		`INSERT INTO posts (author_did, content, visibility, is_remote, original_post_uri, in_reply_to_uri, created_at)
-		 VALUES ($1, $2, 'public', true, $3, NULLIF($4, ''), $5)
+		`INSERT INTO posts (author_did, content, content_html, visibility, is_remote, original_post_uri, in_reply_to_uri, created_at, content_warning, sensitive)
+		 VALUES ($1, $2, NULLIF($3, ''), $9, true, $4, NULLIF($5, ''), $6, NULLIF($7, ''), $8)
 		 ON CONFLICT DO NOTHING
 		 RETURNING id`,
-		actorURI, content, noteID, inReplyTo, publishedTime,
+		actorURI, content, contentHTML, noteID, inReplyTo, publishedTime, summary, sensitive || summary != "", visibility,
 	).Scan(&postID)
 	if err != nil && err != pgx.ErrNoRows {
 		log.Printf("[Inbox] Failed to store remote post: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to store post",
-		})
+		return fmt.Errorf("failed to store post: %w", err)
 	}
 	log.Printf("[Inbox] DEBUG: Successfully inserted remote post, id=%s", postID)
 
+	// The same non-public Note reaches each addressed server once, but may arrive again
+	// for other recipients here, so the audience is added to an existing post as well
+	if visibility != "public" && len(localRecipients) > 0 {
+		audiencePostID := postID
+		if audiencePostID == "" {
+			db.GetDB().QueryRow(ctx, `SELECT id FROM posts WHERE original_post_uri = $1 AND author_did = $2`, noteID, actorURI).Scan(&audiencePostID)
+		}
+		if audiencePostID != "" {
+			dids := make([]string, 0, len(localRecipients))
+			for _, recipient := range localRecipients {
+				dids = append(dids, recipient.DID)
+			}
+			if err := h.postRepo.AddAudience(ctx, audiencePostID, dids); err != nil {
+				log.Printf("[Inbox] Failed to store audience of %s: %v", noteID, err)
+			}
+		}
+	}
+
+	if objType == "Question" && postID != "" {
+		if question, ok := federation.ParseQuestion(object); ok {
+			if err := h.postRepo.UpsertRemotePoll(ctx, postID, remotePoll(question)); err != nil {
+				log.Printf("[Inbox] Failed to store poll of %s: %v", noteID, err)
+			}
+		}
+	}
+
 	// Store media attachments from the Note
 	if postID != "" {
 		if attachments, ok := object["attachment"].([]interface{}); ok {
@@ -574,19 +840,245 @@ func (h *InboxHandler) handleCreate(c echo.Context, activity map[string]interfac
 				}
 			}
 		}
+
+		// Hashtags from the tag array, so the post is found by GetPostsByHashtag
+		for _, tag := range hashtags {
+			if _, tErr := db.GetDB().Exec(ctx,
+				`INSERT INTO post_hashtags (post_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+				postID, tag,
+			); tErr != nil {
+				log.Printf("[Inbox] Failed to store hashtag %s: %v", tag, tErr)
+			}
+		}
+
+		// Mentions of local users show up in their mentions list
+		for _, mentioned := range mentions {
+			localUser := h.lookupLocalActor(ctx, mentioned)
+			if localUser == nil {
+				continue
+			}
+			if _, mErr := db.GetDB().Exec(ctx,
+				`INSERT INTO post_mentions (post_id, mentioned_did) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+				postID, localUser.DID,
+			); mErr != nil {
+				log.Printf("[Inbox] Failed to store mention of %s: %v", localUser.Username, mErr)
+				continue
+			}
+			log.Printf("[Inbox] %s mentioned %s in %s", actorURI, localUser.Username, noteID)
+		}
+	}
+
+	return nil
+}
+
+// storeGroupDM files a federated group message into its group thread. Notes sent from
+// one of our group threads carry its context URI; the sender must be a member. Other
+// groups are matched by the sending server's context URI or by their participants.
+func (h *InboxHandler) storeGroupDM(ctx context.Context, actorURI, noteID, contextURI string, localRecipients []*models.User, remoteParticipants []string, content, ciphertext string, encryptedKeys map[string]string, publishedTime time.Time) error {
+	senderUser, err := federation.EnsureRemoteUser(ctx, actorURI)
+	if err != nil {
+		log.Printf("[Inbox] Failed to ensure remote user %s: %v", actorURI, err)
+		return fmt.Errorf("failed to process sender: %w", err)
+	}
+
+	var thread *models.MessageThread
+	if threadID, ok := strings.CutPrefix(contextURI, h.groupThreadURIPrefix()); ok {
+		thread, err = h.msgRepo.GetThread(ctx, threadID)
+		if errors.Is(err, repository.ErrThreadNotFound) || (err == nil && (!thread.IsGroup || !thread.HasMember(senderUser.ID))) {
+			log.Printf("[Inbox] Ignoring group DM %s from %s: not a member of thread %s", noteID, actorURI, threadID)
+			return nil
+		}
+	} else {
+		// Everyone addressed must fit in one group before any remote actor is fetched
+		if len(localRecipients)+len(remoteParticipants)+1 > models.GroupMaxMembers {
+			log.Printf("[Inbox] Ignoring group DM %s from %s: %d participants", noteID, actorURI, len(localRecipients)+len(remoteParticipants)+1)
+			return nil
+		}
+		memberIDs := make([]string, 0, len(localRecipients)+len(remoteParticipants))
+		for _, recipient := range localRecipients {
+			memberIDs = append(memberIDs, recipient.ID)
+		}
+		for _, participantURI := range remoteParticipants {
+			participant, ensureErr := federation.EnsureRemoteUser(ctx, participantURI)
+			if ensureErr != nil {
+				log.Printf("[Inbox] Skipping group DM participant %s: %v", participantURI, ensureErr)
+				continue
+			}
+			memberIDs = append(memberIDs, participant.ID)
+		}
+
+		// Only the server the thread lives on may change who is in it
+		senderIsOrigin := contextURI != "" && extractDomainFromURI(contextURI) == extractDomainFromURI(actorURI)
+		thread, err = h.msgRepo.GetOrCreateGroupThreadForInbound(ctx, contextURI, senderUser.ID, senderIsOrigin, memberIDs)
+		if errors.Is(err, repository.ErrNotThreadMember) || errors.Is(err, repository.ErrThreadMemberLimit) {
+			log.Printf("[Inbox] Ignoring group DM %s from %s: %v", noteID, actorURI, err)
+			return nil
+		}
+	}
+	if err != nil {
+		log.Printf("[Inbox] Failed to get group thread: %v", err)
+		return fmt.Errorf("failed to get group thread: %w", err)
+	}
+
+	encryptedKeysJSON := ""
+	if len(encryptedKeys) > 0 {
+		if raw, marshalErr := json.Marshal(encryptedKeys); marshalErr == nil {
+			encryptedKeysJSON = string(raw)
+		}
 	}
 
-	// Mark as processed
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
+	if _, _, err := h.msgRepo.ReceiveRemoteMessage(ctx, thread.ID, senderUser.ID, "", noteID, publishedTime, content, ciphertext, encryptedKeysJSON); err != nil {
+		log.Printf("[Inbox] Failed to save group message: %v", err)
+		return fmt.Errorf("failed to save message: %w", err)
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "created"})
+	log.Printf("[Inbox] Group DM from %s saved to thread %s", actorURI, thread.ID)
+	return nil
+}
+
+// groupThreadURIPrefix is the start of the context URI of our group threads
+func (h *InboxHandler) groupThreadURIPrefix() string {
+	return h.cfg.Federation.URL + "/ap/threads/"
+}
+
+// remoteParticipants returns the actors on other servers a direct Note is addressed to,
+// other than its sender
+func (h *InboxHandler) remoteParticipants(recipients []string, actorURI string) []string {
+	seen := make(map[string]bool)
+	var participants []string
+	for _, recipient := range recipients {
+		if recipient == actorURI || seen[recipient] || federation.IsPublicAddress(recipient) || federation.IsFollowersCollection(recipient, actorURI) {
+			continue
+		}
+		domain := extractDomainFromURI(recipient)
+		if domain == "" || domain == h.cfg.Federation.Domain || domain == "localhost" {
+			continue
+		}
+		seen[recipient] = true
+		participants = append(participants, recipient)
+	}
+	return participants
+}
+
+// noteConversation returns the conversation a Note belongs to: its context, or the
+// conversation property some servers send instead
+func noteConversation(object map[string]interface{}) string {
+	if contextURI, ok := object["context"].(string); ok && contextURI != "" {
+		return contextURI
+	}
+	conversation, _ := object["conversation"].(string)
+	return conversation
+}
+
+// maxReplyChainHops bounds how far up an inReplyTo chain of cached remote posts we look for a local thread
+const maxReplyChainHops = 8
+
+// resolveReplyTarget finds the local thread a remote Note replies to. inReplyTo may be
+// one of our posts, one of our replies, or a remote reply we already store; cached remote
+// posts in between are followed up their own inReplyTo. Returns nil when the Note does not
+// belong to a thread on this instance. Replies deeper than MaxReplyDepth attach to the
+// deepest allowed ancestor.
+func (h *InboxHandler) resolveReplyTarget(ctx context.Context, inReplyTo string) (*models.ReplyCreate, int) {
+	uri := inReplyTo
+	for hop := 0; hop < maxReplyChainHops && uri != ""; hop++ {
+		if parent := h.lookupReply(ctx, uri); parent != nil {
+			target := &models.ReplyCreate{PostID: parent.PostID, ParentID: &parent.ID}
+			depth := parent.Depth + 1
+			if depth > models.MaxReplyDepth {
+				target.ParentID = parent.ParentID
+				depth = parent.Depth
+			}
+			return target, depth
+		}
+
+		if postID := h.localPostID(ctx, uri); postID != "" {
+			return &models.ReplyCreate{PostID: postID}, 1
+		}
+
+		// A cached remote post may itself answer one of our threads
+		var next string
+		err := db.GetDB().QueryRow(ctx,
+			`SELECT COALESCE(in_reply_to_uri, '') FROM posts
+			 WHERE original_post_uri = $1 AND deleted_at IS NULL
+			 LIMIT 1`,
+			uri,
+		).Scan(&next)
+		if err != nil {
+			return nil, 0
+		}
+		uri = next
+	}
+	return nil, 0
+}
+
+// lookupReply returns the stored reply a Note URI refers to: a remote reply by its
+// Note ID, or a local one by /replies/:id (or /posts/:id, which older replies federated with)
+func (h *InboxHandler) lookupReply(ctx context.Context, uri string) *models.Reply {
+	if reply, err := h.replyRepo.GetByOriginalURI(ctx, uri); err == nil {
+		return reply
+	}
+	if !h.isLocalURI(uri) {
+		return nil
+	}
+	replyID := extractReplyIDFromURI(uri)
+	if replyID == "" {
+		replyID = extractPostIDFromURI(uri)
+	}
+	if replyID == "" {
+		return nil
+	}
+	reply, err := h.replyRepo.GetByID(ctx, replyID)
+	if err != nil || reply.OriginalURI != "" {
+		return nil
+	}
+	return reply
+}
+
+// localPostID returns the ID of the local post a Note URI refers to, or ""
+func (h *InboxHandler) localPostID(ctx context.Context, uri string) string {
+	if !h.isLocalURI(uri) {
+		return ""
+	}
+	postID := extractPostIDFromURI(uri)
+	if postID == "" {
+		return ""
+	}
+	var id string
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT id::text FROM posts WHERE id::text = $1 AND is_remote = false AND deleted_at IS NULL`,
+		postID,
+	).Scan(&id)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+func (h *InboxHandler) isLocalURI(uri string) bool {
+	domain := extractDomainFromURI(uri)
+	return domain != "" && (domain == h.cfg.Federation.Domain || domain == "localhost")
+}
+
+// storeRemoteReply inserts a remote Note into the replies table of a local thread
+func (h *InboxHandler) storeRemoteReply(ctx context.Context, actorURI, noteID, content, contentHTML string, publishedTime time.Time, target *models.ReplyCreate, depth int) error {
+	// The author's ghost user gives the reply a username in thread views
+	if _, err := federation.EnsureRemoteUser(ctx, actorURI); err != nil {
+		log.Printf("[Inbox] Failed to ensure remote reply author %s: %v", actorURI, err)
+	}
+
+	target.Content = content
+	reply, err := h.replyRepo.CreateRemote(ctx, actorURI, target, depth, contentHTML, noteID, publishedTime)
+	if err != nil {
+		log.Printf("[Inbox] Failed to store remote reply %s: %v", noteID, err)
+		return fmt.Errorf("failed to store reply: %w", err)
+	}
+
+	log.Printf("[Inbox] Remote reply %s from %s stored as reply %s on post %s (depth %d)", noteID, actorURI, reply.ID, reply.PostID, reply.Depth)
+	return nil
 }
 
 // handleLike processes incoming Like activities
-func (h *InboxHandler) handleLike(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleLike(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
 	objectURI, _ := activity["object"].(string)
 
@@ -595,27 +1087,33 @@ func (h *InboxHandler) handleLike(c echo.Context, activity map[string]interface{
 	// Record the like as an interaction
 	postID := extractPostIDFromURI(objectURI)
 	if postID != "" {
-		_, err := db.GetDB().Exec(ctx,
+		rows, err := db.GetDB().Query(ctx,
 			`INSERT INTO interactions (post_id, actor_did, interaction_type)
 			 SELECT id, $1, 'like' FROM posts WHERE id::text = $2 OR original_post_uri = $3
-			 ON CONFLICT DO NOTHING`,
+			 ON CONFLICT DO NOTHING
+			 RETURNING post_id::text`,
 			actorURI, postID, objectURI,
 		)
 		if err != nil {
-			log.Printf("[Inbox] Failed to process like: %v", err)
+			return fmt.Errorf("failed to process like: %w", err)
+		}
+		likedPostIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("failed to process like: %w", err)
+		}
+		for _, likedPostID := range likedPostIDs {
+			realtime.PublishToPostAuthor(ctx, likedPostID, actorURI, realtime.EventLikeCreated, map[string]string{
+				"post_id":   likedPostID,
+				"actor_did": actorURI,
+			})
 		}
 	}
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
-	}
-
-	return c.JSON(http.StatusOK, map[string]string{"status": "liked"})
+	return nil
 }
 
 // handleDelete processes incoming Delete activities
-func (h *InboxHandler) handleDelete(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+func (h *InboxHandler) handleDelete(ctx context.Context, activity map[string]interface{}) error {
 	actorURI, _ := activity["actor"].(string)
 	objectURI := ""
 
@@ -645,30 +1143,75 @@ func (h *InboxHandler) handleDelete(c echo.Context, activity map[string]interfac
 				log.Printf("[Inbox] Failed to delete remote actor cache: %v", err)
 			}
 		} else {
+			if deleted, err := h.msgRepo.DeleteRemoteMessage(ctx, objectURI, actorURI); deleted || err != nil {
+				return remoteMessageChangeError(objectURI, err)
+			}
+
 			_, err := db.GetDB().Exec(ctx,
 				`UPDATE posts SET deleted_at = now() WHERE original_post_uri = $1 OR (author_did = $2 AND id::text = $3)`,
 				objectURI, actorURI, extractPostIDFromURI(objectURI),
 			)
 			if err != nil {
-				log.Printf("[Inbox] Failed to delete remote post: %v", err)
+				return fmt.Errorf("failed to delete remote post: %w", err)
+			}
+			if _, err := h.replyRepo.DeleteRemote(ctx, objectURI, actorURI); err != nil {
+				return err
 			}
 		}
 	}
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
-	}
+	return nil
+}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+// remoteMessageChangeError decides whether a failed edit or deletion of a direct message
+// is retried: one refused by the 3-hour window or the message state never succeeds
+func remoteMessageChangeError(noteID string, err error) error {
+	switch {
+	case err == nil, errors.Is(err, repository.ErrMessageAlreadyDeleted):
+		return nil
+	case errors.Is(err, repository.ErrEditWindowExpired),
+		errors.Is(err, repository.ErrDeleteWindowExpired),
+		errors.Is(err, repository.ErrEditDeletedMessage):
+		return federation.PermanentInboxError("message %s: %v", noteID, err)
+	}
+	return err
 }
 
-// handleUndo processes Undo activities (unfollow, unlike)
-func (h *InboxHandler) handleUndo(c echo.Context, activity map[string]interface{}) error {
-	ctx := c.Request().Context()
+// handleRead applies a read receipt: the actor has read the direct message the object
+// refers to, one of ours or one received from another server, and everything before it
+func (h *InboxHandler) handleRead(ctx context.Context, activity map[string]interface{}) error {
+	actorURI, _ := activity["actor"].(string)
+	noteURI, _ := activity["object"].(string)
+	if obj, ok := activity["object"].(map[string]interface{}); ok {
+		noteURI, _ = obj["id"].(string)
+	}
+	if noteURI == "" {
+		return federation.PermanentInboxError("missing object")
+	}
+
+	messageID := federation.MessageIDFromNoteURI(noteURI)
+	if messageID == "" {
+		var err error
+		if messageID, err = h.msgRepo.GetMessageIDByObjectURI(ctx, noteURI); err != nil {
+			return err
+		}
+	}
+	if messageID == "" {
+		log.Printf("[Inbox] Ignoring Read of unknown message %s from %s", noteURI, actorURI)
+		return nil
+	}
 
+	if _, err := h.msgRepo.MarkReadUpTo(ctx, messageID, actorURI); err != nil {
+		return err
+	}
+	return nil
+}
+
+// handleUndo processes Undo activities (unfollow, unlike, unboost, unblock)
+func (h *InboxHandler) handleUndo(ctx context.Context, activity map[string]interface{}) error {
 	object, ok := activity["object"].(map[string]interface{})
 	if !ok {
-		return c.JSON(http.StatusOK, map[string]string{"status": "accepted"})
+		return nil
 	}
 
 	undoType, _ := object["type"].(string)
@@ -697,13 +1240,337 @@ func (h *InboxHandler) handleUndo(c echo.Context, activity map[string]interface{
 				log.Printf("[Inbox] Failed to undo like: %v", err)
 			}
 		}
+	case "Announce":
+		objectURI, _ := object["object"].(string)
+		actorURI, _ := activity["actor"].(string)
+		if strings.TrimSpace(objectURI) == "" {
+			return nil
+		}
+		_, err := db.GetDB().Exec(ctx,
+			`DELETE FROM interactions WHERE actor_did = $1 AND interaction_type = 'repost'
+			 AND post_id IN (SELECT id FROM posts WHERE original_post_uri = $2 OR id::text = $3)`,
+			actorURI, objectURI, extractPostIDFromURI(objectURI))
+		if err != nil {
+			return fmt.Errorf("failed to undo announce: %w", err)
+		}
+	case "Block":
+		actorURI, _ := activity["actor"].(string)
+		targetURI, _ := object["object"].(string)
+		localUser := h.lookupLocalActor(ctx, targetURI)
+		if localUser == nil {
+			return nil
+		}
+		if _, err := db.GetDB().Exec(ctx,
+			`DELETE FROM actor_blocks WHERE blocker_did = $1 AND blocked_did = $2`,
+			actorURI, localUser.DID,
+		); err != nil {
+			return fmt.Errorf("failed to undo block: %w", err)
+		}
 	}
 
-	if id, _ := activity["id"].(string); id != "" {
-		federation.MarkActivityProcessed(ctx, id)
+	return nil
+}
+
+// handleBlock processes a remote actor blocking one of our users: follows in both
+// directions are severed and the blocker's content is hidden from the blocked user.
+func (h *InboxHandler) handleBlock(ctx context.Context, activity map[string]interface{}) error {
+	actorURI, _ := activity["actor"].(string)
+	targetURI, _ := activity["object"].(string)
+	activityID, _ := activity["id"].(string)
+
+	localUser := h.lookupLocalActor(ctx, targetURI)
+	if localUser == nil {
+		log.Printf("[Inbox] Ignoring Block of non-local actor %s", targetURI)
+		return nil
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "undone"})
+	log.Printf("[Inbox] %s blocked %s", actorURI, localUser.Username)
+
+	if _, err := db.GetDB().Exec(ctx,
+		`INSERT INTO actor_blocks (blocker_did, blocked_did, activity_id)
+		 VALUES ($1, $2, NULLIF($3, ''))
+		 ON CONFLICT (blocker_did, blocked_did) DO NOTHING`,
+		actorURI, localUser.DID, activityID,
+	); err != nil {
+		return fmt.Errorf("failed to store block: %w", err)
+	}
+
+	remoteDIDs := remoteActorDIDs(actorURI)
+	if _, err := db.GetDB().Exec(ctx,
+		`DELETE FROM follows
+		 WHERE (following_did = $1 AND follower_did = ANY($2))
+		    OR (follower_did = $1 AND following_did = ANY($2))`,
+		localUser.DID, remoteDIDs,
+	); err != nil {
+		return fmt.Errorf("failed to sever follows after block: %w", err)
+	}
+
+	return nil
+}
+
+// handleFlag turns a remote report into entries in our moderation queue.
+// The object lists the reported actor and, optionally, specific posts.
+func (h *InboxHandler) handleFlag(ctx context.Context, activity map[string]interface{}) error {
+	actorURI, _ := activity["actor"].(string)
+	content, _ := activity["content"].(string)
+	sourceDomain := extractDomainFromURI(actorURI)
+
+	var objectURIs []string
+	switch obj := activity["object"].(type) {
+	case string:
+		objectURIs = append(objectURIs, obj)
+	case []interface{}:
+		for _, item := range obj {
+			if uri, ok := item.(string); ok {
+				objectURIs = append(objectURIs, uri)
+			} else if m, ok := item.(map[string]interface{}); ok {
+				if uri, _ := m["id"].(string); uri != "" {
+					objectURIs = append(objectURIs, uri)
+				}
+			}
+		}
+	case map[string]interface{}:
+		if uri, _ := obj["id"].(string); uri != "" {
+			objectURIs = append(objectURIs, uri)
+		}
+	}
+	if len(objectURIs) == 0 {
+		return federation.PermanentInboxError("flag without object")
+	}
+
+	reason := strings.TrimSpace(content)
+	if reason == "" {
+		reason = "Reported by " + sourceDomain
+	}
+
+	var targetDID string
+	var postIDs []string
+	for _, uri := range objectURIs {
+		var postID, authorDID string
+		err := db.GetDB().QueryRow(ctx,
+			`SELECT id::text, author_did FROM posts
+			 WHERE original_post_uri = $1 OR id::text = $2
+			 LIMIT 1`,
+			uri, extractPostIDFromURI(uri),
+		).Scan(&postID, &authorDID)
+		if err == nil {
+			postIDs = append(postIDs, postID)
+			if targetDID == "" {
+				targetDID = authorDID
+			}
+			continue
+		}
+		if localUser := h.lookupLocalActor(ctx, uri); localUser != nil {
+			targetDID = localUser.DID
+		} else if targetDID == "" {
+			targetDID = uri
+		}
+	}
+
+	if len(postIDs) == 0 {
+		_, err := db.GetDB().Exec(ctx,
+			`INSERT INTO reports (reporter_did, post_id, reason, status, target_did, source_domain)
+			 VALUES ($1, NULL, $2, 'pending', $3, $4)`,
+			actorURI, reason, targetDID, sourceDomain,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store remote report: %w", err)
+		}
+		return nil
+	}
+
+	for _, postID := range postIDs {
+		_, err := db.GetDB().Exec(ctx,
+			`INSERT INTO reports (reporter_did, post_id, reason, status, target_did, source_domain)
+			 VALUES ($1, $2::uuid, $3, 'pending', $4, $5)`,
+			actorURI, postID, reason, targetDID, sourceDomain,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store remote report: %w", err)
+		}
+	}
+
+	log.Printf("[Inbox] Stored remote report from %s (%d posts)", sourceDomain, len(postIDs))
+	return nil
+}
+
+// handleReject processes a remote refusal of one of our pending Follow requests.
+// Follows the remote side already accepted are left alone.
+func (h *InboxHandler) handleReject(ctx context.Context, activity map[string]interface{}) error {
+	if handled, err := h.handleRelayResponse(ctx, activity, false); handled || err != nil {
+		return err
+	}
+
+	actorURI, _ := activity["actor"].(string)
+	followerURI, ok := federation.RejectedFollower(activity)
+	if !ok {
+		return nil
+	}
+
+	localUser := h.lookupLocalActor(ctx, followerURI)
+	if localUser == nil {
+		log.Printf("[Inbox] Ignoring Reject for unknown follower %s", followerURI)
+		return nil
+	}
+
+	result, err := db.GetDB().Exec(ctx,
+		`UPDATE follows SET status = 'rejected'
+		 WHERE follower_did = $1 AND following_did = ANY($2) AND status = 'pending'`,
+		localUser.DID, remoteActorDIDs(actorURI),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark follow rejected: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		log.Printf("[Inbox] Ignoring Reject from %s: no pending follow from %s", actorURI, localUser.Username)
+		return nil
+	}
+
+	log.Printf("[Inbox] Follow from %s to %s rejected", localUser.Username, actorURI)
+	return nil
+}
+
+// handleMove re-points our users' follows from a remote account to the account it moved to.
+// The move is only honoured when the target lists the origin in its alsoKnownAs.
+func (h *InboxHandler) handleMove(ctx context.Context, activity map[string]interface{}) error {
+	originURI, targetURI, err := federation.ParseMove(activity)
+	if err != nil {
+		return err
+	}
+
+	// Moves into this instance are checked against the local user's aliases
+	if federation.IsLocalURI(targetURI) {
+		target, err := h.userRepo.GetLocalByUsername(ctx, extractUsernameFromURI(targetURI), h.cfg.Federation.Domain)
+		if err != nil || target == nil || !containsString(target.AlsoKnownAs, originURI) {
+			return federation.PermanentInboxError("move target %s does not list %s as an alias", targetURI, originURI)
+		}
+		return h.applyRemoteMove(ctx, originURI, target.DID, nil)
+	}
+
+	if err := federation.VerifyMoveTarget(targetURI, originURI); err != nil {
+		return err
+	}
+
+	targetActor, err := resolveActorFromURI(targetURI)
+	if err != nil || targetActor == nil {
+		return fmt.Errorf("failed to resolve move target %s: %v", targetURI, err)
+	}
+	if _, err := federation.EnsureRemoteUser(ctx, targetActor.ActorURI); err != nil {
+		log.Printf("[Inbox] Failed to ensure move target user: %v", err)
+	}
+	return h.applyRemoteMove(ctx, originURI, targetActor.ActorURI, targetActor)
+}
+
+// applyRemoteMove re-points our users' follows of a moved remote account and
+// leaves the account's ghost user pointing at its new home
+func (h *InboxHandler) applyRemoteMove(ctx context.Context, originURI, targetDID string, targetActor *federation.RemoteActor) error {
+	count, err := repointLocalFollowers(ctx, h.cfg, remoteActorDIDs(originURI), targetDID, targetActor)
+	if err != nil {
+		return err
+	}
+
+	if err := h.userRepo.MarkMoved(ctx, originURI, targetDID); err != nil {
+		log.Printf("[Inbox] Could not mark %s as moved: %v", originURI, err)
+	}
+
+	log.Printf("[Inbox] %s moved to %s; re-pointed %d local followers", originURI, targetDID, count)
+	return nil
+}
+
+// repointLocalFollowers moves the follows our users have of any of oldDIDs to targetDID.
+// When the target is remote (targetActor set) a Follow is sent on each follower's behalf
+// and the new follow stays pending until the target's server accepts it; a follow of the
+// target that was already accepted is kept. Returns the number of followers re-pointed.
+func repointLocalFollowers(ctx context.Context, cfg *config.Config, oldDIDs []string, targetDID string, targetActor *federation.RemoteActor) (int, error) {
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT u.did, u.username FROM follows f
+		 JOIN users u ON u.did = f.follower_did
+		 WHERE f.following_did = ANY($1) AND f.status = 'accepted' AND u.did <> $3
+		   AND COALESCE(u.instance_domain, '') = ANY($2)`,
+		oldDIDs, models.LocalInstanceDomains(cfg.Federation.Domain), targetDID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load followers of moved account: %w", err)
+	}
+	type localFollower struct{ did, username string }
+	var followers []localFollower
+	for rows.Next() {
+		var f localFollower
+		if rows.Scan(&f.did, &f.username) == nil {
+			followers = append(followers, f)
+		}
+	}
+	rows.Close()
+
+	status := "accepted"
+	if targetActor != nil {
+		status = "pending"
+	}
+	for _, f := range followers {
+		if _, err := db.GetDB().Exec(ctx,
+			`INSERT INTO follows (follower_did, following_did, status)
+			 VALUES ($1, $2, $3)
+			 ON CONFLICT (follower_did, following_did) DO UPDATE
+			 SET status = CASE WHEN follows.status = 'accepted' THEN 'accepted' ELSE EXCLUDED.status END`,
+			f.did, targetDID, status,
+		); err != nil {
+			return 0, fmt.Errorf("failed to re-point follow: %w", err)
+		}
+		if _, err := db.GetDB().Exec(ctx,
+			`DELETE FROM follows WHERE follower_did = $1 AND following_did = ANY($2)`,
+			f.did, oldDIDs,
+		); err != nil {
+			log.Printf("[Inbox] Failed to remove old follow after move: %v", err)
+		}
+
+		if targetActor != nil {
+			localActorURI := fmt.Sprintf("%s/ap/users/%s", cfg.Federation.URL, f.username)
+			if err := federation.SendFollow(localActorURI, targetActor); err != nil {
+				log.Printf("[Inbox] Failed to send Follow to move target: %v", err)
+			}
+		}
+	}
+	return len(followers), nil
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupLocalActor returns the local user behind an actor URI (or an activity
+// ID nested under it), or nil when the URI does not belong to this instance.
+func (h *InboxHandler) lookupLocalActor(ctx context.Context, uri string) *models.User {
+	if uri == "" {
+		return nil
+	}
+	domain := extractDomainFromURI(uri)
+	if domain != h.cfg.Federation.Domain && domain != "localhost" && !strings.HasPrefix(uri, h.cfg.Federation.URL+"/") {
+		return nil
+	}
+	username := extractUsernameFromURI(uri)
+	if username == "" {
+		return nil
+	}
+	user, err := h.userRepo.GetLocalByUsername(ctx, username, h.cfg.Federation.Domain)
+	if err != nil || user == nil {
+		return nil
+	}
+	return user
+}
+
+// remoteActorDIDs lists the identifiers a remote actor may be stored under in follows:
+// the actor URI (outbound follows) and did:web:domain:username (inbound follows).
+func remoteActorDIDs(actorURI string) []string {
+	dids := []string{actorURI}
+	if username, domain := extractUsernameFromURI(actorURI), extractDomainFromURI(actorURI); username != "" && domain != "" {
+		dids = append(dids, fmt.Sprintf("did:web:%s:%s", domain, username))
+	}
+	return dids
 }
 
 // Helper functions
@@ -759,6 +1626,16 @@ func extractPostIDFromURI(uri string) string {
 	return ""
 }
 
+func extractReplyIDFromURI(uri string) string {
+	parts := splitURI(uri)
+	for i, p := range parts {
+		if p == "replies" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
 func splitURI(uri string) []string {
 	// Remove protocol
 	idx := 0
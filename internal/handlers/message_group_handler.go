@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"splitter/internal/federation"
+	"splitter/internal/models"
+	"splitter/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+var errMissingEnvelopeKeys = errors.New("encrypted_keys must include every member device")
+
+// CreateGroupThread starts a group conversation owned by the current user
+// POST /api/v1/messages/groups
+func (h *MessageHandler) CreateGroupThread(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	var req models.GroupThreadCreate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	if err := req.Validate(userID); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	for _, memberID := range req.MemberIDs {
+		if _, err := h.userRepo.GetByID(c.Request().Context(), memberID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "User not found: " + memberID,
+			})
+		}
+	}
+
+	thread, err := h.msgRepo.CreateGroupThread(c.Request().Context(), userID, &req)
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"thread": thread,
+	})
+}
+
+// RenameThread sets the title of a group thread
+// PUT /api/v1/messages/threads/:threadId
+func (h *MessageHandler) RenameThread(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	var req struct {
+		Title string `json:"title"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	title := strings.TrimSpace(req.Title)
+	if len([]rune(title)) > models.GroupTitleMaxLen {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("title must be at most %d characters", models.GroupTitleMaxLen),
+		})
+	}
+
+	thread, err := h.msgRepo.RenameThread(c.Request().Context(), c.Param("threadId"), userID, title)
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"thread": thread,
+	})
+}
+
+// GetThreadMembers lists the members of a group thread
+// GET /api/v1/messages/threads/:threadId/members
+func (h *MessageHandler) GetThreadMembers(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	thread, err := h.msgRepo.GetThread(c.Request().Context(), c.Param("threadId"))
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+	if !thread.IsGroup {
+		return groupThreadError(c, repository.ErrNotGroupThread)
+	}
+	if !thread.HasMember(userID) {
+		return groupThreadError(c, repository.ErrNotThreadMember)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"members": thread.Members,
+	})
+}
+
+// AddThreadMembers adds members to a group thread
+// POST /api/v1/messages/threads/:threadId/members
+func (h *MessageHandler) AddThreadMembers(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	var req struct {
+		MemberIDs []string `json:"member_ids"`
+	}
+	if err := c.Bind(&req); err != nil || len(req.MemberIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "member_ids is required",
+		})
+	}
+
+	for _, memberID := range req.MemberIDs {
+		if _, err := h.userRepo.GetByID(c.Request().Context(), memberID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "User not found: " + memberID,
+			})
+		}
+	}
+
+	thread, err := h.msgRepo.AddThreadMembers(c.Request().Context(), c.Param("threadId"), userID, req.MemberIDs)
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"thread": thread,
+	})
+}
+
+// RemoveThreadMember removes a member from a group thread, or leaves it
+// DELETE /api/v1/messages/threads/:threadId/members/:userId
+func (h *MessageHandler) RemoveThreadMember(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	thread, err := h.msgRepo.RemoveThreadMember(c.Request().Context(), c.Param("threadId"), userID, c.Param("userId"))
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+
+	if thread == nil || !thread.HasMember(userID) {
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Left the conversation",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"thread": thread,
+	})
+}
+
+// GetThreadDeviceKeys lists the keys a group message must carry encrypted_keys entries for
+// GET /api/v1/messages/threads/:threadId/device-keys
+func (h *MessageHandler) GetThreadDeviceKeys(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	thread, err := h.msgRepo.GetThread(ctx, c.Param("threadId"))
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+	if !thread.IsGroup {
+		return groupThreadError(c, repository.ErrNotGroupThread)
+	}
+	if !thread.HasMember(userID) {
+		return groupThreadError(c, repository.ErrNotThreadMember)
+	}
+
+	keys, err := h.msgRepo.GetThreadDeviceKeys(ctx, thread.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to get device keys: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// groupThreadError maps group thread errors to a response
+func groupThreadError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, repository.ErrThreadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, repository.ErrNotThreadMember), errors.Is(err, repository.ErrNotThreadOwner):
+		status = http.StatusForbidden
+	case errors.Is(err, repository.ErrNotGroupThread), errors.Is(err, errMissingEnvelopeKeys):
+		status = http.StatusBadRequest
+	case errors.Is(err, repository.ErrThreadMemberLimit):
+		status = http.StatusConflict
+	case strings.HasPrefix(err.Error(), "message request blocked"):
+		status = http.StatusForbidden
+	}
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// groupSendTarget loads a group thread userID can send to. An encrypted message must
+// carry an envelope for every member device; the missing key IDs are returned with
+// errMissingEnvelopeKeys.
+func (h *MessageHandler) groupSendTarget(ctx context.Context, threadID, userID, ciphertext string, encryptedKeys map[string]string) (*models.MessageThread, []string, error) {
+	thread, err := h.msgRepo.GetThread(ctx, threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !thread.IsGroup {
+		return nil, nil, repository.ErrNotGroupThread
+	}
+	if !thread.HasMember(userID) {
+		return nil, nil, repository.ErrNotThreadMember
+	}
+
+	if ciphertext != "" {
+		keys, err := h.msgRepo.GetThreadDeviceKeys(ctx, thread.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if missing := models.MissingEnvelopeKeys(keys, encryptedKeys); len(missing) > 0 {
+			return nil, missing, errMissingEnvelopeKeys
+		}
+	}
+	return thread, nil, nil
+}
+
+// sendGroupMessage handles SendMessage for a group thread
+func (h *MessageHandler) sendGroupMessage(c echo.Context, userID, threadID, content, ciphertext string, encryptedKeys map[string]string) error {
+	ctx := c.Request().Context()
+
+	thread, missing, err := h.groupSendTarget(ctx, threadID, userID, ciphertext, encryptedKeys)
+	if errors.Is(err, errMissingEnvelopeKeys) {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":        err.Error(),
+			"missing_keys": missing,
+		})
+	}
+	if err != nil {
+		return groupThreadError(c, err)
+	}
+
+	sender, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to get sender profile",
+		})
+	}
+
+	msg, _, err := h.msgRepo.SendGroupMessage(ctx, thread.ID, userID, "", content, ciphertext, mapToJSONString(encryptedKeys), nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to send message: " + err.Error(),
+		})
+	}
+
+	response := map[string]interface{}{
+		"message": msg,
+		"thread":  thread,
+	}
+
+	if err := h.deliverFederatedGroupDM(sender, thread, msg.ID, content, ciphertext, encryptedKeys); err != nil {
+		log.Printf("[DM] Group federation delivery failed (message saved locally): %v", err)
+		response["federation_error"] = err.Error()
+	}
+
+	return c.JSON(http.StatusCreated, response)
+}
+
+// deliverFederatedGroupDM sends a group message to the inbox of every remote member.
+// The Create is addressed to all other members, local ones included, so each receiving
+// server can file it into a thread with the full member list.
+func (h *MessageHandler) deliverFederatedGroupDM(sender *models.User, thread *models.MessageThread, messageID, content, ciphertext string, encryptedKeys map[string]string) error {
+	if !h.cfg.Federation.Enabled || sender == nil || thread == nil {
+		return nil
+	}
+
+	recipientURIs := make([]string, 0, len(thread.Members))
+	inboxes := make([]string, 0)
+	var failures []string
+	for _, member := range thread.Members {
+		if member.UserID == sender.ID || member.User == nil {
+			continue
+		}
+		if !h.isRemoteUser(member.User) {
+			recipientURIs = append(recipientURIs, h.localActorURI(member.User.Username))
+			continue
+		}
+		remoteActor, err := h.resolveRemoteRecipient(member.User)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s@%s: %v", member.User.Username, member.User.InstanceDomain, err))
+			continue
+		}
+		recipientURIs = append(recipientURIs, remoteRecipientURI(member.User, remoteActor))
+		inboxes = append(inboxes, remoteActor.InboxURL)
+	}
+	if len(inboxes) == 0 && len(failures) == 0 {
+		return nil
+	}
+
+	contextURI := thread.FederationContext
+	if contextURI == "" {
+		contextURI = fmt.Sprintf("%s/ap/threads/%s", h.cfg.Federation.URL, thread.ID)
+	}
+
+	activity := federation.BuildCreateGroupDMActivity(h.localActorURI(sender.Username), messageID, contextURI, recipientURIs, content, ciphertext, encryptedKeys)
+	for _, inbox := range inboxes {
+		if err := federation.DeliverActivity(activity, inbox); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", inbox, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("delivery failed for %d member(s): %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
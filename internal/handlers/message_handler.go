@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -67,7 +69,7 @@ func (h *MessageHandler) GetMessages(c echo.Context) error {
 		})
 	}
 
-	if thread.ParticipantAID != userID && thread.ParticipantBID != userID {
+	if !thread.HasMember(userID) {
 		return c.JSON(http.StatusForbidden, map[string]string{
 			"error": "Not authorized to view this thread",
 		})
@@ -87,7 +89,13 @@ func (h *MessageHandler) GetMessages(c echo.Context) error {
 		}
 	}
 
-	messages, err := h.msgRepo.GetThreadMessages(c.Request().Context(), threadID, limit, offset)
+	// Group members only see what was sent after they joined
+	var since time.Time
+	if member := thread.Member(userID); member != nil {
+		since = member.JoinedAt
+	}
+
+	messages, err := h.msgRepo.GetThreadMessagesSince(c.Request().Context(), threadID, since, limit, offset)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to get messages: " + err.Error(),
@@ -95,7 +103,9 @@ func (h *MessageHandler) GetMessages(c echo.Context) error {
 	}
 
 	// Mark messages as read
-	_ = h.msgRepo.MarkMessagesAsRead(c.Request().Context(), threadID, userID)
+	if read, _ := h.msgRepo.MarkMessagesAsRead(c.Request().Context(), threadID, userID); read {
+		go h.deliverFederatedRead(userID, thread)
+	}
 
 	if messages == nil {
 		messages = []*models.Message{}
@@ -107,7 +117,7 @@ func (h *MessageHandler) GetMessages(c echo.Context) error {
 	})
 }
 
-// SendMessage sends a message to another user
+// SendMessage sends a message to another user, or to a group thread given by thread_id
 func (h *MessageHandler) SendMessage(c echo.Context) error {
 	userID := c.Get("user_id").(string)
 	ctx := c.Request().Context()
@@ -115,6 +125,7 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 
 	var req struct {
 		RecipientID   string            `json:"recipient_id"`
+		ThreadID      string            `json:"thread_id"`
 		Content       string            `json:"content"`
 		Ciphertext    string            `json:"ciphertext"`
 		EncryptedKeys map[string]string `json:"encrypted_keys"`
@@ -126,13 +137,13 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		})
 	}
 
-	if req.RecipientID == "" || (req.Content == "" && req.Ciphertext == "") {
+	if (req.RecipientID == "" && req.ThreadID == "") || (req.Content == "" && req.Ciphertext == "") {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Recipient ID and message content (or ciphertext) are required",
+			"error": "Recipient ID (or group thread ID) and message content (or ciphertext) are required",
 		})
 	}
 
-	if req.RecipientID == userID {
+	if req.ThreadID == "" && req.RecipientID == userID {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "Cannot send message to yourself",
 		})
@@ -144,6 +155,10 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		})
 	}
 
+	if req.ThreadID != "" {
+		return h.sendGroupMessage(c, userID, req.ThreadID, req.Content, req.Ciphertext, req.EncryptedKeys)
+	}
+
 	// Verify recipient exists
 	recipient, err := h.userRepo.GetByID(ctx, req.RecipientID)
 	if err != nil {
@@ -193,7 +208,7 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		"recipient": recipient,
 	}
 
-	if err := h.deliverFederatedDM(sender, recipient, req.Content, req.Ciphertext, req.EncryptedKeys); err != nil {
+	if err := h.deliverFederatedDM(sender, recipient, msg.ID, req.Content, req.Ciphertext, req.EncryptedKeys); err != nil {
 		log.Printf("[DM] Federation delivery failed (message saved locally): %v", err)
 		response["federation_error"] = err.Error()
 	}
@@ -248,18 +263,21 @@ func (h *MessageHandler) MarkAsRead(c echo.Context) error {
 		})
 	}
 
-	if thread.ParticipantAID != userID && thread.ParticipantBID != userID {
+	if !thread.HasMember(userID) {
 		return c.JSON(http.StatusForbidden, map[string]string{
 			"error": "Not authorized",
 		})
 	}
 
-	err = h.msgRepo.MarkMessagesAsRead(c.Request().Context(), threadID, userID)
+	read, err := h.msgRepo.MarkMessagesAsRead(c.Request().Context(), threadID, userID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to mark as read: " + err.Error(),
 		})
 	}
+	if read {
+		go h.deliverFederatedRead(userID, thread)
+	}
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "Messages marked as read",
@@ -278,9 +296,19 @@ func (h *MessageHandler) DeleteMessage(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	response := map[string]string{
 		"message": "Message deleted",
+	}
+
+	err = h.deliverFederatedMessageChange(c.Request().Context(), userID, messageID, func(actorURI string, recipientURIs []string, msg *models.Message) *federation.Activity {
+		return federation.BuildDeleteDMActivity(actorURI, msg.ID, recipientURIs)
 	})
+	if err != nil {
+		log.Printf("[DM] Federation delivery of deletion failed (deleted locally): %v", err)
+		response["federation_error"] = err.Error()
+	}
+
+	return c.JSON(http.StatusOK, response)
 }
 
 // EditMessage edits a message
@@ -306,9 +334,23 @@ func (h *MessageHandler) EditMessage(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	response := map[string]string{
 		"message": "Message edited",
+	}
+
+	err = h.deliverFederatedMessageChange(c.Request().Context(), userID, messageID, func(actorURI string, recipientURIs []string, msg *models.Message) *federation.Activity {
+		editedAt := time.Now()
+		if msg.EditedAt != nil {
+			editedAt = *msg.EditedAt
+		}
+		return federation.BuildUpdateDMActivity(actorURI, msg.ID, recipientURIs, msg.Content, msg.Ciphertext, editedAt)
 	})
+	if err != nil {
+		log.Printf("[DM] Federation delivery of edit failed (edited locally): %v", err)
+		response["federation_error"] = err.Error()
+	}
+
+	return c.JSON(http.StatusOK, response)
 }
 
 // SyncOfflineMessages safely syncs client-queued encrypted messages after reconnect.
@@ -322,6 +364,7 @@ func (h *MessageHandler) SyncOfflineMessages(c echo.Context) error {
 		QueuedMessages []struct {
 			ClientMessageID string            `json:"client_message_id"`
 			RecipientID     string            `json:"recipient_id"`
+			ThreadID        string            `json:"thread_id"`
 			Content         string            `json:"content"`
 			Ciphertext      string            `json:"ciphertext"`
 			EncryptedKeys   map[string]string `json:"encrypted_keys"`
@@ -377,12 +420,71 @@ func (h *MessageHandler) SyncOfflineMessages(c echo.Context) error {
 	failureCount := 0
 
 	for _, queued := range req.QueuedMessages {
+		if queued.ThreadID != "" {
+			sr := syncResult{ClientMessageID: queued.ClientMessageID, ThreadID: queued.ThreadID}
+			if queued.ClientMessageID == "" || (queued.Content == "" && queued.Ciphertext == "") {
+				failureCount++
+				sr.Error = "client_message_id and content/ciphertext are required"
+				results = append(results, sr)
+				continue
+			}
+
+			thread, missing, err := h.groupSendTarget(ctx, queued.ThreadID, userID, queued.Ciphertext, queued.EncryptedKeys)
+			if err != nil {
+				failureCount++
+				sr.Error = err.Error()
+				if len(missing) > 0 {
+					sr.Error += ": " + strings.Join(missing, ", ")
+				}
+				results = append(results, sr)
+				continue
+			}
+
+			var clientCreatedAt *time.Time
+			if queued.ClientCreatedAt != "" {
+				if parsed, parseErr := time.Parse(time.RFC3339, queued.ClientCreatedAt); parseErr == nil {
+					clientCreatedAt = &parsed
+				}
+			}
+
+			msg, created, err := h.msgRepo.SendGroupMessage(
+				ctx,
+				thread.ID,
+				userID,
+				queued.ClientMessageID,
+				queued.Content,
+				queued.Ciphertext,
+				mapToJSONString(queued.EncryptedKeys),
+				clientCreatedAt,
+			)
+			if err != nil {
+				failureCount++
+				sr.Error = "failed to sync message: " + err.Error()
+				results = append(results, sr)
+				continue
+			}
+
+			sr.Message = msg
+			sr.Created = created
+			if created {
+				createdCount++
+				if fedErr := h.deliverFederatedGroupDM(sender, thread, msg.ID, queued.Content, queued.Ciphertext, queued.EncryptedKeys); fedErr != nil {
+					log.Printf("[DM] Sync group federation delivery failed (message saved): %v", fedErr)
+					sr.Error = "federation delivery pending: " + fedErr.Error()
+				}
+			} else {
+				deduplicatedCount++
+			}
+			results = append(results, sr)
+			continue
+		}
+
 		if queued.RecipientID == "" || queued.ClientMessageID == "" || (queued.Content == "" && queued.Ciphertext == "") {
 			failureCount++
 			results = append(results, syncResult{
 				ClientMessageID: queued.ClientMessageID,
 				Created:         false,
-				Error:           "recipient_id, client_message_id and content/ciphertext are required",
+				Error:           "recipient_id (or thread_id), client_message_id and content/ciphertext are required",
 			})
 			continue
 		}
@@ -472,7 +574,7 @@ func (h *MessageHandler) SyncOfflineMessages(c echo.Context) error {
 				ThreadID:        thread.ID,
 				Created:         true,
 			}
-			if fedErr := h.deliverFederatedDM(sender, recipient, queued.Content, queued.Ciphertext, queued.EncryptedKeys); fedErr != nil {
+			if fedErr := h.deliverFederatedDM(sender, recipient, msg.ID, queued.Content, queued.Ciphertext, queued.EncryptedKeys); fedErr != nil {
 				log.Printf("[DM] Sync federation delivery failed (message saved): %v", fedErr)
 				sr.Error = "federation delivery pending: " + fedErr.Error()
 			}
@@ -496,6 +598,45 @@ func (h *MessageHandler) SyncOfflineMessages(c echo.Context) error {
 	})
 }
 
+// GetSyncChanges returns what changed in the user's conversations after ?cursor= for one
+// of their approved devices, named by ?device_id= or the X-Device-ID header. Each device
+// keeps its own cursor; while has_more is set it fetches again with the returned cursor.
+// GET /api/v1/messages/sync
+func (h *MessageHandler) GetSyncChanges(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	deviceID := strings.TrimSpace(c.QueryParam("device_id"))
+	if deviceID == "" {
+		deviceID = strings.TrimSpace(c.Request().Header.Get("X-Device-ID"))
+	}
+	if deviceID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "device_id is required"})
+	}
+
+	cursor, err := models.ParseSyncCursor(c.QueryParam("cursor"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	limit := models.MessageSyncDefaultLimit
+	if l := c.QueryParam("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, models.MessageSyncMaxLimit)
+		}
+	}
+
+	page, err := h.msgRepo.GetChangesSince(c.Request().Context(), userID, deviceID, cursor, limit)
+	if errors.Is(err, repository.ErrDeviceNotApproved) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("GetSyncChanges error for user %s device %s: %v", userID, deviceID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to sync messages"})
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
 func mapToJSONString(value map[string]string) string {
 	if len(value) == 0 {
 		return "{}"
@@ -507,15 +648,142 @@ func mapToJSONString(value map[string]string) string {
 	return string(raw)
 }
 
-func (h *MessageHandler) deliverFederatedDM(sender, recipient *models.User, content, ciphertext string, encryptedKeys map[string]string) error {
+func (h *MessageHandler) deliverFederatedDM(sender, recipient *models.User, messageID, content, ciphertext string, encryptedKeys map[string]string) error {
 	if !h.cfg.Federation.Enabled || recipient == nil || sender == nil {
 		return nil
 	}
 
-	if recipient.InstanceDomain == h.cfg.Federation.Domain || recipient.InstanceDomain == "localhost" || recipient.InstanceDomain == "" {
+	if !h.isRemoteUser(recipient) {
+		return nil
+	}
+
+	remoteActor, err := h.resolveRemoteRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	activity := federation.BuildCreateDMActivity(h.localActorURI(sender.Username), messageID, remoteRecipientURI(recipient, remoteActor), content, ciphertext, encryptedKeys)
+	return federation.DeliverActivity(activity, remoteActor.InboxURL)
+}
+
+// remoteThreadParticipants returns the participants of a thread, other than userID, who
+// live on another server
+func (h *MessageHandler) remoteThreadParticipants(ctx context.Context, thread *models.MessageThread, userID string) ([]*models.User, error) {
+	var participants []*models.User
+	if thread.IsGroup {
+		for _, member := range thread.Members {
+			if member.UserID != userID && member.User != nil {
+				participants = append(participants, member.User)
+			}
+		}
+	} else {
+		otherID := thread.ParticipantAID
+		if otherID == userID {
+			otherID = thread.ParticipantBID
+		}
+		other, err := h.userRepo.GetByID(ctx, otherID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get participant: %w", err)
+		}
+		participants = append(participants, other)
+	}
+
+	remote := make([]*models.User, 0, len(participants))
+	for _, participant := range participants {
+		if h.isRemoteUser(participant) && participant.DID != "" {
+			remote = append(remote, participant)
+		}
+	}
+	return remote, nil
+}
+
+// deliverFederatedMessageChange sends an edit or deletion of one of userID's messages,
+// built by build, to every remote participant of its thread
+func (h *MessageHandler) deliverFederatedMessageChange(ctx context.Context, userID, messageID string, build func(actorURI string, recipientURIs []string, msg *models.Message) *federation.Activity) error {
+	if !h.cfg.Federation.Enabled {
 		return nil
 	}
 
+	msg, err := h.msgRepo.GetMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	thread, err := h.msgRepo.GetThread(ctx, msg.ThreadID)
+	if err != nil {
+		return err
+	}
+	recipients, err := h.remoteThreadParticipants(ctx, thread, userID)
+	if err != nil || len(recipients) == 0 {
+		return err
+	}
+	sender, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get sender: %w", err)
+	}
+
+	recipientURIs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		recipientURIs = append(recipientURIs, recipient.DID)
+	}
+	activity := build(h.localActorURI(sender.Username), recipientURIs, msg)
+
+	var failures []string
+	for _, recipientURI := range recipientURIs {
+		if err := federation.DeliverToActor(activity, recipientURI); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", recipientURI, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("delivery failed for %d participant(s): %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// deliverFederatedRead sends a read receipt to each remote participant of a thread the
+// reader has just read, naming the newest message received from them. It runs after the
+// response, so failures are only logged.
+func (h *MessageHandler) deliverFederatedRead(readerID string, thread *models.MessageThread) {
+	if !h.cfg.Federation.Enabled {
+		return
+	}
+	ctx := context.Background()
+
+	senders, err := h.remoteThreadParticipants(ctx, thread, readerID)
+	if err != nil || len(senders) == 0 {
+		if err != nil {
+			log.Printf("[DM] Read receipt for thread %s not sent: %v", thread.ID, err)
+		}
+		return
+	}
+	reader, err := h.userRepo.GetByID(ctx, readerID)
+	if err != nil {
+		log.Printf("[DM] Read receipt for thread %s not sent: %v", thread.ID, err)
+		return
+	}
+
+	for _, sender := range senders {
+		noteURI, err := h.msgRepo.GetLatestObjectURIFrom(ctx, thread.ID, sender.ID)
+		if err != nil || noteURI == "" {
+			continue
+		}
+		activity := federation.BuildReadActivity(h.localActorURI(reader.Username), noteURI, sender.DID)
+		if err := federation.DeliverToActor(activity, sender.DID); err != nil {
+			log.Printf("[DM] Read receipt delivery to %s failed: %v", sender.DID, err)
+		}
+	}
+}
+
+// isRemoteUser reports whether user lives on another server
+func (h *MessageHandler) isRemoteUser(user *models.User) bool {
+	return !user.IsLocalTo(h.cfg.Federation.Domain)
+}
+
+func (h *MessageHandler) localActorURI(username string) string {
+	return fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, username)
+}
+
+// resolveRemoteRecipient resolves the actor of a remote user to deliver a DM to its inbox
+func (h *MessageHandler) resolveRemoteRecipient(recipient *models.User) (*federation.RemoteActor, error) {
 	resolveInputs := []string{}
 	if recipient.Username != "" && recipient.InstanceDomain != "" {
 		resolveInputs = append(resolveInputs, recipient.Username+"@"+recipient.InstanceDomain)
@@ -537,15 +805,15 @@ func (h *MessageHandler) deliverFederatedDM(sender, recipient *models.User, cont
 		if resolveErr == nil {
 			resolveErr = fmt.Errorf("missing remote inbox")
 		}
-		return fmt.Errorf("resolve recipient failed: %w", resolveErr)
+		return nil, fmt.Errorf("resolve recipient failed: %w", resolveErr)
 	}
+	return remoteActor, nil
+}
 
-	actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, sender.Username)
-	recipientURI := recipient.DID
-	if strings.TrimSpace(recipientURI) == "" {
-		recipientURI = remoteActor.ActorURI
+// remoteRecipientURI is the URI a DM to a remote user is addressed to
+func remoteRecipientURI(recipient *models.User, remoteActor *federation.RemoteActor) string {
+	if strings.TrimSpace(recipient.DID) != "" {
+		return recipient.DID
 	}
-
-	activity := federation.BuildCreateDMActivity(actorURI, recipientURI, content, ciphertext, encryptedKeys)
-	return federation.DeliverActivity(activity, remoteActor.InboxURL)
+	return remoteActor.ActorURI
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"splitter/internal/config"
+	"splitter/internal/db"
+	"splitter/internal/federation"
+	"splitter/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NodeInfoHandler serves NodeInfo and host-meta discovery documents
+type NodeInfoHandler struct {
+	cfg *config.Config
+}
+
+// NewNodeInfoHandler creates a new NodeInfoHandler
+func NewNodeInfoHandler(cfg *config.Config) *NodeInfoHandler {
+	return &NodeInfoHandler{cfg: cfg}
+}
+
+// GetNodeInfoIndex returns the NodeInfo discovery document
+// GET /.well-known/nodeinfo
+func (h *NodeInfoHandler) GetNodeInfoIndex(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"links": []WebFingerLink{
+			{
+				Rel:  federation.NodeInfoSchema,
+				Href: h.cfg.Federation.URL + "/nodeinfo/2.1",
+			},
+		},
+	})
+}
+
+// GetNodeInfo returns the NodeInfo 2.1 document with software and usage statistics
+// GET /nodeinfo/2.1
+func (h *NodeInfoHandler) GetNodeInfo(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var usage federation.NodeInfoUsage
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM users u
+			 WHERE COALESCE(u.instance_domain, '') = ANY($1)),
+			(SELECT COUNT(DISTINCT p.author_did) FROM posts p
+			 WHERE p.is_remote = false AND p.deleted_at IS NULL AND p.created_at > now() - interval '30 days'),
+			(SELECT COUNT(DISTINCT p.author_did) FROM posts p
+			 WHERE p.is_remote = false AND p.deleted_at IS NULL AND p.created_at > now() - interval '180 days'),
+			(SELECT COUNT(*) FROM posts p WHERE p.is_remote = false AND p.deleted_at IS NULL)`,
+		models.LocalInstanceDomains(h.cfg.Federation.Domain),
+	).Scan(&usage.TotalUsers, &usage.ActiveMonth, &usage.ActiveHalfyear, &usage.LocalPosts)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to load usage statistics",
+		})
+	}
+
+	nodeInfo := federation.BuildNodeInfo(h.cfg.Federation.Domain, h.cfg.Server.RegistrationsOpen, usage)
+
+	c.Response().Header().Set("Content-Type", `application/json; profile="`+federation.NodeInfoSchema+`#"; charset=utf-8`)
+	return c.JSON(http.StatusOK, nodeInfo)
+}
+
+// GetHostMeta returns the XRD host-meta document pointing at WebFinger
+// GET /.well-known/host-meta
+func (h *NodeInfoHandler) GetHostMeta(c echo.Context) error {
+	xrd := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" template="%s/.well-known/webfinger?resource={uri}"/>
+</XRD>
+`, h.cfg.Federation.URL)
+	return c.Blob(http.StatusOK, "application/xrd+xml; charset=utf-8", []byte(xrd))
+}
+
+// GetHostMetaJSON returns the JRD form of host-meta
+// GET /.well-known/host-meta.json
+func (h *NodeInfoHandler) GetHostMetaJSON(c echo.Context) error {
+	c.Response().Header().Set("Content-Type", "application/jrd+json; charset=utf-8")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"links": []map[string]string{
+			{
+				"rel":      "lrdd",
+				"template": h.cfg.Federation.URL + "/.well-known/webfinger?resource={uri}",
+			},
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"splitter/internal/config"
+	"splitter/internal/federation"
+	"splitter/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NoteHandler serves local posts and replies as ActivityPub Note objects
+type NoteHandler struct {
+	postRepo  *repository.PostRepository
+	replyRepo *repository.ReplyRepository
+	cfg       *config.Config
+}
+
+// NewNoteHandler creates a new NoteHandler
+func NewNoteHandler(postRepo *repository.PostRepository, cfg *config.Config) *NoteHandler {
+	return &NoteHandler{postRepo: postRepo, replyRepo: repository.NewReplyRepository(), cfg: cfg}
+}
+
+// GetNote returns the Note for a local public post, i.e. the object behind the
+// IDs used in our Create activities.
+// GET /posts/:id
+func (h *NoteHandler) GetNote(c echo.Context) error {
+	post, err := h.postRepo.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil || post == nil || post.IsRemote || (post.Visibility != "" && post.Visibility != "public") {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "note not found",
+		})
+	}
+
+	baseURL := strings.TrimRight(h.cfg.Federation.URL, "/")
+	actorURI := fmt.Sprintf("%s/ap/users/%s", baseURL, post.Username)
+
+	mediaURL := ""
+	if len(post.Media) > 0 {
+		mediaURL = post.Media[0].MediaURL
+		if mediaURL != "" && !strings.HasPrefix(mediaURL, "http") {
+			mediaURL = baseURL + mediaURL
+		}
+	}
+
+	activity := federation.BuildCreateNoteActivity(actorURI, post.ID, post.Content, post.CreatedAt, mediaURL, post.InReplyToURI, post.ContentWarning, post.Sensitive)
+	note, ok := activity.Object.(federation.Note)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to build note",
+		})
+	}
+	note.Context = "https://www.w3.org/ns/activitystreams"
+	if post.UpdatedAt != nil {
+		note.Updated = post.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+	if post.Poll != nil {
+		return c.JSON(http.StatusOK, federation.NewQuestion(note, questionPoll(post.Poll)))
+	}
+	return c.JSON(http.StatusOK, note)
+}
+
+// GetReplyNote returns the Note for a local reply on a public post
+// GET /replies/:id
+func (h *NoteHandler) GetReplyNote(c echo.Context) error {
+	ctx := c.Request().Context()
+	reply, err := h.replyRepo.GetByID(ctx, c.Param("id"))
+	if err != nil || reply == nil || reply.OriginalURI != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "note not found",
+		})
+	}
+	post, err := h.postRepo.GetByID(ctx, reply.PostID)
+	if err != nil || post == nil || (post.Visibility != "" && post.Visibility != "public") {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "note not found",
+		})
+	}
+
+	baseURL := strings.TrimRight(h.cfg.Federation.URL, "/")
+	actorURI := fmt.Sprintf("%s/ap/users/%s", baseURL, reply.Username)
+	inReplyTo := inReplyToURI(ctx, h.postRepo, h.replyRepo, baseURL, reply.PostID, reply.ParentID)
+
+	activity := federation.BuildCreateReplyActivity(actorURI, reply.ID, reply.Content, reply.CreatedAt, inReplyTo)
+	note, ok := activity.Object.(federation.Note)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to build note",
+		})
+	}
+	note.Context = "https://www.w3.org/ns/activitystreams"
+
+	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+	return c.JSON(http.StatusOK, note)
+}
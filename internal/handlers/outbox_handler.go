@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"splitter/internal/config"
-	"splitter/internal/db"
+	"splitter/internal/federation"
 	"splitter/internal/repository"
 
 	"github.com/labstack/echo/v4"
@@ -14,58 +16,93 @@ import (
 // OutboxHandler handles ActivityPub outbox queries
 type OutboxHandler struct {
 	userRepo *repository.UserRepository
+	postRepo *repository.PostRepository
 	cfg      *config.Config
 }
 
 // NewOutboxHandler creates a new OutboxHandler
-func NewOutboxHandler(userRepo *repository.UserRepository, cfg *config.Config) *OutboxHandler {
-	return &OutboxHandler{userRepo: userRepo, cfg: cfg}
+func NewOutboxHandler(userRepo *repository.UserRepository, postRepo *repository.PostRepository, cfg *config.Config) *OutboxHandler {
+	return &OutboxHandler{userRepo: userRepo, postRepo: postRepo, cfg: cfg}
 }
 
-// GetOutbox returns the outbox for a user (OrderedCollection of activities)
-// GET /users/:username/outbox
+// GetOutbox returns the outbox for a user (OrderedCollection of activities).
+// Only the user's public Create and Announce activities are listed, built from
+// posts and interactions rather than the delivery log.
+// GET /ap/users/:username/outbox
 func (h *OutboxHandler) GetOutbox(c echo.Context) error {
+	ctx := c.Request().Context()
 	username := c.Param("username")
 
 	// Verify user exists
-	user, _, err := h.userRepo.GetByUsername(c.Request().Context(), username)
+	user, err := h.userRepo.GetLocalByUsername(ctx, username, h.cfg.Federation.Domain)
 	if err != nil || user == nil {
 		return c.JSON(http.StatusNotFound, map[string]string{
 			"error": "user not found",
 		})
 	}
 
-	// Get recent outbox activities
-	rows, err := db.GetDB().Query(c.Request().Context(),
-		`SELECT payload FROM outbox_activities
-		 WHERE status = 'sent'
-		 ORDER BY created_at DESC LIMIT 20`)
+	total, err := h.postRepo.CountOutboxEntries(ctx, user.DID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "failed to get outbox",
 		})
 	}
-	defer rows.Close()
-
-	var items []interface{}
-	for rows.Next() {
-		var payload []byte
-		if err := rows.Scan(&payload); err == nil {
-			var item interface{}
-			if err := json.Unmarshal(payload, &item); err == nil {
-				items = append(items, item)
-			}
-		}
+
+	baseURL := strings.TrimRight(h.cfg.Federation.URL, "/")
+	actorURI := fmt.Sprintf("%s/ap/users/%s", baseURL, username)
+	outboxID := actorURI + "/outbox"
+
+	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
+
+	pageParam := c.QueryParam("page")
+	if pageParam == "" {
+		return c.JSON(http.StatusOK, federation.OrderedCollection(outboxID, total, collectionPageSize))
 	}
 
-	collection := map[string]interface{}{
-		"@context":     "https://www.w3.org/ns/activitystreams",
-		"id":           h.cfg.Federation.URL + "/users/" + username + "/outbox",
-		"type":         "OrderedCollection",
-		"totalItems":   len(items),
-		"orderedItems": items,
+	page, err := strconv.Atoi(pageParam)
+	if err != nil || page < 1 {
+		page = 1
 	}
 
-	c.Response().Header().Set("Content-Type", "application/activity+json; charset=utf-8")
-	return c.JSON(http.StatusOK, collection)
+	entries, err := h.postRepo.GetOutboxEntries(ctx, user.DID, collectionPageSize, (page-1)*collectionPageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to get outbox",
+		})
+	}
+
+	items := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		if activity := OutboxActivity(baseURL, actorURI, entry); activity != nil {
+			items = append(items, activity)
+		}
+	}
+
+	return c.JSON(http.StatusOK, federation.OrderedCollectionPage(outboxID, page, total, collectionPageSize, items))
+}
+
+// OutboxActivity builds the activity an outbox entry is listed as: the Create of a
+// post, or the Announce of a repost under an ID that stays the same across fetches.
+// Returns nil for entries of an unknown kind.
+func OutboxActivity(baseURL, actorURI string, entry *repository.OutboxEntry) *federation.Activity {
+	switch entry.Kind {
+	case "create":
+		mediaURL := entry.MediaURL
+		if mediaURL != "" && !strings.HasPrefix(mediaURL, "http") {
+			mediaURL = baseURL + mediaURL
+		}
+		return federation.BuildCreateNoteActivity(
+			actorURI, entry.PostID, entry.Content, entry.PostCreatedAt, mediaURL, entry.InReplyToURI,
+			entry.ContentWarning, entry.Sensitive,
+		)
+	case "announce":
+		objectURI := fmt.Sprintf("%s/posts/%s", baseURL, entry.PostID)
+		if entry.IsRemote && entry.OriginalPostURI != "" {
+			objectURI = entry.OriginalPostURI
+		}
+		activity := federation.BuildAnnounceActivity(actorURI, objectURI)
+		activity.ID = fmt.Sprintf("%s/activities/announce-%s", baseURL, entry.ActivityKey)
+		return activity
+	}
+	return nil
 }
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"splitter/internal/config"
+	"splitter/internal/federation"
+	"splitter/internal/models"
+	"splitter/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetPoll returns the poll of a post with its current results
+// GET /api/v1/posts/:id/poll
+func (h *PostHandler) GetPoll(c echo.Context) error {
+	did, _ := c.Get("did").(string)
+	poll, err := h.postRepo.GetPoll(c.Request().Context(), c.Param("id"), did)
+	if errors.Is(err, repository.ErrPollNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Poll not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to get poll",
+		})
+	}
+	return c.JSON(http.StatusOK, poll)
+}
+
+// VotePoll casts the current user's vote. Votes on remote polls are sent to the poll's
+// author as Notes named after each chosen option.
+// POST /api/v1/posts/:id/poll/votes
+func (h *PostHandler) VotePoll(c echo.Context) error {
+	did, ok := c.Get("did").(string)
+	if !ok || did == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req models.PollVote
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := c.Request().Context()
+	post, err := h.postRepo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Post not found",
+		})
+	}
+	if post.AuthorDID == did {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "You cannot vote in your own poll",
+		})
+	}
+
+	err = h.postRepo.VotePoll(ctx, post.ID, did, req.Choices, "")
+	switch {
+	case errors.Is(err, repository.ErrPollNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Poll not found",
+		})
+	case errors.Is(err, repository.ErrPollClosed):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": "Poll has ended",
+		})
+	case errors.Is(err, repository.ErrPollAlreadyVoted):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "You have already voted in this poll",
+		})
+	case errors.Is(err, repository.ErrPollInvalidChoice):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid poll choices",
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to record vote",
+		})
+	}
+
+	poll, err := h.postRepo.GetPoll(ctx, post.ID, did)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to get poll",
+		})
+	}
+
+	if post.IsRemote && post.OriginalPostURI != "" && h.cfg.Federation.Enabled {
+		go h.deliverPollVotes(did, post, poll, req.Choices)
+	}
+
+	return c.JSON(http.StatusOK, poll)
+}
+
+// deliverPollVotes sends one vote Note per choice to the author of a remote poll
+func (h *PostHandler) deliverPollVotes(did string, post *models.Post, poll *models.Poll, choices []int) {
+	user, err := h.userRepo.GetByDID(context.Background(), did)
+	if err != nil {
+		log.Printf("[Federation] Failed to fetch user %s for poll vote delivery: %v", did, err)
+		return
+	}
+	actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+
+	for _, choice := range choices {
+		activity := federation.BuildPollVoteActivity(actorURI, post.OriginalPostURI, post.AuthorDID, poll.Options[choice].Title)
+		if err := federation.DeliverToActor(activity, post.AuthorDID); err != nil {
+			log.Printf("[Federation] Failed to deliver poll vote on %s: %v", post.OriginalPostURI, err)
+		}
+	}
+}
+
+// formValues returns every value of a repeated form field, as in poll_options=a&poll_options=b
+func formValues(c echo.Context, name string) []string {
+	form, err := c.FormParams()
+	if err != nil {
+		return nil
+	}
+	return form[name]
+}
+
+// questionPoll converts a stored poll into the poll of a federated Question
+func questionPoll(poll *models.Poll) federation.QuestionPoll {
+	question := federation.QuestionPoll{
+		Multiple:    poll.Multiple,
+		EndTime:     poll.ExpiresAt,
+		ClosedAt:    poll.ClosedAt,
+		VotersCount: poll.VotersCount,
+	}
+	for _, option := range poll.Options {
+		question.Options = append(question.Options, option.Title)
+		question.Counts = append(question.Counts, option.VotesCount)
+	}
+	return question
+}
+
+// remotePoll converts the poll of an inbound Question into a poll to cache
+func remotePoll(question federation.QuestionPoll) *models.Poll {
+	poll := &models.Poll{
+		Multiple:    question.Multiple,
+		ExpiresAt:   question.EndTime,
+		ClosedAt:    question.ClosedAt,
+		VotersCount: question.VotersCount,
+	}
+	for i, title := range question.Options {
+		poll.Options = append(poll.Options, models.PollOption{Title: title, VotesCount: question.Counts[i]})
+	}
+	return poll
+}
+
+// CloseExpiredPolls closes the expired polls of local posts and federates their final
+// results as Update(Question) to the post's audience and the remote voters.
+func CloseExpiredPolls(ctx context.Context, postRepo *repository.PostRepository, userRepo *repository.UserRepository, cfg *config.Config) (int, error) {
+	postIDs, err := postRepo.CloseExpiredPolls(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !cfg.Federation.Enabled {
+		return len(postIDs), nil
+	}
+
+	for _, postID := range postIDs {
+		post, err := postRepo.GetByID(ctx, postID)
+		if err != nil || post.Poll == nil {
+			continue
+		}
+		user, err := userRepo.GetByDID(ctx, post.AuthorDID)
+		if err != nil {
+			log.Printf("[Federation] Failed to fetch author of closed poll %s: %v", postID, err)
+			continue
+		}
+
+		actorURI := fmt.Sprintf("%s/ap/users/%s", cfg.Federation.URL, user.Username)
+		closedAt := time.Now().UTC()
+		if post.Poll.ClosedAt != nil {
+			closedAt = *post.Poll.ClosedAt
+		}
+		// Posts with a poll carry no media
+		activity := federation.BuildUpdateNoteActivity(actorURI, post.ID, post.Content, post.CreatedAt, closedAt, "", "", post.ContentWarning, post.Sensitive)
+		// The Update carries the results, not an edit of the text
+		if note, ok := activity.Object.(federation.Note); ok {
+			note.Updated = ""
+			if post.UpdatedAt != nil {
+				note.Updated = post.UpdatedAt.UTC().Format(time.RFC3339)
+			}
+			activity.Object = note
+		}
+		federation.AsQuestion(activity, questionPoll(post.Poll))
+
+		deliverToAudience(activity, post.Visibility, post.AuthorDID, actorURI)
+		voters, err := postRepo.GetPollRemoteVoters(ctx, post.ID)
+		if err != nil {
+			log.Printf("[Federation] Failed to list voters of poll %s: %v", postID, err)
+			continue
+		}
+		for _, voter := range voters {
+			if err := federation.DeliverToActor(activity, voter); err != nil {
+				log.Printf("[Federation] Failed to deliver poll results to %s: %v", voter, err)
+			}
+		}
+	}
+	return len(postIDs), nil
+}
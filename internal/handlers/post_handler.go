@@ -10,8 +10,10 @@ import (
 
 	"splitter/internal/config"
 	"splitter/internal/federation"
+	"splitter/internal/helpers"
 	"splitter/internal/models"
 	"splitter/internal/repository"
+	"splitter/internal/sanitize"
 	"splitter/internal/service"
 
 	"github.com/labstack/echo/v4"
@@ -43,11 +45,21 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 		})
 	}
 
+	// A moved account is a tombstone pointing at its new home
+	if author, err := h.userRepo.GetByDID(c.Request().Context(), did); err == nil && author.MovedTo != "" {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Account has moved to " + author.MovedTo,
+		})
+	}
+
 	// Parse multipart form
 	// Limit handled by middleware, but good to have fallback checks
 	content := c.FormValue("content")
 	visibility := c.FormValue("visibility")
+	contentWarning := strings.TrimSpace(c.FormValue("content_warning"))
+	sensitive := c.FormValue("sensitive") == "true"
 	expiresInMinutesRaw := c.FormValue("expires_in_minutes")
+	pollOptions := formValues(c, "poll_options")
 
 	// Handle file upload check first to validate
 	file, fileErr := c.FormFile("file")
@@ -58,6 +70,16 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 			"error": "Content too long (max 500 characters)",
 		})
 	}
+	if len(contentWarning) > 200 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Content warning too long (max 200 characters)",
+		})
+	}
+	if visibility != "" && !models.IsValidVisibility(visibility) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid visibility setting",
+		})
+	}
 	// Check if both content is empty and no file is provided
 	// fileErr will be nil if file exists
 	if content == "" && fileErr != nil {
@@ -104,9 +126,33 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 
 	req := models.PostCreate{
 		Content:          content,
+		ContentWarning:   contentWarning,
+		Sensitive:        sensitive,
 		Visibility:       visibility,
 		ExpiresInMinutes: expiresInMinutes,
 	}
+	if len(pollOptions) > 0 {
+		pollExpiresIn := 0
+		if raw := c.FormValue("poll_expires_in_minutes"); raw != "" {
+			parsed, parseErr := strconv.Atoi(raw)
+			if parseErr != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "poll_expires_in_minutes must be an integer",
+				})
+			}
+			pollExpiresIn = parsed
+		}
+		req.Poll = &models.PollCreate{
+			Options:          pollOptions,
+			Multiple:         c.FormValue("poll_multiple") == "true",
+			ExpiresInMinutes: pollExpiresIn,
+		}
+		if err := req.Validate(fileErr == nil); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+	}
 
 	post, err := h.postRepo.Create(c.Request().Context(), did, &req, mediaData, mediaType)
 	if err != nil {
@@ -115,6 +161,8 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 		})
 	}
 
+	h.recordLocalMentions(c.Request().Context(), post.ID, post.Content)
+
 	// Federation Hook: Deliver to remote followers
 	if h.cfg.Federation.Enabled {
 		log.Printf("[Federation] Post created by %s, triggering delivery...", did)
@@ -126,25 +174,21 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 				return
 			}
 
+			if err := federation.RecordMentionLinks(context.Background(), post.ID, post.Content); err != nil {
+				log.Printf("[Federation] Failed to record mention links of post %s: %v", post.ID, err)
+			}
+
 			// Construct Actor URI: base_url/ap/users/username
 			actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
 			log.Printf("[Federation] Building Create activity for %s (post %s)", actorURI, post.ID)
 
-			// Resolve absolute media URL for federation
-			mediaURL := ""
-			if len(post.Media) > 0 && post.Media[0].MediaURL != "" {
-				mu := post.Media[0].MediaURL
-				if !strings.HasPrefix(mu, "http") {
-					mu = strings.TrimRight(h.cfg.Federation.URL, "/") + mu
-				}
-				mediaURL = mu
-			}
-
 			// Build Create activity
-			activity := federation.BuildCreateNoteActivity(actorURI, post.ID, post.Content, post.CreatedAt, mediaURL, "")
+			activity := federation.BuildCreateNoteActivity(actorURI, post.ID, post.Content, post.CreatedAt, h.federatedMediaURL(post), "", post.ContentWarning, post.Sensitive)
+			if post.Poll != nil {
+				federation.AsQuestion(activity, questionPoll(post.Poll))
+			}
 
-			// Deliver to followers
-			federation.DeliverToFollowers(activity, did)
+			deliverToAudience(activity, post.Visibility, did, actorURI)
 		}()
 	} else {
 		log.Printf("[Federation] Federation disabled, skipping delivery for post %s", post.ID)
@@ -157,6 +201,61 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 	return c.JSON(http.StatusCreated, post)
 }
 
+// federatedMediaURL resolves the absolute URL of a post's first attachment for federation
+func (h *PostHandler) federatedMediaURL(post *models.Post) string {
+	if len(post.Media) == 0 || post.Media[0].MediaURL == "" {
+		return ""
+	}
+	mediaURL := post.Media[0].MediaURL
+	if !strings.HasPrefix(mediaURL, "http") {
+		mediaURL = strings.TrimRight(h.cfg.Federation.URL, "/") + mediaURL
+	}
+	return mediaURL
+}
+
+// recordLocalMentions stores mentions of local users so they show up in their mentions list
+func (h *PostHandler) recordLocalMentions(ctx context.Context, postID, content string) {
+	var dids []string
+	for _, mention := range federation.ParseMentions(content) {
+		if mention.Domain != "" {
+			continue
+		}
+		user, err := h.userRepo.GetLocalByUsername(ctx, mention.Username, h.cfg.Federation.Domain)
+		if err != nil || user == nil {
+			continue
+		}
+		dids = append(dids, user.DID)
+	}
+	if len(dids) == 0 {
+		return
+	}
+	if err := h.postRepo.AddMentions(ctx, postID, dids); err != nil {
+		log.Printf("[Posts] Failed to record mentions for post %s: %v", postID, err)
+	}
+}
+
+// GetMentions returns posts that mention the current user
+// GET /api/v1/posts/mentions
+func (h *PostHandler) GetMentions(c echo.Context) error {
+	did, ok := c.Get("did").(string)
+	if !ok || did == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Unauthorized",
+		})
+	}
+
+	limit, offset := helpers.ParsePagination(c.QueryParam("limit"), c.QueryParam("offset"))
+
+	posts, err := h.postRepo.GetMentions(c.Request().Context(), did, limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch mentions",
+		})
+	}
+
+	return c.JSON(http.StatusOK, posts)
+}
+
 // GetPost retrieves a post by ID
 func (h *PostHandler) GetPost(c echo.Context) error {
 	postID := c.Param("id")
@@ -176,6 +275,12 @@ func (h *PostHandler) GetPost(c echo.Context) error {
 	if post.InReplyToURI != "" {
 		post.ParentContext = h.resolveParentContext(c.Request().Context(), post.InReplyToURI)
 	}
+	if did, _ := c.Get("did").(string); did != "" && post.Poll != nil {
+		if poll, err := h.postRepo.GetPoll(c.Request().Context(), post.ID, did); err == nil {
+			post.Poll = poll
+		}
+	}
+	h.queueThreadBackfill(c, post)
 
 	return c.JSON(http.StatusOK, post)
 }
@@ -197,6 +302,9 @@ func (h *PostHandler) FetchThreadContext(c echo.Context) error {
 		})
 	}
 
+	// The rest of the conversation (deeper ancestors, replies) is fetched in the background
+	h.queueThreadBackfill(c, post)
+
 	if post.InReplyToURI == "" {
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"message":        "Post has no parent context",
@@ -282,18 +390,7 @@ func (h *PostHandler) resolveParentContext(ctx context.Context, parentURI string
 		}
 	}
 
-	if note.AttributedTo != "" {
-		_, _ = federation.EnsureRemoteUser(ctx, note.AttributedTo)
-	}
-
-	cachedParent, cacheErr := h.postRepo.CreateRemoteCachedPost(
-		ctx,
-		note.AttributedTo,
-		note.Content,
-		note.ID,
-		note.InReplyTo,
-		note.PublishedAt,
-	)
+	cachedParent, cacheErr := cacheRemoteNote(ctx, h.postRepo, note)
 	if cacheErr != nil || cachedParent == nil {
 		return &models.ParentContextInfo{
 			Status:  "missing",
@@ -310,6 +407,115 @@ func (h *PostHandler) resolveParentContext(ctx context.Context, parentURI string
 	}
 }
 
+// cacheRemoteNote stores a fetched remote Note as a cached post, creating a ghost user for its author
+func cacheRemoteNote(ctx context.Context, postRepo *repository.PostRepository, note *federation.RemoteNote) (*models.Post, error) {
+	if note.AttributedTo != "" {
+		_, _ = federation.EnsureRemoteUser(ctx, note.AttributedTo)
+	}
+
+	contentHTML, content := sanitize.Remote(note.Content)
+	return postRepo.CreateRemoteCachedPost(
+		ctx,
+		note.AttributedTo,
+		content,
+		contentHTML,
+		note.ID,
+		note.InReplyTo,
+		note.PublishedAt,
+	)
+}
+
+// NewThreadBackfillStore returns the store used by thread backfill workers: Notes are cached as remote posts
+func NewThreadBackfillStore(postRepo *repository.PostRepository) federation.ThreadNoteStore {
+	return func(ctx context.Context, note *federation.RemoteNote) error {
+		_, err := cacheRemoteNote(ctx, postRepo, note)
+		return err
+	}
+}
+
+// threadRootURI returns the remote Note whose thread should be backfilled for a post:
+// the post itself when remote, or the remote post it replies to.
+func threadRootURI(post *models.Post) string {
+	if post.IsRemote && post.OriginalPostURI != "" {
+		return post.OriginalPostURI
+	}
+	if post.InReplyToURI != "" && !federation.IsLocalURI(post.InReplyToURI) {
+		return post.InReplyToURI
+	}
+	return ""
+}
+
+// BackfillThread queues a background fetch of a remote thread's ancestors and replies.
+// POST /api/v1/posts/:id/backfill
+func (h *PostHandler) BackfillThread(c echo.Context) error {
+	post, err := h.postRepo.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Post not found",
+		})
+	}
+
+	rootURI := threadRootURI(post)
+	if rootURI == "" || !h.cfg.Federation.Enabled {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Post is not part of a remote thread",
+		})
+	}
+
+	job, err := federation.EnqueueThreadBackfill(c.Request().Context(), rootURI)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to queue thread backfill",
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// GetThreadBackfill reports the state of a post's thread backfill
+// GET /api/v1/posts/:id/backfill
+func (h *PostHandler) GetThreadBackfill(c echo.Context) error {
+	post, err := h.postRepo.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Post not found",
+		})
+	}
+
+	rootURI := threadRootURI(post)
+	if rootURI == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Post is not part of a remote thread",
+		})
+	}
+
+	job, err := federation.GetThreadBackfill(c.Request().Context(), rootURI)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "No backfill for this thread",
+		})
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+// queueThreadBackfill schedules a backfill when a local user opens a remote thread
+func (h *PostHandler) queueThreadBackfill(c echo.Context, post *models.Post) {
+	if !h.cfg.Federation.Enabled {
+		return
+	}
+	if did, _ := c.Get("did").(string); did == "" {
+		return
+	}
+	rootURI := threadRootURI(post)
+	if rootURI == "" {
+		return
+	}
+	if _, err := federation.EnqueueThreadBackfill(c.Request().Context(), rootURI); err != nil {
+		log.Printf("[Backfill] Failed to queue backfill of %s: %v", rootURI, err)
+	}
+}
+
 func summarizeParentPost(post *models.Post) *models.ParentPostSummary {
 	if post == nil {
 		return nil
@@ -451,6 +657,11 @@ func (h *PostHandler) UpdatePost(c echo.Context) error {
 			"error": "Invalid request body",
 		})
 	}
+	if req.Visibility != nil && !models.IsValidVisibility(*req.Visibility) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid visibility setting",
+		})
+	}
 
 	post, err := h.postRepo.Update(c.Request().Context(), postID, did, &req)
 	if err != nil {
@@ -459,9 +670,103 @@ func (h *PostHandler) UpdatePost(c echo.Context) error {
 		})
 	}
 
+	if req.Content != nil {
+		h.recordLocalMentions(c.Request().Context(), post.ID, post.Content)
+	}
+
+	// Federation Hook: send the edited Note to the audience of the original Create
+	if h.cfg.Federation.Enabled && req.Content != nil {
+		go h.deliverPostUpdate(did, post.ID)
+	}
+
 	return c.JSON(http.StatusOK, post)
 }
 
+// deliverPostUpdate sends an Update(Note) with the current version of a post
+func (h *PostHandler) deliverPostUpdate(did, postID string) {
+	ctx := context.Background()
+	user, err := h.userRepo.GetByDID(ctx, did)
+	if err != nil {
+		log.Printf("[Federation] Failed to fetch user %s for update delivery: %v", did, err)
+		return
+	}
+	post, err := h.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		log.Printf("[Federation] Failed to load edited post %s: %v", postID, err)
+		return
+	}
+	if post.IsRemote || post.UpdatedAt == nil {
+		return
+	}
+	if err := federation.RecordMentionLinks(ctx, post.ID, post.Content); err != nil {
+		log.Printf("[Federation] Failed to record mention links of post %s: %v", post.ID, err)
+	}
+
+	actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+	activity := federation.BuildUpdateNoteActivity(actorURI, post.ID, post.Content, post.CreatedAt, *post.UpdatedAt, h.federatedMediaURL(post), "", post.ContentWarning, post.Sensitive)
+	if post.Poll != nil {
+		federation.AsQuestion(activity, questionPoll(post.Poll))
+	}
+
+	deliverToAudience(activity, post.Visibility, did, actorURI)
+}
+
+// deliverToAudience addresses an activity about a local post according to the post's visibility
+// and delivers it: public posts go to followers, mentioned accounts and relays; followers-only
+// posts to the followers collection and mentioned accounts; circle posts only to the remote
+// members of the author's circle.
+func deliverToAudience(activity *federation.Activity, visibility, authorDID, actorURI string) {
+	switch visibility {
+	case "", "public":
+		federation.DeliverToFollowers(activity, authorDID)
+		federation.DeliverToMentioned(activity)
+		federation.DeliverToRelays(activity)
+	case "followers":
+		federation.AddressToFollowers(activity, actorURI)
+		federation.DeliverToFollowers(activity, authorDID)
+		federation.DeliverToMentioned(activity)
+	case "circle":
+		federation.DeliverToCircle(activity, authorDID)
+	}
+}
+
+// GetPostRevisions returns the edit history of a post, oldest first, ending with the current version
+// GET /api/v1/posts/:id/revisions
+func (h *PostHandler) GetPostRevisions(c echo.Context) error {
+	post, err := h.postRepo.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Post not found",
+		})
+	}
+
+	revisions, err := h.postRepo.GetRevisions(c.Request().Context(), post.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch revisions",
+		})
+	}
+
+	current := &models.PostRevision{
+		PostID:         post.ID,
+		Content:        post.Content,
+		ContentHTML:    post.ContentHTML,
+		ContentWarning: post.ContentWarning,
+		Sensitive:      post.Sensitive,
+		CreatedAt:      post.CreatedAt,
+		Current:        true,
+	}
+	if post.UpdatedAt != nil {
+		current.CreatedAt = *post.UpdatedAt
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"post_id":    post.ID,
+		"updated_at": post.UpdatedAt,
+		"revisions":  append(revisions, current),
+	})
+}
+
 // DeletePost deletes a post
 func (h *PostHandler) DeletePost(c echo.Context) error {
 	// Get DID from JWT token
@@ -500,7 +805,11 @@ func (h *PostHandler) DeletePost(c echo.Context) error {
 			}
 
 			deleteActivity := federation.BuildDeleteActivity(actorURI, objectURI)
-			go federation.DeliverToFollowers(deleteActivity, did)
+			if meta != nil && !meta.IsRemote {
+				go deliverToAudience(deleteActivity, meta.Visibility, did, actorURI)
+			} else {
+				go federation.DeliverToFollowers(deleteActivity, did)
+			}
 		}
 	}
 
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"splitter/internal/federation"
+	"splitter/internal/models"
+	"splitter/internal/repository"
+	"splitter/internal/security"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UploadPrekeys stores a signed prekey and/or a batch of one-time prekeys of one of the
+// user's approved devices, and reports whether the device is running low.
+// Endpoint: POST /api/v1/auth/devices/:deviceId/prekeys (authenticated)
+func (h *AuthHandler) UploadPrekeys(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+	}
+
+	deviceID := strings.TrimSpace(c.Param("deviceId"))
+	if deviceID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "deviceId is required"})
+	}
+
+	var req models.PrekeyUpload
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if err := req.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	status, err := h.prekeyRepo.UploadPrekeys(c.Request().Context(), userID, deviceID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDeviceNotApproved):
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		case errors.Is(err, repository.ErrTooManyPrekeys):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			log.Printf("UploadPrekeys error for user %s: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store prekeys"})
+		}
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetPrekeyStatus returns how many one-time prekeys a device has left and whether it
+// should upload more or rotate its signed prekey.
+// Endpoint: GET /api/v1/auth/devices/:deviceId/prekeys (authenticated)
+func (h *AuthHandler) GetPrekeyStatus(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+	}
+
+	status, err := h.prekeyRepo.GetPrekeyStatus(c.Request().Context(), userID, strings.TrimSpace(c.Param("deviceId")))
+	if errors.Is(err, repository.ErrDeviceNotApproved) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("GetPrekeyStatus error for user %s: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get prekey status"})
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// ClaimPrekeyBundles returns a prekey bundle for each device of a DID, handing the
+// requesting device one one-time prekey of each. Bundles of remote users are claimed
+// from their server.
+// Endpoint: POST /api/v1/dids/:did/prekeys/claim (authenticated)
+func (h *AuthHandler) ClaimPrekeyBundles(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+	}
+
+	did := strings.TrimSpace(c.Param("did"))
+	if did == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "DID is required"})
+	}
+
+	var req struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "device_id is required"})
+	}
+
+	ctx := c.Request().Context()
+	claimantDID, err := h.prekeyRepo.GetApprovedDeviceDID(ctx, userID, req.DeviceID)
+	if errors.Is(err, repository.ErrDeviceNotApproved) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("ClaimPrekeyBundles error for user %s: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to claim prekeys"})
+	}
+
+	target, err := h.userRepo.GetByDID(ctx, did)
+	if err != nil || target == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	var bundles []*models.PrekeyBundle
+	if h.isRemoteUser(target) {
+		if !h.cfg.Federation.Enabled {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+		caller, err := h.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to claim prekeys"})
+		}
+		actor, err := federation.ResolveRemoteUser(target.Username + "@" + target.InstanceDomain)
+		if err != nil {
+			log.Printf("ClaimPrekeyBundles: failed to resolve %s: %v", did, err)
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to reach the user's server"})
+		}
+		callerActorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, caller.Username)
+		bundles, err = federation.ClaimRemotePrekeyBundles(ctx, actor.ActorURI, callerActorURI, req.DeviceID)
+		if errors.Is(err, federation.ErrPrekeysUnsupported) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		if err != nil {
+			log.Printf("ClaimPrekeyBundles: remote claim for %s failed: %v", did, err)
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to claim prekeys from the user's server"})
+		}
+		for _, bundle := range bundles {
+			bundle.DID = target.DID
+		}
+	} else {
+		bundles, err = h.prekeyRepo.ClaimPrekeyBundles(ctx, did, models.GroupEnvelopeKeyID(claimantDID, req.DeviceID))
+		if err != nil {
+			log.Printf("ClaimPrekeyBundles error for DID %s: %v", did, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to claim prekeys"})
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"did":     did,
+		"bundles": bundles,
+		"count":   len(bundles),
+	})
+}
+
+// isRemoteUser reports whether user lives on another server
+func (h *AuthHandler) isRemoteUser(user *models.User) bool {
+	return !user.IsLocalTo(h.cfg.Federation.Domain)
+}
+
+// GetActorPrekeys publishes the prekey bundles of a local user's devices to other
+// servers, without one-time prekeys
+// GET /ap/users/:username/prekeys
+func (h *ActorHandler) GetActorPrekeys(c echo.Context) error {
+	user, err := h.userRepo.GetLocalByUsername(c.Request().Context(), c.Param("username"), h.cfg.Federation.Domain)
+	if err != nil || user == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	bundles, err := h.prekeyRepo.ListPrekeyBundles(c.Request().Context(), user.DID)
+	if err != nil {
+		log.Printf("GetActorPrekeys error for %s: %v", user.Username, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load prekeys"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":      fmt.Sprintf("%s/ap/users/%s/prekeys", h.cfg.Federation.URL, user.Username),
+		"actor":   fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username),
+		"bundles": bundles,
+	})
+}
+
+// ClaimActorPrekeys hands a device on another server one-time prekeys of a local user's
+// devices. The request must be signed; the signing actor and the device named in the
+// body together identify the requester, and claims are rate limited per actor and server.
+// POST /ap/users/:username/prekeys
+func (h *ActorHandler) ClaimActorPrekeys(c echo.Context) error {
+	ctx := c.Request().Context()
+	signer, err := federation.VerifyFetchRequest(ctx, c.Request())
+	if err != nil {
+		log.Printf("[Prekeys] Rejected claim for %s: %v", c.Param("username"), err)
+		if errors.Is(err, federation.ErrFetchDomainBlocked) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "domain blocked"})
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "signed request required"})
+	}
+
+	var req struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	user, err := h.userRepo.GetLocalByUsername(ctx, c.Param("username"), h.cfg.Federation.Domain)
+	if err != nil || user == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	// Device IDs are the claimant's to choose, so claims are capped per actor and server
+	deviceID := strings.TrimSpace(req.DeviceID)
+	if allowed, reason := security.GetMessagingGuard().AllowPrekeyClaim(signer, extractDomainFromURI(signer), deviceID, user.DID); !allowed {
+		log.Printf("[Prekeys] Throttled claim for %s by %s: %s", user.Username, signer, reason)
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": reason})
+	}
+
+	claimant := models.GroupEnvelopeKeyID(signer, deviceID)
+	bundles, err := h.prekeyRepo.ClaimPrekeyBundles(ctx, user.DID, claimant)
+	if err != nil {
+		log.Printf("ClaimActorPrekeys error for %s: %v", user.Username, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to claim prekeys"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"actor":   fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username),
+		"bundles": bundles,
+	})
+}
@@ -69,7 +69,7 @@ func (h *ReplyHandler) CreateReply(c echo.Context) error {
 		// New depth = Parent.Depth + 1
 		depth = parent.Depth + 1
 
-		if depth > 3 {
+		if depth > models.MaxReplyDepth {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Maximum reply depth exceeded"})
 		}
 
@@ -93,32 +93,30 @@ func (h *ReplyHandler) CreateReply(c echo.Context) error {
 	// Federation Hook: Deliver reply to remote instances
 	if h.cfg.Federation.Enabled {
 		go func() {
-			user, err := h.userRepo.GetByDID(context.Background(), authorDID)
+			ctx := context.Background()
+			user, err := h.userRepo.GetByDID(ctx, authorDID)
 			if err != nil {
 				log.Printf("[Federation] Failed to fetch user %s for reply delivery: %v", authorDID, err)
 				return
 			}
 			actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
-
-			// Determine the correct inReplyTo URI
-			// For remote posts, use the original_post_uri; for local posts, build a local URL
-			parentPost, pErr := h.PostRepo.GetByID(context.Background(), req.PostID)
-			var inReplyTo string
-			if pErr == nil && parentPost.IsRemote && parentPost.OriginalPostURI != "" {
-				inReplyTo = parentPost.OriginalPostURI
-			} else {
-				inReplyTo = fmt.Sprintf("%s/posts/%s", strings.TrimRight(h.cfg.Federation.URL, "/"), req.PostID)
+			if err := federation.RecordMentionLinks(ctx, reply.ID, reply.Content); err != nil {
+				log.Printf("[Federation] Failed to record mention links of reply %s: %v", reply.ID, err)
 			}
 
-			activity := federation.BuildCreateNoteActivity(actorURI, reply.ID, reply.Content, reply.CreatedAt, "", inReplyTo)
+			// Nested replies answer their parent reply; remote objects keep their original URIs
+			inReplyTo := inReplyToURI(ctx, h.PostRepo, h.Repo, h.cfg.Federation.URL, req.PostID, req.ParentID)
+
+			activity := federation.BuildCreateReplyActivity(actorURI, reply.ID, reply.Content, reply.CreatedAt, inReplyTo)
 			federation.DeliverToFollowers(activity, authorDID)
+			federation.DeliverToMentioned(activity)
 
-			// If replying to a remote post, also deliver directly to the remote author
-			if pErr == nil && parentPost.IsRemote && parentPost.AuthorDID != "" {
-				if dErr := federation.DeliverToActor(activity, parentPost.AuthorDID); dErr != nil {
-					log.Printf("[Federation] Failed to deliver reply to remote author %s: %v", parentPost.AuthorDID, dErr)
+			// Remote authors up the thread (root post and parent reply) get the reply directly
+			for _, remoteAuthor := range remoteThreadAuthors(ctx, h.PostRepo, h.Repo, req.PostID, req.ParentID) {
+				if dErr := federation.DeliverToActor(activity, remoteAuthor); dErr != nil {
+					log.Printf("[Federation] Failed to deliver reply to remote author %s: %v", remoteAuthor, dErr)
 				} else {
-					log.Printf("[Federation] Reply %s delivered to remote author %s", reply.ID, parentPost.AuthorDID)
+					log.Printf("[Federation] Reply %s delivered to remote author %s", reply.ID, remoteAuthor)
 				}
 			}
 
@@ -149,3 +147,37 @@ func (h *ReplyHandler) GetReplies(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, replies)
 }
+
+// inReplyToURI returns the Note URI a reply answers: its parent reply, or the post
+// for top-level replies. Remote posts and replies keep the URI they federated with.
+func inReplyToURI(ctx context.Context, postRepo *repository.PostRepository, replyRepo *repository.ReplyRepository, baseURL, postID string, parentID *string) string {
+	if parentID != nil {
+		if parent, err := replyRepo.GetByID(ctx, *parentID); err == nil {
+			if parent.OriginalURI != "" {
+				return parent.OriginalURI
+			}
+			return federation.ReplyNoteURI(parent.ID)
+		}
+	}
+
+	if post, err := postRepo.GetByID(ctx, postID); err == nil && post.IsRemote && post.OriginalPostURI != "" {
+		return post.OriginalPostURI
+	}
+	return fmt.Sprintf("%s/posts/%s", strings.TrimRight(baseURL, "/"), postID)
+}
+
+// remoteThreadAuthors returns the remote authors of a reply's root post and parent reply
+func remoteThreadAuthors(ctx context.Context, postRepo *repository.PostRepository, replyRepo *repository.ReplyRepository, postID string, parentID *string) []string {
+	var authors []string
+	if post, err := postRepo.GetByID(ctx, postID); err == nil && post.IsRemote && post.AuthorDID != "" {
+		authors = append(authors, post.AuthorDID)
+	}
+	if parentID != nil {
+		if parent, err := replyRepo.GetByID(ctx, *parentID); err == nil && parent.OriginalURI != "" {
+			if len(authors) == 0 || authors[0] != parent.AuthorDID {
+				authors = append(authors, parent.AuthorDID)
+			}
+		}
+	}
+	return authors
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"splitter/internal/realtime"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// streamHeartbeat keeps idle connections open through proxies
+const streamHeartbeat = 25 * time.Second
+
+// StreamHandler pushes realtime events to connected clients
+type StreamHandler struct {
+	hub            *realtime.Hub
+	allowedOrigins map[string]bool
+}
+
+// NewStreamHandler creates a new StreamHandler. Browsers may only open WebSocket streams
+// from allowedOrigins, the frontend origins also allowed by CORS.
+func NewStreamHandler(hub *realtime.Hub, allowedOrigins []string) *StreamHandler {
+	origins := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins[strings.TrimRight(origin, "/")] = true
+	}
+	return &StreamHandler{hub: hub, allowedOrigins: origins}
+}
+
+// Stream pushes the current user's events over a WebSocket, or as server-sent events
+// when the request is not a WebSocket upgrade. A reconnecting client passes the id of
+// the last event it handled as ?resume= (or Last-Event-ID) to receive what it missed;
+// when that is no longer possible it gets a resync event first.
+// GET /api/v1/stream
+func (h *StreamHandler) Stream(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	resumeToken := c.QueryParam("resume")
+	if resumeToken == "" {
+		resumeToken = c.Request().Header.Get("Last-Event-ID")
+	}
+
+	sub, replay, resumed := h.hub.Subscribe(userID, resumeToken)
+	defer h.hub.Unsubscribe(sub)
+
+	if !resumed {
+		replay = append([]realtime.Event{{Type: realtime.EventResync, CreatedAt: time.Now().UTC()}}, replay...)
+	}
+
+	if strings.EqualFold(c.Request().Header.Get("Upgrade"), "websocket") {
+		return h.streamWebSocket(c, sub, replay)
+	}
+	return h.streamSSE(c, sub, replay)
+}
+
+func (h *StreamHandler) streamWebSocket(c echo.Context, sub *realtime.Subscription, replay []realtime.Event) error {
+	server := websocket.Server{
+		// Browsers always send an Origin; other clients authenticate by token alone
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			if origin := req.Header.Get("Origin"); origin != "" && !h.allowedOrigins[origin] && !h.allowedOrigins["*"] {
+				return fmt.Errorf("origin %s not allowed", origin)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// The client does not send anything; reading only notices when it goes away
+			gone := make(chan struct{})
+			go func() {
+				defer close(gone)
+				var discard []byte
+				for {
+					if err := websocket.Message.Receive(ws, &discard); err != nil {
+						return
+					}
+				}
+			}()
+
+			for _, event := range replay {
+				if websocket.JSON.Send(ws, event) != nil {
+					return
+				}
+			}
+
+			heartbeat := time.NewTicker(streamHeartbeat)
+			defer heartbeat.Stop()
+			for {
+				select {
+				case event, ok := <-sub.Events:
+					if !ok || websocket.JSON.Send(ws, event) != nil {
+						return
+					}
+				case <-heartbeat.C:
+					ping := realtime.Event{Type: realtime.EventPing, CreatedAt: time.Now().UTC()}
+					if websocket.JSON.Send(ws, ping) != nil {
+						return
+					}
+				case <-gone:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+func (h *StreamHandler) streamSSE(c echo.Context, sub *realtime.Subscription, replay []realtime.Event) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	for _, event := range replay {
+		if err := writeSSEEvent(res, event); err != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok || writeSSEEvent(res, event) != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeSSEEvent writes one event in the text/event-stream format
+func writeSSEEvent(res *echo.Response, event realtime.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(res, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
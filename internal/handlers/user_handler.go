@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -164,15 +165,17 @@ func (h *UserHandler) UpdateProfile(c echo.Context) error {
 
 	if h.cfg != nil && h.cfg.Federation.Enabled {
 		actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+		signingKeyPEM, _ := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
 		activity := federation.BuildUpdateActorActivity(
 			actorURI,
 			user.Username,
 			updatedUser.DisplayName,
 			updatedUser.Bio,
 			updatedUser.AvatarURL,
-			updatedUser.PublicKey,
+			signingKeyPEM,
 			updatedUser.EncryptionPublicKey,
 		)
+		federation.SetActorAliases(activity, user.AlsoKnownAs, user.MovedTo)
 		go federation.DeliverToFollowers(activity, user.DID)
 	}
 
@@ -216,15 +219,17 @@ func (h *UserHandler) UploadAvatar(c echo.Context) error {
 
 	if h.cfg != nil && h.cfg.Federation.Enabled {
 		actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+		signingKeyPEM, _ := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
 		activity := federation.BuildUpdateActorActivity(
 			actorURI,
 			user.Username,
 			updatedUser.DisplayName,
 			updatedUser.Bio,
 			updatedUser.AvatarURL,
-			updatedUser.PublicKey,
+			signingKeyPEM,
 			updatedUser.EncryptionPublicKey,
 		)
+		federation.SetActorAliases(activity, user.AlsoKnownAs, user.MovedTo)
 		go federation.DeliverToFollowers(activity, user.DID)
 	}
 
@@ -342,13 +347,14 @@ func (h *UserHandler) UpdateEncryptionKey(c echo.Context) error {
 	if h.cfg != nil && h.cfg.Federation.Enabled {
 		if user, fetchErr := h.userRepo.GetByID(c.Request().Context(), userID); fetchErr == nil && user != nil {
 			actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+			signingKeyPEM, _ := federation.GetActorPublicKeyPEM(c.Request().Context(), user.ID)
 			activity := federation.BuildUpdateActorActivity(
 				actorURI,
 				user.Username,
 				user.DisplayName,
 				user.Bio,
 				user.AvatarURL,
-				user.PublicKey,
+				signingKeyPEM,
 				req.EncryptionPublicKey,
 			)
 			go federation.DeliverToFollowers(activity, user.DID)
@@ -479,3 +485,178 @@ func (h *UserHandler) IsInCircle(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, map[string]bool{"in_circle": inCircle})
 }
+
+// maxAccountAliases bounds the alsoKnownAs list of a user
+const maxAccountAliases = 10
+
+// resolveAccountAlias resolves a handle (@user@domain) or actor URI of an account on another server
+func resolveAccountAlias(account string) (*federation.RemoteActor, error) {
+	account = strings.TrimPrefix(strings.TrimSpace(account), "@")
+	if account == "" {
+		return nil, fmt.Errorf("empty account")
+	}
+	if strings.HasPrefix(account, "http://") || strings.HasPrefix(account, "https://") {
+		if federation.IsLocalURI(account) {
+			return nil, fmt.Errorf("%s is an account on this server", account)
+		}
+		return resolveActorFromURI(account)
+	}
+	if !strings.Contains(account, "@") {
+		return nil, fmt.Errorf("%s is not a handle on another server", account)
+	}
+	actor, err := federation.ResolveRemoteUser(account)
+	if err != nil {
+		return nil, err
+	}
+	if federation.IsLocalURI(actor.ActorURI) {
+		return nil, fmt.Errorf("%s is an account on this server", account)
+	}
+	return actor, nil
+}
+
+// UpdateAliases replaces the accounts the current user claims as their own (alsoKnownAs).
+// A new account must list the old one here before the old one can move to it, and vice versa.
+// PUT /api/v1/users/me/aliases
+func (h *UserHandler) UpdateAliases(c echo.Context) error {
+	did := c.Get("did").(string)
+	ctx := c.Request().Context()
+
+	user, err := h.userRepo.GetByDID(ctx, did)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+
+	var req struct {
+		Aliases []string `json:"aliases"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	if len(req.Aliases) > maxAccountAliases {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("At most %d aliases are allowed", maxAccountAliases),
+		})
+	}
+
+	aliases := []string{}
+	for _, account := range req.Aliases {
+		actor, err := resolveAccountAlias(account)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("Could not resolve alias %s: %v", account, err),
+			})
+		}
+		if !containsString(aliases, actor.ActorURI) {
+			aliases = append(aliases, actor.ActorURI)
+		}
+	}
+
+	if err := h.userRepo.SetAliases(ctx, user.ID, aliases); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to update aliases",
+		})
+	}
+	user.AlsoKnownAs = aliases
+
+	if h.cfg != nil && h.cfg.Federation.Enabled {
+		actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+		signingKeyPEM, _ := federation.GetActorPublicKeyPEM(ctx, user.ID)
+		activity := federation.BuildUpdateActorActivity(
+			actorURI,
+			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.AvatarURL,
+			signingKeyPEM,
+			user.EncryptionPublicKey,
+		)
+		federation.SetActorAliases(activity, user.AlsoKnownAs, user.MovedTo)
+		go federation.DeliverToFollowers(activity, user.DID)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"also_known_as": aliases,
+	})
+}
+
+// MoveAccount moves the current user to an account on another server. The target must
+// already list this account in its alsoKnownAs. Remote followers receive a Move, local
+// followers are re-pointed here, and this account is left as a tombstone pointing at the target.
+// POST /api/v1/users/me/move
+func (h *UserHandler) MoveAccount(c echo.Context) error {
+	did := c.Get("did").(string)
+	ctx := c.Request().Context()
+
+	if h.cfg == nil || !h.cfg.Federation.Enabled {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Federation is disabled on this server",
+		})
+	}
+
+	user, err := h.userRepo.GetByDID(ctx, did)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "User not found",
+		})
+	}
+	if user.MovedTo != "" {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Account has already moved to " + user.MovedTo,
+		})
+	}
+
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	target, err := resolveAccountAlias(req.Target)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Could not resolve move target: %v", err),
+		})
+	}
+
+	actorURI := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, user.Username)
+	aliases, err := federation.FetchActorAliases(target.ActorURI)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "Could not fetch the target account",
+		})
+	}
+	if !containsString(aliases, actorURI) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": fmt.Sprintf("%s must list %s in its aliases first", target.ActorURI, actorURI),
+		})
+	}
+
+	if err := h.userRepo.MarkMoved(ctx, user.DID, target.ActorURI); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Failed to move account",
+		})
+	}
+	if _, err := federation.EnsureRemoteUser(ctx, target.ActorURI); err != nil {
+		log.Printf("[Federation] Failed to ensure move target user: %v", err)
+	}
+
+	// Remote followers' servers verify the target and follow it themselves
+	go federation.DeliverToFollowers(federation.BuildMoveActivity(actorURI, target.ActorURI), user.DID)
+
+	repointed, err := repointLocalFollowers(ctx, h.cfg, []string{user.DID}, target.ActorURI, target)
+	if err != nil {
+		log.Printf("[Federation] Failed to re-point local followers of %s: %v", user.Username, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"moved_to":              target.ActorURI,
+		"local_followers_moved": repointed,
+	})
+}
@@ -77,17 +77,25 @@ func (h *WebFingerHandler) Handle(c echo.Context) error {
 		})
 	}
 
+	// acct:domain@domain names the instance actor, which peers resolve to check
+	// deliveries signed on behalf of our users
+	if username == domain {
+		return h.respond(c, resource, h.cfg.Federation.URL+"/ap/actor")
+	}
+
 	// Look up user
-	user, _, err := h.userRepo.GetByUsername(c.Request().Context(), username)
+	user, err := h.userRepo.GetLocalByUsername(c.Request().Context(), username, h.cfg.Federation.Domain)
 	if err != nil || user == nil {
 		return c.JSON(http.StatusNotFound, map[string]string{
 			"error": "user not found",
 		})
 	}
 
-	// Build response
-	actorURL := fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, username)
+	return h.respond(c, resource, fmt.Sprintf("%s/ap/users/%s", h.cfg.Federation.URL, username))
+}
 
+// respond writes the JRD for resource pointing at actorURL
+func (h *WebFingerHandler) respond(c echo.Context, resource, actorURL string) error {
 	response := WebFingerResponse{
 		Subject: resource,
 		Links: []WebFingerLink{
@@ -128,3 +128,35 @@ func OptionalAuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// StreamAuthMiddleware is AuthMiddleware for streaming endpoints. Browsers cannot set
+// headers on WebSocket and EventSource requests, so the token may also be passed as the
+// access_token query parameter.
+func StreamAuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
+	auth := AuthMiddleware(jwtSecret)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		authenticated := auth(next)
+		return func(c echo.Context) error {
+			if token := c.QueryParam("access_token"); token != "" && c.Request().Header.Get("Authorization") == "" {
+				c.Request().Header.Set("Authorization", "Bearer "+token)
+			}
+			return authenticated(c)
+		}
+	}
+}
+
+// RedactAccessToken masks the access_token query parameter of a request URI, so that
+// tokens passed to the streaming endpoints do not end up in access logs.
+func RedactAccessToken(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if name, _, _ := strings.Cut(param, "="); name == "access_token" {
+			params[i] = "access_token=REDACTED"
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
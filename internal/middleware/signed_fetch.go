@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"splitter/internal/federation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireSignedFetch rejects unsigned ActivityPub GETs while federation secure mode is on.
+// The verified signer's actor URI is stored in the context as "signed_fetch_actor".
+func RequireSignedFetch() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !federation.IsSecureMode() {
+				return next(c)
+			}
+
+			signer, err := federation.VerifyFetchRequest(c.Request().Context(), c.Request())
+			if err != nil {
+				log.Printf("[SecureMode] Rejected %s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+				if errors.Is(err, federation.ErrFetchDomainBlocked) {
+					return c.JSON(http.StatusForbidden, map[string]string{
+						"error": "domain blocked",
+					})
+				}
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "signed request required",
+				})
+			}
+
+			c.Set("signed_fetch_actor", signer)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	PollMinOptions            = 2
+	PollMaxOptions            = 4
+	PollMaxOptionLength       = 50
+	PollMinExpiresInMinutes   = 5
+	PollMaxExpiresInMinutes   = 10080
+	PollDefaultExpiresMinutes = 1440
+)
+
+// Poll is a single or multiple choice poll attached to a post
+type Poll struct {
+	ID          string       `json:"id"`
+	PostID      string       `json:"post_id"`
+	Multiple    bool         `json:"multiple"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"` // Remote polls may not have an expiry
+	Expired     bool         `json:"expired"`
+	ClosedAt    *time.Time   `json:"closed_at,omitempty"` // Set once the final results are counted
+	VotersCount int          `json:"voters_count"`
+	Options     []PollOption `json:"options"`
+	Voted       bool         `json:"voted"`               // Whether the current user has voted
+	OwnVotes    []int        `json:"own_votes,omitempty"` // Option indexes the current user voted for
+}
+
+// PollOption is one choice of a poll with its vote count
+type PollOption struct {
+	Title      string `json:"title"`
+	VotesCount int    `json:"votes_count"`
+}
+
+// PollCreate represents the poll attached to a new post
+type PollCreate struct {
+	Options          []string `json:"options"`
+	Multiple         bool     `json:"multiple,omitempty"`
+	ExpiresInMinutes int      `json:"expires_in_minutes,omitempty"` // defaults to one day
+}
+
+// Validate checks the options and expiry of a new poll, trimming the option titles
+func (p *PollCreate) Validate() error {
+	if len(p.Options) < PollMinOptions || len(p.Options) > PollMaxOptions {
+		return fmt.Errorf("a poll needs between %d and %d options", PollMinOptions, PollMaxOptions)
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return fmt.Errorf("poll options cannot be empty")
+		}
+		if len([]rune(option)) > PollMaxOptionLength {
+			return fmt.Errorf("poll option too long (max %d characters)", PollMaxOptionLength)
+		}
+		if seen[option] {
+			return fmt.Errorf("poll options must be unique")
+		}
+		seen[option] = true
+		p.Options[i] = option
+	}
+	if p.ExpiresInMinutes == 0 {
+		p.ExpiresInMinutes = PollDefaultExpiresMinutes
+	}
+	if p.ExpiresInMinutes < PollMinExpiresInMinutes || p.ExpiresInMinutes > PollMaxExpiresInMinutes {
+		return fmt.Errorf("poll expires_in_minutes must be between %d and %d", PollMinExpiresInMinutes, PollMaxExpiresInMinutes)
+	}
+	return nil
+}
+
+// PollVote represents the options chosen by a voter
+type PollVote struct {
+	Choices []int `json:"choices"`
+}
@@ -12,6 +12,9 @@ type Post struct {
 	Username         string             `json:"username,omitempty"`
 	AvatarURL        string             `json:"avatar_url,omitempty"`
 	Content          string             `json:"content"`
+	ContentWarning   string             `json:"content_warning,omitempty"` // Shown in place of the content until expanded
+	Sensitive        bool               `json:"sensitive"`                 // Media is hidden behind a warning
+	ContentHTML      string             `json:"content_html,omitempty"`    // Sanitized HTML of remote posts; Content holds its plain text
 	Visibility       string             `json:"visibility,omitempty"`
 	IsRemote         bool               `json:"is_remote"`
 	OriginalPostURI  string             `json:"original_post_uri,omitempty"`
@@ -24,6 +27,7 @@ type Post struct {
 	DirectReplyCount int                `json:"direct_reply_count"`
 	TotalReplyCount  int                `json:"total_reply_count"`
 	Media            []Media            `json:"media,omitempty"` // Attached media
+	Poll             *Poll              `json:"poll,omitempty"`
 	CreatedAt        time.Time          `json:"created_at"`
 	UpdatedAt        *time.Time         `json:"updated_at,omitempty"`
 	ExpiresAt        *time.Time         `json:"expires_at,omitempty"`
@@ -38,6 +42,19 @@ type Media struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// PostRevision is a version of a post before it was edited. The revision list of a
+// post ends with its current version, which has no ID and is marked Current.
+type PostRevision struct {
+	ID             string    `json:"id,omitempty"`
+	PostID         string    `json:"post_id"`
+	Content        string    `json:"content"`
+	ContentHTML    string    `json:"content_html,omitempty"`
+	ContentWarning string    `json:"content_warning,omitempty"`
+	Sensitive      bool      `json:"sensitive"`
+	CreatedAt      time.Time `json:"created_at"` // When this version was written
+	Current        bool      `json:"current,omitempty"`
+}
+
 type ParentPostSummary struct {
 	ID              string    `json:"id"`
 	AuthorDID       string    `json:"author_did"`
@@ -59,9 +76,22 @@ type ParentContextInfo struct {
 
 // PostCreate represents the data needed to create a new post
 type PostCreate struct {
-	Content          string `json:"content" validate:"required,max=500"`
-	Visibility       string `json:"visibility,omitempty"`         // defaults to "public"
-	ExpiresInMinutes *int   `json:"expires_in_minutes,omitempty"` // optional ephemeral TTL
+	Content          string      `json:"content" validate:"required,max=500"`
+	ContentWarning   string      `json:"content_warning,omitempty" validate:"max=200"` // optional CW / summary
+	Sensitive        bool        `json:"sensitive,omitempty"`                          // hide media behind a warning
+	Visibility       string      `json:"visibility,omitempty"`                         // defaults to "public"
+	ExpiresInMinutes *int        `json:"expires_in_minutes,omitempty"`                 // optional ephemeral TTL
+	Poll             *PollCreate `json:"poll,omitempty"`                               // optional poll
+}
+
+// IsValidVisibility reports whether visibility is one a post can have (the posts.visibility
+// CHECK constraint): public, followers (followers only) or circle (the author's close friends)
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case "public", "followers", "circle":
+		return true
+	}
+	return false
 }
 
 // Validate checks if the PostCreate struct is valid
@@ -72,7 +102,10 @@ func (p *PostCreate) Validate(hasMedia bool) error {
 	if p.Content == "" && !hasMedia {
 		return fmt.Errorf("either content or media is required")
 	}
-	if p.Visibility != "" && p.Visibility != "public" && p.Visibility != "followers" && p.Visibility != "private" {
+	if len(p.ContentWarning) > 200 {
+		return fmt.Errorf("content warning too long (max 200 characters)")
+	}
+	if p.Visibility != "" && !IsValidVisibility(p.Visibility) {
 		return fmt.Errorf("invalid visibility setting")
 	}
 	if p.ExpiresInMinutes != nil {
@@ -83,6 +116,17 @@ func (p *PostCreate) Validate(hasMedia bool) error {
 			return fmt.Errorf("expires_in_minutes cannot exceed 10080 (7 days)")
 		}
 	}
+	if p.Poll != nil {
+		if hasMedia {
+			return fmt.Errorf("a post cannot have both media and a poll")
+		}
+		if p.Content == "" {
+			return fmt.Errorf("a poll needs a question")
+		}
+		if err := p.Poll.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
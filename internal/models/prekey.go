@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// PrekeyUploadMaxBatch is the most one-time prekeys accepted in one upload
+	PrekeyUploadMaxBatch = 100
+	// PrekeyMaxAvailable is the most unclaimed one-time prekeys a device may hold
+	PrekeyMaxAvailable = 500
+	// PrekeyLowThreshold is the count of unclaimed one-time prekeys below which the
+	// device is told to upload more
+	PrekeyLowThreshold = 10
+	// PrekeyMaxLength bounds an encoded public key or signature
+	PrekeyMaxLength = 1024
+	// SignedPrekeyMaxAge is how long a signed prekey is used before clients should rotate it
+	SignedPrekeyMaxAge = 30 * 24 * time.Hour
+	// PrekeyClaimReuseWindow is how long a requester claiming again gets the one-time
+	// prekey it was already handed, so retries do not drain the device's keys
+	PrekeyClaimReuseWindow = 10 * time.Minute
+)
+
+// SignedPrekey is a medium-term prekey of a device, signed with its identity key
+type SignedPrekey struct {
+	KeyID     int        `json:"key_id"`
+	PublicKey string     `json:"public_key"`
+	Signature string     `json:"signature"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// OneTimePrekey is a prekey handed out to a single session initiator
+type OneTimePrekey struct {
+	KeyID     int    `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// PrekeyUpload represents prekeys uploaded by a device. Either part may be omitted.
+type PrekeyUpload struct {
+	SignedPrekey   *SignedPrekey   `json:"signed_prekey,omitempty"`
+	OneTimePrekeys []OneTimePrekey `json:"one_time_prekeys,omitempty"`
+}
+
+// Validate checks an upload, trimming the encoded keys
+func (u *PrekeyUpload) Validate() error {
+	if u.SignedPrekey == nil && len(u.OneTimePrekeys) == 0 {
+		return fmt.Errorf("signed_prekey or one_time_prekeys is required")
+	}
+	if len(u.OneTimePrekeys) > PrekeyUploadMaxBatch {
+		return fmt.Errorf("too many one-time prekeys (max %d per upload)", PrekeyUploadMaxBatch)
+	}
+
+	if spk := u.SignedPrekey; spk != nil {
+		spk.PublicKey = strings.TrimSpace(spk.PublicKey)
+		spk.Signature = strings.TrimSpace(spk.Signature)
+		spk.CreatedAt = nil
+		if spk.KeyID < 0 {
+			return fmt.Errorf("signed prekey key_id must not be negative")
+		}
+		if spk.PublicKey == "" || spk.Signature == "" {
+			return fmt.Errorf("signed prekey needs public_key and signature")
+		}
+		if len(spk.PublicKey) > PrekeyMaxLength || len(spk.Signature) > PrekeyMaxLength {
+			return fmt.Errorf("signed prekey too long (max %d characters)", PrekeyMaxLength)
+		}
+	}
+
+	seen := make(map[int]bool, len(u.OneTimePrekeys))
+	for i := range u.OneTimePrekeys {
+		otk := &u.OneTimePrekeys[i]
+		otk.PublicKey = strings.TrimSpace(otk.PublicKey)
+		if otk.KeyID < 0 {
+			return fmt.Errorf("one-time prekey key_id must not be negative")
+		}
+		if otk.PublicKey == "" {
+			return fmt.Errorf("one-time prekey %d has no public_key", otk.KeyID)
+		}
+		if len(otk.PublicKey) > PrekeyMaxLength {
+			return fmt.Errorf("one-time prekey too long (max %d characters)", PrekeyMaxLength)
+		}
+		if seen[otk.KeyID] {
+			return fmt.Errorf("one-time prekey key_id %d is repeated", otk.KeyID)
+		}
+		seen[otk.KeyID] = true
+	}
+	return nil
+}
+
+// PrekeyStatus tells a device whether it should upload more prekeys
+type PrekeyStatus struct {
+	DeviceID                string     `json:"device_id"`
+	OneTimePrekeysAvailable int        `json:"one_time_prekeys_available"`
+	SignedPrekeyCreatedAt   *time.Time `json:"signed_prekey_created_at,omitempty"`
+	// LowPrekeys is set when fewer than PrekeyLowThreshold one-time prekeys are left
+	LowPrekeys bool `json:"low_prekeys"`
+	// SignedPrekeyStale is set when there is no signed prekey or it is due for rotation
+	SignedPrekeyStale bool `json:"signed_prekey_stale"`
+}
+
+// NewPrekeyStatus builds the status of a device from its prekey counts
+func NewPrekeyStatus(deviceID string, available int, signedPrekeyCreatedAt *time.Time, now time.Time) *PrekeyStatus {
+	return &PrekeyStatus{
+		DeviceID:                deviceID,
+		OneTimePrekeysAvailable: available,
+		SignedPrekeyCreatedAt:   signedPrekeyCreatedAt,
+		LowPrekeys:              available < PrekeyLowThreshold,
+		SignedPrekeyStale:       signedPrekeyCreatedAt == nil || now.Sub(*signedPrekeyCreatedAt) > SignedPrekeyMaxAge,
+	}
+}
+
+// PrekeyBundle is what a sender needs to start a session with one device: the identity
+// key of the device, its current signed prekey and, when claimed, a one-time prekey.
+// Without a one-time prekey the session starts from the signed prekey alone.
+type PrekeyBundle struct {
+	DID           string         `json:"did"`
+	DeviceID      string         `json:"device_id"`
+	IdentityKey   string         `json:"identity_key"`
+	SignedPrekey  *SignedPrekey  `json:"signed_prekey"`
+	OneTimePrekey *OneTimePrekey `json:"one_time_prekey,omitempty"`
+}
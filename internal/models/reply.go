@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// MaxReplyDepth is the deepest nesting level of a reply (1 = reply to the post)
+const MaxReplyDepth = 3
+
 // Reply represents a threaded reply
 type Reply struct {
 	ID               string     `json:"id"`
@@ -13,6 +16,8 @@ type Reply struct {
 	AuthorDID        string     `json:"author_did"`
 	Username         string     `json:"username,omitempty"` // populated from join
 	Content          string     `json:"content"`
+	ContentHTML      string     `json:"content_html,omitempty"` // Sanitized HTML of remote replies
+	OriginalURI      string     `json:"original_uri,omitempty"` // Note ID of replies received from other servers
 	Depth            int        `json:"depth"`
 	LikesCount       int        `json:"likes_count"`
 	Liked            bool       `json:"liked"` // Whether current user has liked this reply
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,6 +17,7 @@ type User struct {
 	DID                   string     `json:"did"`             // Decentralized Identifier (did:key:...)
 	DisplayName           string     `json:"display_name"`
 	Bio                   string     `json:"bio,omitempty"`
+	BioHTML               string     `json:"bio_html,omitempty"` // Sanitized HTML bio of remote users
 	AvatarURL             string     `json:"avatar_url,omitempty"`
 	PublicKey             string     `json:"public_key"`            // Base64 encoded signing public key
 	EncryptionPublicKey   string     `json:"encryption_public_key"` // Base64 encoded encryption public key
@@ -24,16 +26,38 @@ type User struct {
 	ModerationRequestedAt *time.Time `json:"moderation_requested_at,omitempty"`
 	IsLocked              bool       `json:"is_locked"`
 	IsSuspended           bool       `json:"is_suspended"`
+	AlsoKnownAs           []string   `json:"also_known_as,omitempty"` // Actor URIs of the user's other accounts
+	MovedTo               string     `json:"moved_to,omitempty"`      // Actor URI the account moved to
+	MovedAt               *time.Time `json:"moved_at,omitempty"`
 	CreatedAt             time.Time  `json:"created_at"`
 	UpdatedAt             time.Time  `json:"updated_at"`
 }
 
-// Message represents a direct message between two users
+// LocalInstanceDomains lists the instance_domain values of accounts of the instance serving
+// localDomain: the domain itself, and "localhost" or empty for accounts created before it
+// was configured. Cached remote users carry their own server's domain.
+func LocalInstanceDomains(localDomain string) []string {
+	return []string{localDomain, "localhost", ""}
+}
+
+// IsLocalTo reports whether the user is an account of the instance serving localDomain
+// rather than a cached remote user
+func (u *User) IsLocalTo(localDomain string) bool {
+	for _, domain := range LocalInstanceDomains(localDomain) {
+		if u.InstanceDomain == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// Message represents a direct message between two users, or a message to a group.
+// Group messages have no recipient.
 type Message struct {
 	ID              string     `json:"id"`
 	ThreadID        string     `json:"thread_id"`
 	SenderID        string     `json:"sender_id"`
-	RecipientID     string     `json:"recipient_id"`
+	RecipientID     string     `json:"recipient_id,omitempty"`
 	ClientMessageID string     `json:"client_message_id,omitempty"`
 	Content         string     `json:"content"`
 	Ciphertext      string     `json:"ciphertext,omitempty"` // Base64 encoded encrypted content
@@ -46,17 +70,257 @@ type Message struct {
 	EditedAt        *time.Time `json:"edited_at,omitempty"`  // Message edit timestamp
 }
 
-// MessageThread represents a conversation between two users
+// MessageThread represents a conversation between two users, or a group conversation.
+// Group threads have no participant_a_id / participant_b_id; their members are in Members.
 type MessageThread struct {
 	ID             string    `json:"id"`
 	ParticipantAID string    `json:"participant_a_id"`
 	ParticipantBID string    `json:"participant_b_id"`
+	IsGroup        bool      `json:"is_group"`
+	Title          string    `json:"title,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// Context URI of a group started on another server
+	FederationContext string `json:"-"`
 	// Populated fields
-	OtherUser   *User    `json:"other_user,omitempty"`
-	LastMessage *Message `json:"last_message,omitempty"`
-	UnreadCount int      `json:"unread_count"`
+	OtherUser   *User           `json:"other_user,omitempty"`
+	Members     []*ThreadMember `json:"members,omitempty"`
+	LastMessage *Message        `json:"last_message,omitempty"`
+	UnreadCount int             `json:"unread_count"`
+}
+
+// HasMember reports whether userID takes part in the thread
+func (t *MessageThread) HasMember(userID string) bool {
+	if !t.IsGroup {
+		return userID != "" && (t.ParticipantAID == userID || t.ParticipantBID == userID)
+	}
+	return t.Member(userID) != nil
+}
+
+// Member returns the group membership of userID, or nil
+func (t *MessageThread) Member(userID string) *ThreadMember {
+	for _, member := range t.Members {
+		if member.UserID == userID {
+			return member
+		}
+	}
+	return nil
+}
+
+// Thread member roles
+const (
+	ThreadRoleOwner  = "owner"
+	ThreadRoleMember = "member"
+)
+
+// Group thread limits
+const (
+	GroupMaxMembers  = 50 // including the owner
+	GroupTitleMaxLen = 100
+)
+
+// ThreadMember is a member of a group thread with their own read position
+type ThreadMember struct {
+	UserID      string     `json:"user_id"`
+	Role        string     `json:"role"`
+	JoinedAt    time.Time  `json:"joined_at"`
+	LastReadAt  *time.Time `json:"last_read_at,omitempty"`
+	UnreadCount int        `json:"unread_count"`
+	User        *User      `json:"user,omitempty"`
+}
+
+// ThreadDeviceKey is an encryption key a group message must carry an encrypted_keys entry for.
+// Members without approved devices are reached through their account key.
+type ThreadDeviceKey struct {
+	KeyID               string `json:"key_id"` // entry name in encrypted_keys
+	UserID              string `json:"user_id"`
+	DID                 string `json:"did"`
+	DeviceID            string `json:"device_id,omitempty"`
+	EncryptionPublicKey string `json:"encryption_public_key"`
+}
+
+// GroupEnvelopeKeyID names the encrypted_keys entry of a member device in a group message.
+// Device IDs are only unique per user, so group envelopes are keyed by DID and device;
+// an account key without a device is keyed by the DID alone.
+func GroupEnvelopeKeyID(did, deviceID string) string {
+	if deviceID == "" {
+		return did
+	}
+	return did + "#" + deviceID
+}
+
+// MissingEnvelopeKeys returns the IDs of keys that have no entry in encryptedKeys
+func MissingEnvelopeKeys(keys []*ThreadDeviceKey, encryptedKeys map[string]string) []string {
+	missing := []string{}
+	for _, key := range keys {
+		if strings.TrimSpace(encryptedKeys[key.KeyID]) == "" {
+			missing = append(missing, key.KeyID)
+		}
+	}
+	return missing
+}
+
+// DeviceEnvelope returns the encrypted_keys entry meant for a device of the user with the
+// given DID: the group envelope of the device, an entry under the bare device ID, or the
+// account key entry under the DID.
+func DeviceEnvelope(encryptedKeys map[string]string, did, deviceID string) string {
+	for _, keyID := range []string{GroupEnvelopeKeyID(did, deviceID), deviceID, did} {
+		if keyID == "" {
+			continue
+		}
+		if envelope := strings.TrimSpace(encryptedKeys[keyID]); envelope != "" {
+			return envelope
+		}
+	}
+	return ""
+}
+
+// Message sync page sizes
+const (
+	MessageSyncDefaultLimit = 100
+	MessageSyncMaxLimit     = 500
+)
+
+// MessageChange is a new, edited, deleted or read message as synced to one device.
+// Deleted messages are sent without their content.
+type MessageChange struct {
+	*Message
+	// DeviceKey is the encrypted_keys entry of the syncing device
+	DeviceKey string `json:"device_key,omitempty"`
+	// DeviceDeliveredAt is when the syncing device first received the message
+	DeviceDeliveredAt *time.Time `json:"device_delivered_at,omitempty"`
+	Position          SyncCursor `json:"-"`
+}
+
+// ReadStateChange is a new read position of a group member
+type ReadStateChange struct {
+	ThreadID   string     `json:"thread_id"`
+	UserID     string     `json:"user_id"`
+	LastReadAt *time.Time `json:"last_read_at,omitempty"`
+	Position   SyncCursor `json:"-"`
+}
+
+// MessageSyncPage is what changed for a device after its cursor. The device passes
+// Cursor back on its next sync, right away while HasMore is set.
+type MessageSyncPage struct {
+	Messages   []*MessageChange   `json:"messages"`
+	ReadStates []*ReadStateChange `json:"read_states"`
+	Cursor     string             `json:"cursor"`
+	HasMore    bool               `json:"has_more"`
+}
+
+// SyncCursor is the position of a change: the transaction that wrote it and the change
+// sequence it took. Sequence values are taken when a row is written, not when it
+// commits, so changes are ordered by writing transaction first and only handed out once
+// every transaction up to theirs has finished.
+type SyncCursor struct {
+	XID int64
+	Seq int64
+}
+
+// Before reports whether c sorts before other
+func (c SyncCursor) Before(other SyncCursor) bool {
+	return c.XID < other.XID || (c.XID == other.XID && c.Seq < other.Seq)
+}
+
+// String formats the cursor as returned to devices
+func (c SyncCursor) String() string {
+	return strconv.FormatInt(c.XID, 10) + "." + strconv.FormatInt(c.Seq, 10)
+}
+
+// ParseSyncCursor parses a sync cursor; an empty cursor starts from the beginning, and a
+// bare sequence from before cursors carried a transaction starts over as well
+func ParseSyncCursor(cursor string) (SyncCursor, error) {
+	if cursor == "" {
+		return SyncCursor{}, nil
+	}
+	xid, seq, found := strings.Cut(cursor, ".")
+	if !found {
+		xid, seq = "0", cursor
+	}
+	x, err := strconv.ParseInt(xid, 10, 64)
+	if err != nil || x < 0 {
+		return SyncCursor{}, fmt.Errorf("invalid sync cursor")
+	}
+	s, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || s < 0 {
+		return SyncCursor{}, fmt.Errorf("invalid sync cursor")
+	}
+	if !found {
+		return SyncCursor{}, nil
+	}
+	return SyncCursor{XID: x, Seq: s}, nil
+}
+
+// NewMessageSyncPage merges message and read state changes after cursor, each sorted by
+// position and fetched with up to limit+1 entries, into a page of at most limit changes.
+// It stops at the first change written by a transaction at or after xmin, the oldest
+// transaction still running when the changes were read: a transaction before it may yet
+// commit a change with a lower position, which the cursor must not skip.
+func NewMessageSyncPage(messages []*MessageChange, readStates []*ReadStateChange, cursor SyncCursor, xmin int64, limit int) *MessageSyncPage {
+	page := &MessageSyncPage{Messages: []*MessageChange{}, ReadStates: []*ReadStateChange{}}
+	i, j := 0, 0
+	for i < len(messages) || j < len(readStates) {
+		takeMessage := j == len(readStates) || (i < len(messages) && messages[i].Position.Before(readStates[j].Position))
+		var next SyncCursor
+		if takeMessage {
+			next = messages[i].Position
+		} else {
+			next = readStates[j].Position
+		}
+		if next.XID >= xmin {
+			break
+		}
+		if i+j == limit {
+			page.HasMore = true
+			break
+		}
+		cursor = next
+		if takeMessage {
+			page.Messages = append(page.Messages, messages[i])
+			i++
+		} else {
+			page.ReadStates = append(page.ReadStates, readStates[j])
+			j++
+		}
+	}
+	page.Cursor = cursor.String()
+	return page
+}
+
+// GroupThreadCreate is the request to start a group conversation
+type GroupThreadCreate struct {
+	Title     string   `json:"title"`
+	MemberIDs []string `json:"member_ids"`
+}
+
+// Validate trims the title, drops blank and repeated member IDs and checks the limits.
+// ownerID is the creator, who is always a member and must not be listed.
+func (g *GroupThreadCreate) Validate(ownerID string) error {
+	g.Title = strings.TrimSpace(g.Title)
+	if len([]rune(g.Title)) > GroupTitleMaxLen {
+		return fmt.Errorf("title must be at most %d characters", GroupTitleMaxLen)
+	}
+
+	seen := map[string]bool{ownerID: true}
+	members := make([]string, 0, len(g.MemberIDs))
+	for _, id := range g.MemberIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		members = append(members, id)
+	}
+	g.MemberIDs = members
+
+	if len(members) == 0 {
+		return fmt.Errorf("a group needs at least one other member")
+	}
+	if len(members)+1 > GroupMaxMembers {
+		return fmt.Errorf("a group can have at most %d members", GroupMaxMembers)
+	}
+	return nil
 }
 
 // ModerationRequest represents a request for moderation privileges
@@ -0,0 +1,275 @@
+package realtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types pushed to clients
+const (
+	EventMessageCreated = "message.created"
+	EventMessageEdited  = "message.edited"
+	EventMessageDeleted = "message.deleted"
+	EventMessageRead    = "message.read"
+	EventFollowCreated  = "follow.created"
+	EventLikeCreated    = "like.created"
+	EventReplyCreated   = "reply.created"
+	// EventPrekeysLow tells a user's devices that one of them should upload one-time prekeys
+	EventPrekeysLow = "prekeys.low"
+
+	// EventResync tells a resuming client that events were lost and it should refetch
+	EventResync = "resync"
+	// EventPing keeps idle connections open
+	EventPing = "ping"
+)
+
+const (
+	subscriptionBuffer = 64
+	backlogSize        = 256
+	backlogTTL         = 10 * time.Minute
+)
+
+// Event is a change pushed to a user's connections. ID is the resume token of the event:
+// a client that reconnects with it receives everything published after it.
+type Event struct {
+	ID        string      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	// Partial is set when Data was too large to relay; the client should refetch
+	Partial bool `json:"partial,omitempty"`
+
+	seq uint64
+}
+
+// Subscription is one client connection of a user. Events arrives on Events until the
+// subscription is closed; a subscriber that falls behind is closed by the hub and is
+// expected to reconnect with the ID of the last event it handled.
+type Subscription struct {
+	UserID string
+	Events <-chan Event
+
+	events chan Event
+	closed bool
+}
+
+type userBacklog struct {
+	events  []Event
+	trimmed uint64 // highest sequence dropped from events
+}
+
+// Hub fans published events out to the subscriptions of their recipients and keeps a
+// short backlog per user so reconnecting clients can resume.
+type Hub struct {
+	mu sync.Mutex
+
+	epoch   string
+	seq     uint64
+	subs    map[string]map[*Subscription]struct{}
+	backlog map[string]*userBacklog
+	// Highest sequence dropped with a whole user backlog
+	evicted   uint64
+	lastPrune time.Time
+
+	// publish replaces local delivery, e.g. to relay events from another process
+	publish func(userIDs []string, event Event)
+}
+
+var (
+	hubCount  atomic.Uint64
+	globalHub = NewHub()
+)
+
+// GetHub returns the process-wide hub
+func GetHub() *Hub {
+	return globalHub
+}
+
+// NewHub creates an empty hub. Resume tokens of another hub, including one of a previous
+// server run, are not resumable.
+func NewHub() *Hub {
+	return &Hub{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(hubCount.Add(1), 36),
+		subs:    make(map[string]map[*Subscription]struct{}),
+		backlog: make(map[string]*userBacklog),
+	}
+}
+
+// Publish sends an event to every connection of the given users
+func (h *Hub) Publish(userIDs []string, eventType string, data interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	event := Event{Type: eventType, Data: data, CreatedAt: time.Now().UTC()}
+
+	h.mu.Lock()
+	publish := h.publish
+	h.mu.Unlock()
+	if publish != nil {
+		publish(userIDs, event)
+		return
+	}
+	h.deliver(userIDs, event)
+}
+
+// deliver assigns the event its resume token, records it and hands it to subscribers
+func (h *Hub) deliver(userIDs []string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	event.seq = h.seq
+	event.ID = h.token(h.seq)
+
+	seen := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		h.record(userID, event)
+
+		for sub := range h.subs[userID] {
+			select {
+			case sub.events <- event:
+			default:
+				// Too far behind: the client resumes from its last event
+				h.closeLocked(sub)
+			}
+		}
+	}
+	if event.CreatedAt.Sub(h.lastPrune) > time.Minute {
+		h.lastPrune = event.CreatedAt
+		h.pruneLocked(event.CreatedAt)
+	}
+}
+
+// record appends event to the user's backlog, trimming it to backlogSize
+func (h *Hub) record(userID string, event Event) {
+	backlog := h.backlog[userID]
+	if backlog == nil {
+		backlog = &userBacklog{}
+		h.backlog[userID] = backlog
+	}
+	backlog.events = append(backlog.events, event)
+	if over := len(backlog.events) - backlogSize; over > 0 {
+		backlog.trimmed = backlog.events[over-1].seq
+		backlog.events = append([]Event(nil), backlog.events[over:]...)
+	}
+}
+
+// pruneLocked drops backlog entries older than backlogTTL
+func (h *Hub) pruneLocked(now time.Time) {
+	cutoff := now.Add(-backlogTTL)
+	for userID, backlog := range h.backlog {
+		if len(backlog.events) > 0 && backlog.events[0].CreatedAt.After(cutoff) {
+			continue
+		}
+		keep := 0
+		for keep < len(backlog.events) && !backlog.events[keep].CreatedAt.After(cutoff) {
+			keep++
+		}
+		if keep > 0 {
+			backlog.trimmed = backlog.events[keep-1].seq
+			backlog.events = append([]Event(nil), backlog.events[keep:]...)
+		}
+		if len(backlog.events) == 0 {
+			h.evicted = max(h.evicted, backlog.trimmed)
+			delete(h.backlog, userID)
+		}
+	}
+}
+
+// Subscribe registers a connection for userID. With the resume token of the last event a
+// client handled, the events it missed are returned for replay; resumed is false when
+// that is not possible and the client should refetch its state.
+func (h *Hub) Subscribe(userID, resumeToken string) (sub *Subscription, replay []Event, resumed bool) {
+	events := make(chan Event, subscriptionBuffer)
+	sub = &Subscription{UserID: userID, Events: events, events: events}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+
+	if resumeToken == "" {
+		return sub, nil, true
+	}
+	after, ok := h.parseToken(resumeToken)
+	if !ok {
+		return sub, nil, false
+	}
+
+	backlog := h.backlog[userID]
+	floor := h.evicted
+	if backlog != nil {
+		floor = backlog.trimmed
+	}
+	if after < floor {
+		return sub, nil, false
+	}
+	if backlog != nil {
+		for _, event := range backlog.events {
+			if event.seq > after {
+				replay = append(replay, event)
+			}
+		}
+	}
+	return sub, replay, true
+}
+
+// Unsubscribe removes a connection from the hub
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeLocked(sub)
+}
+
+func (h *Hub) closeLocked(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+	if subs := h.subs[sub.UserID]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subs, sub.UserID)
+		}
+	}
+}
+
+// Connections returns the number of open subscriptions
+func (h *Hub) Connections() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	count := 0
+	for _, subs := range h.subs {
+		count += len(subs)
+	}
+	return count
+}
+
+func (h *Hub) token(seq uint64) string {
+	return fmt.Sprintf("%s.%d", h.epoch, seq)
+}
+
+// parseToken returns the sequence of a resume token issued by this hub
+func (h *Hub) parseToken(token string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(token, ".")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > h.seq {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,46 @@
+package realtime
+
+import (
+	"context"
+	"log"
+
+	"splitter/internal/db"
+)
+
+// PublishToDIDs sends an event to the local users with the given DIDs
+func PublishToDIDs(ctx context.Context, dids []string, eventType string, data interface{}) {
+	if len(dids) == 0 {
+		return
+	}
+	rows, err := db.GetDB().Query(ctx, `SELECT id::text FROM users WHERE did = ANY($1)`, dids)
+	if err != nil {
+		log.Printf("[Realtime] Failed to resolve %s recipients: %v", eventType, err)
+		return
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	GetHub().Publish(userIDs, eventType, data)
+}
+
+// PublishToPostAuthor sends an event about an interaction with a post to its author,
+// unless the author is the one interacting
+func PublishToPostAuthor(ctx context.Context, postID, actorDID, eventType string, data interface{}) {
+	var userID string
+	err := db.GetDB().QueryRow(ctx, `
+		SELECT u.id::text FROM posts p
+		JOIN users u ON u.did = p.author_did
+		WHERE p.id::text = $1 AND p.author_did <> $2`,
+		postID, actorDID,
+	).Scan(&userID)
+	if err != nil {
+		return
+	}
+	GetHub().Publish([]string{userID}, eventType, data)
+}
@@ -0,0 +1,98 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"splitter/internal/db"
+)
+
+// relayChannel is the Postgres NOTIFY channel events are relayed on
+const relayChannel = "realtime_events"
+
+// maxRelayPayload stays under Postgres' 8000 byte NOTIFY payload limit
+const maxRelayPayload = 7900
+
+type relayedEvent struct {
+	UserIDs []string `json:"user_ids"`
+	Event   Event    `json:"event"`
+}
+
+// RelayToServer makes the hub forward published events to the server process over
+// Postgres NOTIFY instead of delivering them. Worker processes have no client
+// connections; the server picks the events up with ListenForRelayedEvents.
+func (h *Hub) RelayToServer() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish = func(userIDs []string, event Event) {
+		payload, err := encodeRelayedEvent(userIDs, event)
+		if err != nil {
+			log.Printf("[Realtime] Failed to encode %s event: %v", event.Type, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := db.GetDB().Exec(ctx, `SELECT pg_notify($1, $2)`, relayChannel, payload); err != nil {
+			log.Printf("[Realtime] Failed to relay %s event: %v", event.Type, err)
+		}
+	}
+}
+
+// encodeRelayedEvent encodes an event for NOTIFY. An event too large for the payload
+// limit is relayed without its data and marked partial.
+func encodeRelayedEvent(userIDs []string, event Event) (string, error) {
+	raw, err := json.Marshal(relayedEvent{UserIDs: userIDs, Event: event})
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > maxRelayPayload {
+		event.Data = nil
+		event.Partial = true
+		if raw, err = json.Marshal(relayedEvent{UserIDs: userIDs, Event: event}); err != nil {
+			return "", err
+		}
+	}
+	return string(raw), nil
+}
+
+// ListenForRelayedEvents delivers events relayed by worker processes until ctx is
+// cancelled, reconnecting when the listening connection is lost.
+func (h *Hub) ListenForRelayedEvents(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Realtime] Relay listener stopped, reconnecting: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	pooled, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The listening connection leaves the pool so no other query runs on it
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+relayChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var relayed relayedEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &relayed); err != nil {
+			log.Printf("[Realtime] Ignoring malformed relayed event: %v", err)
+			continue
+		}
+		h.deliver(relayed.UserIDs, relayed.Event)
+	}
+}
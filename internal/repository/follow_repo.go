@@ -6,6 +6,7 @@ import (
 
 	"splitter/internal/db"
 	"splitter/internal/models"
+	"splitter/internal/realtime"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -65,6 +66,8 @@ func (r *FollowRepository) Create(ctx context.Context, followerDID, followingDID
 		return nil, fmt.Errorf("failed to create follow: %w", err)
 	}
 
+	realtime.PublishToDIDs(ctx, []string{followingDID}, realtime.EventFollowCreated, &follow)
+
 	return &follow, nil
 }
 
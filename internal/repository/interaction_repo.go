@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"splitter/internal/db"
+	"splitter/internal/realtime"
 )
 
 // InteractionRepository handles database operations for post interactions
@@ -23,11 +24,18 @@ func (r *InteractionRepository) CreateLike(ctx context.Context, postID, actorDID
 		ON CONFLICT (post_id, actor_did, interaction_type) DO NOTHING
 	`
 
-	_, err := db.GetDB().Exec(ctx, query, postID, actorDID)
+	result, err := db.GetDB().Exec(ctx, query, postID, actorDID)
 	if err != nil {
 		return fmt.Errorf("failed to create like: %w", err)
 	}
 
+	if result.RowsAffected() > 0 {
+		realtime.PublishToPostAuthor(ctx, postID, actorDID, realtime.EventLikeCreated, map[string]string{
+			"post_id":   postID,
+			"actor_did": actorDID,
+		})
+	}
+
 	return nil
 }
 
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"splitter/internal/db"
+	"splitter/internal/models"
+	"splitter/internal/realtime"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetMessage returns a message by ID
+func (r *MessageRepository) GetMessage(ctx context.Context, messageID string) (*models.Message, error) {
+	msg, err := scanMessage(db.GetDB().QueryRow(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1`, messageID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return msg, nil
+}
+
+// ReceiveRemoteMessage stores a message received from another server as the Note objectURI,
+// published at publishedAt (no later than now). recipientID is empty for group messages.
+// A Note already stored is not stored again; the bool reports a new row.
+func (r *MessageRepository) ReceiveRemoteMessage(ctx context.Context, threadID, senderID, recipientID, objectURI string, publishedAt time.Time, content, ciphertext, encryptedKeys string) (*models.Message, bool, error) {
+	msg, err := scanMessage(db.GetDB().QueryRow(ctx, `
+		INSERT INTO messages (thread_id, sender_did, recipient_did, sender_id, recipient_id, object_uri, published_at, content, ciphertext, encrypted_keys)
+		SELECT $1, us.did, ur.did, us.id, ur.id, NULLIF($4, ''), LEAST($5, NOW()), $6, $7,
+		       CASE WHEN NULLIF($8, '') IS NULL THEN NULL ELSE $8::jsonb END
+		FROM users us
+		LEFT JOIN users ur ON ur.id = NULLIF($3, '')::uuid
+		WHERE us.id = $2
+		ON CONFLICT (object_uri) WHERE object_uri IS NOT NULL
+		DO NOTHING
+		RETURNING `+messageColumns,
+		threadID, senderID, recipientID, objectURI, publishedAt, content, ciphertext, encryptedKeys,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to store remote message: %w", err)
+	}
+
+	_, _ = db.GetDB().Exec(ctx, `UPDATE message_threads SET updated_at = NOW() WHERE id = $1`, threadID)
+	publishThreadEvent(ctx, threadID, realtime.EventMessageCreated, msg)
+	return msg, true, nil
+}
+
+// GetMessageIDByObjectURI returns the ID of the message received as the Note objectURI,
+// or "" when there is none
+func (r *MessageRepository) GetMessageIDByObjectURI(ctx context.Context, objectURI string) (string, error) {
+	var messageID string
+	err := db.GetDB().QueryRow(ctx, `SELECT id FROM messages WHERE object_uri = $1`, objectURI).Scan(&messageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up message by object uri: %w", err)
+	}
+	return messageID, nil
+}
+
+// remoteMessageSender returns the message received as objectURI, its sender and when it
+// was published, when that sender is the actor senderDID
+func (r *MessageRepository) remoteMessageSender(ctx context.Context, objectURI, senderDID string) (messageID, senderID string, publishedAt time.Time, err error) {
+	err = db.GetDB().QueryRow(ctx,
+		`SELECT m.id, m.sender_id, COALESCE(m.published_at, m.created_at) FROM messages m JOIN users u ON u.id = m.sender_id
+		 WHERE m.object_uri = $1 AND u.did = $2`,
+		objectURI, senderDID,
+	).Scan(&messageID, &senderID, &publishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to look up remote message: %w", err)
+	}
+	return messageID, senderID, publishedAt, nil
+}
+
+// EditRemoteMessage applies an edit sent by the remote sender of a message, within the
+// same window as local edits, counted from when the Note was published so that a late
+// delivery does not extend it. Returns false when no message of senderDID has the ID.
+func (r *MessageRepository) EditRemoteMessage(ctx context.Context, objectURI, senderDID, content, ciphertext string) (bool, error) {
+	messageID, senderID, publishedAt, err := r.remoteMessageSender(ctx, objectURI, senderDID)
+	if err != nil || messageID == "" {
+		return false, err
+	}
+	if time.Since(publishedAt) > messageChangeWindow {
+		return true, ErrEditWindowExpired
+	}
+	return true, r.EditMessage(ctx, messageID, senderID, content, ciphertext)
+}
+
+// DeleteRemoteMessage applies a deletion for everyone sent by the remote sender of a
+// message, within the same window as local deletions, counted from when the Note was
+// published. Returns false when no message of senderDID has the ID.
+func (r *MessageRepository) DeleteRemoteMessage(ctx context.Context, objectURI, senderDID string) (bool, error) {
+	messageID, senderID, publishedAt, err := r.remoteMessageSender(ctx, objectURI, senderDID)
+	if err != nil || messageID == "" {
+		return false, err
+	}
+	if time.Since(publishedAt) > messageChangeWindow {
+		return true, ErrDeleteWindowExpired
+	}
+	return true, r.DeleteMessage(ctx, messageID, senderID)
+}
+
+// MarkReadUpTo applies a read receipt of the remote reader readerDID: the message and
+// everything before it in its thread count as read by them. Only participants of the
+// thread are affected. Reports whether the read state changed.
+func (r *MessageRepository) MarkReadUpTo(ctx context.Context, messageID, readerDID string) (bool, error) {
+	var threadID, readerID string
+	var readUpTo time.Time
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT m.thread_id, m.created_at, u.id FROM messages m, users u WHERE m.id = $1 AND u.did = $2`,
+		messageID, readerDID,
+	).Scan(&threadID, &readUpTo, &readerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up read message: %w", err)
+	}
+
+	direct, err := db.GetDB().Exec(ctx,
+		`UPDATE messages SET is_read = true
+		 WHERE thread_id = $1 AND recipient_id = $2 AND is_read = false AND created_at <= $3`,
+		threadID, readerID, readUpTo,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+	group, err := db.GetDB().Exec(ctx,
+		`UPDATE message_thread_members SET last_read_at = $3
+		 WHERE thread_id = $1 AND user_id = $2 AND (last_read_at IS NULL OR last_read_at < $3)`,
+		threadID, readerID, readUpTo,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+
+	changed := direct.RowsAffected() > 0 || group.RowsAffected() > 0
+	if changed {
+		publishThreadEvent(ctx, threadID, realtime.EventMessageRead, map[string]interface{}{
+			"thread_id": threadID,
+			"reader_id": readerID,
+			"read_at":   time.Now().UTC(),
+		})
+	}
+	return changed, nil
+}
+
+// GetLatestObjectURIFrom returns the Note ID of the newest message senderID sent to a
+// thread from another server, or "" when there is none
+func (r *MessageRepository) GetLatestObjectURIFrom(ctx context.Context, threadID, senderID string) (string, error) {
+	var objectURI string
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT object_uri FROM messages
+		 WHERE thread_id = $1 AND sender_id = $2 AND object_uri IS NOT NULL AND deleted_at IS NULL
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		threadID, senderID,
+	).Scan(&objectURI)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest remote message: %w", err)
+	}
+	return objectURI, nil
+}
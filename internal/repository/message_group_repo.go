@@ -0,0 +1,549 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"splitter/internal/db"
+	"splitter/internal/models"
+	"splitter/internal/realtime"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrThreadNotFound    = errors.New("thread not found")
+	ErrNotGroupThread    = errors.New("not a group thread")
+	ErrNotThreadMember   = errors.New("not a member of this thread")
+	ErrNotThreadOwner    = errors.New("only the group owner can do this")
+	ErrThreadMemberLimit = errors.New("group member limit reached")
+)
+
+const messageColumns = `id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
+	COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
+	is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at`
+
+func scanMessage(row pgx.Row) (*models.Message, error) {
+	var msg models.Message
+	err := row.Scan(
+		&msg.ID,
+		&msg.ThreadID,
+		&msg.SenderID,
+		&msg.RecipientID,
+		&msg.ClientMessageID,
+		&msg.Content,
+		&msg.Ciphertext,
+		&msg.EncryptedKeys,
+		&msg.IsRead,
+		&msg.CreatedAt,
+		&msg.ClientCreatedAt,
+		&msg.DeliveredAt,
+		&msg.DeletedAt,
+		&msg.EditedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// CreateGroupThread starts a group conversation owned by ownerID. Every member must
+// accept messages from the owner under their message privacy setting.
+func (r *MessageRepository) CreateGroupThread(ctx context.Context, ownerID string, group *models.GroupThreadCreate) (*models.MessageThread, error) {
+	if err := r.checkCanAddMembers(ctx, ownerID, group.MemberIDs); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var threadID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO message_threads (is_group, title, created_by) VALUES (true, $1, $2) RETURNING id::text`,
+		group.Title, ownerID,
+	).Scan(&threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group thread: %w", err)
+	}
+	if err := insertThreadMembers(ctx, tx, threadID, ownerID, group.MemberIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit group thread: %w", err)
+	}
+	return r.GetThread(ctx, threadID)
+}
+
+// insertThreadMembers adds ownerID (when set) as owner and memberIDs as members
+func insertThreadMembers(ctx context.Context, tx pgx.Tx, threadID, ownerID string, memberIDs []string) error {
+	if ownerID != "" {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO message_thread_members (thread_id, user_id, role) VALUES ($1, $2, 'owner')
+			 ON CONFLICT (thread_id, user_id) DO NOTHING`,
+			threadID, ownerID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add group owner: %w", err)
+		}
+	}
+	if len(memberIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO message_thread_members (thread_id, user_id, role)
+		 SELECT $1, u.id, 'member' FROM users u WHERE u.id::text = ANY($2::text[])
+		 ON CONFLICT (thread_id, user_id) DO NOTHING`,
+		threadID, memberIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add group members: %w", err)
+	}
+	return nil
+}
+
+// checkCanAddMembers applies each new member's message privacy setting to actorID
+func (r *MessageRepository) checkCanAddMembers(ctx context.Context, actorID string, memberIDs []string) error {
+	for _, memberID := range memberIDs {
+		allowed, reason, err := r.canSendMessageToRecipient(ctx, actorID, memberID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("message request blocked: %s", reason)
+		}
+	}
+	return nil
+}
+
+// GetThreadMembers lists the members of a group thread with their unread counts.
+// A member's unread messages are those from others since they last read the thread,
+// or since they joined.
+func (r *MessageRepository) GetThreadMembers(ctx context.Context, threadID string) ([]*models.ThreadMember, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT m.user_id::text, m.role, m.joined_at, m.last_read_at,
+		       (SELECT COUNT(*) FROM messages msg
+		        WHERE msg.thread_id = m.thread_id
+		          AND msg.sender_id <> m.user_id
+		          AND msg.deleted_at IS NULL
+		          AND msg.created_at > COALESCE(m.last_read_at, m.joined_at)),
+		       u.username, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), u.instance_domain,
+		       COALESCE(u.did, ''), COALESCE(u.encryption_public_key, '')
+		FROM message_thread_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.thread_id = $1
+		ORDER BY m.joined_at ASC, u.username ASC
+	`, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*models.ThreadMember
+	for rows.Next() {
+		var member models.ThreadMember
+		var user models.User
+		if err := rows.Scan(
+			&member.UserID,
+			&member.Role,
+			&member.JoinedAt,
+			&member.LastReadAt,
+			&member.UnreadCount,
+			&user.Username,
+			&user.DisplayName,
+			&user.AvatarURL,
+			&user.InstanceDomain,
+			&user.DID,
+			&user.EncryptionPublicKey,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan thread member: %w", err)
+		}
+		user.ID = member.UserID
+		member.User = &user
+		members = append(members, &member)
+	}
+	return members, rows.Err()
+}
+
+// getUserGroupThreads returns the group threads userID belongs to, newest first
+func (r *MessageRepository) getUserGroupThreads(ctx context.Context, userID string) ([]*models.MessageThread, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT t.id::text, t.title, COALESCE(t.federation_context, ''), t.created_at, t.updated_at
+		FROM message_threads t
+		JOIN message_thread_members m ON m.thread_id = t.id AND m.user_id = $1
+		WHERE t.is_group
+		ORDER BY t.updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group threads: %w", err)
+	}
+	defer rows.Close()
+
+	var threads []*models.MessageThread
+	for rows.Next() {
+		thread := &models.MessageThread{IsGroup: true}
+		if err := rows.Scan(&thread.ID, &thread.Title, &thread.FederationContext, &thread.CreatedAt, &thread.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group thread: %w", err)
+		}
+		threads = append(threads, thread)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get group threads: %w", err)
+	}
+	rows.Close()
+
+	for _, thread := range threads {
+		thread.Members, err = r.GetThreadMembers(ctx, thread.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member := thread.Member(userID); member != nil {
+			thread.UnreadCount = member.UnreadCount
+		}
+		thread.LastMessage = r.lastThreadMessage(ctx, thread.ID)
+	}
+	return threads, nil
+}
+
+// groupThreadFor loads a group thread and the membership of userID in it
+func (r *MessageRepository) groupThreadFor(ctx context.Context, threadID, userID string) (*models.MessageThread, *models.ThreadMember, error) {
+	thread, err := r.GetThread(ctx, threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !thread.IsGroup {
+		return nil, nil, ErrNotGroupThread
+	}
+	member := thread.Member(userID)
+	if member == nil {
+		return nil, nil, ErrNotThreadMember
+	}
+	return thread, member, nil
+}
+
+// AddThreadMembers adds members to a group thread. Only the owner can add members.
+func (r *MessageRepository) AddThreadMembers(ctx context.Context, threadID, actorID string, memberIDs []string) (*models.MessageThread, error) {
+	thread, actor, err := r.groupThreadFor(ctx, threadID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.ThreadRoleOwner {
+		return nil, ErrNotThreadOwner
+	}
+
+	var added []string
+	seen := make(map[string]bool)
+	for _, memberID := range memberIDs {
+		if memberID == "" || seen[memberID] || thread.Member(memberID) != nil {
+			continue
+		}
+		seen[memberID] = true
+		added = append(added, memberID)
+	}
+	if len(added) == 0 {
+		return thread, nil
+	}
+	if len(thread.Members)+len(added) > models.GroupMaxMembers {
+		return nil, ErrThreadMemberLimit
+	}
+	if err := r.checkCanAddMembers(ctx, actorID, added); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := insertThreadMembers(ctx, tx, threadID, "", added); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit group members: %w", err)
+	}
+	return r.GetThread(ctx, threadID)
+}
+
+// RemoveThreadMember removes memberID from a group thread. The owner can remove anyone;
+// other members can only leave. When the owner leaves, the longest-standing member
+// becomes owner; when the last member leaves, the thread is deleted and nil is returned.
+func (r *MessageRepository) RemoveThreadMember(ctx context.Context, threadID, actorID, memberID string) (*models.MessageThread, error) {
+	thread, actor, err := r.groupThreadFor(ctx, threadID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if memberID != actorID && actor.Role != models.ThreadRoleOwner {
+		return nil, ErrNotThreadOwner
+	}
+	target := thread.Member(memberID)
+	if target == nil {
+		return nil, ErrNotThreadMember
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM message_thread_members WHERE thread_id = $1 AND user_id = $2`,
+		threadID, memberID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to remove group member: %w", err)
+	}
+
+	if len(thread.Members) == 1 {
+		if _, err := tx.Exec(ctx, `DELETE FROM message_threads WHERE id = $1`, threadID); err != nil {
+			return nil, fmt.Errorf("failed to delete empty group thread: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit group member removal: %w", err)
+		}
+		return nil, nil
+	}
+
+	if target.Role == models.ThreadRoleOwner {
+		_, err := tx.Exec(ctx, `
+			UPDATE message_thread_members SET role = 'owner'
+			WHERE thread_id = $1 AND user_id = (
+				SELECT user_id FROM message_thread_members
+				WHERE thread_id = $1
+				ORDER BY joined_at ASC
+				LIMIT 1
+			)`, threadID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hand over group ownership: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit group member removal: %w", err)
+	}
+	return r.GetThread(ctx, threadID)
+}
+
+// RenameThread sets the title of a group thread. Only the owner can rename it.
+func (r *MessageRepository) RenameThread(ctx context.Context, threadID, actorID, title string) (*models.MessageThread, error) {
+	_, actor, err := r.groupThreadFor(ctx, threadID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.ThreadRoleOwner {
+		return nil, ErrNotThreadOwner
+	}
+
+	if _, err := db.GetDB().Exec(ctx,
+		`UPDATE message_threads SET title = $2, updated_at = NOW() WHERE id = $1`,
+		threadID, title,
+	); err != nil {
+		return nil, fmt.Errorf("failed to rename thread: %w", err)
+	}
+	return r.GetThread(ctx, threadID)
+}
+
+// SendGroupMessage stores a message to a group thread. Like SendMessageWithClientMetadata
+// it is idempotent per sender and client_message_id; the bool reports a new row.
+func (r *MessageRepository) SendGroupMessage(ctx context.Context, threadID, senderID, clientMessageID, content, ciphertext, encryptedKeys string, clientCreatedAt *time.Time) (*models.Message, bool, error) {
+	msg, err := scanMessage(db.GetDB().QueryRow(ctx, `
+		INSERT INTO messages (thread_id, sender_did, sender_id, client_message_id, content, ciphertext, encrypted_keys, client_created_at)
+		SELECT $1, us.did, us.id, NULLIF($3, ''), $4, $5,
+		       CASE WHEN NULLIF($6, '') IS NULL THEN NULL ELSE $6::jsonb END,
+		       $7
+		FROM users us
+		WHERE us.id = $2
+		ON CONFLICT (sender_id, client_message_id)
+		WHERE client_message_id IS NOT NULL
+		DO NOTHING
+		RETURNING `+messageColumns,
+		threadID, senderID, clientMessageID, content, ciphertext, encryptedKeys, clientCreatedAt,
+	))
+	if errors.Is(err, pgx.ErrNoRows) && clientMessageID != "" {
+		msg, err = scanMessage(db.GetDB().QueryRow(ctx,
+			`SELECT `+messageColumns+` FROM messages WHERE sender_id = $1 AND client_message_id = $2 LIMIT 1`,
+			senderID, clientMessageID,
+		))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to fetch deduplicated message: %w", err)
+		}
+		return msg, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to send group message: %w", err)
+	}
+
+	_, _ = db.GetDB().Exec(ctx, `UPDATE message_threads SET updated_at = NOW() WHERE id = $1`, threadID)
+	publishThreadEvent(ctx, threadID, realtime.EventMessageCreated, msg)
+	return msg, true, nil
+}
+
+// GetThreadDeviceKeys lists the keys a group message must be encrypted for: every approved
+// device of every member, or the account key of a member without approved devices.
+func (r *MessageRepository) GetThreadDeviceKeys(ctx context.Context, threadID string) ([]*models.ThreadDeviceKey, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT u.id::text, COALESCE(u.did, ''), COALESCE(dk.device_id, ''),
+		       COALESCE(dk.encryption_public_key, u.encryption_public_key, '')
+		FROM message_thread_members m
+		JOIN users u ON u.id = m.user_id
+		LEFT JOIN user_device_keys dk ON dk.user_id = u.id AND dk.status = 'approved'
+		WHERE m.thread_id = $1
+		ORDER BY m.joined_at ASC, dk.device_id ASC
+	`, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread device keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*models.ThreadDeviceKey, 0)
+	for rows.Next() {
+		var key models.ThreadDeviceKey
+		if err := rows.Scan(&key.UserID, &key.DID, &key.DeviceID, &key.EncryptionPublicKey); err != nil {
+			return nil, fmt.Errorf("failed to scan thread device key: %w", err)
+		}
+		if key.DID == "" || key.EncryptionPublicKey == "" {
+			continue
+		}
+		key.KeyID = models.GroupEnvelopeKeyID(key.DID, key.DeviceID)
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// GetOrCreateGroupThreadForInbound finds the group thread a federated group message belongs
+// to, or creates it with the sender as owner. A thread is found by the context URI the
+// sending server gave it, or, without one, by having exactly the addressed members.
+// Only the thread's origin changes its membership: members it addresses are added when
+// senderIsOrigin (the sender lives on the context URI's host) or, for threads without a
+// context, when the sender owns the thread. Messages from other members are filed without
+// adding anyone, and a sender outside an existing thread gets ErrNotThreadMember. A thread
+// is only keyed by a context URI its origin sent, so nobody else can claim the conversation.
+func (r *MessageRepository) GetOrCreateGroupThreadForInbound(ctx context.Context, contextURI, senderID string, senderIsOrigin bool, memberIDs []string) (*models.MessageThread, error) {
+	var threadID string
+	var err error
+	if contextURI != "" {
+		err = db.GetDB().QueryRow(ctx,
+			`SELECT id::text FROM message_threads WHERE is_group AND federation_context = $1`,
+			contextURI,
+		).Scan(&threadID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = nil
+		}
+	}
+	// Without a context, or with one only its origin may claim, match by participants
+	if err == nil && threadID == "" && (contextURI == "" || !senderIsOrigin) {
+		everyone := append([]string{senderID}, memberIDs...)
+		sort.Strings(everyone)
+		err = db.GetDB().QueryRow(ctx, `
+			SELECT t.id::text
+			FROM message_threads t
+			JOIN message_thread_members m ON m.thread_id = t.id
+			WHERE t.is_group AND t.federation_context IS NULL
+			GROUP BY t.id
+			HAVING array_agg(DISTINCT m.user_id::text ORDER BY m.user_id::text) = $1::text[]
+			ORDER BY MAX(t.updated_at) DESC
+			LIMIT 1
+		`, dedupeSorted(everyone)).Scan(&threadID)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find group thread: %w", err)
+	}
+
+	if threadID != "" {
+		thread, err := r.GetThread(ctx, threadID)
+		if err != nil {
+			return nil, err
+		}
+		sender := thread.Member(senderID)
+		if sender == nil {
+			return nil, ErrNotThreadMember
+		}
+		mayAddMembers := senderIsOrigin
+		if contextURI == "" {
+			mayAddMembers = sender.Role == models.ThreadRoleOwner
+		}
+		if !mayAddMembers {
+			return thread, nil
+		}
+		var missing []string
+		for _, memberID := range memberIDs {
+			if thread.Member(memberID) != nil {
+				continue
+			}
+			allowed, reason, err := r.canSendMessageToRecipient(ctx, senderID, memberID)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				log.Printf("[Messages] Not adding %s to group thread %s: %s", memberID, threadID, reason)
+				continue
+			}
+			missing = append(missing, memberID)
+		}
+		if len(missing) == 0 {
+			return thread, nil
+		}
+		if len(thread.Members)+len(missing) > models.GroupMaxMembers {
+			return nil, ErrThreadMemberLimit
+		}
+		tx, err := db.GetDB().Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+		if err := insertThreadMembers(ctx, tx, threadID, "", missing); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit group members: %w", err)
+		}
+		return r.GetThread(ctx, threadID)
+	}
+
+	if len(memberIDs)+1 > models.GroupMaxMembers {
+		return nil, ErrThreadMemberLimit
+	}
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	threadContext := contextURI
+	if !senderIsOrigin {
+		threadContext = ""
+	}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO message_threads (is_group, created_by, federation_context)
+		 VALUES (true, $1, NULLIF($2, ''))
+		 RETURNING id::text`,
+		senderID, threadContext,
+	).Scan(&threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group thread: %w", err)
+	}
+	if err := insertThreadMembers(ctx, tx, threadID, senderID, memberIDs); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit group thread: %w", err)
+	}
+	return r.GetThread(ctx, threadID)
+}
+
+// dedupeSorted drops repeated values from a sorted slice
+func dedupeSorted(values []string) []string {
+	out := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			out = append(out, value)
+		}
+	}
+	return out
+}
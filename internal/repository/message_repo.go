@@ -2,15 +2,30 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"time"
 
 	"splitter/internal/db"
 	"splitter/internal/models"
+	"splitter/internal/realtime"
 
 	"github.com/jackc/pgx/v5"
 )
 
+var (
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrMessageAlreadyDeleted = errors.New("message already deleted")
+	ErrEditDeletedMessage    = errors.New("cannot edit deleted message")
+	ErrDeleteWindowExpired   = errors.New("cannot delete messages older than 3 hours")
+	ErrEditWindowExpired     = errors.New("cannot edit messages older than 3 hours")
+)
+
+// messageChangeWindow is how long after sending a message can be edited or deleted
+const messageChangeWindow = 3 * time.Hour
+
 // MessageRepository handles database operations for messages
 type MessageRepository struct{}
 
@@ -144,7 +159,7 @@ func (r *MessageRepository) SendMessage(ctx context.Context, threadID, senderID,
 		       CASE WHEN NULLIF($6, '') IS NULL THEN NULL ELSE $6::jsonb END
 		FROM users us, users ur
 		WHERE us.id = $2 AND ur.id = $3
-		RETURNING id, thread_id, sender_id, recipient_id, COALESCE(client_message_id, ''), content,
+		RETURNING id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
 		          COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
 		          is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
 	`
@@ -175,6 +190,8 @@ func (r *MessageRepository) SendMessage(ctx context.Context, threadID, senderID,
 	updateQuery := `UPDATE message_threads SET updated_at = NOW() WHERE id = $1`
 	_, _ = db.GetDB().Exec(ctx, updateQuery, threadID)
 
+	publishThreadEvent(ctx, threadID, realtime.EventMessageCreated, &msg)
+
 	return &msg, nil
 }
 
@@ -202,7 +219,7 @@ func (r *MessageRepository) SendMessageWithClientMetadata(ctx context.Context, t
 		ON CONFLICT (sender_id, client_message_id)
 		WHERE client_message_id IS NOT NULL
 		DO NOTHING
-		RETURNING id, thread_id, sender_id, recipient_id, COALESCE(client_message_id, ''), content,
+		RETURNING id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
 		          COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
 		          is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
 	`
@@ -229,7 +246,7 @@ func (r *MessageRepository) SendMessageWithClientMetadata(ctx context.Context, t
 	if err == pgx.ErrNoRows {
 		inserted = false
 		existingQuery := `
-			SELECT id, thread_id, sender_id, recipient_id, COALESCE(client_message_id, ''), content,
+			SELECT id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
 			       COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
 			       is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
 			FROM messages
@@ -261,6 +278,7 @@ func (r *MessageRepository) SendMessageWithClientMetadata(ctx context.Context, t
 	if inserted {
 		updateQuery := `UPDATE message_threads SET updated_at = NOW() WHERE id = $1`
 		_, _ = db.GetDB().Exec(ctx, updateQuery, threadID)
+		publishThreadEvent(ctx, threadID, realtime.EventMessageCreated, &msg)
 	}
 
 	return &msg, inserted, nil
@@ -281,17 +299,23 @@ func (r *MessageRepository) HasClientMessageID(ctx context.Context, senderID, cl
 
 // GetThreadMessages gets all messages in a thread
 func (r *MessageRepository) GetThreadMessages(ctx context.Context, threadID string, limit, offset int) ([]*models.Message, error) {
+	return r.GetThreadMessagesSince(ctx, threadID, time.Time{}, limit, offset)
+}
+
+// GetThreadMessagesSince gets the messages of a thread sent at or after since.
+// Group members only see what was sent after they joined.
+func (r *MessageRepository) GetThreadMessagesSince(ctx context.Context, threadID string, since time.Time, limit, offset int) ([]*models.Message, error) {
 	query := `
-		SELECT id, thread_id, sender_id, recipient_id, COALESCE(client_message_id, ''), content,
+		SELECT id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
 		       COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
 		       is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
 		FROM messages
-		WHERE thread_id = $1
+		WHERE thread_id = $1 AND created_at >= $4
 		ORDER BY created_at ASC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := db.GetDB().Query(ctx, query, threadID, limit, offset)
+	rows, err := db.GetDB().Query(ctx, query, threadID, limit, offset, since)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
@@ -370,57 +394,74 @@ func (r *MessageRepository) GetUserThreads(ctx context.Context, userID string) (
 		unreadQuery := `SELECT COUNT(*) FROM messages WHERE thread_id = $1 AND recipient_id = $2 AND is_read = false`
 		_ = db.GetDB().QueryRow(ctx, unreadQuery, thread.ID, userID).Scan(&thread.UnreadCount)
 
-		// Get last message
-		lastMsgQuery := `
-			SELECT id, thread_id, sender_id, recipient_id, COALESCE(client_message_id, ''), content,
-			       COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
-			       is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
-			FROM messages
-			WHERE thread_id = $1 AND deleted_at IS NULL
-			ORDER BY created_at DESC
-			LIMIT 1
-		`
-		var lastMsg models.Message
-		err = db.GetDB().QueryRow(ctx, lastMsgQuery, thread.ID).Scan(
-			&lastMsg.ID,
-			&lastMsg.ThreadID,
-			&lastMsg.SenderID,
-			&lastMsg.RecipientID,
-			&lastMsg.ClientMessageID,
-			&lastMsg.Content,
-			&lastMsg.Ciphertext,
-			&lastMsg.EncryptedKeys,
-			&lastMsg.IsRead,
-			&lastMsg.CreatedAt,
-			&lastMsg.ClientCreatedAt,
-			&lastMsg.DeliveredAt,
-			&lastMsg.DeletedAt,
-			&lastMsg.EditedAt,
-		)
-		if err == nil {
-			thread.LastMessage = &lastMsg
-		}
+		thread.LastMessage = r.lastThreadMessage(ctx, thread.ID)
 
 		threads = append(threads, &thread)
 	}
+	rows.Close()
+
+	groups, err := r.getUserGroupThreads(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) > 0 {
+		threads = append(threads, groups...)
+		sort.SliceStable(threads, func(i, j int) bool {
+			return threads[i].UpdatedAt.After(threads[j].UpdatedAt)
+		})
+	}
 
 	return threads, nil
 }
 
+// lastThreadMessage returns the newest message of a thread that is not deleted, or nil
+func (r *MessageRepository) lastThreadMessage(ctx context.Context, threadID string) *models.Message {
+	lastMsgQuery := `
+		SELECT id, thread_id, sender_id, COALESCE(recipient_id::text, ''), COALESCE(client_message_id, ''), content,
+		       COALESCE(ciphertext::text, ''), COALESCE(encrypted_keys::text, '{}'),
+		       is_read, created_at, client_created_at, delivered_at, deleted_at, edited_at
+		FROM messages
+		WHERE thread_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	var lastMsg models.Message
+	err := db.GetDB().QueryRow(ctx, lastMsgQuery, threadID).Scan(
+		&lastMsg.ID,
+		&lastMsg.ThreadID,
+		&lastMsg.SenderID,
+		&lastMsg.RecipientID,
+		&lastMsg.ClientMessageID,
+		&lastMsg.Content,
+		&lastMsg.Ciphertext,
+		&lastMsg.EncryptedKeys,
+		&lastMsg.IsRead,
+		&lastMsg.CreatedAt,
+		&lastMsg.ClientCreatedAt,
+		&lastMsg.DeliveredAt,
+		&lastMsg.DeletedAt,
+		&lastMsg.EditedAt,
+	)
+	if err != nil {
+		return nil
+	}
+	return &lastMsg
+}
+
 // DeleteMessage soft-deletes a message (WhatsApp-style)
 // Only allows deletion within 3 hours of sending
 func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID, userID string) error {
 	// Check if message exists, user owns it, and it's within 3 hour window
-	var senderID string
+	var senderID, threadID string
 	var createdAt time.Time
 	var alreadyDeleted bool
 
 	checkQuery := `
-		SELECT sender_id, created_at, deleted_at IS NOT NULL
+		SELECT sender_id, thread_id, created_at, deleted_at IS NOT NULL
 		FROM messages
 		WHERE id = $1
 	`
-	err := db.GetDB().QueryRow(ctx, checkQuery, messageID).Scan(&senderID, &createdAt, &alreadyDeleted)
+	err := db.GetDB().QueryRow(ctx, checkQuery, messageID).Scan(&senderID, &threadID, &createdAt, &alreadyDeleted)
 	if err != nil {
 		return fmt.Errorf("message not found: %w", err)
 	}
@@ -430,21 +471,28 @@ func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID, userID
 	}
 
 	if alreadyDeleted {
-		return fmt.Errorf("message already deleted")
+		return ErrMessageAlreadyDeleted
 	}
 
 	// Check 3-hour window
-	if time.Since(createdAt) > 3*time.Hour {
-		return fmt.Errorf("cannot delete messages older than 3 hours")
+	if time.Since(createdAt) > messageChangeWindow {
+		return ErrDeleteWindowExpired
 	}
 
 	// Soft delete by setting deleted_at timestamp
-	deleteQuery := `UPDATE messages SET deleted_at = NOW() WHERE id = $1`
-	_, err = db.GetDB().Exec(ctx, deleteQuery, messageID)
+	deleteQuery := `UPDATE messages SET deleted_at = NOW() WHERE id = $1 RETURNING deleted_at`
+	var deletedAt time.Time
+	err = db.GetDB().QueryRow(ctx, deleteQuery, messageID).Scan(&deletedAt)
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 
+	publishThreadEvent(ctx, threadID, realtime.EventMessageDeleted, map[string]interface{}{
+		"message_id": messageID,
+		"thread_id":  threadID,
+		"deleted_at": deletedAt,
+	})
+
 	return nil
 }
 
@@ -452,16 +500,16 @@ func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID, userID
 // Only allows editing within 3 hours of sending
 func (r *MessageRepository) EditMessage(ctx context.Context, messageID, userID, newContent, newCiphertext string) error {
 	// Check if message exists, user owns it, and it's within 3 hour window
-	var senderID string
+	var senderID, threadID string
 	var createdAt time.Time
 	var deletedAt *time.Time
 
 	checkQuery := `
-		SELECT sender_id, created_at, deleted_at
+		SELECT sender_id, thread_id, created_at, deleted_at
 		FROM messages
 		WHERE id = $1
 	`
-	err := db.GetDB().QueryRow(ctx, checkQuery, messageID).Scan(&senderID, &createdAt, &deletedAt)
+	err := db.GetDB().QueryRow(ctx, checkQuery, messageID).Scan(&senderID, &threadID, &createdAt, &deletedAt)
 	if err != nil {
 		return fmt.Errorf("message not found: %w", err)
 	}
@@ -471,12 +519,12 @@ func (r *MessageRepository) EditMessage(ctx context.Context, messageID, userID,
 	}
 
 	if deletedAt != nil {
-		return fmt.Errorf("cannot edit deleted message")
+		return ErrEditDeletedMessage
 	}
 
 	// Check 3-hour window
-	if time.Since(createdAt) > 3*time.Hour {
-		return fmt.Errorf("cannot edit messages older than 3 hours")
+	if time.Since(createdAt) > messageChangeWindow {
+		return ErrEditWindowExpired
 	}
 
 	// Update message content and set edited_at timestamp
@@ -484,29 +532,66 @@ func (r *MessageRepository) EditMessage(ctx context.Context, messageID, userID,
 		UPDATE messages 
 		SET content = $1, ciphertext = $2, edited_at = NOW() 
 		WHERE id = $3
+		RETURNING edited_at
 	`
-	_, err = db.GetDB().Exec(ctx, updateQuery, newContent, newCiphertext, messageID)
+	var editedAt time.Time
+	err = db.GetDB().QueryRow(ctx, updateQuery, newContent, newCiphertext, messageID).Scan(&editedAt)
 	if err != nil {
 		return fmt.Errorf("failed to edit message: %w", err)
 	}
 
+	publishThreadEvent(ctx, threadID, realtime.EventMessageEdited, map[string]interface{}{
+		"message_id": messageID,
+		"thread_id":  threadID,
+		"content":    newContent,
+		"ciphertext": newCiphertext,
+		"edited_at":  editedAt,
+	})
+
 	return nil
 }
 
-// MarkMessagesAsRead marks all messages in a thread as read for a user
-func (r *MessageRepository) MarkMessagesAsRead(ctx context.Context, threadID, userID string) error {
+// MarkMessagesAsRead marks all messages in a thread as read for a user and reports
+// whether anything was unread
+func (r *MessageRepository) MarkMessagesAsRead(ctx context.Context, threadID, userID string) (bool, error) {
 	query := `UPDATE messages SET is_read = true WHERE thread_id = $1 AND recipient_id = $2 AND is_read = false`
-	_, err := db.GetDB().Exec(ctx, query, threadID, userID)
+	direct, err := db.GetDB().Exec(ctx, query, threadID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to mark messages as read: %w", err)
+		return false, fmt.Errorf("failed to mark messages as read: %w", err)
 	}
-	return nil
+
+	// Group messages have no recipient; each member keeps their own read position,
+	// which only moves when there is something new to read
+	group, err := db.GetDB().Exec(ctx,
+		`UPDATE message_thread_members m SET last_read_at = now()
+		 WHERE m.thread_id = $1 AND m.user_id = $2
+		   AND EXISTS (
+			SELECT 1 FROM messages msg
+			WHERE msg.thread_id = m.thread_id AND msg.sender_id <> m.user_id AND msg.deleted_at IS NULL
+			  AND msg.created_at > COALESCE(m.last_read_at, m.joined_at)
+		   )`,
+		threadID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+
+	changed := direct.RowsAffected() > 0 || group.RowsAffected() > 0
+	if changed {
+		publishThreadEvent(ctx, threadID, realtime.EventMessageRead, map[string]interface{}{
+			"thread_id": threadID,
+			"reader_id": userID,
+			"read_at":   time.Now().UTC(),
+		})
+	}
+	return changed, nil
 }
 
 // GetThread gets a thread by ID
 func (r *MessageRepository) GetThread(ctx context.Context, threadID string) (*models.MessageThread, error) {
 	query := `
-		SELECT id, participant_a_id, participant_b_id, created_at, updated_at
+		SELECT id, COALESCE(participant_a_id::text, ''), COALESCE(participant_b_id::text, ''),
+		       is_group, title, COALESCE(federation_context, ''), created_at, updated_at
 		FROM message_threads
 		WHERE id = $1
 	`
@@ -516,16 +601,52 @@ func (r *MessageRepository) GetThread(ctx context.Context, threadID string) (*mo
 		&thread.ID,
 		&thread.ParticipantAID,
 		&thread.ParticipantBID,
+		&thread.IsGroup,
+		&thread.Title,
+		&thread.FederationContext,
 		&thread.CreatedAt,
 		&thread.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("thread not found")
+		return nil, ErrThreadNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get thread: %w", err)
 	}
 
+	if thread.IsGroup {
+		thread.Members, err = r.GetThreadMembers(ctx, thread.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &thread, nil
 }
+
+// publishThreadEvent pushes a realtime event to everyone in a thread, the acting user's
+// other connections included
+func publishThreadEvent(ctx context.Context, threadID, eventType string, data interface{}) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT participant_a_id::text FROM message_threads WHERE id = $1 AND participant_a_id IS NOT NULL
+		UNION
+		SELECT participant_b_id::text FROM message_threads WHERE id = $1 AND participant_b_id IS NOT NULL
+		UNION
+		SELECT user_id::text FROM message_thread_members WHERE thread_id = $1
+	`, threadID)
+	if err != nil {
+		log.Printf("[Realtime] Failed to resolve thread %s members: %v", threadID, err)
+		return
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	realtime.GetHub().Publish(userIDs, eventType, data)
+}
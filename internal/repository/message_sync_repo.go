@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"splitter/internal/db"
+	"splitter/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDeviceNotApproved is returned when syncing a device that is not an approved device of the user
+var ErrDeviceNotApproved = errors.New("device is not an approved device of this user")
+
+// GetChangesSince returns what changed in userID's conversations after cursor, as seen
+// by one of the user's approved devices: new, edited, deleted and read messages, and the
+// read positions of group members. Messages returned are recorded as delivered to the
+// device, and to the user when they are the recipient.
+func (r *MessageRepository) GetChangesSince(ctx context.Context, userID, deviceID string, cursor models.SyncCursor, limit int) (*models.MessageSyncPage, error) {
+	var did string
+	err := db.GetDB().QueryRow(ctx,
+		`UPDATE user_device_keys dk SET last_seen_at = NOW()
+		 FROM users u
+		 WHERE u.id = dk.user_id AND dk.user_id = $1 AND dk.device_id = $2 AND dk.status = 'approved'
+		 RETURNING u.did`,
+		userID, deviceID,
+	).Scan(&did)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotApproved
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify device: %w", err)
+	}
+
+	// Taken before reading changes, so every transaction below it has finished by then
+	var xmin int64
+	if err := db.GetDB().QueryRow(ctx,
+		`SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`,
+	).Scan(&xmin); err != nil {
+		return nil, fmt.Errorf("failed to get oldest running transaction: %w", err)
+	}
+
+	messages, err := r.getMessageChanges(ctx, userID, did, deviceID, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	readStates, err := r.getReadStateChanges(ctx, userID, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := models.NewMessageSyncPage(messages, readStates, cursor, xmin, limit)
+	if err := r.recordDeviceDeliveries(ctx, userID, deviceID, page.Messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// getMessageChanges returns messages of userID's threads changed after cursor, in order.
+// Group members only see messages sent since they joined.
+func (r *MessageRepository) getMessageChanges(ctx context.Context, userID, did, deviceID string, cursor models.SyncCursor, limit int) ([]*models.MessageChange, error) {
+	query := `
+		SELECT ` + messageColumns + `, change_xid::text::bigint, change_seq
+		FROM messages
+		WHERE (change_xid, change_seq) > ($2::text::xid8, $3)
+		  AND (
+			thread_id IN (SELECT id FROM message_threads WHERE participant_a_id = $1 OR participant_b_id = $1)
+			OR EXISTS (
+				SELECT 1 FROM message_thread_members tm
+				WHERE tm.thread_id = messages.thread_id AND tm.user_id = $1 AND messages.created_at >= tm.joined_at
+			)
+		  )
+		ORDER BY change_xid, change_seq
+		LIMIT $4
+	`
+
+	rows, err := db.GetDB().Query(ctx, query, userID, strconv.FormatInt(cursor.XID, 10), cursor.Seq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.MessageChange{}
+	for rows.Next() {
+		var msg models.Message
+		change := &models.MessageChange{Message: &msg}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.ThreadID,
+			&msg.SenderID,
+			&msg.RecipientID,
+			&msg.ClientMessageID,
+			&msg.Content,
+			&msg.Ciphertext,
+			&msg.EncryptedKeys,
+			&msg.IsRead,
+			&msg.CreatedAt,
+			&msg.ClientCreatedAt,
+			&msg.DeliveredAt,
+			&msg.DeletedAt,
+			&msg.EditedAt,
+			&change.Position.XID,
+			&change.Position.Seq,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan message change: %w", err)
+		}
+
+		if msg.DeletedAt != nil {
+			msg.Content, msg.Ciphertext, msg.EncryptedKeys = "", "", ""
+		} else {
+			var envelopes map[string]string
+			if json.Unmarshal([]byte(msg.EncryptedKeys), &envelopes) == nil {
+				change.DeviceKey = models.DeviceEnvelope(envelopes, did, deviceID)
+			}
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message changes: %w", err)
+	}
+	return changes, nil
+}
+
+// getReadStateChanges returns read positions in userID's group threads changed after cursor, in order
+func (r *MessageRepository) getReadStateChanges(ctx context.Context, userID string, cursor models.SyncCursor, limit int) ([]*models.ReadStateChange, error) {
+	query := `
+		SELECT tm.thread_id, tm.user_id, tm.last_read_at, tm.read_change_xid::text::bigint, tm.read_change_seq
+		FROM message_thread_members tm
+		JOIN message_thread_members me ON me.thread_id = tm.thread_id AND me.user_id = $1
+		WHERE (tm.read_change_xid, tm.read_change_seq) > ($2::text::xid8, $3)
+		ORDER BY tm.read_change_xid, tm.read_change_seq
+		LIMIT $4
+	`
+
+	rows, err := db.GetDB().Query(ctx, query, userID, strconv.FormatInt(cursor.XID, 10), cursor.Seq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get read state changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.ReadStateChange{}
+	for rows.Next() {
+		var change models.ReadStateChange
+		if err := rows.Scan(&change.ThreadID, &change.UserID, &change.LastReadAt, &change.Position.XID, &change.Position.Seq); err != nil {
+			return nil, fmt.Errorf("failed to scan read state change: %w", err)
+		}
+		changes = append(changes, &change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read read state changes: %w", err)
+	}
+	return changes, nil
+}
+
+// recordDeviceDeliveries marks messages as delivered to the device, keeping the time of
+// the first delivery, and sets DeviceDeliveredAt on each change
+func (r *MessageRepository) recordDeviceDeliveries(ctx context.Context, userID, deviceID string, changes []*models.MessageChange) error {
+	messageIDs := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.DeletedAt == nil {
+			messageIDs = append(messageIDs, change.ID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	// The outer SELECT does not see the rows inserted by the CTE, so each message appears once
+	rows, err := db.GetDB().Query(ctx, `
+		WITH inserted AS (
+			INSERT INTO message_device_deliveries (message_id, user_id, device_id)
+			SELECT unnest($1::uuid[]), $2, $3
+			ON CONFLICT DO NOTHING
+			RETURNING message_id, delivered_at
+		)
+		SELECT message_id::text, delivered_at FROM inserted
+		UNION ALL
+		SELECT message_id::text, delivered_at FROM message_device_deliveries
+		WHERE message_id = ANY($1::uuid[]) AND user_id = $2 AND device_id = $3`,
+		messageIDs, userID, deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record device deliveries: %w", err)
+	}
+	deliveredAt := make(map[string]time.Time, len(messageIDs))
+	for rows.Next() {
+		var messageID string
+		var at time.Time
+		if err := rows.Scan(&messageID, &at); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan device delivery: %w", err)
+		}
+		deliveredAt[messageID] = at
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to record device deliveries: %w", err)
+	}
+	for _, change := range changes {
+		if at, ok := deliveredAt[change.ID]; ok {
+			change.DeviceDeliveredAt = &at
+		}
+	}
+
+	// The first device to receive a direct message delivers it to the recipient
+	if _, err := db.GetDB().Exec(ctx,
+		`UPDATE messages SET delivered_at = NOW()
+		 WHERE id = ANY($1::uuid[]) AND recipient_id = $2 AND delivered_at IS NULL`,
+		messageIDs, userID,
+	); err != nil {
+		return fmt.Errorf("failed to mark messages delivered: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"splitter/internal/db"
+	"splitter/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPollNotFound      = errors.New("poll not found")
+	ErrPollClosed        = errors.New("poll is closed")
+	ErrPollAlreadyVoted  = errors.New("already voted in this poll")
+	ErrPollInvalidChoice = errors.New("invalid poll choice")
+)
+
+// insertPoll stores the poll of a new local post inside its creation transaction
+func insertPoll(ctx context.Context, tx pgx.Tx, postID string, poll *models.PollCreate) (*models.Poll, error) {
+	expiresAt := time.Now().UTC().Add(time.Duration(poll.ExpiresInMinutes) * time.Minute)
+	newPoll := models.Poll{PostID: postID, Multiple: poll.Multiple, ExpiresAt: &expiresAt}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO polls (post_id, multiple, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		postID, poll.Multiple, expiresAt,
+	).Scan(&newPoll.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create poll: %w", err)
+	}
+
+	for i, title := range poll.Options {
+		if _, err := tx.Exec(ctx, `INSERT INTO poll_options (poll_id, position, title) VALUES ($1, $2, $3)`, newPoll.ID, i, title); err != nil {
+			return nil, fmt.Errorf("failed to create poll option: %w", err)
+		}
+		newPoll.Options = append(newPoll.Options, models.PollOption{Title: title})
+	}
+	return &newPoll, nil
+}
+
+// GetPoll returns the poll attached to a post with the viewer's own votes (viewerDID may be empty)
+func (r *PostRepository) GetPoll(ctx context.Context, postID, viewerDID string) (*models.Poll, error) {
+	polls, err := r.loadPolls(ctx, []string{postID}, viewerDID)
+	if err != nil {
+		return nil, err
+	}
+	poll, ok := polls[postID]
+	if !ok {
+		return nil, ErrPollNotFound
+	}
+	return poll, nil
+}
+
+// attachPolls sets Poll on the posts that have one
+func (r *PostRepository) attachPolls(ctx context.Context, posts []*models.Post, viewerDID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIDs := make([]string, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	polls, err := r.loadPolls(ctx, postIDs, viewerDID)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Poll = polls[post.ID]
+	}
+	return nil
+}
+
+// loadPolls fetches the polls of the given posts, keyed by post ID
+func (r *PostRepository) loadPolls(ctx context.Context, postIDs []string, viewerDID string) (map[string]*models.Poll, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT p.id::text, p.post_id::text, p.multiple, p.expires_at, p.closed_at, p.voters_count,
+		       o.title, o.votes_count,
+		       EXISTS(SELECT 1 FROM poll_votes v WHERE v.option_id = o.id AND v.voter_did = $2)
+		FROM polls p
+		JOIN poll_options o ON o.poll_id = p.id
+		WHERE p.post_id::text = ANY($1)
+		ORDER BY p.post_id, o.position`,
+		postIDs, viewerDID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get polls: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	polls := make(map[string]*models.Poll)
+	for rows.Next() {
+		var poll models.Poll
+		var option models.PollOption
+		var ownVote bool
+		if err := rows.Scan(&poll.ID, &poll.PostID, &poll.Multiple, &poll.ExpiresAt, &poll.ClosedAt, &poll.VotersCount,
+			&option.Title, &option.VotesCount, &ownVote); err != nil {
+			return nil, fmt.Errorf("failed to scan poll: %w", err)
+		}
+
+		existing, ok := polls[poll.PostID]
+		if !ok {
+			poll.Expired = poll.ClosedAt != nil || (poll.ExpiresAt != nil && !poll.ExpiresAt.After(now))
+			existing = &poll
+			polls[poll.PostID] = existing
+		}
+		if ownVote {
+			existing.Voted = true
+			existing.OwnVotes = append(existing.OwnVotes, len(existing.Options))
+		}
+		existing.Options = append(existing.Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read polls: %w", err)
+	}
+	return polls, nil
+}
+
+// VotePoll records the choices (option indexes) of a voter. Local voters vote once with all
+// their choices; remote voters send one vote Note per choice, so on a multiple choice poll
+// each remote vote adds a choice. originalVoteURI is the id of the remote vote Note.
+func (r *PostRepository) VotePoll(ctx context.Context, postID, voterDID string, choices []int, originalVoteURI string) error {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var pollID string
+	var multiple bool
+	var expiresAt, closedAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT p.id::text, p.multiple, p.expires_at, p.closed_at
+		FROM polls p
+		JOIN posts ON posts.id = p.post_id
+		WHERE p.post_id = $1 AND posts.deleted_at IS NULL
+		FOR UPDATE OF p`,
+		postID,
+	).Scan(&pollID, &multiple, &expiresAt, &closedAt)
+	if err == pgx.ErrNoRows {
+		return ErrPollNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get poll: %w", err)
+	}
+	if closedAt != nil || (expiresAt != nil && !expiresAt.After(time.Now())) {
+		return ErrPollClosed
+	}
+
+	var optionCount int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM poll_options WHERE poll_id = $1`, pollID).Scan(&optionCount); err != nil {
+		return fmt.Errorf("failed to count poll options: %w", err)
+	}
+	if len(choices) == 0 || (!multiple && len(choices) > 1) {
+		return ErrPollInvalidChoice
+	}
+	seen := make(map[int]bool, len(choices))
+	for _, choice := range choices {
+		if choice < 0 || choice >= optionCount || seen[choice] {
+			return ErrPollInvalidChoice
+		}
+		seen[choice] = true
+	}
+
+	var previous []int
+	rows, err := tx.Query(ctx, `
+		SELECT o.position FROM poll_votes v JOIN poll_options o ON o.id = v.option_id
+		WHERE v.poll_id = $1 AND v.voter_did = $2`,
+		pollID, voterDID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get previous votes: %w", err)
+	}
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan previous vote: %w", err)
+		}
+		previous = append(previous, position)
+	}
+	rows.Close()
+	if len(previous) > 0 {
+		if !multiple || originalVoteURI == "" {
+			return ErrPollAlreadyVoted
+		}
+		for _, position := range previous {
+			if seen[position] {
+				return ErrPollAlreadyVoted
+			}
+		}
+	}
+
+	for _, choice := range choices {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO poll_votes (poll_id, option_id, voter_did, original_vote_uri)
+			SELECT $1, id, $3, NULLIF($4, '') FROM poll_options WHERE poll_id = $1 AND position = $2`,
+			pollID, choice, voterDID, originalVoteURI,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record vote: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE poll_options SET votes_count = votes_count + 1 WHERE poll_id = $1 AND position = $2`, pollID, choice); err != nil {
+			return fmt.Errorf("failed to count vote: %w", err)
+		}
+	}
+	if len(previous) == 0 {
+		if _, err := tx.Exec(ctx, `UPDATE polls SET voters_count = voters_count + 1 WHERE id = $1`, pollID); err != nil {
+			return fmt.Errorf("failed to count voter: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CloseExpiredPolls closes the expired polls of local posts, recounting their results
+// from the recorded votes. Returns the IDs of the posts whose poll was closed.
+func (r *PostRepository) CloseExpiredPolls(ctx context.Context) ([]string, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE polls p
+		SET closed_at = now(),
+		    voters_count = (SELECT COUNT(DISTINCT voter_did) FROM poll_votes v WHERE v.poll_id = p.id)
+		FROM posts
+		WHERE posts.id = p.post_id AND posts.is_remote = false
+		  AND p.closed_at IS NULL AND p.expires_at <= now()
+		RETURNING p.id::text, p.post_id::text`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close expired polls: %w", err)
+	}
+	var pollIDs, postIDs []string
+	for rows.Next() {
+		var pollID, postID string
+		if err := rows.Scan(&pollID, &postID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan closed poll: %w", err)
+		}
+		pollIDs = append(pollIDs, pollID)
+		postIDs = append(postIDs, postID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read closed polls: %w", err)
+	}
+
+	if len(pollIDs) > 0 {
+		_, err := tx.Exec(ctx, `
+			UPDATE poll_options o
+			SET votes_count = (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)
+			WHERE o.poll_id::text = ANY($1)`,
+			pollIDs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to recount poll results: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return postIDs, nil
+}
+
+// GetPollRemoteVoters returns the remote actors that voted in the poll of a post
+func (r *PostRepository) GetPollRemoteVoters(ctx context.Context, postID string) ([]string, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT DISTINCT v.voter_did
+		FROM poll_votes v
+		JOIN polls p ON p.id = v.poll_id
+		WHERE p.post_id = $1 AND v.original_vote_uri IS NOT NULL`,
+		postID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get poll voters: %w", err)
+	}
+	defer rows.Close()
+
+	var voters []string
+	for rows.Next() {
+		var voter string
+		if err := rows.Scan(&voter); err != nil {
+			return nil, fmt.Errorf("failed to scan poll voter: %w", err)
+		}
+		voters = append(voters, voter)
+	}
+	return voters, rows.Err()
+}
+
+// UpsertRemotePoll stores or refreshes the poll of a cached remote post from its Question.
+// The counts are the author's; options beyond the new list are dropped.
+func (r *PostRepository) UpsertRemotePoll(ctx context.Context, postID string, poll *models.Poll) error {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var pollID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO polls (post_id, multiple, expires_at, closed_at, voters_count)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (post_id) DO UPDATE
+		SET multiple = EXCLUDED.multiple, expires_at = EXCLUDED.expires_at,
+		    closed_at = EXCLUDED.closed_at, voters_count = EXCLUDED.voters_count
+		RETURNING id::text`,
+		postID, poll.Multiple, poll.ExpiresAt, poll.ClosedAt, poll.VotersCount,
+	).Scan(&pollID)
+	if err != nil {
+		return fmt.Errorf("failed to store remote poll: %w", err)
+	}
+
+	for i, option := range poll.Options {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO poll_options (poll_id, position, title, votes_count)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (poll_id, position) DO UPDATE
+			SET title = EXCLUDED.title, votes_count = EXCLUDED.votes_count`,
+			pollID, i, option.Title, option.VotesCount,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store remote poll option: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM poll_options WHERE poll_id = $1 AND position >= $2`, pollID, len(poll.Options)); err != nil {
+		return fmt.Errorf("failed to prune remote poll options: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
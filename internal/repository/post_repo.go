@@ -18,6 +18,7 @@ type PostFederationMeta struct {
 	AuthorDID       string
 	OriginalPostURI string
 	IsRemote        bool
+	Visibility      string
 }
 
 // NewPostRepository creates a new PostRepository
@@ -45,9 +46,9 @@ func (r *PostRepository) Create(ctx context.Context, authorDID string, post *mod
 	defer tx.Rollback(ctx)
 
 	query := `
-		INSERT INTO posts (author_did, content, visibility, expires_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, author_did, content, visibility, is_remote, created_at, updated_at, expires_at
+		INSERT INTO posts (author_did, content, visibility, expires_at, content_warning, sensitive)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id, author_did, content, COALESCE(content_warning, ''), sensitive, visibility, is_remote, created_at, updated_at, expires_at
 	`
 
 	var newPost models.Post
@@ -56,10 +57,14 @@ func (r *PostRepository) Create(ctx context.Context, authorDID string, post *mod
 		post.Content,
 		visibility,
 		expiresAt,
+		post.ContentWarning,
+		post.Sensitive || post.ContentWarning != "",
 	).Scan(
 		&newPost.ID,
 		&newPost.AuthorDID,
 		&newPost.Content,
+		&newPost.ContentWarning,
+		&newPost.Sensitive,
 		&newPost.Visibility,
 		&newPost.IsRemote,
 		&newPost.CreatedAt,
@@ -96,6 +101,14 @@ func (r *PostRepository) Create(ctx context.Context, authorDID string, post *mod
 		newPost.Media = []models.Media{media}
 	}
 
+	if post.Poll != nil {
+		poll, err := insertPoll(ctx, tx, newPost.ID, post.Poll)
+		if err != nil {
+			return nil, err
+		}
+		newPost.Poll = poll
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -130,6 +143,7 @@ func (r *PostRepository) GetByID(ctx context.Context, id string) (*models.Post,
 		SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 		       COALESCE(p.original_post_uri, ''), COALESCE(p.in_reply_to_uri, ''),
 		       p.created_at, p.updated_at, p.expires_at,
+		       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 		       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 		       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 		       p.direct_reply_count, p.total_reply_count,
@@ -156,6 +170,9 @@ func (r *PostRepository) GetByID(ctx context.Context, id string) (*models.Post,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.ExpiresAt,
+		&post.ContentWarning,
+		&post.Sensitive,
+		&post.ContentHTML,
 		&post.Username,
 		&post.AvatarURL,
 		&post.LikeCount,
@@ -184,6 +201,10 @@ func (r *PostRepository) GetByID(ctx context.Context, id string) (*models.Post,
 		}}
 	}
 
+	if err := r.attachPolls(ctx, []*models.Post{&post}, ""); err != nil {
+		return nil, err
+	}
+
 	return &post, nil
 }
 
@@ -193,6 +214,7 @@ func (r *PostRepository) GetByOriginalURI(ctx context.Context, originalURI strin
 		SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 		       COALESCE(p.original_post_uri, ''), COALESCE(p.in_reply_to_uri, ''),
 		       p.created_at, p.updated_at, p.expires_at,
+		       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 		       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 		       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 		       p.direct_reply_count, p.total_reply_count,
@@ -221,6 +243,9 @@ func (r *PostRepository) GetByOriginalURI(ctx context.Context, originalURI strin
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.ExpiresAt,
+		&post.ContentWarning,
+		&post.Sensitive,
+		&post.ContentHTML,
 		&post.Username,
 		&post.AvatarURL,
 		&post.LikeCount,
@@ -253,7 +278,7 @@ func (r *PostRepository) GetByOriginalURI(ctx context.Context, originalURI strin
 }
 
 // CreateRemoteCachedPost inserts a remote post fetched on demand for thread context.
-func (r *PostRepository) CreateRemoteCachedPost(ctx context.Context, authorDID, content, originalURI, inReplyToURI string, createdAt time.Time) (*models.Post, error) {
+func (r *PostRepository) CreateRemoteCachedPost(ctx context.Context, authorDID, content, contentHTML, originalURI, inReplyToURI string, createdAt time.Time) (*models.Post, error) {
 	if originalURI == "" {
 		return nil, fmt.Errorf("original URI is required")
 	}
@@ -267,8 +292,8 @@ func (r *PostRepository) CreateRemoteCachedPost(ctx context.Context, authorDID,
 			ORDER BY created_at DESC
 			LIMIT 1
 		), inserted AS (
-			INSERT INTO posts (author_did, content, visibility, is_remote, original_post_uri, in_reply_to_uri, created_at)
-			SELECT $2, $3, 'public', true, $1, NULLIF($4, ''), $5
+			INSERT INTO posts (author_did, content, content_html, visibility, is_remote, original_post_uri, in_reply_to_uri, created_at)
+			SELECT $2, $3, NULLIF($4, ''), 'public', true, $1, NULLIF($5, ''), $6
 			WHERE NOT EXISTS (SELECT 1 FROM existing)
 			RETURNING id::text AS id
 		)
@@ -276,7 +301,7 @@ func (r *PostRepository) CreateRemoteCachedPost(ctx context.Context, authorDID,
 		UNION ALL
 		SELECT id FROM existing
 		LIMIT 1
-	`, originalURI, authorDID, content, inReplyToURI, createdAt.UTC()).Scan(&id)
+	`, originalURI, authorDID, content, contentHTML, inReplyToURI, createdAt.UTC()).Scan(&id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to cache remote post: %w", err)
 	}
@@ -289,6 +314,7 @@ func (r *PostRepository) GetByAuthorDID(ctx context.Context, authorDID string, l
 	query := `
 		SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 		       p.created_at, p.updated_at, p.expires_at,
+		       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 		       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 		       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 		       p.direct_reply_count, p.total_reply_count
@@ -296,6 +322,7 @@ func (r *PostRepository) GetByAuthorDID(ctx context.Context, authorDID string, l
 		LEFT JOIN users u ON p.author_did = u.did
 		WHERE p.author_did = $1 AND p.deleted_at IS NULL
 		  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+		  AND (p.is_remote = false OR p.visibility = 'public')
 		ORDER BY p.created_at DESC
 		LIMIT $2 OFFSET $3
 	`
@@ -318,6 +345,9 @@ func (r *PostRepository) GetByAuthorDID(ctx context.Context, authorDID string, l
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&post.ExpiresAt,
+			&post.ContentWarning,
+			&post.Sensitive,
+			&post.ContentHTML,
 			&post.Username,
 			&post.AvatarURL,
 			&post.LikeCount,
@@ -329,6 +359,10 @@ func (r *PostRepository) GetByAuthorDID(ctx context.Context, authorDID string, l
 		posts = append(posts, &post)
 	}
 
+	if err := r.attachPolls(ctx, posts, ""); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -337,6 +371,7 @@ func (r *PostRepository) GetFeed(ctx context.Context, userDID string, limit, off
 	query := `
 		SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 		       p.created_at, p.updated_at, p.expires_at,
+		       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 		       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 		       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 		       COALESCE((SELECT COUNT(*) > 0 FROM interactions WHERE post_id = p.id AND actor_did = $1 AND interaction_type = 'like'), false) as liked_by_user,
@@ -348,17 +383,22 @@ func (r *PostRepository) GetFeed(ctx context.Context, userDID string, limit, off
 		LEFT JOIN users u ON p.author_did = u.did
 		LEFT JOIN follows f ON p.author_did = f.following_did AND f.follower_did = $1
 		LEFT JOIN media m ON p.id = m.post_id
-		WHERE (f.follower_did = $1 OR p.author_did = $1) AND p.deleted_at IS NULL
+		WHERE (f.follower_did = $1 OR p.author_did = $1
+		       OR EXISTS (SELECT 1 FROM post_audience pa WHERE pa.post_id = p.id AND pa.recipient_did = $1))
+		  AND p.deleted_at IS NULL
 		  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM actor_blocks ab WHERE ab.blocker_did = p.author_did AND ab.blocked_did = $1)
 		  AND (
 		    p.author_did = $1
 		    OR p.visibility = 'public'
 		    OR (p.visibility = 'followers' AND f.follower_did = $1)
-		    OR (p.visibility = 'circle' AND EXISTS (
+		    OR (p.visibility = 'circle' AND p.is_remote = false AND EXISTS (
 		        SELECT 1 FROM circle_members cm
 		        JOIN users u_owner  ON cm.owner_id  = u_owner.id  AND u_owner.did  = p.author_did
 		        JOIN users u_viewer ON cm.member_id = u_viewer.id AND u_viewer.did = $1
 		    ))
+		    -- Non-public remote posts are shown to the local users they were addressed to
+		    OR (p.is_remote = true AND EXISTS (SELECT 1 FROM post_audience pa WHERE pa.post_id = p.id AND pa.recipient_did = $1))
 		  )
 		ORDER BY p.created_at DESC
 		LIMIT $2 OFFSET $3
@@ -385,6 +425,9 @@ func (r *PostRepository) GetFeed(ctx context.Context, userDID string, limit, off
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&post.ExpiresAt,
+			&post.ContentWarning,
+			&post.Sensitive,
+			&post.ContentHTML,
 			&post.Username,
 			&post.AvatarURL,
 			&post.LikeCount,
@@ -412,6 +455,10 @@ func (r *PostRepository) GetFeed(ctx context.Context, userDID string, limit, off
 		posts = append(posts, &post)
 	}
 
+	if err := r.attachPolls(ctx, posts, userDID); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -429,6 +476,7 @@ func (r *PostRepository) GetPublicFeedWithUser(ctx context.Context, userDID stri
 		query = `
 			SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 			       p.created_at, p.updated_at, p.expires_at,
+			       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 			       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 			       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 			       COALESCE((SELECT COUNT(*) > 0 FROM interactions WHERE post_id = p.id AND actor_did = $1 AND interaction_type = 'like'), false) as liked_by_user,
@@ -440,7 +488,8 @@ func (r *PostRepository) GetPublicFeedWithUser(ctx context.Context, userDID stri
 			LEFT JOIN users u ON p.author_did = u.did
 			LEFT JOIN media m ON p.id = m.post_id
 			WHERE p.visibility = 'public' AND p.deleted_at IS NULL
-			  AND (p.expires_at IS NULL OR p.expires_at > NOW())` + localFilterClause + `
+			  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+			  AND NOT EXISTS (SELECT 1 FROM actor_blocks ab WHERE ab.blocker_did = p.author_did AND ab.blocked_did = $1)` + localFilterClause + `
 			ORDER BY p.created_at DESC
 			LIMIT $2 OFFSET $3
 		`
@@ -450,6 +499,7 @@ func (r *PostRepository) GetPublicFeedWithUser(ctx context.Context, userDID stri
 		query = `
 			SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 			       p.created_at, p.updated_at, p.expires_at,
+			       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 			       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 			       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 			       false as liked_by_user,
@@ -489,6 +539,9 @@ func (r *PostRepository) GetPublicFeedWithUser(ctx context.Context, userDID stri
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&post.ExpiresAt,
+			&post.ContentWarning,
+			&post.Sensitive,
+			&post.ContentHTML,
 			&post.Username,
 			&post.AvatarURL,
 			&post.LikeCount,
@@ -516,6 +569,10 @@ func (r *PostRepository) GetPublicFeedWithUser(ctx context.Context, userDID stri
 		posts = append(posts, &post)
 	}
 
+	if err := r.attachPolls(ctx, posts, userDID); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -524,8 +581,26 @@ func (r *PostRepository) GetPublicFeed(ctx context.Context, limit, offset int) (
 	return r.GetPublicFeedWithUser(ctx, "", limit, offset, false)
 }
 
-// Update updates a post's content
+// Update updates a post. The version being replaced is kept in post_revisions when the content changes.
 func (r *PostRepository) Update(ctx context.Context, postID, authorDID string, update *models.PostUpdate) (*models.Post, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO post_revisions (post_id, content, content_html, content_warning, sensitive, created_at)
+		SELECT id, content, content_html, content_warning, sensitive, COALESCE(updated_at, created_at)
+		FROM posts
+		WHERE id = $1 AND author_did = $2 AND deleted_at IS NULL
+		  AND $3::text IS NOT NULL AND content IS DISTINCT FROM $3::text`,
+		postID, authorDID, update.Content,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record post revision: %w", err)
+	}
+
 	query := `
 		UPDATE posts
 		SET 
@@ -537,7 +612,7 @@ func (r *PostRepository) Update(ctx context.Context, postID, authorDID string, u
 	`
 
 	var post models.Post
-	err := db.GetDB().QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		update.Content,
 		update.Visibility,
 		postID,
@@ -561,9 +636,88 @@ func (r *PostRepository) Update(ctx context.Context, postID, authorDID string, u
 		return nil, fmt.Errorf("failed to update post: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return &post, nil
 }
 
+// UpdateRemote applies an Update(Note) to a cached remote post, keeping the replaced version.
+// Only the original author's edits apply, and an edit older than the stored one is ignored,
+// as is an Update that leaves the content unchanged (such as a poll count refresh).
+// Returns false when no matching post was changed.
+func (r *PostRepository) UpdateRemote(ctx context.Context, originalURI, authorDID, content, contentHTML, contentWarning string, sensitive bool, updatedAt time.Time) (bool, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO post_revisions (post_id, content, content_html, content_warning, sensitive, created_at)
+		SELECT id, content, content_html, content_warning, sensitive, COALESCE(updated_at, created_at)
+		FROM posts
+		WHERE original_post_uri = $1 AND author_did = $2 AND deleted_at IS NULL
+		  AND (updated_at IS NULL OR updated_at < $3)
+		  AND (content IS DISTINCT FROM $4 OR COALESCE(content_warning, '') <> $5 OR sensitive <> $6)`,
+		originalURI, authorDID, updatedAt.UTC(), content, contentWarning, sensitive,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record post revision: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE posts
+		SET content = $3, content_html = NULLIF($4, ''), content_warning = NULLIF($5, ''), sensitive = $6, updated_at = $7
+		WHERE original_post_uri = $1 AND author_did = $2 AND deleted_at IS NULL
+		  AND (updated_at IS NULL OR updated_at < $7)
+		  AND (content IS DISTINCT FROM $3 OR COALESCE(content_warning, '') <> $5 OR sensitive <> $6)`,
+		originalURI, authorDID, content, contentHTML, contentWarning, sensitive, updatedAt.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update remote post: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetRevisions returns the earlier versions of a post, oldest first
+func (r *PostRepository) GetRevisions(ctx context.Context, postID string) ([]*models.PostRevision, error) {
+	rows, err := db.GetDB().Query(ctx, `
+		SELECT id::text, post_id::text, content, COALESCE(content_html, ''), COALESCE(content_warning, ''), sensitive, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY created_at ASC, recorded_at ASC`,
+		postID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []*models.PostRevision{}
+	for rows.Next() {
+		var revision models.PostRevision
+		if err := rows.Scan(
+			&revision.ID,
+			&revision.PostID,
+			&revision.Content,
+			&revision.ContentHTML,
+			&revision.ContentWarning,
+			&revision.Sensitive,
+			&revision.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan post revision: %w", err)
+		}
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
 // Delete soft-deletes a post
 func (r *PostRepository) Delete(ctx context.Context, postID, authorDID string, isAdmin bool) error {
 	var query string
@@ -595,13 +749,13 @@ func (r *PostRepository) Delete(ctx context.Context, postID, authorDID string, i
 
 func (r *PostRepository) GetFederationMeta(ctx context.Context, postID string) (*PostFederationMeta, error) {
 	query := `
-		SELECT author_did, COALESCE(original_post_uri, ''), is_remote
+		SELECT author_did, COALESCE(original_post_uri, ''), is_remote, COALESCE(visibility, 'public')
 		FROM posts
 		WHERE id = $1
 	`
 
 	var meta PostFederationMeta
-	err := db.GetDB().QueryRow(ctx, query, postID).Scan(&meta.AuthorDID, &meta.OriginalPostURI, &meta.IsRemote)
+	err := db.GetDB().QueryRow(ctx, query, postID).Scan(&meta.AuthorDID, &meta.OriginalPostURI, &meta.IsRemote, &meta.Visibility)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("post not found")
 	}
@@ -658,7 +812,8 @@ func (r *PostRepository) GetTrendingHashtags(ctx context.Context, limit int) ([]
 	return trending, nil
 }
 
-// GetPostsByHashtag returns posts containing a specific hashtag
+// GetPostsByHashtag returns posts containing a specific hashtag, either in their text or,
+// for federated posts whose HTML content does not match, in their Hashtag tags
 func (r *PostRepository) GetPostsByHashtag(ctx context.Context, tag string, userDID string, limit, offset int) ([]*models.Post, error) {
 	// In PostgreSQL POSIX regex, \y is the word boundary marker, not \b
 	pattern := `#` + tag + `\y`
@@ -670,6 +825,7 @@ func (r *PostRepository) GetPostsByHashtag(ctx context.Context, tag string, user
 		query = `
 			SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 			       p.created_at, p.updated_at, p.expires_at,
+			       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 			       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 			       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 			       COALESCE((SELECT COUNT(*) > 0 FROM interactions WHERE post_id = p.id AND actor_did = $1 AND interaction_type = 'like'), false) as liked_by_user,
@@ -680,18 +836,19 @@ func (r *PostRepository) GetPostsByHashtag(ctx context.Context, tag string, user
 			FROM posts p
 			LEFT JOIN users u ON p.author_did = u.did
 			LEFT JOIN media m ON p.id = m.post_id
-			WHERE p.content ~* $2
+			WHERE (p.content ~* $2 OR EXISTS (SELECT 1 FROM post_hashtags ph WHERE ph.post_id = p.id AND ph.tag = LOWER($5)))
 			  AND p.deleted_at IS NULL
 			  AND p.visibility = 'public'
 			  AND (p.expires_at IS NULL OR p.expires_at > NOW())
 			ORDER BY p.created_at DESC
 			LIMIT $3 OFFSET $4
 		`
-		args = []interface{}{userDID, pattern, limit, offset}
+		args = []interface{}{userDID, pattern, limit, offset, tag}
 	} else {
 		query = `
 			SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
 			       p.created_at, p.updated_at, p.expires_at,
+			       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
 			       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
 			       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
 			       false as liked_by_user,
@@ -702,14 +859,14 @@ func (r *PostRepository) GetPostsByHashtag(ctx context.Context, tag string, user
 			FROM posts p
 			LEFT JOIN users u ON p.author_did = u.did
 			LEFT JOIN media m ON p.id = m.post_id
-			WHERE p.content ~* $1
+			WHERE (p.content ~* $1 OR EXISTS (SELECT 1 FROM post_hashtags ph WHERE ph.post_id = p.id AND ph.tag = LOWER($4)))
 			  AND p.deleted_at IS NULL
 			  AND p.visibility = 'public'
 			  AND (p.expires_at IS NULL OR p.expires_at > NOW())
 			ORDER BY p.created_at DESC
 			LIMIT $2 OFFSET $3
 		`
-		args = []interface{}{pattern, limit, offset}
+		args = []interface{}{pattern, limit, offset, tag}
 	}
 
 	rows, err := db.GetDB().Query(ctx, query, args...)
@@ -733,6 +890,9 @@ func (r *PostRepository) GetPostsByHashtag(ctx context.Context, tag string, user
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&post.ExpiresAt,
+			&post.ContentWarning,
+			&post.Sensitive,
+			&post.ContentHTML,
 			&post.Username,
 			&post.AvatarURL,
 			&post.LikeCount,
@@ -814,14 +974,184 @@ func (r *PostRepository) CountPostsByHashtag(ctx context.Context, tag string) (i
 	var count int
 	err := db.GetDB().QueryRow(ctx, `
 		SELECT COUNT(*)
-		FROM posts
-		WHERE content ~* $1
+		FROM posts p
+		WHERE (p.content ~* $1 OR EXISTS (SELECT 1 FROM post_hashtags ph WHERE ph.post_id = p.id AND ph.tag = LOWER($2)))
 		  AND deleted_at IS NULL
 		  AND visibility = 'public'
 		  AND (expires_at IS NULL OR expires_at > NOW())
-	`, pattern).Scan(&count)
+	`, pattern, tag).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count posts by hashtag: %w", err)
 	}
 	return count, nil
 }
+
+// AddMentions records the local users a post mentions
+func (r *PostRepository) AddMentions(ctx context.Context, postID string, userDIDs []string) error {
+	for _, did := range userDIDs {
+		_, err := db.GetDB().Exec(ctx,
+			`INSERT INTO post_mentions (post_id, mentioned_did) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			postID, did,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add mention: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddAudience records the local users a non-public remote post was addressed to
+func (r *PostRepository) AddAudience(ctx context.Context, postID string, userDIDs []string) error {
+	for _, did := range userDIDs {
+		_, err := db.GetDB().Exec(ctx,
+			`INSERT INTO post_audience (post_id, recipient_did) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			postID, did,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add post audience: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetMentions returns posts that mention the given user, newest first
+func (r *PostRepository) GetMentions(ctx context.Context, userDID string, limit, offset int) ([]*models.Post, error) {
+	query := `
+		SELECT p.id, p.author_did, p.content, p.visibility, p.is_remote,
+		       p.created_at, p.updated_at, p.expires_at,
+		       COALESCE(p.content_warning, ''), p.sensitive, COALESCE(p.content_html, ''),
+		       COALESCE(u.username, '') as username, COALESCE(u.avatar_url, '') as avatar_url,
+		       COALESCE((SELECT COUNT(*) FROM interactions WHERE post_id = p.id AND interaction_type = 'like'), 0) as like_count,
+		       p.direct_reply_count, p.total_reply_count
+		FROM post_mentions pm
+		JOIN posts p ON p.id = pm.post_id
+		LEFT JOIN users u ON p.author_did = u.did
+		WHERE pm.mentioned_did = $1 AND p.deleted_at IS NULL
+		  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM actor_blocks ab WHERE ab.blocker_did = p.author_did AND ab.blocked_did = $1)
+		ORDER BY pm.created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := db.GetDB().Query(ctx, query, userDID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(
+			&post.ID,
+			&post.AuthorDID,
+			&post.Content,
+			&post.Visibility,
+			&post.IsRemote,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.ExpiresAt,
+			&post.ContentWarning,
+			&post.Sensitive,
+			&post.ContentHTML,
+			&post.Username,
+			&post.AvatarURL,
+			&post.LikeCount,
+			&post.DirectReplyCount,
+			&post.TotalReplyCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+		posts = append(posts, &post)
+	}
+
+	return posts, nil
+}
+
+// OutboxEntry is a public activity by a local user, as listed in their ActivityPub outbox
+type OutboxEntry struct {
+	Kind            string // "create" or "announce"
+	ActivityKey     string // post ID for creates, interaction ID for announces
+	PostID          string
+	Content         string
+	ContentWarning  string
+	Sensitive       bool
+	IsRemote        bool
+	OriginalPostURI string
+	InReplyToURI    string
+	MediaURL        string
+	PostCreatedAt   time.Time
+	ActivityAt      time.Time
+}
+
+const outboxEntriesQuery = `
+	SELECT 'create' AS kind, p.id::text AS activity_key, p.id::text AS post_id, COALESCE(p.content, '') AS content,
+	       COALESCE(p.content_warning, '') AS content_warning, p.sensitive,
+	       p.is_remote, COALESCE(p.original_post_uri, '') AS original_post_uri, COALESCE(p.in_reply_to_uri, '') AS in_reply_to_uri,
+	       COALESCE((SELECT m.media_url FROM media m WHERE m.post_id = p.id ORDER BY m.created_at ASC LIMIT 1), '') AS media_url,
+	       p.created_at AS post_created_at, p.created_at AS activity_at
+	FROM posts p
+	WHERE p.author_did = $1
+	  AND p.is_remote = false
+	  AND p.visibility = 'public'
+	  AND p.deleted_at IS NULL
+	  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+	UNION ALL
+	SELECT 'announce', i.id::text, p.id::text, COALESCE(p.content, ''),
+	       COALESCE(p.content_warning, ''), p.sensitive, p.is_remote,
+	       COALESCE(p.original_post_uri, ''), COALESCE(p.in_reply_to_uri, ''), '',
+	       p.created_at, i.created_at
+	FROM interactions i
+	INNER JOIN posts p ON p.id = i.post_id
+	WHERE i.actor_did = $1
+	  AND i.interaction_type = 'repost'
+	  AND p.visibility = 'public'
+	  AND p.deleted_at IS NULL
+	  AND (p.expires_at IS NULL OR p.expires_at > NOW())
+`
+
+// CountOutboxEntries returns the number of public Create/Announce activities of a user
+func (r *PostRepository) CountOutboxEntries(ctx context.Context, authorDID string) (int, error) {
+	var count int
+	err := db.GetDB().QueryRow(ctx, `SELECT COUNT(*) FROM (`+outboxEntriesQuery+`) entries`, authorDID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count outbox entries: %w", err)
+	}
+	return count, nil
+}
+
+// GetOutboxEntries returns a user's public posts and reposts, newest activity first
+func (r *PostRepository) GetOutboxEntries(ctx context.Context, authorDID string, limit, offset int) ([]*OutboxEntry, error) {
+	rows, err := db.GetDB().Query(ctx,
+		`SELECT * FROM (`+outboxEntriesQuery+`) entries ORDER BY activity_at DESC, activity_key DESC LIMIT $2 OFFSET $3`,
+		authorDID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		if err := rows.Scan(
+			&entry.Kind,
+			&entry.ActivityKey,
+			&entry.PostID,
+			&entry.Content,
+			&entry.ContentWarning,
+			&entry.Sensitive,
+			&entry.IsRemote,
+			&entry.OriginalPostURI,
+			&entry.InReplyToURI,
+			&entry.MediaURL,
+			&entry.PostCreatedAt,
+			&entry.ActivityAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"splitter/internal/db"
+	"splitter/internal/models"
+	"splitter/internal/realtime"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrTooManyPrekeys is returned when an upload would leave a device with more than
+// models.PrekeyMaxAvailable unclaimed one-time prekeys
+var ErrTooManyPrekeys = fmt.Errorf("device would hold more than %d unclaimed one-time prekeys", models.PrekeyMaxAvailable)
+
+// claimedPrekeyRetention is how long handed out one-time prekeys are kept, so repeated
+// key IDs of a device are not accepted again while sessions built on them are young
+const claimedPrekeyRetention = 30 * 24 * time.Hour
+
+// PrekeyRepository handles database operations for device prekey bundles.
+type PrekeyRepository struct{}
+
+// NewPrekeyRepository creates a new PrekeyRepository.
+func NewPrekeyRepository() *PrekeyRepository {
+	return &PrekeyRepository{}
+}
+
+// GetApprovedDeviceDID returns the DID of the user when deviceID is one of their
+// approved devices
+func (r *PrekeyRepository) GetApprovedDeviceDID(ctx context.Context, userID, deviceID string) (string, error) {
+	var did string
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT COALESCE(u.did, '') FROM user_device_keys dk JOIN users u ON u.id = dk.user_id
+		 WHERE dk.user_id = $1 AND dk.device_id = $2 AND dk.status = 'approved'`,
+		userID, deviceID,
+	).Scan(&did)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrDeviceNotApproved
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to verify device: %w", err)
+	}
+	return did, nil
+}
+
+// UploadPrekeys stores prekeys of one of the user's approved devices. A new signed
+// prekey replaces the previous one; one-time prekeys are added to those not yet claimed,
+// skipping key IDs the device already used.
+func (r *PrekeyRepository) UploadPrekeys(ctx context.Context, userID, deviceID string, upload *models.PrekeyUpload) (*models.PrekeyStatus, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the device serializes uploads, so the available count below stays accurate
+	var identityKey string
+	err = tx.QueryRow(ctx,
+		`SELECT encryption_public_key FROM user_device_keys
+		 WHERE user_id = $1 AND device_id = $2 AND status = 'approved'
+		 FOR UPDATE`,
+		userID, deviceID,
+	).Scan(&identityKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotApproved
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify device: %w", err)
+	}
+
+	if spk := upload.SignedPrekey; spk != nil {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO device_signed_prekeys (user_id, device_id, key_id, public_key, signature, identity_key)
+			 VALUES ($1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (user_id, device_id, key_id)
+			 DO UPDATE SET public_key = EXCLUDED.public_key, signature = EXCLUDED.signature,
+			               identity_key = EXCLUDED.identity_key, created_at = NOW()`,
+			userID, deviceID, spk.KeyID, spk.PublicKey, spk.Signature, identityKey,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store signed prekey: %w", err)
+		}
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM device_signed_prekeys WHERE user_id = $1 AND device_id = $2 AND key_id <> $3`,
+			userID, deviceID, spk.KeyID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to remove old signed prekeys: %w", err)
+		}
+	}
+
+	if len(upload.OneTimePrekeys) > 0 {
+		var available int
+		if err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM device_one_time_prekeys
+			 WHERE user_id = $1 AND device_id = $2 AND claimed_at IS NULL`,
+			userID, deviceID,
+		).Scan(&available); err != nil {
+			return nil, fmt.Errorf("failed to count one-time prekeys: %w", err)
+		}
+		if available+len(upload.OneTimePrekeys) > models.PrekeyMaxAvailable {
+			return nil, ErrTooManyPrekeys
+		}
+
+		keyIDs := make([]int32, 0, len(upload.OneTimePrekeys))
+		publicKeys := make([]string, 0, len(upload.OneTimePrekeys))
+		for _, otk := range upload.OneTimePrekeys {
+			keyIDs = append(keyIDs, int32(otk.KeyID))
+			publicKeys = append(publicKeys, otk.PublicKey)
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO device_one_time_prekeys (user_id, device_id, key_id, public_key)
+			 SELECT $1, $2, unnest($3::int[]), unnest($4::text[])
+			 ON CONFLICT DO NOTHING`,
+			userID, deviceID, keyIDs, publicKeys,
+		); err != nil {
+			return nil, fmt.Errorf("failed to store one-time prekeys: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM device_one_time_prekeys
+		 WHERE user_id = $1 AND device_id = $2 AND claimed_at < $3`,
+		userID, deviceID, time.Now().Add(-claimedPrekeyRetention),
+	); err != nil {
+		return nil, fmt.Errorf("failed to remove claimed one-time prekeys: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return r.GetPrekeyStatus(ctx, userID, deviceID)
+}
+
+// GetPrekeyStatus returns how many one-time prekeys one of the user's approved devices
+// has left and how old its signed prekey is
+func (r *PrekeyRepository) GetPrekeyStatus(ctx context.Context, userID, deviceID string) (*models.PrekeyStatus, error) {
+	var available int
+	var signedAt *time.Time
+	err := db.GetDB().QueryRow(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM device_one_time_prekeys otk
+			 WHERE otk.user_id = dk.user_id AND otk.device_id = dk.device_id AND otk.claimed_at IS NULL),
+			(SELECT MAX(sp.created_at) FROM device_signed_prekeys sp
+			 WHERE sp.user_id = dk.user_id AND sp.device_id = dk.device_id AND sp.identity_key = dk.encryption_public_key)
+		 FROM user_device_keys dk
+		 WHERE dk.user_id = $1 AND dk.device_id = $2 AND dk.status = 'approved'`,
+		userID, deviceID,
+	).Scan(&available, &signedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotApproved
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prekey status: %w", err)
+	}
+	return models.NewPrekeyStatus(deviceID, available, signedAt, time.Now()), nil
+}
+
+// prekeyBundlesQuery selects the approved devices of the user with DID $1 that have a
+// signed prekey made with their current identity key, newest device first
+const prekeyBundlesQuery = `
+	SELECT dk.user_id::text, dk.device_id, dk.encryption_public_key,
+	       sp.key_id, sp.public_key, sp.signature, sp.created_at
+	FROM user_device_keys dk
+	JOIN users u ON u.id = dk.user_id
+	JOIN LATERAL (
+		SELECT key_id, public_key, signature, created_at
+		FROM device_signed_prekeys
+		WHERE user_id = dk.user_id AND device_id = dk.device_id AND identity_key = dk.encryption_public_key
+		ORDER BY created_at DESC
+		LIMIT 1
+	) sp ON true
+	WHERE u.did = $1 AND dk.status = 'approved'
+	ORDER BY dk.approved_at DESC NULLS LAST, dk.requested_at DESC
+`
+
+// scanPrekeyBundles reads rows of prekeyBundlesQuery, returning the owner's user ID
+func scanPrekeyBundles(rows pgx.Rows, did string) (string, []*models.PrekeyBundle, error) {
+	defer rows.Close()
+
+	var userID string
+	bundles := []*models.PrekeyBundle{}
+	for rows.Next() {
+		bundle := &models.PrekeyBundle{DID: did, SignedPrekey: &models.SignedPrekey{}}
+		var createdAt time.Time
+		if err := rows.Scan(
+			&userID,
+			&bundle.DeviceID,
+			&bundle.IdentityKey,
+			&bundle.SignedPrekey.KeyID,
+			&bundle.SignedPrekey.PublicKey,
+			&bundle.SignedPrekey.Signature,
+			&createdAt,
+		); err != nil {
+			return "", nil, fmt.Errorf("failed to scan prekey bundle: %w", err)
+		}
+		bundle.SignedPrekey.CreatedAt = &createdAt
+		bundles = append(bundles, bundle)
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, fmt.Errorf("failed to read prekey bundles: %w", err)
+	}
+	return userID, bundles, nil
+}
+
+// ListPrekeyBundles returns the bundles of the user with the DID without claiming
+// one-time prekeys
+func (r *PrekeyRepository) ListPrekeyBundles(ctx context.Context, did string) ([]*models.PrekeyBundle, error) {
+	rows, err := db.GetDB().Query(ctx, prekeyBundlesQuery, did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prekey bundles: %w", err)
+	}
+	_, bundles, err := scanPrekeyBundles(rows, did)
+	return bundles, err
+}
+
+// ClaimPrekeyBundles returns a bundle for every device of the user with the DID that has
+// published a signed prekey, handing claimant one unclaimed one-time prekey of each.
+// A claimant asking again within models.PrekeyClaimReuseWindow gets the keys it already
+// holds. Devices left with few one-time prekeys are told over the realtime hub.
+func (r *PrekeyRepository) ClaimPrekeyBundles(ctx context.Context, did, claimant string) ([]*models.PrekeyBundle, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Concurrent claims of one claimant wait for each other so a retry reuses the keys
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "prekeys\n"+did+"\n"+claimant); err != nil {
+		return nil, fmt.Errorf("failed to lock prekey claim: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, prekeyBundlesQuery, did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prekey bundles: %w", err)
+	}
+	userID, bundles, err := scanPrekeyBundles(rows, did)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bundle := range bundles {
+		var otk models.OneTimePrekey
+		err := tx.QueryRow(ctx,
+			`SELECT key_id, public_key FROM device_one_time_prekeys
+			 WHERE user_id = $1 AND device_id = $2 AND claimed_by = $3 AND claimed_at > $4
+			 ORDER BY claimed_at DESC
+			 LIMIT 1`,
+			userID, bundle.DeviceID, claimant, time.Now().Add(-models.PrekeyClaimReuseWindow),
+		).Scan(&otk.KeyID, &otk.PublicKey)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// SKIP LOCKED lets claims of other requesters take the next key instead of waiting
+			err = tx.QueryRow(ctx,
+				`UPDATE device_one_time_prekeys SET claimed_by = $3, claimed_at = NOW()
+				 WHERE (user_id, device_id, key_id) = (
+					SELECT user_id, device_id, key_id FROM device_one_time_prekeys
+					WHERE user_id = $1 AND device_id = $2 AND claimed_at IS NULL
+					ORDER BY created_at, key_id
+					LIMIT 1
+					FOR UPDATE SKIP LOCKED
+				 )
+				 RETURNING key_id, public_key`,
+				userID, bundle.DeviceID, claimant,
+			).Scan(&otk.KeyID, &otk.PublicKey)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim one-time prekey: %w", err)
+		}
+		bundle.OneTimePrekey = &otk
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, bundle := range bundles {
+		r.warnLowPrekeys(ctx, userID, bundle.DeviceID)
+	}
+	return bundles, nil
+}
+
+// warnLowPrekeys tells the user's connections when a device is running out of one-time prekeys
+func (r *PrekeyRepository) warnLowPrekeys(ctx context.Context, userID, deviceID string) {
+	status, err := r.GetPrekeyStatus(ctx, userID, deviceID)
+	if err != nil {
+		log.Printf("[Prekeys] Failed to check prekeys of device %s: %v", deviceID, err)
+		return
+	}
+	if status.LowPrekeys {
+		realtime.GetHub().Publish([]string{userID}, realtime.EventPrekeysLow, status)
+	}
+}
@@ -3,9 +3,11 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"splitter/internal/db"
 	"splitter/internal/models"
+	"splitter/internal/realtime"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -56,42 +58,179 @@ func (r *ReplyRepository) Create(ctx context.Context, authorDID string, reply *m
 		return nil, fmt.Errorf("failed to create reply: %w", err)
 	}
 
-	// Update Root Post Counters (Always increment total_reply_count for the root post)
-	// If depth is 1 (reply to post), we also increment direct_reply_count
+	if err := incrementReplyCounters(ctx, tx, reply.PostID, reply.ParentID, depth); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	publishReplyEvent(ctx, &newReply)
+
+	return &newReply, nil
+}
+
+// CreateRemote stores a reply received from another server. originalURI is the
+// remote Note ID; a Note that is already stored is returned as is, without
+// touching the counters again.
+func (r *ReplyRepository) CreateRemote(ctx context.Context, authorDID string, reply *models.ReplyCreate, depth int, contentHTML, originalURI string, createdAt time.Time) (*models.Reply, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO replies (post_id, parent_id, author_did, content, content_html, depth, original_reply_uri, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		ON CONFLICT (original_reply_uri) WHERE original_reply_uri IS NOT NULL DO NOTHING
+		RETURNING id`,
+		reply.PostID,
+		reply.ParentID,
+		authorDID,
+		reply.Content,
+		contentHTML,
+		depth,
+		originalURI,
+		createdAt.UTC(),
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return r.GetByOriginalURI(ctx, originalURI)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote reply: %w", err)
+	}
+
+	if err := incrementReplyCounters(ctx, tx, reply.PostID, reply.ParentID, depth); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	created, err := r.GetByID(ctx, id)
+	if err == nil {
+		publishReplyEvent(ctx, created)
+	}
+	return created, err
+}
+
+// UpdateRemote applies an Update(Note) from the original author to a stored remote reply.
+// An edit older than the stored one is ignored. Returns false when no matching reply exists.
+func (r *ReplyRepository) UpdateRemote(ctx context.Context, originalURI, authorDID, content, contentHTML string, updatedAt time.Time) (bool, error) {
+	tag, err := db.GetDB().Exec(ctx, `
+		UPDATE replies
+		SET content = $3, content_html = NULLIF($4, ''), updated_at = $5
+		WHERE original_reply_uri = $1 AND author_did = $2 AND deleted_at IS NULL
+		  AND (updated_at IS NULL OR updated_at < $5)`,
+		originalURI, authorDID, content, contentHTML, updatedAt.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update remote reply: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteRemote applies a Delete from the original author to a stored remote reply and
+// takes it off the counters CreateRemote added it to, in one transaction. Returns false
+// when no matching reply exists or it was already deleted.
+func (r *ReplyRepository) DeleteRemote(ctx context.Context, originalURI, authorDID string) (bool, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var postID string
+	var parentID *string
+	var depth int
+	err = tx.QueryRow(ctx, `
+		UPDATE replies SET deleted_at = now()
+		WHERE original_reply_uri = $1 AND author_did = $2 AND deleted_at IS NULL
+		RETURNING post_id, parent_id, depth`,
+		originalURI, authorDID,
+	).Scan(&postID, &parentID, &depth)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete remote reply: %w", err)
+	}
+
+	if err := adjustReplyCounters(ctx, tx, postID, parentID, depth, -1); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// publishReplyEvent notifies the author of the post and of the parent reply of a new reply
+func publishReplyEvent(ctx context.Context, reply *models.Reply) {
+	dids := []string{}
+	var postAuthor, parentAuthor string
+	_ = db.GetDB().QueryRow(ctx, `SELECT author_did FROM posts WHERE id = $1`, reply.PostID).Scan(&postAuthor)
+	if reply.ParentID != nil {
+		_ = db.GetDB().QueryRow(ctx, `SELECT author_did FROM replies WHERE id = $1`, *reply.ParentID).Scan(&parentAuthor)
+	}
+	for _, did := range []string{postAuthor, parentAuthor} {
+		if did != "" && did != reply.AuthorDID {
+			dids = append(dids, did)
+		}
+	}
+	realtime.PublishToDIDs(ctx, dids, realtime.EventReplyCreated, reply)
+}
+
+// incrementReplyCounters updates the root post and every ancestor reply for a new reply
+func incrementReplyCounters(ctx context.Context, tx pgx.Tx, postID string, parentID *string, depth int) error {
+	return adjustReplyCounters(ctx, tx, postID, parentID, depth, 1)
+}
+
+// adjustReplyCounters adds delta to the counters of the root post and every ancestor reply
+// of a reply at depth: 1 when a reply is added, -1 when one is removed
+func adjustReplyCounters(ctx context.Context, tx pgx.Tx, postID string, parentID *string, depth int, delta int) error {
+	var err error
+
+	// Update Root Post Counters (total_reply_count always changes for the root post)
+	// If depth is 1 (reply to post), direct_reply_count changes too
 	if depth == 1 {
 		_, err = tx.Exec(ctx, `
 			UPDATE posts 
-			SET direct_reply_count = direct_reply_count + 1, 
-			    total_reply_count = total_reply_count + 1 
-			WHERE id = $1`, reply.PostID)
+			SET direct_reply_count = GREATEST(direct_reply_count + $2, 0), 
+			    total_reply_count = GREATEST(total_reply_count + $2, 0) 
+			WHERE id = $1`, postID, delta)
 	} else {
 		_, err = tx.Exec(ctx, `
 			UPDATE posts 
-			SET total_reply_count = total_reply_count + 1 
-			WHERE id = $1`, reply.PostID)
+			SET total_reply_count = GREATEST(total_reply_count + $2, 0) 
+			WHERE id = $1`, postID, delta)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to update post counters: %w", err)
+		return fmt.Errorf("failed to update post counters: %w", err)
 	}
 
 	// Update Parent Reply Counters (if parent is a reply)
-	if reply.ParentID != nil {
-		// Increment direct and total count for immediate parent
+	if parentID != nil {
+		// Change direct and total count of the immediate parent
 		_, err = tx.Exec(ctx, `
 			UPDATE replies 
-			SET direct_reply_count = direct_reply_count + 1, 
-			    total_reply_count = total_reply_count + 1 
-			WHERE id = $1`, *reply.ParentID)
+			SET direct_reply_count = GREATEST(direct_reply_count + $2, 0), 
+			    total_reply_count = GREATEST(total_reply_count + $2, 0) 
+			WHERE id = $1`, *parentID, delta)
 		if err != nil {
-			return nil, fmt.Errorf("failed to update parent reply counters: %w", err)
+			return fmt.Errorf("failed to update parent reply counters: %w", err)
 		}
 
-		// Propagate total_reply_count update to all ancestors (excluding the immediate parent which is already done)
+		// Propagate the total_reply_count change to all ancestors (excluding the immediate parent which is already done)
 		// We can find ancestors by traversing up. Since max depth is 3, this loop is short.
 		// Immediate parent is already updated. We need to update *its* parent, and so on, until we hit a top-level reply (parent_id is null).
 		// Note: The root post is already updated above.
 
-		currentParentID := *reply.ParentID
+		currentParentID := *parentID
 		for {
 			var grandparentID *string
 			err := tx.QueryRow(ctx, "SELECT parent_id FROM replies WHERE id = $1", currentParentID).Scan(&grandparentID)
@@ -99,7 +238,7 @@ func (r *ReplyRepository) Create(ctx context.Context, authorDID string, reply *m
 				if err == pgx.ErrNoRows {
 					break // Should not happen if foreign keys are correct
 				}
-				return nil, fmt.Errorf("failed to fetch ancestor: %w", err)
+				return fmt.Errorf("failed to fetch ancestor: %w", err)
 			}
 
 			if grandparentID == nil {
@@ -107,20 +246,16 @@ func (r *ReplyRepository) Create(ctx context.Context, authorDID string, reply *m
 			}
 
 			// Update ancestor
-			_, err = tx.Exec(ctx, `UPDATE replies SET total_reply_count = total_reply_count + 1 WHERE id = $1`, *grandparentID)
+			_, err = tx.Exec(ctx, `UPDATE replies SET total_reply_count = GREATEST(total_reply_count + $2, 0) WHERE id = $1`, *grandparentID, delta)
 			if err != nil {
-				return nil, fmt.Errorf("failed to update ancestor counters: %w", err)
+				return fmt.Errorf("failed to update ancestor counters: %w", err)
 			}
 
 			currentParentID = *grandparentID
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return &newReply, nil
+	return nil
 }
 
 // GetByPostID retrieves all replies for a post, sorted by popularity then time
@@ -133,6 +268,7 @@ func (r *ReplyRepository) GetByPostID(ctx context.Context, postID string, userDI
 		query = `
 			SELECT r.id, r.post_id, r.parent_id, r.author_did, r.content, r.depth,
 			       r.likes_count, r.direct_reply_count, r.total_reply_count, r.created_at, r.updated_at,
+			       COALESCE(r.content_html, ''), COALESCE(r.original_reply_uri, ''),
 			       COALESCE(u.username, 'unknown'),
 			       COALESCE((SELECT COUNT(*) > 0 FROM interactions WHERE post_id = r.id AND actor_did = $2 AND interaction_type = 'like'), false) as liked
 			FROM replies r
@@ -145,6 +281,7 @@ func (r *ReplyRepository) GetByPostID(ctx context.Context, postID string, userDI
 		query = `
 			SELECT r.id, r.post_id, r.parent_id, r.author_did, r.content, r.depth,
 			       r.likes_count, r.direct_reply_count, r.total_reply_count, r.created_at, r.updated_at,
+			       COALESCE(r.content_html, ''), COALESCE(r.original_reply_uri, ''),
 			       COALESCE(u.username, 'unknown'),
 			       false as liked
 			FROM replies r
@@ -176,6 +313,8 @@ func (r *ReplyRepository) GetByPostID(ctx context.Context, postID string, userDI
 			&reply.TotalReplyCount,
 			&reply.CreatedAt,
 			&reply.UpdatedAt,
+			&reply.ContentHTML,
+			&reply.OriginalURI,
 			&reply.Username,
 			&reply.Liked,
 		)
@@ -190,14 +329,26 @@ func (r *ReplyRepository) GetByPostID(ctx context.Context, postID string, userDI
 
 // GetByID retrieves a single reply by ID
 func (r *ReplyRepository) GetByID(ctx context.Context, id string) (*models.Reply, error) {
+	return r.getOne(ctx, "r.id = $1", id)
+}
+
+// GetByOriginalURI retrieves a remote reply by the ID of its federated Note
+func (r *ReplyRepository) GetByOriginalURI(ctx context.Context, uri string) (*models.Reply, error) {
+	return r.getOne(ctx, "r.original_reply_uri = $1", uri)
+}
+
+func (r *ReplyRepository) getOne(ctx context.Context, condition string, arg string) (*models.Reply, error) {
 	query := `
 		SELECT r.id, r.post_id, r.parent_id, r.author_did, r.content, r.depth,
-		       r.likes_count, r.direct_reply_count, r.total_reply_count, r.created_at, r.updated_at
+		       r.likes_count, r.direct_reply_count, r.total_reply_count, r.created_at, r.updated_at,
+		       COALESCE(r.content_html, ''), COALESCE(r.original_reply_uri, ''),
+		       COALESCE(u.username, 'unknown')
 		FROM replies r
-		WHERE r.id = $1 AND r.deleted_at IS NULL
+		LEFT JOIN users u ON r.author_did = u.did
+		WHERE ` + condition + ` AND r.deleted_at IS NULL
 	`
 	var reply models.Reply
-	err := db.GetDB().QueryRow(ctx, query, id).Scan(
+	err := db.GetDB().QueryRow(ctx, query, arg).Scan(
 		&reply.ID,
 		&reply.PostID,
 		&reply.ParentID,
@@ -209,6 +360,9 @@ func (r *ReplyRepository) GetByID(ctx context.Context, id string) (*models.Reply
 		&reply.TotalReplyCount,
 		&reply.CreatedAt,
 		&reply.UpdatedAt,
+		&reply.ContentHTML,
+		&reply.OriginalURI,
+		&reply.Username,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("reply not found")
@@ -76,7 +76,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.UserCreate, pa
 // GetByID retrieves a user by UUID
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(bio_html, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -90,6 +90,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 		&user.DID,
 		&user.DisplayName,
 		&user.Bio,
+		&user.BioHTML,
 		&user.AvatarURL,
 		&user.PublicKey,
 		&user.EncryptionPublicKey,
@@ -97,6 +98,9 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 		&user.ModerationRequested,
 		&user.IsLocked,
 		&user.IsSuspended,
+		&user.AlsoKnownAs,
+		&user.MovedTo,
+		&user.MovedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -113,15 +117,30 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 
 // GetByUsername retrieves a user by username (for login)
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, string, error) {
+	return r.getByUsername(ctx, `WHERE username = $1 OR email = $1`, username)
+}
+
+// GetLocalByUsername retrieves a user of this instance by username. Cached remote users
+// with the same username are skipped, so this is the lookup for anything served under
+// /ap/users/:username.
+func (r *UserRepository) GetLocalByUsername(ctx context.Context, username, localDomain string) (*models.User, error) {
+	user, _, err := r.getByUsername(ctx,
+		`WHERE username = $1 AND COALESCE(instance_domain, '') = ANY($2)`,
+		username, models.LocalInstanceDomains(localDomain),
+	)
+	return user, err
+}
+
+// getByUsername retrieves a user and their password hash matching the where clause
+func (r *UserRepository) getByUsername(ctx context.Context, where string, args ...interface{}) (*models.User, string, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), COALESCE(password_hash, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), COALESCE(password_hash, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
-		WHERE username = $1 OR email = $1
-	`
+		` + where
 
 	var user models.User
 	var passwordHash string
-	err := db.GetDB().QueryRow(ctx, query, username).Scan(
+	err := db.GetDB().QueryRow(ctx, query, args...).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -137,6 +156,9 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 		&user.ModerationRequested,
 		&user.IsLocked,
 		&user.IsSuspended,
+		&user.AlsoKnownAs,
+		&user.MovedTo,
+		&user.MovedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -154,7 +176,7 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -175,6 +197,9 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.ModerationRequested,
 		&user.IsLocked,
 		&user.IsSuspended,
+		&user.AlsoKnownAs,
+		&user.MovedTo,
+		&user.MovedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -192,7 +217,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 // GetByDID retrieves a user by DID (Decentralized Identifier)
 func (r *UserRepository) GetByDID(ctx context.Context, did string) (*models.User, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(bio_html, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
 		WHERE did = $1
 	`
@@ -206,6 +231,7 @@ func (r *UserRepository) GetByDID(ctx context.Context, did string) (*models.User
 		&user.DID,
 		&user.DisplayName,
 		&user.Bio,
+		&user.BioHTML,
 		&user.AvatarURL,
 		&user.PublicKey,
 		&user.EncryptionPublicKey,
@@ -213,6 +239,9 @@ func (r *UserRepository) GetByDID(ctx context.Context, did string) (*models.User
 		&user.ModerationRequested,
 		&user.IsLocked,
 		&user.IsSuspended,
+		&user.AlsoKnownAs,
+		&user.MovedTo,
+		&user.MovedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -343,7 +372,7 @@ func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, e
 // SearchUsers searches for users by username or display name
 func (r *UserRepository) SearchUsers(ctx context.Context, searchTerm string, limit, offset int) ([]*models.User, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
 		WHERE (username ILIKE $1 OR display_name ILIKE $1 OR instance_domain ILIKE $1)
 		AND is_suspended = false
@@ -376,6 +405,9 @@ func (r *UserRepository) SearchUsers(ctx context.Context, searchTerm string, lim
 			&user.ModerationRequested,
 			&user.IsLocked,
 			&user.IsSuspended,
+			&user.AlsoKnownAs,
+			&user.MovedTo,
+			&user.MovedAt,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -470,7 +502,7 @@ func (r *UserRepository) RequestModeration(ctx context.Context, userID string) e
 // GetModerationRequests gets all pending moderation requests (admin only)
 func (r *UserRepository) GetModerationRequests(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, created_at, updated_at
+		SELECT id, username, COALESCE(email, ''), instance_domain, COALESCE(did, ''), display_name, COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(public_key, ''), COALESCE(encryption_public_key, ''), COALESCE(role, 'user'), COALESCE(moderation_requested, false), is_locked, is_suspended, COALESCE(also_known_as, '{}'), COALESCE(moved_to, ''), moved_at, created_at, updated_at
 		FROM users
 		WHERE moderation_requested = true AND role = 'user'
 		ORDER BY moderation_requested_at ASC
@@ -500,6 +532,9 @@ func (r *UserRepository) GetModerationRequests(ctx context.Context) ([]*models.U
 			&user.ModerationRequested,
 			&user.IsLocked,
 			&user.IsSuspended,
+			&user.AlsoKnownAs,
+			&user.MovedTo,
+			&user.MovedAt,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -630,6 +665,40 @@ func (r *UserRepository) UpdateEncryptionKey(ctx context.Context, userID, encryp
 	return nil
 }
 
+// SetAliases replaces the actor URIs a user publishes as alsoKnownAs
+func (r *UserRepository) SetAliases(ctx context.Context, userID string, aliases []string) error {
+	if aliases == nil {
+		aliases = []string{}
+	}
+	result, err := db.GetDB().Exec(ctx,
+		`UPDATE users SET also_known_as = $1, updated_at = NOW() WHERE id = $2`,
+		aliases, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update aliases: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// MarkMoved records that an account moved to targetURI. An account moves only once.
+func (r *UserRepository) MarkMoved(ctx context.Context, did, targetURI string) error {
+	result, err := db.GetDB().Exec(ctx,
+		`UPDATE users SET moved_to = $1, moved_at = NOW(), updated_at = NOW()
+		 WHERE did = $2 AND moved_to IS NULL`,
+		targetURI, did,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark account moved: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found or already moved")
+	}
+	return nil
+}
+
 // UpdateAvatar stores avatar binary data in DB and updates avatar URL.
 func (r *UserRepository) UpdateAvatar(ctx context.Context, userID string, avatarData []byte, mediaType string) (*models.User, error) {
 	avatarURL := fmt.Sprintf("/api/v1/users/%s/avatar", userID)
@@ -0,0 +1,344 @@
+// Package sanitize cleans HTML received from remote servers before it is stored.
+// Remote Notes and actor summaries carry arbitrary HTML; only a small allowlist of
+// formatting tags survives, links are rewritten to be safe to render, and a plain-text
+// rendering is produced for search, hashtags and clients that do not render HTML.
+package sanitize
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags maps each permitted element to the attributes it may keep.
+// This follows what Mastodon emits and accepts for status content.
+var allowedTags = map[string][]string{
+	"p":          nil,
+	"br":         nil,
+	"span":       {"class"},
+	"a":          {"href", "class"},
+	"del":        nil,
+	"s":          nil,
+	"pre":        nil,
+	"code":       nil,
+	"blockquote": nil,
+	"b":          nil,
+	"strong":     nil,
+	"i":          nil,
+	"em":         nil,
+	"u":          nil,
+	"ul":         nil,
+	"ol":         {"start", "reversed"},
+	"li":         {"value"},
+}
+
+// droppedTags are removed together with everything inside them
+var droppedTags = map[string]bool{
+	"script":    true,
+	"style":     true,
+	"iframe":    true,
+	"frameset":  true,
+	"object":    true,
+	"applet":    true,
+	"noscript":  true,
+	"noembed":   true,
+	"template":  true,
+	"svg":       true,
+	"math":      true,
+	"textarea":  true,
+	"select":    true,
+	"title":     true,
+	"head":      true,
+	"xmp":       true,
+	"plaintext": true,
+}
+
+// allowedClasses are the microformat classes remote servers use for mentions and links
+var allowedClasses = map[string]bool{
+	"h-card":    true,
+	"u-url":     true,
+	"mention":   true,
+	"hashtag":   true,
+	"invisible": true,
+	"ellipsis":  true,
+}
+
+// allowedSchemes are the link schemes kept in href attributes
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// blockTags end a line in the plain-text rendering
+var blockTags = map[string]bool{
+	"p":          true,
+	"div":        true,
+	"pre":        true,
+	"blockquote": true,
+	"ul":         true,
+	"ol":         true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+}
+
+// maxDepth bounds how deeply nested allowed elements may be
+const maxDepth = 32
+
+// HTML returns input reduced to the allowlisted tags and attributes. Scripts, styles,
+// embedded content and event handlers are removed, unknown elements are unwrapped,
+// and links get rel="nofollow noopener noreferrer" and target="_blank".
+func HTML(input string) string {
+	var out strings.Builder
+	var open []string // allowed elements currently open, innermost last
+	skipDepth := 0    // >0 while inside a dropped element
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break // io.EOF or malformed input; emit what we have
+		}
+
+		token := z.Token()
+		name := strings.ToLower(token.Data)
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[name] {
+				if tt == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			attrs, ok := allowedTags[name]
+			if !ok {
+				continue
+			}
+			if name == "br" {
+				out.WriteString("<br>")
+				continue
+			}
+			if len(open) >= maxDepth {
+				continue
+			}
+			out.WriteString("<" + name)
+			writeAttributes(&out, name, token.Attr, attrs)
+			out.WriteString(">")
+			if tt == html.SelfClosingTagToken {
+				out.WriteString("</" + name + ">")
+				continue
+			}
+			open = append(open, name)
+
+		case html.EndTagToken:
+			if droppedTags[name] {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			// Close back to the matching element; stray end tags are ignored
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+
+		case html.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(html.EscapeString(token.Data))
+			}
+		}
+		// Comments and doctypes are dropped
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String()
+}
+
+// writeAttributes emits the permitted attributes of an element
+func writeAttributes(out *strings.Builder, tag string, attrs []html.Attribute, allowed []string) {
+	seen := make(map[string]bool)
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || seen[key] || !contains(allowed, key) {
+			continue
+		}
+		seen[key] = true
+
+		value := attr.Val
+		switch key {
+		case "href":
+			safe, ok := safeURL(value)
+			if !ok {
+				continue
+			}
+			value = safe
+		case "class":
+			value = filterClasses(value)
+			if value == "" {
+				continue
+			}
+		case "start", "value":
+			if !isNumber(value) {
+				continue
+			}
+		case "reversed":
+			out.WriteString(" reversed")
+			continue
+		}
+
+		out.WriteString(" " + key + `="` + html.EscapeString(value) + `"`)
+	}
+
+	if tag == "a" {
+		out.WriteString(` rel="nofollow noopener noreferrer" target="_blank"`)
+	}
+}
+
+// safeURL returns the URL if it is absolute with an allowed scheme
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" {
+		return "", false
+	}
+	if !allowedSchemes[strings.ToLower(parsed.Scheme)] {
+		return "", false
+	}
+	if parsed.Scheme != "mailto" && parsed.Host == "" {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+func filterClasses(value string) string {
+	var kept []string
+	for _, class := range strings.Fields(value) {
+		if allowedClasses[class] {
+			kept = append(kept, class)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func isNumber(value string) bool {
+	if value == "" || len(value) > 9 {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Text renders HTML as plain text: tags are removed, entities decoded, <br> and
+// block elements become line breaks, and dropped elements contribute nothing.
+func Text(input string) string {
+	var out strings.Builder
+	skipDepth := 0
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		name := strings.ToLower(token.Data)
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[name] {
+				if tt == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			switch {
+			case name == "br":
+				out.WriteString("\n")
+			case name == "li":
+				out.WriteString("\n- ")
+			case blockTags[name]:
+				out.WriteString("\n\n")
+			}
+		case html.EndTagToken:
+			if droppedTags[name] {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if skipDepth == 0 && blockTags[name] {
+				out.WriteString("\n\n")
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(token.Data)
+			}
+		}
+	}
+
+	return normalizeText(out.String())
+}
+
+// normalizeText trims each line and collapses runs of blank lines
+func normalizeText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var result []string
+	blank := false
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if len(result) > 0 {
+				blank = true
+			}
+			continue
+		}
+		if blank {
+			result = append(result, "")
+			blank = false
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
+
+// Remote returns the sanitized HTML and the plain-text rendering of remote content
+func Remote(input string) (string, string) {
+	return HTML(input), Text(input)
+}
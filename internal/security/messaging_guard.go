@@ -3,6 +3,8 @@ package security
 import (
 	"sync"
 	"time"
+
+	"splitter/internal/models"
 )
 
 type MessagingSecurityEvent struct {
@@ -23,6 +25,8 @@ type MessagingSecurityMetrics struct {
 	InboxThrottled         int `json:"inbox_throttled"`
 	InboxRejected          int `json:"inbox_rejected"`
 	SuspiciousEventsLogged int `json:"suspicious_events_logged"`
+	PrekeyClaimAllowed     int `json:"prekey_claim_allowed"`
+	PrekeyClaimThrottled   int `json:"prekey_claim_throttled"`
 }
 
 type MessagingSecuritySnapshot struct {
@@ -31,6 +35,8 @@ type MessagingSecuritySnapshot struct {
 		LocalPerHour          int `json:"local_per_hour"`
 		RemoteActorPerMinute  int `json:"remote_actor_per_minute"`
 		RemoteDomainPerMinute int `json:"remote_domain_per_minute"`
+		PrekeyClaimsPerActor  int `json:"prekey_claims_per_actor_per_day"`
+		PrekeyClaimsPerDomain int `json:"prekey_claims_per_domain_per_day"`
 	} `json:"limits"`
 	Metrics      MessagingSecurityMetrics `json:"metrics"`
 	RecentEvents []MessagingSecurityEvent `json:"recent_events"`
@@ -43,6 +49,11 @@ type MessagingGuard struct {
 	remoteActorHits  map[string][]time.Time
 	remoteDomainHits map[string][]time.Time
 
+	// Remote prekey claims, keyed by claimed DID and claiming actor or domain
+	prekeyActorHits  map[string][]time.Time
+	prekeyDomainHits map[string][]time.Time
+	prekeyClaimants  map[string]time.Time
+
 	metrics MessagingSecurityMetrics
 	events  []MessagingSecurityEvent
 }
@@ -53,6 +64,12 @@ const (
 	remoteActorPerMinuteLimit  = 40
 	remoteDomainPerMinuteLimit = 200
 	maxRecentEvents            = 200
+
+	// Remote prekey claims handing out fresh one-time prekeys of one user, per day. These
+	// stay well below a device's upload batch so no one server can drain its keys.
+	prekeyClaimsPerActorPerDay  = 20
+	prekeyClaimsPerDomainPerDay = 60
+	maxTrackedPrekeyClaimants   = 10000
 )
 
 var globalMessagingGuard = NewMessagingGuard()
@@ -66,6 +83,9 @@ func NewMessagingGuard() *MessagingGuard {
 		localSenderHits:  make(map[string][]time.Time),
 		remoteActorHits:  make(map[string][]time.Time),
 		remoteDomainHits: make(map[string][]time.Time),
+		prekeyActorHits:  make(map[string][]time.Time),
+		prekeyDomainHits: make(map[string][]time.Time),
+		prekeyClaimants:  make(map[string]time.Time),
 		events:           make([]MessagingSecurityEvent, 0, maxRecentEvents),
 	}
 }
@@ -207,6 +227,67 @@ func (g *MessagingGuard) AllowRemoteInbound(remoteActorURI, remoteDomain string)
 	return true, ""
 }
 
+// AllowPrekeyClaim limits how many one-time prekeys of targetDID remote servers can take.
+// Claims are counted per claiming actor and per claiming domain, whatever device IDs they
+// name; a device claiming again within models.PrekeyClaimReuseWindow is handed the keys it
+// already holds, so the retry is not counted.
+func (g *MessagingGuard) AllowPrekeyClaim(claimantActorURI, claimantDomain, deviceID, targetDID string) (bool, string) {
+	now := time.Now().UTC()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	claimantKey := targetDID + " " + claimantActorURI + "#" + deviceID
+	if last, ok := g.prekeyClaimants[claimantKey]; ok && now.Sub(last) < models.PrekeyClaimReuseWindow {
+		g.metrics.PrekeyClaimAllowed++
+		return true, ""
+	}
+
+	actorKey := targetDID + " " + claimantActorURI
+	domainKey := targetDID + " " + claimantDomain
+	dayStart := now.Add(-24 * time.Hour)
+	actorHits := trimWindow(g.prekeyActorHits[actorKey], dayStart)
+	domainHits := trimWindow(g.prekeyDomainHits[domainKey], dayStart)
+
+	reason := ""
+	switch {
+	case len(actorHits)+1 > prekeyClaimsPerActorPerDay:
+		reason = "remote actor prekey claim limit exceeded"
+	case len(domainHits)+1 > prekeyClaimsPerDomainPerDay:
+		reason = "remote domain prekey claim limit exceeded"
+	}
+	if reason != "" {
+		g.metrics.PrekeyClaimThrottled++
+		g.events = g.appendEvents(g.events, MessagingSecurityEvent{
+			Type:      "rate_limit",
+			Source:    claimantActorURI,
+			Action:    "throttled",
+			Reason:    reason,
+			Timestamp: now,
+			Metadata: map[string]interface{}{
+				"window":    "24h",
+				"domain":    claimantDomain,
+				"device_id": deviceID,
+				"did":       targetDID,
+			},
+		})
+		return false, reason
+	}
+
+	if len(g.prekeyClaimants) >= maxTrackedPrekeyClaimants {
+		for key, last := range g.prekeyClaimants {
+			if now.Sub(last) >= models.PrekeyClaimReuseWindow {
+				delete(g.prekeyClaimants, key)
+			}
+		}
+	}
+	g.prekeyClaimants[claimantKey] = now
+	g.prekeyActorHits[actorKey] = append(actorHits, now)
+	g.prekeyDomainHits[domainKey] = append(domainHits, now)
+	g.metrics.PrekeyClaimAllowed++
+	return true, ""
+}
+
 func (g *MessagingGuard) RecordSuspicious(source, reason string, metadata map[string]interface{}) {
 	now := time.Now().UTC()
 	g.mu.Lock()
@@ -255,5 +336,7 @@ func (g *MessagingGuard) Snapshot() MessagingSecuritySnapshot {
 	snapshot.Limits.LocalPerHour = localPerHourLimit
 	snapshot.Limits.RemoteActorPerMinute = remoteActorPerMinuteLimit
 	snapshot.Limits.RemoteDomainPerMinute = remoteDomainPerMinuteLimit
+	snapshot.Limits.PrekeyClaimsPerActor = prekeyClaimsPerActorPerDay
+	snapshot.Limits.PrekeyClaimsPerDomain = prekeyClaimsPerDomainPerDay
 	return snapshot
 }
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"splitter/internal/config"
 	"splitter/internal/federation"
 	"splitter/internal/handlers"
 	"splitter/internal/middleware"
+	"splitter/internal/realtime"
 	"splitter/internal/repository"
 	"splitter/internal/service"
 	"splitter/internal/worker"
@@ -48,6 +52,20 @@ func NewServer(cfg *config.Config) *Server {
 	messageHandler := handlers.NewMessageHandler(messageRepo, userRepo, cfg)
 	replyHandler := handlers.NewReplyHandler(cfg, userRepo)
 	hashtagHandler := handlers.NewHashtagHandler(postRepo)
+	// CORS: use CORS_ORIGINS env var if set, otherwise default to localhost
+	corsOrigins := []string{
+		"http://localhost:3000", "http://127.0.0.1:3000",
+		"http://localhost:3001", "http://127.0.0.1:3001",
+		"http://localhost:8000", "http://localhost:8001",
+	}
+	if extra := os.Getenv("CORS_ORIGINS"); extra != "" {
+		for _, o := range strings.Split(extra, ",") {
+			if trimmed := strings.TrimSpace(o); trimmed != "" {
+				corsOrigins = append(corsOrigins, trimmed)
+			}
+		}
+	}
+	streamHandler := handlers.NewStreamHandler(realtime.GetHub(), corsOrigins)
 
 	storyService := service.NewStoryService(storyRepo)
 	storyHandler := handlers.NewStoryHandler(storyService)
@@ -57,37 +75,79 @@ func NewServer(cfg *config.Config) *Server {
 
 	// Federation handlers
 	webfingerHandler := handlers.NewWebFingerHandler(userRepo, cfg)
+	nodeInfoHandler := handlers.NewNodeInfoHandler(cfg)
 	actorHandler := handlers.NewActorHandler(userRepo, cfg)
 	inboxHandler := handlers.NewInboxHandler(userRepo, messageRepo, cfg)
-	outboxHandler := handlers.NewOutboxHandler(userRepo, cfg)
+	outboxHandler := handlers.NewOutboxHandler(userRepo, postRepo, cfg)
+	collectionHandler := handlers.NewCollectionHandler(userRepo, followRepo, cfg)
+	noteHandler := handlers.NewNoteHandler(postRepo, cfg)
 	federationHandler := handlers.NewFederationHandler(userRepo, cfg)
 
 	// Initialize federation keys if federation is enabled
 	if cfg.Federation.Enabled {
+		federation.SetInstanceURL(cfg.Federation.URL)
+		federation.SetSecureMode(cfg.Federation.SecureMode)
+		federation.ConfigureSignaturePolicy(time.Duration(cfg.Federation.SignatureMaxSkewSeconds) * time.Second)
 		if err := federation.EnsureInstanceKeys(cfg.Federation.Domain); err != nil {
 			log.Printf("[Federation] WARNING: Failed to initialize keys: %v", err)
 		} else {
 			log.Printf("[Federation] Initialized for domain '%s' at %s", cfg.Federation.Domain, cfg.Federation.URL)
 		}
+
+		// Per-user signing keys: make sure every existing local user has one
+		go func() {
+			ctx := context.Background()
+			if err := federation.EnsureActorKeyTable(ctx); err != nil {
+				log.Printf("[Federation] WARNING: Failed to ensure actor_keys table: %v", err)
+				return
+			}
+			created, err := federation.BackfillActorKeys(ctx, cfg.Federation.Domain)
+			if err != nil {
+				log.Printf("[Federation] WARNING: Actor key backfill failed: %v", err)
+				return
+			}
+			if created > 0 {
+				log.Printf("[Federation] Backfilled signing keys for %d local users", created)
+			}
+		}()
+
+		// Peer registry: seed from configured peers and previously seen remote actors
+		go func() {
+			ctx := context.Background()
+			if err := federation.EnsureKnownInstancesTable(ctx); err != nil {
+				log.Printf("[Federation] WARNING: Failed to ensure known_instances table: %v", err)
+				return
+			}
+			if err := federation.SeedKnownInstances(ctx, cfg.Federation.Domain); err != nil {
+				log.Printf("[Federation] WARNING: Known instance seeding failed: %v", err)
+			}
+		}()
+
+		// Relay subscriptions
+		go func() {
+			if err := federation.EnsureRelaysSchema(context.Background()); err != nil {
+				log.Printf("[Federation] WARNING: Failed to ensure relay tables: %v", err)
+			}
+		}()
+
+		// Retention rollups and run log
+		go func() {
+			if err := federation.EnsureRetentionSchema(context.Background()); err != nil {
+				log.Printf("[Federation] WARNING: Failed to ensure retention tables: %v", err)
+			}
+		}()
 	}
 
 	// Global middleware
-	e.Use(echomiddleware.Logger())
+	e.Use(echomiddleware.LoggerWithConfig(echomiddleware.LoggerConfig{
+		// Stream clients may pass their token in the query string; keep it out of the log
+		Format: strings.Replace(echomiddleware.DefaultLoggerConfig.Format, "${uri}", "${custom}", 1),
+		CustomTagFunc: func(c echo.Context, buf *bytes.Buffer) (int, error) {
+			return buf.WriteString(middleware.RedactAccessToken(c.Request().RequestURI))
+		},
+	}))
 	e.Use(echomiddleware.Recover())
 	e.Use(echomiddleware.BodyLimit("6M")) // Limit body size to 6MB (allow overhead for 5MB file)
-	// CORS: use CORS_ORIGINS env var if set, otherwise default to localhost
-	corsOrigins := []string{
-		"http://localhost:3000", "http://127.0.0.1:3000",
-		"http://localhost:3001", "http://127.0.0.1:3001",
-		"http://localhost:8000", "http://localhost:8001",
-	}
-	if extra := os.Getenv("CORS_ORIGINS"); extra != "" {
-		for _, o := range strings.Split(extra, ",") {
-			if trimmed := strings.TrimSpace(o); trimmed != "" {
-				corsOrigins = append(corsOrigins, trimmed)
-			}
-		}
-	}
 	log.Printf("CORS allowed origins: %v", corsOrigins)
 	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
 		AllowOrigins:     corsOrigins,
@@ -102,7 +162,7 @@ func NewServer(cfg *config.Config) *Server {
 	e.Static("/media", "./uploads")
 
 	// Routes
-	setupRoutes(e, cfg, authHandler, userHandler, postHandler, mediaHandler, followHandler, interactionHandler, adminHandler, messageHandler, replyHandler, hashtagHandler, webfingerHandler, actorHandler, inboxHandler, outboxHandler, federationHandler, storyHandler)
+	setupRoutes(e, cfg, authHandler, userHandler, postHandler, mediaHandler, followHandler, interactionHandler, adminHandler, messageHandler, replyHandler, hashtagHandler, streamHandler, webfingerHandler, nodeInfoHandler, actorHandler, inboxHandler, outboxHandler, collectionHandler, noteHandler, federationHandler, storyHandler)
 
 	return &Server{
 		echo: e,
@@ -124,10 +184,14 @@ func setupRoutes(
 	messageHandler *handlers.MessageHandler,
 	replyHandler *handlers.ReplyHandler,
 	hashtagHandler *handlers.HashtagHandler,
+	streamHandler *handlers.StreamHandler,
 	webfingerHandler *handlers.WebFingerHandler,
+	nodeInfoHandler *handlers.NodeInfoHandler,
 	actorHandler *handlers.ActorHandler,
 	inboxHandler *handlers.InboxHandler,
 	outboxHandler *handlers.OutboxHandler,
+	collectionHandler *handlers.CollectionHandler,
+	noteHandler *handlers.NoteHandler,
 	federationHandler *handlers.FederationHandler,
 	storyHandler *handlers.StoryHandler,
 ) {
@@ -159,11 +223,14 @@ func setupRoutes(
 	authAuth.POST("/devices/request", authHandler.RequestDeviceKey)
 	authAuth.POST("/devices/:deviceId/approve", authHandler.ApproveDeviceKey)
 	authAuth.GET("/devices", authHandler.ListDeviceKeys)
+	authAuth.POST("/devices/:deviceId/prekeys", authHandler.UploadPrekeys)  // Upload signed / one-time prekeys
+	authAuth.GET("/devices/:deviceId/prekeys", authHandler.GetPrekeyStatus) // Remaining one-time prekeys
 
 	// Public revocation endpoints — no auth required (for federation)
 	api.GET("/auth/check-key", authHandler.CheckKeyRevocation)           // GET /api/v1/auth/check-key?key=<b64>
 	api.GET("/dids/:did/revoked-keys", authHandler.GetPublicRevokedKeys) // Per-DID revocation list
 	api.GET("/dids/:did/device-keys", authHandler.GetPublicDeviceKeys)
+	api.POST("/dids/:did/prekeys/claim", authHandler.ClaimPrekeyBundles, middleware.AuthMiddleware(cfg.JWT.Secret)) // Prekey bundles, one one-time prekey per device
 
 	// User routes
 	users := api.Group("/users")
@@ -178,6 +245,8 @@ func setupRoutes(
 	usersAuth.PUT("/me", userHandler.UpdateProfile)
 	usersAuth.POST("/me/avatar", userHandler.UploadAvatar)
 	usersAuth.PUT("/me/encryption-key", userHandler.UpdateEncryptionKey) // Add encryption key for existing users
+	usersAuth.PUT("/me/aliases", userHandler.UpdateAliases)              // alsoKnownAs accounts on other servers
+	usersAuth.POST("/me/move", userHandler.MoveAccount)                  // Move to an account on another server
 	usersAuth.DELETE("/me", userHandler.DeleteAccount)
 	// Circle (close friends) endpoints
 	usersAuth.GET("/me/circle", userHandler.GetCircle)
@@ -191,18 +260,24 @@ func setupRoutes(
 	// Post routes
 	posts := api.Group("/posts")
 	posts.Use(middleware.OptionalAuthMiddleware(cfg.JWT.Secret))
-	posts.GET("/:id", postHandler.GetPost)            // Public - view any post
-	posts.GET("/user/:did", postHandler.GetUserPosts) // Public - view user's posts by DID
-	posts.GET("/public", postHandler.GetPublicFeed)   // Public - get public feed
+	posts.GET("/:id", postHandler.GetPost)                    // Public - view any post
+	posts.GET("/user/:did", postHandler.GetUserPosts)         // Public - view user's posts by DID
+	posts.GET("/public", postHandler.GetPublicFeed)           // Public - get public feed
+	posts.GET("/:id/revisions", postHandler.GetPostRevisions) // Public - edit history of a post
+	posts.GET("/:id/poll", postHandler.GetPoll)               // Public - poll results
 
 	// Protected post routes (require authentication)
 	postsAuth := api.Group("/posts")
 	postsAuth.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
 	postsAuth.POST("", postHandler.CreatePost)
 	postsAuth.GET("/feed", postHandler.GetFeed)
+	postsAuth.GET("/mentions", postHandler.GetMentions)
 	postsAuth.POST("/:id/fetch-context", postHandler.FetchThreadContext)
+	postsAuth.POST("/:id/backfill", postHandler.BackfillThread)
+	postsAuth.GET("/:id/backfill", postHandler.GetThreadBackfill)
 	postsAuth.PUT("/:id", postHandler.UpdatePost)
 	postsAuth.DELETE("/:id", postHandler.DeletePost)
+	postsAuth.POST("/:id/poll/votes", postHandler.VotePoll)
 	postsAuth.POST("/:id/report", adminHandler.ReportPost)   // Report a post (triggers AI screen)
 	postsAuth.POST("/:id/appeal", adminHandler.SubmitAppeal) // Appeal an AI-actioned removal
 	// Replies (Authenticated)
@@ -252,11 +327,21 @@ func setupRoutes(
 	messagesAuth.GET("/threads/:threadId", messageHandler.GetMessages)
 	messagesAuth.POST("/send", messageHandler.SendMessage)
 	messagesAuth.POST("/sync", messageHandler.SyncOfflineMessages)
+	messagesAuth.GET("/sync", messageHandler.GetSyncChanges)
 	messagesAuth.POST("/conversation/:userId", messageHandler.StartConversation)
 	messagesAuth.POST("/threads/:threadId/read", messageHandler.MarkAsRead)
+	messagesAuth.POST("/groups", messageHandler.CreateGroupThread)
+	messagesAuth.PUT("/threads/:threadId", messageHandler.RenameThread)
+	messagesAuth.GET("/threads/:threadId/members", messageHandler.GetThreadMembers)
+	messagesAuth.POST("/threads/:threadId/members", messageHandler.AddThreadMembers)
+	messagesAuth.DELETE("/threads/:threadId/members/:userId", messageHandler.RemoveThreadMember)
+	messagesAuth.GET("/threads/:threadId/device-keys", messageHandler.GetThreadDeviceKeys)
 	messagesAuth.DELETE("/:messageId", messageHandler.DeleteMessage) // Delete message (3-hour window)
 	messagesAuth.PUT("/:messageId", messageHandler.EditMessage)      // Edit message (3-hour window)
 
+	// Realtime events (WebSocket, or server-sent events)
+	api.GET("/stream", streamHandler.Stream, middleware.StreamAuthMiddleware(cfg.JWT.Secret))
+
 	// Moderation request (authenticated users)
 	usersAuth.POST("/me/request-moderation", adminHandler.RequestModeration)
 
@@ -283,6 +368,17 @@ func setupRoutes(
 	admin.GET("/federation-inspector", adminHandler.GetFederationInspector)
 	admin.GET("/federation/reputation", adminHandler.GetInstanceReputation)
 	admin.GET("/federation/network", adminHandler.GetFederationNetwork)
+	admin.GET("/federation/inbox", adminHandler.GetInboxQueue)                         // Inbox queue / dead letters
+	admin.POST("/federation/inbox/:id/replay", adminHandler.ReplayInboxActivity)       // Replay a dead-lettered activity
+	admin.GET("/federation/instances", adminHandler.GetKnownInstances)                 // Known peer registry
+	admin.PUT("/federation/instances/:domain/pin", adminHandler.PinKnownInstance)      // Pin a peer
+	admin.DELETE("/federation/instances/:domain/pin", adminHandler.UnpinKnownInstance) // Unpin a peer
+	admin.DELETE("/federation/instances/:domain", adminHandler.RemoveKnownInstance)    // Remove a peer
+	admin.GET("/federation/relays", adminHandler.GetRelays)                            // Relay subscriptions and traffic
+	admin.POST("/federation/relays", adminHandler.SubscribeRelay)                      // Follow a relay
+	admin.DELETE("/federation/relays/:id", adminHandler.UnsubscribeRelay)              // Unfollow a relay
+	admin.GET("/federation/retention", adminHandler.GetRetentionStatus)                // Table sizes and last compaction
+	admin.POST("/federation/retention/run", adminHandler.RunRetention)                 // Run retention now (dry run by default)
 	admin.GET("/messaging-security", adminHandler.GetMessagingSecurity)
 	admin.GET("/ai-actions", adminHandler.GetAIActionsQueue)       // AI-auto-removed content
 	admin.GET("/appeals", adminHandler.GetAppeals)                 // User appeals queue
@@ -295,10 +391,26 @@ func setupRoutes(
 
 	// WebFinger & ActivityPub (public, no auth)
 	e.GET("/.well-known/webfinger", webfingerHandler.Handle)
-	e.GET("/ap/users/:username", actorHandler.GetActor)          // ActivityPub Actor
-	e.POST("/ap/users/:username/inbox", inboxHandler.Handle)     // Receive activities (per-user)
-	e.POST("/ap/shared-inbox", inboxHandler.Handle)              // Shared inbox (federation)
-	e.GET("/ap/users/:username/outbox", outboxHandler.GetOutbox) // List activities
+	e.GET("/.well-known/nodeinfo", nodeInfoHandler.GetNodeInfoIndex)
+	e.GET("/nodeinfo/2.1", nodeInfoHandler.GetNodeInfo)
+	e.GET("/.well-known/host-meta", nodeInfoHandler.GetHostMeta)
+	e.GET("/.well-known/host-meta.json", nodeInfoHandler.GetHostMetaJSON)
+	e.GET("/ap/actor", actorHandler.GetInstanceActor)        // Instance (Application) actor, always unsigned so peers can fetch our key
+	e.POST("/ap/users/:username/inbox", inboxHandler.Handle) // Receive activities (per-user)
+	e.POST("/ap/shared-inbox", inboxHandler.Handle)          // Shared inbox (federation)
+
+	// Object fetches require an HTTP Signature when FEDERATION_SECURE_MODE is on
+	signedFetch := middleware.RequireSignedFetch()
+	e.GET("/ap/users/:username", actorHandler.GetActor, signedFetch)                    // ActivityPub Actor
+	e.GET("/ap/users/:username/outbox", outboxHandler.GetOutbox, signedFetch)           // List activities
+	e.GET("/ap/users/:username/followers", collectionHandler.GetFollowers, signedFetch) // Followers collection
+	e.GET("/ap/users/:username/following", collectionHandler.GetFollowing, signedFetch) // Following collection
+	e.GET("/ap/users/:username/prekeys", actorHandler.GetActorPrekeys, signedFetch)     // Device prekey bundles
+	e.GET("/posts/:id", noteHandler.GetNote, signedFetch)                               // ActivityPub Note
+	e.GET("/replies/:id", noteHandler.GetReplyNote, signedFetch)                        // ActivityPub Note of a reply
+
+	// Prekey claims hand out one-time keys, so they are signed even outside secure mode
+	e.POST("/ap/users/:username/prekeys", actorHandler.ClaimActorPrekeys)
 
 	// Federation API (public, no auth required for cross-instance discovery)
 	fed := api.Group("/federation")
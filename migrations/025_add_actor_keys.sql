@@ -0,0 +1,14 @@
+-- Migration 025: Add per-user ActivityPub signing keys
+-- Every local user gets their own RSA keypair which is published on their
+-- actor document and used to sign outbound deliveries of their activities.
+-- instance_keys is kept for the instance (Application) actor only.
+
+CREATE TABLE IF NOT EXISTS actor_keys (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id         UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    key_type        TEXT NOT NULL DEFAULT 'rsa',
+    public_key_pem  TEXT NOT NULL,
+    private_key_pem TEXT NOT NULL,
+    created_at      TIMESTAMPTZ DEFAULT now()
+);
+
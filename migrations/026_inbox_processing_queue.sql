@@ -0,0 +1,15 @@
+-- Migration 026: Asynchronous inbox processing
+-- The inbox verifies and persists activities, then returns 202 Accepted.
+-- Workers pick up pending rows, retry failures with backoff, and move
+-- activities that keep failing to the 'dead' (dead-letter) state for admin replay.
+
+-- Rows stored before this migration were processed synchronously
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'processed';
+ALTER TABLE inbox_activities ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ DEFAULT now();
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+ALTER TABLE inbox_activities ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_inbox_status_next_attempt ON inbox_activities (status, next_attempt_at);
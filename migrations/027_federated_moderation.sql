@@ -0,0 +1,18 @@
+-- Migration 027: Federated moderation state from inbound Block / Flag activities
+-- actor_blocks records remote actors that blocked a local user; their content is
+-- hidden from the blocked user's feeds. Remote Flag activities land in reports and
+-- may target an account rather than a post.
+
+CREATE TABLE IF NOT EXISTS actor_blocks (
+    id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    blocker_did TEXT NOT NULL,
+    blocked_did TEXT NOT NULL,
+    activity_id TEXT,
+    created_at  TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (blocker_did, blocked_did)
+);
+
+CREATE INDEX IF NOT EXISTS idx_actor_blocks_blocked ON actor_blocks (blocked_did);
+
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS target_did TEXT;
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS source_domain TEXT;
@@ -0,0 +1,5 @@
+-- Migration 028: Shared inbox for remote actors
+-- Fan-out collapses followers on the same server into one delivery to the
+-- actor's endpoints.sharedInbox.
+
+ALTER TABLE remote_actors ADD COLUMN IF NOT EXISTS shared_inbox_url TEXT;
@@ -0,0 +1,13 @@
+-- Migration 029: Known instances registry
+-- Peers are discovered from WebFinger lookups, signed inbound activities and
+-- remote_actors, replacing the compiled-in FEDERATION_INSTANCE_MAP as the source
+-- of truth for health checks, migration and the federated timeline.
+
+CREATE TABLE IF NOT EXISTS known_instances (
+    domain TEXT PRIMARY KEY,
+    base_url TEXT NOT NULL,
+    software TEXT NOT NULL DEFAULT '',
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
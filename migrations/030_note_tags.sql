@@ -0,0 +1,25 @@
+-- Migration 030: Content warnings, sensitive media, hashtags and mentions
+-- posts.content_warning is federated as the Note summary and posts.sensitive as
+-- Note.sensitive. post_hashtags holds tags taken from federated Notes' tag arrays
+-- (their HTML content does not match the #tag text search). post_mentions records
+-- local users mentioned by a post, local or remote.
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_warning TEXT;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS sensitive BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS post_hashtags (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag     TEXT NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag ON post_hashtags (tag);
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id       UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    mentioned_did TEXT NOT NULL,
+    created_at    TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (post_id, mentioned_did)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_mentioned ON post_mentions (mentioned_did, created_at DESC);
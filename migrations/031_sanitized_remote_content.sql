@@ -0,0 +1,7 @@
+-- Migration 031: Sanitized HTML for remote content
+-- Remote Notes and actor summaries arrive as HTML. They are sanitized at ingestion:
+-- posts.content and users.bio hold the plain-text rendering (used for search, hashtags
+-- and moderation), posts.content_html and users.bio_html the allowlisted HTML.
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_html TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio_html TEXT;
@@ -0,0 +1,9 @@
+-- Migration 032: Federated replies in the replies table
+-- Remote Notes replying to a local post or reply are stored as replies so they show
+-- up in threads and move the reply counters. original_reply_uri is the remote Note ID
+-- (used to resolve replies to them and to deduplicate deliveries); content_html holds
+-- the sanitized HTML, content its plain text.
+
+ALTER TABLE replies ADD COLUMN IF NOT EXISTS original_reply_uri TEXT;
+ALTER TABLE replies ADD COLUMN IF NOT EXISTS content_html TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_replies_original_reply_uri ON replies (original_reply_uri) WHERE original_reply_uri IS NOT NULL;
@@ -0,0 +1,18 @@
+-- Migration 033: Remote thread backfill queue
+-- One row per remote thread root. Workers walk the root's ancestors, its context
+-- collection and its replies collections, caching the Notes as remote posts.
+-- Finished threads are walked again when reopened after a while.
+
+CREATE TABLE IF NOT EXISTS thread_backfills (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    note_uri TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, processing, failed, done
+    attempts INT NOT NULL DEFAULT 0,
+    fetched_count INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ DEFAULT now(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_backfills_status_next_attempt ON thread_backfills (status, next_attempt_at);
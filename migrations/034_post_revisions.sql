@@ -0,0 +1,17 @@
+-- Migration 034: Post edit history
+-- Each edit of a post, local or received as Update(Note), keeps the version it
+-- replaced. created_at is when that version was written (the post's creation or
+-- previous edit); recorded_at is when it was superseded.
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    content_html TEXT,
+    content_warning TEXT,
+    sensitive BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions (post_id, created_at);
@@ -0,0 +1,27 @@
+-- Migration 035: ActivityPub relay subscriptions
+-- The instance actor follows LitePub/Mastodon-style relays. relays holds the
+-- subscription state (kept after unsubscribing), relay_traffic counts the
+-- Announces received from and the activities forwarded to each relay.
+
+CREATE TABLE IF NOT EXISTS relays (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    inbox_url TEXT NOT NULL UNIQUE,
+    actor_uri TEXT,
+    domain TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, accepted, rejected, unsubscribed
+    follow_activity_id TEXT NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    accepted_at TIMESTAMPTZ,
+    unsubscribed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_relays_actor_uri ON relays (actor_uri);
+
+CREATE TABLE IF NOT EXISTS relay_traffic (
+    relay_id UUID NOT NULL REFERENCES relays(id) ON DELETE CASCADE,
+    direction TEXT NOT NULL, -- received, forwarded
+    activity_count BIGINT NOT NULL DEFAULT 0,
+    last_activity_at TIMESTAMPTZ,
+    PRIMARY KEY (relay_id, direction)
+);
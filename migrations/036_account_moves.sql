@@ -0,0 +1,9 @@
+-- Migration 036: User-initiated account moves
+-- also_known_as lists the actor URIs a user claims as their other accounts and is
+-- published as alsoKnownAs. moved_to is set when the account has moved; the old
+-- account stays behind as a tombstone whose actor points at the new one.
+-- Remote accounts that sent us a verified Move get moved_to as well.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS also_known_as TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS moved_to TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS moved_at TIMESTAMPTZ;
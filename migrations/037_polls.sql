@@ -0,0 +1,38 @@
+-- Migration 037: Polls
+-- A post can carry one poll. For local polls the counts in poll_options are
+-- maintained from poll_votes and recounted when the poll closes; for remote
+-- polls they mirror the counts of the author's Question and poll_votes only
+-- holds the votes our own users sent.
+
+CREATE TABLE IF NOT EXISTS polls (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    multiple BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMPTZ,
+    closed_at TIMESTAMPTZ,
+    voters_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_open_expiry ON polls (expires_at) WHERE closed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    votes_count INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (poll_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    option_id UUID NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    voter_did TEXT NOT NULL, -- local DID or remote actor URI
+    original_vote_uri TEXT, -- id of the vote Note, for remote votes
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (poll_id, option_id, voter_did)
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_voter ON poll_votes (poll_id, voter_did);
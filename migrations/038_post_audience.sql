@@ -0,0 +1,12 @@
+-- Migration 038: Audience of non-public remote posts
+-- Followers-only and limited (circle) Notes from other servers are stored with their
+-- visibility instead of as public posts. post_audience lists the local users a Note
+-- was explicitly addressed to; followers-only posts are also shown to local followers.
+
+CREATE TABLE IF NOT EXISTS post_audience (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    recipient_did TEXT NOT NULL,
+    PRIMARY KEY (post_id, recipient_did)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_audience_recipient ON post_audience (recipient_did);
@@ -0,0 +1,37 @@
+-- Migration 039: Retention for federation bookkeeping tables
+-- The worker deletes delivered outbox rows, finished inbox rows, expired deduplication
+-- entries and stale federation_connections edges once they are older than their TTL.
+-- Deleted deliveries are first summed into federation_delivery_daily, one row per day,
+-- remote domain and direction, so reputation and the inspector keep their history.
+-- retention_runs records every run, including dry runs that only count.
+
+CREATE TABLE IF NOT EXISTS federation_delivery_daily (
+    day DATE NOT NULL,
+    domain TEXT NOT NULL,
+    direction TEXT NOT NULL CHECK (direction IN ('inbound', 'outbound')),
+    success_count BIGINT NOT NULL DEFAULT 0, -- outbound: sent, inbound: processed
+    failure_count BIGINT NOT NULL DEFAULT 0, -- outbound: failed, inbound: dead-lettered
+    last_activity_at TIMESTAMPTZ,
+    PRIMARY KEY (day, domain, direction)
+);
+
+CREATE INDEX IF NOT EXISTS idx_federation_delivery_daily_domain ON federation_delivery_daily (domain, day);
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    dry_run BOOLEAN NOT NULL DEFAULT false,
+    outbox_deleted BIGINT NOT NULL DEFAULT 0,
+    inbox_deleted BIGINT NOT NULL DEFAULT 0,
+    dedup_deleted BIGINT NOT NULL DEFAULT 0,
+    connections_deleted BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_started ON retention_runs (started_at DESC);
+
+-- Retention selects by age
+CREATE INDEX IF NOT EXISTS idx_outbox_created ON outbox_activities (created_at);
+CREATE INDEX IF NOT EXISTS idx_inbox_received ON inbox_activities (received_at);
+CREATE INDEX IF NOT EXISTS idx_activity_dedup_expires ON activity_deduplication (expires_at);
@@ -0,0 +1,30 @@
+-- Migration 040: Group conversations
+-- A group thread has any number of members, listed in message_thread_members with a
+-- role; one-to-one threads keep using participant_a_id / participant_b_id. Group
+-- messages have no recipient_id, so each member tracks what they have read with
+-- last_read_at. federation_context is the context URI of a group started on another
+-- server; inbound group messages carrying it are filed into the same thread.
+
+ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS is_group BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE message_threads ADD COLUMN IF NOT EXISTS federation_context TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_threads_federation_context
+    ON message_threads (federation_context) WHERE federation_context IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS message_thread_members (
+    thread_id UUID NOT NULL REFERENCES message_threads(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'member')),
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_read_at TIMESTAMPTZ,
+    PRIMARY KEY (thread_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_thread_members_user ON message_thread_members (user_id);
+
+-- Databases created from 001 still require a recipient and both participants
+ALTER TABLE messages ALTER COLUMN recipient_did DROP NOT NULL;
+ALTER TABLE message_threads ALTER COLUMN participant_a DROP NOT NULL;
+ALTER TABLE message_threads ALTER COLUMN participant_b DROP NOT NULL;
@@ -0,0 +1,63 @@
+-- Migration 041: Cursor-based message sync
+-- Every change a device has to learn about takes the next value of message_change_seq:
+-- a new message, an edit, a deletion or a read receipt bumps messages.change_seq, and
+-- a group member's read position bumps message_thread_members.read_change_seq. A
+-- device syncs with the highest value it has seen as its cursor.
+-- message_device_deliveries records when each device of a user first received a
+-- message, independently of the other devices of that user.
+
+CREATE SEQUENCE IF NOT EXISTS message_change_seq;
+
+-- The volatile default numbers existing rows as the column is added
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('message_change_seq');
+CREATE INDEX IF NOT EXISTS idx_messages_change_seq ON messages (change_seq);
+
+ALTER TABLE message_thread_members ADD COLUMN IF NOT EXISTS read_change_seq BIGINT NOT NULL DEFAULT nextval('message_change_seq');
+CREATE INDEX IF NOT EXISTS idx_message_thread_members_read_change_seq ON message_thread_members (read_change_seq);
+
+CREATE OR REPLACE FUNCTION bump_message_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.content IS DISTINCT FROM OLD.content
+        OR NEW.ciphertext IS DISTINCT FROM OLD.ciphertext
+        OR NEW.encrypted_keys IS DISTINCT FROM OLD.encrypted_keys
+        OR NEW.is_read IS DISTINCT FROM OLD.is_read
+        OR NEW.edited_at IS DISTINCT FROM OLD.edited_at
+        OR NEW.deleted_at IS DISTINCT FROM OLD.deleted_at THEN
+        NEW.change_seq = nextval('message_change_seq');
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_messages_change_seq ON messages;
+CREATE TRIGGER bump_messages_change_seq
+    BEFORE UPDATE ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_message_change_seq();
+
+CREATE OR REPLACE FUNCTION bump_read_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.last_read_at IS DISTINCT FROM OLD.last_read_at THEN
+        NEW.read_change_seq = nextval('message_change_seq');
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_message_thread_members_read_change_seq ON message_thread_members;
+CREATE TRIGGER bump_message_thread_members_read_change_seq
+    BEFORE UPDATE ON message_thread_members
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_read_change_seq();
+
+CREATE TABLE IF NOT EXISTS message_device_deliveries (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, user_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_device_deliveries_device ON message_device_deliveries (user_id, device_id);
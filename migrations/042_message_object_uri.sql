@@ -0,0 +1,8 @@
+-- Migration 042: Federated message IDs
+-- object_uri is the Note ID of a message received from another server. Edits,
+-- deletions and read receipts sent by that server refer to the message by it.
+-- Messages sent from here use the Note ID /messages/<id> and leave it empty.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS object_uri TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_object_uri ON messages (object_uri) WHERE object_uri IS NOT NULL;
@@ -0,0 +1,34 @@
+-- Migration 043: Prekey bundles for device encryption
+-- Each approved device publishes a signed prekey, signed with its encryption_public_key
+-- (the identity key of the device), and a batch of one-time prekeys. A sender starting
+-- a session claims one bundle per device of the recipient; every claim takes its own
+-- one-time prekey. Signed prekeys record the identity key they were signed with so a
+-- re-registered device key does not serve stale bundles.
+
+CREATE TABLE IF NOT EXISTS device_signed_prekeys (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    key_id INTEGER NOT NULL,
+    public_key TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    identity_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, device_id, key_id)
+);
+
+CREATE TABLE IF NOT EXISTS device_one_time_prekeys (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    key_id INTEGER NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- The device (DID#device) or remote actor the key was handed out to
+    claimed_by TEXT,
+    claimed_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, device_id, key_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_one_time_prekeys_available
+    ON device_one_time_prekeys (user_id, device_id, created_at) WHERE claimed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_device_one_time_prekeys_claimed_by
+    ON device_one_time_prekeys (user_id, claimed_by, claimed_at) WHERE claimed_at IS NOT NULL;
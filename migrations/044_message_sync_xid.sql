@@ -0,0 +1,40 @@
+-- Migration 044: Commit-safe message sync cursors
+-- change_seq is taken when a row is written, not when its transaction commits: if one
+-- writer takes 10 and another 11 and the second commits first, a device syncing in
+-- between moves its cursor past 10 and never sees the first change. Each change now
+-- also records the transaction that wrote it. Sync orders changes by (transaction,
+-- sequence) and only returns those of transactions older than every transaction still
+-- running, so a change can no longer commit behind a cursor already handed out.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+CREATE INDEX IF NOT EXISTS idx_messages_change_xid_seq ON messages (change_xid, change_seq);
+
+ALTER TABLE message_thread_members ADD COLUMN IF NOT EXISTS read_change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+CREATE INDEX IF NOT EXISTS idx_message_thread_members_read_change_xid_seq ON message_thread_members (read_change_xid, read_change_seq);
+
+CREATE OR REPLACE FUNCTION bump_message_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.content IS DISTINCT FROM OLD.content
+        OR NEW.ciphertext IS DISTINCT FROM OLD.ciphertext
+        OR NEW.encrypted_keys IS DISTINCT FROM OLD.encrypted_keys
+        OR NEW.is_read IS DISTINCT FROM OLD.is_read
+        OR NEW.edited_at IS DISTINCT FROM OLD.edited_at
+        OR NEW.deleted_at IS DISTINCT FROM OLD.deleted_at THEN
+        NEW.change_seq = nextval('message_change_seq');
+        NEW.change_xid = pg_current_xact_id();
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION bump_read_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.last_read_at IS DISTINCT FROM OLD.last_read_at THEN
+        NEW.read_change_seq = nextval('message_change_seq');
+        NEW.read_change_xid = pg_current_xact_id();
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
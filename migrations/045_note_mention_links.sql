@@ -0,0 +1,12 @@
+-- Migration 045: Stored mention links
+-- The actor URI each mention in a local post or reply links to is resolved once, when
+-- the text is written, and kept here keyed by the lowercased handle (username or
+-- username@domain). Notes are rendered from these rows, so serving a Note never looks
+-- accounts up over WebFinger. object_id is the id of the post or reply.
+
+CREATE TABLE IF NOT EXISTS note_mention_links (
+    object_id TEXT NOT NULL,
+    handle    TEXT NOT NULL,
+    href      TEXT NOT NULL,
+    PRIMARY KEY (object_id, handle)
+);
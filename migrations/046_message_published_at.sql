@@ -0,0 +1,7 @@
+-- Migration 046: Published time of federated messages
+-- published_at is the published time of the Note a message was received as, never later
+-- than its arrival. The edit and delete window of a remote message runs from it rather
+-- than from created_at, so a delayed delivery does not extend the window. It stays
+-- empty for messages sent from here.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
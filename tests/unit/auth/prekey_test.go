@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"splitter/internal/models"
+)
+
+/*
+PREKEY BUNDLE UNIT TEST SUMMARY:
+- What is tested: validation of device prekey uploads and the low-prekey status in
+  internal/models/prekey.go (no DB required).
+- Test cases:
+    - PrekeyUpload.Validate: empty upload, incomplete signed prekey, repeated or
+      negative key IDs, oversized batches, trimming of encoded keys
+    - NewPrekeyStatus: low one-time prekey count, missing and stale signed prekeys
+
+RESULT SUMMARY:
+- Pure model logic, zero external dependencies.
+- Claiming is not covered here: it relies on row locking in PostgreSQL.
+*/
+
+func TestPrekeyUploadValidate(t *testing.T) {
+	batch := func(n int) []models.OneTimePrekey {
+		keys := make([]models.OneTimePrekey, n)
+		for i := range keys {
+			keys[i] = models.OneTimePrekey{KeyID: i, PublicKey: "otk"}
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name    string
+		upload  models.PrekeyUpload
+		wantErr bool
+	}{
+		{"empty", models.PrekeyUpload{}, true},
+		{"signed prekey only", models.PrekeyUpload{SignedPrekey: &models.SignedPrekey{KeyID: 1, PublicKey: "spk", Signature: "sig"}}, false},
+		{"one-time prekeys only", models.PrekeyUpload{OneTimePrekeys: batch(3)}, false},
+		{"unsigned prekey", models.PrekeyUpload{SignedPrekey: &models.SignedPrekey{KeyID: 1, PublicKey: "spk", Signature: "  "}}, true},
+		{"negative signed key id", models.PrekeyUpload{SignedPrekey: &models.SignedPrekey{KeyID: -1, PublicKey: "spk", Signature: "sig"}}, true},
+		{"oversized signed prekey", models.PrekeyUpload{SignedPrekey: &models.SignedPrekey{PublicKey: strings.Repeat("a", models.PrekeyMaxLength+1), Signature: "sig"}}, true},
+		{"repeated key id", models.PrekeyUpload{OneTimePrekeys: []models.OneTimePrekey{{KeyID: 4, PublicKey: "a"}, {KeyID: 4, PublicKey: "b"}}}, true},
+		{"missing public key", models.PrekeyUpload{OneTimePrekeys: []models.OneTimePrekey{{KeyID: 4}}}, true},
+		{"full batch", models.PrekeyUpload{OneTimePrekeys: batch(models.PrekeyUploadMaxBatch)}, false},
+		{"batch too large", models.PrekeyUpload{OneTimePrekeys: batch(models.PrekeyUploadMaxBatch + 1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.upload.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrekeyUploadValidateTrims(t *testing.T) {
+	upload := models.PrekeyUpload{
+		SignedPrekey:   &models.SignedPrekey{KeyID: 7, PublicKey: " spk\n", Signature: " sig "},
+		OneTimePrekeys: []models.OneTimePrekey{{KeyID: 1, PublicKey: "\totk "}},
+	}
+	if err := upload.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if upload.SignedPrekey.PublicKey != "spk" || upload.SignedPrekey.Signature != "sig" || upload.OneTimePrekeys[0].PublicKey != "otk" {
+		t.Fatalf("expected trimmed keys, got %+v and %+v", upload.SignedPrekey, upload.OneTimePrekeys)
+	}
+}
+
+func TestNewPrekeyStatus(t *testing.T) {
+	now := time.Now()
+	fresh := now.Add(-time.Hour)
+	old := now.Add(-models.SignedPrekeyMaxAge - time.Hour)
+
+	tests := []struct {
+		name      string
+		available int
+		signedAt  *time.Time
+		wantLow   bool
+		wantStale bool
+	}{
+		{"stocked", models.PrekeyLowThreshold, &fresh, false, false},
+		{"running low", models.PrekeyLowThreshold - 1, &fresh, true, false},
+		{"exhausted without signed prekey", 0, nil, true, true},
+		{"stale signed prekey", 50, &old, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := models.NewPrekeyStatus("phone", tt.available, tt.signedAt, now)
+			if status.LowPrekeys != tt.wantLow || status.SignedPrekeyStale != tt.wantStale {
+				t.Fatalf("NewPrekeyStatus() = %+v, want low %v stale %v", status, tt.wantLow, tt.wantStale)
+			}
+		})
+	}
+}
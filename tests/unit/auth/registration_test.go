@@ -0,0 +1,43 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"splitter/internal/config"
+	"splitter/internal/handlers"
+	"splitter/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- NodeInfo advertises whether the instance accepts sign-ups; an instance advertising
+  closed registrations must actually refuse them.
+
+EXPECTED BEHAVIOR:
+- With registrations closed, POST /api/v1/auth/register is refused with 403 before the
+  request is even read.
+*/
+
+func TestRegisterRefusedWhenRegistrationsClosed(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.Server.RegistrationsOpen = false
+	handler := handlers.NewAuthHandler(repository.NewUserRepository(), cfg)
+
+	body := `{"username":"alice","email":"alice@example.com","password":"correct horse battery"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := handler.Register(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 with registrations closed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
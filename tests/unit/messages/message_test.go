@@ -0,0 +1,263 @@
+package messages_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"splitter/internal/models"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- Group conversations are checked before anything reaches the database.
+- A thread's membership decides who can read and send, for one-to-one and group threads alike.
+- Encrypted group messages must carry an envelope for every member device.
+- Devices catch up with a cursor and must not lose or repeat changes between pages.
+
+EXPECTED BEHAVIOR:
+- Group titles are trimmed and limited; member lists are deduplicated, exclude the owner and are limited.
+- One-to-one threads admit their two participants; group threads admit their members.
+- Group envelopes are keyed by DID and device, and missing envelopes are reported by key ID.
+- A syncing device gets its own envelope; sync pages merge message and read state changes
+  in sequence order, and their cursor resumes right after the last change returned.
+
+TEST RESULT SUMMARY:
+- Passed: Validation, membership, envelope key and sync paging cases.
+- Failed: None
+- Limitations: Repository queries and the change sequence triggers are not exercised.
+*/
+
+func TestGroupThreadCreateValidation(t *testing.T) {
+	manyMembers := make([]string, models.GroupMaxMembers)
+	for i := range manyMembers {
+		manyMembers[i] = "user-" + strings.Repeat("x", i+1)
+	}
+
+	tests := []struct {
+		name        string
+		group       models.GroupThreadCreate
+		wantErr     bool
+		wantTitle   string
+		wantMembers int
+	}{
+		{"valid group", models.GroupThreadCreate{Title: "  Team  ", MemberIDs: []string{"bob", "carol"}}, false, "Team", 2},
+		{"owner and repeats are dropped", models.GroupThreadCreate{MemberIDs: []string{"owner", "bob", "bob", " ", "carol"}}, false, "", 2},
+		{"no other member", models.GroupThreadCreate{MemberIDs: []string{"owner"}}, true, "", 0},
+		{"title too long", models.GroupThreadCreate{Title: strings.Repeat("a", models.GroupTitleMaxLen+1), MemberIDs: []string{"bob"}}, true, "", 0},
+		{"too many members", models.GroupThreadCreate{MemberIDs: manyMembers}, true, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.group.Validate("owner")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.group.Title != tt.wantTitle || len(tt.group.MemberIDs) != tt.wantMembers {
+				t.Fatalf("expected title %q with %d members, got %q with %v", tt.wantTitle, tt.wantMembers, tt.group.Title, tt.group.MemberIDs)
+			}
+		})
+	}
+}
+
+func TestMessageThreadHasMember(t *testing.T) {
+	direct := &models.MessageThread{ParticipantAID: "alice", ParticipantBID: "bob"}
+	group := &models.MessageThread{
+		IsGroup: true,
+		Members: []*models.ThreadMember{
+			{UserID: "alice", Role: models.ThreadRoleOwner},
+			{UserID: "carol", Role: models.ThreadRoleMember},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		thread *models.MessageThread
+		userID string
+		want   bool
+	}{
+		{"direct participant", direct, "bob", true},
+		{"direct outsider", direct, "carol", false},
+		{"direct empty user", &models.MessageThread{ParticipantAID: "alice"}, "", false},
+		{"group member", group, "carol", true},
+		{"group outsider", group, "bob", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.thread.HasMember(tt.userID); got != tt.want {
+				t.Fatalf("HasMember(%q) = %v, want %v", tt.userID, got, tt.want)
+			}
+		})
+	}
+
+	if member := group.Member("alice"); member == nil || member.Role != models.ThreadRoleOwner {
+		t.Fatalf("expected alice to be the owner, got %+v", member)
+	}
+}
+
+func TestMissingEnvelopeKeys(t *testing.T) {
+	keys := []*models.ThreadDeviceKey{
+		{KeyID: models.GroupEnvelopeKeyID("did:key:alice", "phone")},
+		{KeyID: models.GroupEnvelopeKeyID("did:key:alice", "laptop")},
+		{KeyID: models.GroupEnvelopeKeyID("did:key:bob", "")},
+	}
+	if keys[0].KeyID != "did:key:alice#phone" || keys[2].KeyID != "did:key:bob" {
+		t.Fatalf("unexpected key IDs %q and %q", keys[0].KeyID, keys[2].KeyID)
+	}
+
+	missing := models.MissingEnvelopeKeys(keys, map[string]string{
+		"did:key:alice#phone": "wrapped-1",
+		"did:key:bob":         " ",
+	})
+	if len(missing) != 2 || missing[0] != "did:key:alice#laptop" || missing[1] != "did:key:bob" {
+		t.Fatalf("expected the laptop and blank bob envelopes to be missing, got %v", missing)
+	}
+
+	if missing := models.MissingEnvelopeKeys(keys, map[string]string{
+		"did:key:alice#phone":  "a",
+		"did:key:alice#laptop": "b",
+		"did:key:bob":          "c",
+	}); len(missing) != 0 {
+		t.Fatalf("expected no missing envelopes, got %v", missing)
+	}
+}
+
+func TestDeviceEnvelope(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string]string
+		want string
+	}{
+		{"group envelope of the device", map[string]string{"did:key:alice#phone": "group", "phone": "bare", "did:key:alice": "account"}, "group"},
+		{"bare device ID", map[string]string{"phone": "bare", "did:key:alice": "account"}, "bare"},
+		{"account key", map[string]string{"did:key:alice": "account", "did:key:alice#laptop": "laptop"}, "account"},
+		{"blank entries are skipped", map[string]string{"did:key:alice#phone": " ", "did:key:alice": "account"}, "account"},
+		{"nothing for this device", map[string]string{"did:key:bob": "bob"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := models.DeviceEnvelope(tt.keys, "did:key:alice", "phone"); got != tt.want {
+				t.Fatalf("DeviceEnvelope() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyncCursor(t *testing.T) {
+	tests := []struct {
+		cursor  string
+		want    models.SyncCursor
+		wantErr bool
+	}{
+		{"", models.SyncCursor{}, false},
+		{"7.42", models.SyncCursor{XID: 7, Seq: 42}, false},
+		// A bare sequence predates transaction cursors and starts over
+		{"42", models.SyncCursor{}, false},
+		{"-1", models.SyncCursor{}, true},
+		{"7.-1", models.SyncCursor{}, true},
+		{"x.42", models.SyncCursor{}, true},
+		{"abc", models.SyncCursor{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := models.ParseSyncCursor(tt.cursor)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Fatalf("ParseSyncCursor(%q) = %+v, %v; want %+v, wantErr %v", tt.cursor, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewMessageSyncPage(t *testing.T) {
+	message := func(seq int64) *models.MessageChange {
+		return &models.MessageChange{Message: &models.Message{ID: "m" + strconv.FormatInt(seq, 10)}, Position: models.SyncCursor{XID: seq, Seq: seq}}
+	}
+	readState := func(seq int64) *models.ReadStateChange {
+		return &models.ReadStateChange{ThreadID: "t", UserID: "u" + strconv.FormatInt(seq, 10), Position: models.SyncCursor{XID: seq, Seq: seq}}
+	}
+	const noneRunning = 100
+
+	// Each list is fetched with limit+1 entries after the cursor
+	messages := []*models.MessageChange{message(11), message(12), message(15)}
+	readStates := []*models.ReadStateChange{readState(13), readState(16), readState(17)}
+	cursor := models.SyncCursor{XID: 10, Seq: 10}
+
+	page := models.NewMessageSyncPage(messages, readStates, cursor, noneRunning, 2)
+	if len(page.Messages) != 2 || len(page.ReadStates) != 0 || page.Cursor != "12.12" || !page.HasMore {
+		t.Fatalf("expected messages 11 and 12 with cursor 12 and more to come, got %+v", page)
+	}
+
+	page = models.NewMessageSyncPage(messages, readStates, cursor, noneRunning, 4)
+	if len(page.Messages) != 3 || len(page.ReadStates) != 1 || page.Cursor != "15.15" || !page.HasMore {
+		t.Fatalf("expected changes 11 to 15 with cursor 15 and more to come, got %+v", page)
+	}
+
+	page = models.NewMessageSyncPage(messages[2:], readStates[1:], models.SyncCursor{XID: 13, Seq: 13}, noneRunning, 10)
+	if len(page.Messages) != 1 || len(page.ReadStates) != 2 || page.Cursor != "17.17" || page.HasMore {
+		t.Fatalf("expected the last three changes and no more, got %+v", page)
+	}
+
+	page = models.NewMessageSyncPage(nil, nil, models.SyncCursor{XID: 17, Seq: 17}, noneRunning, 10)
+	if page.Messages == nil || page.ReadStates == nil || page.Cursor != "17.17" || page.HasMore {
+		t.Fatalf("expected an empty page keeping the cursor, got %+v", page)
+	}
+}
+
+/*
+WHY THIS TEST EXISTS:
+- Change sequences are taken when a row is written, not when it commits. A writer can
+  take seq 10, a second writer seq 11 and commit first; a device syncing in between
+  must not move its cursor past the change the first writer has not committed yet.
+
+EXPECTED BEHAVIOR:
+- Changes of transactions at or after the oldest running one are held back.
+- Once that transaction commits, its change is returned after the cursor given out.
+*/
+
+func TestNewMessageSyncPageWaitsForRunningWriters(t *testing.T) {
+	change := func(id string, xid, seq int64) *models.MessageChange {
+		return &models.MessageChange{Message: &models.Message{ID: id}, Position: models.SyncCursor{XID: xid, Seq: seq}}
+	}
+
+	// Writer A (xid 100) takes seq 10, writer B (xid 101) takes seq 11, B commits first
+	a := change("a", 100, 10)
+	b := change("b", 101, 11)
+	// A writer that started before A (xid 90) takes seq 12 and commits too
+	early := change("early", 90, 12)
+
+	// A is still running: only what committed below it may be handed out
+	page := models.NewMessageSyncPage([]*models.MessageChange{early, b}, nil, models.SyncCursor{}, 100, 10)
+	if len(page.Messages) != 1 || page.Messages[0].ID != "early" || page.HasMore {
+		t.Fatalf("expected only the change below the running writer, got %+v", page)
+	}
+	cursor, err := models.ParseSyncCursor(page.Cursor)
+	if err != nil {
+		t.Fatalf("failed to parse cursor %q: %v", page.Cursor, err)
+	}
+
+	// A commits; the next sync resumes from the cursor and sees A before B
+	var after []*models.MessageChange
+	for _, c := range []*models.MessageChange{early, a, b} {
+		if cursor.Before(c.Position) {
+			after = append(after, c)
+		}
+	}
+	page = models.NewMessageSyncPage(after, nil, cursor, 102, 10)
+	if len(page.Messages) != 2 || page.Messages[0].ID != "a" || page.Messages[1].ID != "b" {
+		t.Fatalf("expected the delayed change and the one after it, got %+v", page)
+	}
+	if page.Cursor != "101.11" {
+		t.Fatalf("expected the cursor to end at writer B, got %q", page.Cursor)
+	}
+
+	// With no stable change the cursor stays put and the device is not told to hurry
+	page = models.NewMessageSyncPage([]*models.MessageChange{b}, nil, cursor, 100, 10)
+	if len(page.Messages) != 0 || page.Cursor != cursor.String() || page.HasMore {
+		t.Fatalf("expected an empty page keeping the cursor, got %+v", page)
+	}
+}
@@ -0,0 +1,73 @@
+package posts_test
+
+import (
+	"testing"
+	"time"
+
+	"splitter/internal/federation"
+	"splitter/internal/handlers"
+	"splitter/internal/repository"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- A user's outbox is built from their public posts and reposts rather than the delivery
+  log, so remote servers backfilling it must get well-formed Create and Announce activities.
+
+EXPECTED BEHAVIOR:
+- A post is listed as a Create of its Note, with local media made absolute.
+- A repost is listed as an Announce of the original Note (the remote URI for remote posts)
+  under an ID derived from the repost, so every fetch returns the same activity.
+- Entries of an unknown kind are left out.
+*/
+
+func TestOutboxActivity(t *testing.T) {
+	const baseURL = "https://splitter.test"
+	const actorURI = baseURL + "/ap/users/alice"
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	post := &repository.OutboxEntry{
+		Kind: "create", ActivityKey: "post-1", PostID: "post-1",
+		Content: "hello fediverse", MediaURL: "/uploads/cat.png",
+		ContentWarning: "cats", Sensitive: true, PostCreatedAt: created, ActivityAt: created,
+	}
+	activity := handlers.OutboxActivity(baseURL, actorURI, post)
+	if activity == nil || activity.Type != "Create" || activity.Actor != actorURI {
+		t.Fatalf("expected a Create by %s, got %+v", actorURI, activity)
+	}
+	note, ok := activity.Object.(federation.Note)
+	if !ok {
+		t.Fatalf("expected a Note object, got %T", activity.Object)
+	}
+	if len(note.Attachment) != 1 || note.Attachment[0].URL != baseURL+"/uploads/cat.png" {
+		t.Fatalf("expected the media attached by absolute URL, got %+v", note.Attachment)
+	}
+	if note.Summary != "cats" || !note.Sensitive {
+		t.Fatalf("expected the content warning to be kept, got %q sensitive=%v", note.Summary, note.Sensitive)
+	}
+
+	tests := []struct {
+		name       string
+		entry      *repository.OutboxEntry
+		wantObject string
+	}{
+		{"repost of a local post", &repository.OutboxEntry{Kind: "announce", ActivityKey: "like-7", PostID: "post-2"}, baseURL + "/posts/post-2"},
+		{"repost of a remote post", &repository.OutboxEntry{Kind: "announce", ActivityKey: "like-8", PostID: "post-3", IsRemote: true, OriginalPostURI: "https://mastodon.test/users/bob/statuses/9"}, "https://mastodon.test/users/bob/statuses/9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := handlers.OutboxActivity(baseURL, actorURI, tt.entry)
+			second := handlers.OutboxActivity(baseURL, actorURI, tt.entry)
+			if first == nil || first.Type != "Announce" || first.Object != tt.wantObject {
+				t.Fatalf("expected an Announce of %s, got %+v", tt.wantObject, first)
+			}
+			if first.ID != baseURL+"/activities/announce-"+tt.entry.ActivityKey || second.ID != first.ID {
+				t.Fatalf("expected a stable Announce ID, got %s and %s", first.ID, second.ID)
+			}
+		})
+	}
+
+	if activity := handlers.OutboxActivity(baseURL, actorURI, &repository.OutboxEntry{Kind: "like"}); activity != nil {
+		t.Fatalf("expected unknown entries to be skipped, got %+v", activity)
+	}
+}
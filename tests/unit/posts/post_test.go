@@ -14,10 +14,12 @@ WHY THIS TEST EXISTS:
 EXPECTED BEHAVIOR:
 - valid content passes.
 - empty content fails unless media is present.
-- invalid visibility fails.
+- circle visibility passes, invalid visibility fails.
+- content warnings longer than 200 characters fail.
+- polls need 2-4 unique options of at most 50 characters, a valid expiry and no media.
 
 TEST RESULT SUMMARY:
-- Passed: Valid post, too long content, empty content (no media), empty content (with media), invalid visibility.
+- Passed: Valid post, too long content, empty content (no media), empty content (with media), invalid visibility, content warning length, poll options and expiry.
 */
 
 func TestPostCreateValidation(t *testing.T) {
@@ -66,6 +68,15 @@ func TestPostCreateValidation(t *testing.T) {
 			hasMedia: true,
 			wantErr:  false,
 		},
+		{
+			name: "Circle Visibility",
+			post: models.PostCreate{
+				Content:    "Close friends only",
+				Visibility: "circle",
+			},
+			hasMedia: false,
+			wantErr:  false,
+		},
 		{
 			name: "Invalid Visibility",
 			post: models.PostCreate{
@@ -76,6 +87,85 @@ func TestPostCreateValidation(t *testing.T) {
 			wantErr:  true,
 			errMsg:   "invalid visibility setting",
 		},
+		{
+			name: "Content Warning Too Long",
+			post: models.PostCreate{
+				Content:        "Valid content",
+				ContentWarning: strings.Repeat("w", 201),
+			},
+			hasMedia: false,
+			wantErr:  true,
+			errMsg:   "content warning too long",
+		},
+		{
+			name: "Valid Content Warning",
+			post: models.PostCreate{
+				Content:        "Valid content",
+				ContentWarning: "Spoilers",
+				Sensitive:      true,
+			},
+			hasMedia: false,
+			wantErr:  false,
+		},
+		{
+			name: "Valid Poll",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza", "Sushi"}},
+			},
+			hasMedia: false,
+			wantErr:  false,
+		},
+		{
+			name: "Poll With One Option",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza"}},
+			},
+			hasMedia: false,
+			wantErr:  true,
+			errMsg:   "between 2 and 4 options",
+		},
+		{
+			name: "Poll With Duplicate Options",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza", " Pizza "}},
+			},
+			hasMedia: false,
+			wantErr:  true,
+			errMsg:   "must be unique",
+		},
+		{
+			name: "Poll Option Too Long",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza", strings.Repeat("s", 51)}},
+			},
+			hasMedia: false,
+			wantErr:  true,
+			errMsg:   "poll option too long",
+		},
+		{
+			name: "Poll Expiry Too Short",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza", "Sushi"}, ExpiresInMinutes: 1},
+			},
+			hasMedia: false,
+			wantErr:  true,
+			errMsg:   "poll expires_in_minutes",
+		},
+		{
+			name: "Poll With Media",
+			post: models.PostCreate{
+				Content: "Lunch?",
+				Poll:    &models.PollCreate{Options: []string{"Pizza", "Sushi"}},
+			},
+			hasMedia: true,
+			wantErr:  true,
+			errMsg:   "both media and a poll",
+		},
 	}
 
 	for _, tt := range tests {
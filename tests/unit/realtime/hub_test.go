@@ -0,0 +1,135 @@
+package realtime_test
+
+import (
+	"testing"
+	"time"
+
+	"splitter/internal/realtime"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- Clients rely on the realtime hub instead of polling for new messages and notifications.
+- Reconnecting clients must not silently miss events.
+
+EXPECTED BEHAVIOR:
+- Published events reach every connection of each recipient once, and nobody else.
+- Resuming with the id of the last handled event replays what was missed.
+- Resume tokens the hub cannot honour ask the client to resync.
+- A connection that stops reading is closed instead of blocking publishers.
+
+TEST RESULT SUMMARY:
+- Passed: Fan-out, resume, resync and slow consumer cases.
+- Failed: None
+- Limitations: The Postgres relay between processes is not exercised.
+*/
+
+func receive(t *testing.T, sub *realtime.Subscription) realtime.Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events:
+		if !ok {
+			t.Fatalf("subscription closed unexpectedly")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for an event")
+	}
+	return realtime.Event{}
+}
+
+func TestHubFansOutToRecipients(t *testing.T) {
+	hub := realtime.NewHub()
+	phone, _, _ := hub.Subscribe("alice", "")
+	laptop, _, _ := hub.Subscribe("alice", "")
+	other, _, _ := hub.Subscribe("carol", "")
+
+	hub.Publish([]string{"alice", "bob", "alice"}, realtime.EventMessageCreated, map[string]string{"id": "m1"})
+
+	for _, sub := range []*realtime.Subscription{phone, laptop} {
+		event := receive(t, sub)
+		if event.Type != realtime.EventMessageCreated || event.ID == "" {
+			t.Fatalf("expected a message.created event with a resume token, got %+v", event)
+		}
+	}
+	select {
+	case event := <-phone.Events:
+		t.Fatalf("expected one event per connection, got a second %+v", event)
+	case event := <-other.Events:
+		t.Fatalf("expected no event for a non-recipient, got %+v", event)
+	default:
+	}
+
+	if got := hub.Connections(); got != 3 {
+		t.Fatalf("expected 3 connections, got %d", got)
+	}
+	hub.Unsubscribe(laptop)
+	hub.Unsubscribe(laptop)
+	if got := hub.Connections(); got != 2 {
+		t.Fatalf("expected 2 connections after unsubscribing, got %d", got)
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	hub := realtime.NewHub()
+	sub, _, _ := hub.Subscribe("alice", "")
+	hub.Publish([]string{"alice"}, realtime.EventFollowCreated, nil)
+	first := receive(t, sub)
+	hub.Unsubscribe(sub)
+
+	hub.Publish([]string{"alice"}, realtime.EventLikeCreated, nil)
+	hub.Publish([]string{"bob"}, realtime.EventLikeCreated, nil)
+	hub.Publish([]string{"alice"}, realtime.EventReplyCreated, nil)
+
+	resumed, replay, ok := hub.Subscribe("alice", first.ID)
+	defer hub.Unsubscribe(resumed)
+	if !ok {
+		t.Fatalf("expected the token of a recent event to be resumable")
+	}
+	if len(replay) != 2 || replay[0].Type != realtime.EventLikeCreated || replay[1].Type != realtime.EventReplyCreated {
+		t.Fatalf("expected the two missed events in order, got %+v", replay)
+	}
+
+	otherHub := realtime.NewHub()
+	otherSub, _, _ := otherHub.Subscribe("alice", "")
+	otherHub.Publish([]string{"alice"}, realtime.EventFollowCreated, nil)
+	otherToken := receive(t, otherSub).ID
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed token", "garbage"},
+		{"token of another hub", otherToken},
+		{"token from the future", first.ID + "999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay, ok := hub.Subscribe("alice", tt.token)
+			defer hub.Unsubscribe(sub)
+			if ok || len(replay) != 0 {
+				t.Fatalf("expected a resync, got ok=%v replay=%+v", ok, replay)
+			}
+		})
+	}
+}
+
+func TestHubClosesSlowSubscribers(t *testing.T) {
+	hub := realtime.NewHub()
+	sub, _, _ := hub.Subscribe("alice", "")
+
+	for i := 0; i < 200; i++ {
+		hub.Publish([]string{"alice"}, realtime.EventMessageCreated, i)
+	}
+
+	received := 0
+	for range sub.Events {
+		received++
+	}
+	if received == 0 || received >= 200 {
+		t.Fatalf("expected the subscription to be closed after its buffer filled, got %d events", received)
+	}
+	if got := hub.Connections(); got != 0 {
+		t.Fatalf("expected the slow subscription to be removed, got %d connections", got)
+	}
+}
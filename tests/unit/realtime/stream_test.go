@@ -0,0 +1,91 @@
+package realtime_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"splitter/internal/handlers"
+	"splitter/internal/middleware"
+	"splitter/internal/realtime"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- Stream tokens may travel in the query string and must not leak into access logs.
+- A page on another origin must not open a WebSocket stream with a user's token.
+
+EXPECTED BEHAVIOR:
+- The access_token query parameter is masked, other parameters are kept.
+- WebSocket handshakes from unlisted origins are refused; listed origins and
+  clients without an Origin header connect and receive events.
+*/
+
+func TestRedactAccessToken(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/api/v1/stream", "/api/v1/stream"},
+		{"/api/v1/stream?access_token=secret", "/api/v1/stream?access_token=REDACTED"},
+		{"/api/v1/stream?resume=42&access_token=secret", "/api/v1/stream?resume=42&access_token=REDACTED"},
+		{"/api/v1/posts?page=2", "/api/v1/posts?page=2"},
+	}
+
+	for _, tt := range tests {
+		if got := middleware.RedactAccessToken(tt.uri); got != tt.want {
+			t.Fatalf("RedactAccessToken(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestStreamWebSocketChecksOrigin(t *testing.T) {
+	e := echo.New()
+	stream := handlers.NewStreamHandler(realtime.NewHub(), []string{"http://localhost:3000"})
+	e.GET("/api/v1/stream", stream.Stream, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", "user-1")
+			return next(c)
+		}
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	// A resume token the hub cannot honour makes the stream open with a resync event
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/stream?resume=stale"
+	dial := func(origin string) (*websocket.Conn, error) {
+		config, err := websocket.NewConfig(wsURL, "http://localhost")
+		if err != nil {
+			t.Fatalf("failed to build config: %v", err)
+		}
+		// An empty origin is sent as an empty header, as non-browser clients do
+		config.Origin = &url.URL{}
+		if origin != "" {
+			config.Origin, _ = url.Parse(origin)
+		}
+		return websocket.DialConfig(config)
+	}
+
+	if ws, err := dial("https://evil.example"); err == nil {
+		ws.Close()
+		t.Fatalf("expected a handshake from an unlisted origin to be refused")
+	}
+
+	for _, origin := range []string{"http://localhost:3000", ""} {
+		ws, err := dial(origin)
+		if err != nil {
+			t.Fatalf("expected origin %q to connect, got %v", origin, err)
+		}
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var event realtime.Event
+		if err := websocket.JSON.Receive(ws, &event); err != nil || event.Type != realtime.EventResync {
+			t.Fatalf("expected a resync event for origin %q, got %+v, %v", origin, event, err)
+		}
+		ws.Close()
+	}
+}
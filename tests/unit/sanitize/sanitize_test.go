@@ -0,0 +1,217 @@
+package sanitize_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"splitter/internal/sanitize"
+)
+
+// maliciousCorpus collects payloads that must never survive sanitization.
+// It also seeds FuzzHTML.
+var maliciousCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=https://evil.test/x.js></SCRIPT>`,
+	`<img src=x onerror=alert(1)>`,
+	`<svg onload=alert(1)><circle r=1 /></svg>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href="JaVaScRiPt:alert(1)">click</a>`,
+	`<a href="java&#09;script:alert(1)">click</a>`,
+	`<a href="javascript&#58;alert(1)">click</a>`,
+	`<a href=" javascript:alert(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="//evil.test/">protocol relative</a>`,
+	`<p onclick="alert(1)" style="background:url(javascript:alert(1))">hi</p>`,
+	`<style>body{display:none}</style>visible`,
+	`<iframe src="https://evil.test"></iframe>`,
+	`<object data="https://evil.test/x.swf"><param name=x></object>`,
+	`<embed src="https://evil.test/x.swf">after`,
+	`<form action="https://evil.test"><input name=x><button>go</button></form>`,
+	`<meta http-equiv="refresh" content="0;url=https://evil.test">`,
+	`<base href="https://evil.test/">`,
+	`<link rel=stylesheet href=https://evil.test/x.css>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<template><script>alert(1)</script></template>`,
+	`<textarea><script>alert(1)</script></textarea>`,
+	`<!--<script>alert(1)</script>-->`,
+	`<scr<script>ipt>alert(1)</script>`,
+	`"><script>alert(1)</script>`,
+	`<span class="h-card evil" style="position:fixed">x</span>`,
+	`<a href="https://ok.test" onmouseover="alert(1)" rel="opener" target="_self">ok</a>`,
+	`<div><b><i><u><p>unclosed`,
+	`</p></p></a>stray closers`,
+	`<p>` + strings.Repeat(`<span>`, 100) + `deep`,
+}
+
+var (
+	tagPattern     = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+	safeTags       = regexp.MustCompile(`^(p|br|span|a|del|s|pre|code|blockquote|b|strong|i|em|u|ul|ol|li)$`)
+	unsafeAttrs    = regexp.MustCompile(`(?i)\s(on[a-z]+|style|src|action|formaction|srcdoc)\s*=`)
+	unsafeSchemes  = regexp.MustCompile(`(?i)href="\s*(javascript|vbscript|data):`)
+	protocolRelURL = regexp.MustCompile(`href="//`)
+)
+
+// assertSafe checks every tag left in output: only allowlisted elements, no event
+// handlers, styles or embedding attributes, and no script-capable link schemes.
+func assertSafe(t *testing.T, input, output string) {
+	t.Helper()
+	for _, match := range tagPattern.FindAllStringSubmatch(output, -1) {
+		if !safeTags.MatchString(strings.ToLower(match[2])) {
+			t.Fatalf("unsafe element in output for %q: %q", input, output)
+		}
+		if unsafeAttrs.MatchString(match[3]) || unsafeSchemes.MatchString(match[3]) || protocolRelURL.MatchString(match[3]) {
+			t.Fatalf("unsafe attribute in output for %q: %q", input, output)
+		}
+	}
+}
+
+func TestHTMLRemovesMaliciousPayloads(t *testing.T) {
+	for _, payload := range maliciousCorpus {
+		assertSafe(t, payload, sanitize.HTML(payload))
+	}
+}
+
+func TestHTMLKeepsMastodonMarkup(t *testing.T) {
+	input := `<p>Hi <span class="h-card"><a href="https://mastodon.test/@bob" class="u-url mention">@<span>bob</span></a></span>, see ` +
+		`<a href="https://mastodon.test/tags/go" class="mention hashtag" rel="tag">#<span>Go</span></a><br>` +
+		`<a href="https://example.test/a/very/long/path" rel="nofollow noopener" target="_blank"><span class="invisible">https://</span>` +
+		`<span class="ellipsis">example.test/a/very</span><span class="invisible">/long/path</span></a></p>`
+
+	output := sanitize.HTML(input)
+
+	for _, want := range []string{
+		`<span class="h-card"><a href="https://mastodon.test/@bob" class="u-url mention" rel="nofollow noopener noreferrer" target="_blank">@<span>bob</span></a></span>`,
+		`<a href="https://mastodon.test/tags/go" class="mention hashtag" rel="nofollow noopener noreferrer" target="_blank">#<span>Go</span></a><br>`,
+		`<span class="invisible">https://</span>`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected %q in %q", want, output)
+		}
+	}
+}
+
+func TestHTMLRewritesLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "adds rel and target",
+			input: `<a href="https://ok.test/x" rel="opener" target="_self">ok</a>`,
+			want:  `<a href="https://ok.test/x" rel="nofollow noopener noreferrer" target="_blank">ok</a>`,
+		},
+		{
+			name:  "drops unsafe scheme but keeps text",
+			input: `<a href="javascript:alert(1)">click</a>`,
+			want:  `<a rel="nofollow noopener noreferrer" target="_blank">click</a>`,
+		},
+		{
+			name:  "drops relative links",
+			input: `<a href="/local">x</a>`,
+			want:  `<a rel="nofollow noopener noreferrer" target="_blank">x</a>`,
+		},
+		{
+			name:  "keeps mailto",
+			input: `<a href="mailto:a@b.test">mail</a>`,
+			want:  `<a href="mailto:a@b.test" rel="nofollow noopener noreferrer" target="_blank">mail</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitize.HTML(tt.input); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLStructure(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unwraps unknown elements", `<div><h1>Title</h1><p>body</p></div>`, `Title<p>body</p>`},
+		{"drops script with content", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"closes unclosed tags", `<p><b>bold`, `<p><b>bold</b></p>`},
+		{"ignores stray end tags", `</b>text</p>`, `text`},
+		{"escapes text", `<p>1 &lt; 2 &amp; "q"</p>`, `<p>1 &lt; 2 &amp; &#34;q&#34;</p>`},
+		{"keeps numeric list attributes", `<ol start="3" reversed onclick="x"><li value="x">a</li></ol>`, `<ol start="3" reversed><li>a</li></ol>`},
+		{"void embed does not swallow content", `<embed src=x>after`, `after`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitize.HTML(tt.input); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "mastodon status",
+			input: `<p>Hello <span class="h-card"><a href="https://m.test/@bob" class="u-url mention">@<span>bob</span></a></span> <a href="https://m.test/tags/go" class="mention hashtag" rel="tag">#<span>Go</span></a></p><p>line one<br>line two</p>`,
+			want:  "Hello @bob #Go\n\nline one\nline two",
+		},
+		{
+			name:  "decodes entities",
+			input: `<p>Tom &amp; Jerry &lt;3</p>`,
+			want:  "Tom & Jerry <3",
+		},
+		{
+			name:  "drops scripts and styles",
+			input: `<style>p{}</style><p>safe</p><script>alert(1)</script>`,
+			want:  "safe",
+		},
+		{
+			name:  "lists",
+			input: `<ul><li>one</li><li>two</li></ul>`,
+			want:  "- one\n- two",
+		},
+		{
+			name:  "plain text passes through",
+			input: "already plain",
+			want:  "already plain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitize.Text(tt.input); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzHTML(f *testing.F) {
+	for _, payload := range maliciousCorpus {
+		f.Add(payload)
+	}
+	f.Add(`<p>plain <b>bold</b> <a href="https://ok.test">link</a></p>`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		output := sanitize.HTML(input)
+		assertSafe(t, input, output)
+
+		// Sanitizing is idempotent: clean output is a fixed point
+		if again := sanitize.HTML(output); again != output {
+			t.Fatalf("not idempotent for %q:\n first: %q\nsecond: %q", input, output, again)
+		}
+
+		assertSafe(t, input, sanitize.HTML(sanitize.Text(input)))
+	})
+}
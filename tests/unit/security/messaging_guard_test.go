@@ -1,8 +1,10 @@
 package security_test
 
 import (
+	"fmt"
 	"testing"
 
+	"splitter/internal/models"
 	"splitter/internal/security"
 )
 
@@ -71,3 +73,39 @@ func TestMessagingGuard_SuspiciousEventRecording(t *testing.T) {
 		t.Fatalf("expected recent events to include logged security events")
 	}
 }
+
+func TestMessagingGuard_PrekeyClaimsCannotDrainPool(t *testing.T) {
+	guard := security.NewMessagingGuard()
+	const target = "did:key:bob"
+	pool := models.PrekeyUploadMaxBatch
+
+	// Ten actors on one server each cycle through fresh device IDs
+	claimed := 0
+	for actor := 0; actor < 10; actor++ {
+		actorURI := fmt.Sprintf("https://remote.example/ap/users/mallory%d", actor)
+		for device := 0; device < 50; device++ {
+			if allowed, _ := guard.AllowPrekeyClaim(actorURI, "remote.example", fmt.Sprintf("device-%d", device), target); allowed {
+				claimed++
+			}
+		}
+	}
+	if claimed >= pool {
+		t.Fatalf("expected claims with new device IDs to stay below the pool of %d keys, got %d", pool, claimed)
+	}
+	if snapshot := guard.Snapshot(); snapshot.Metrics.PrekeyClaimThrottled == 0 {
+		t.Fatalf("expected PrekeyClaimThrottled metric to increment")
+	}
+
+	// A device retrying within the reuse window gets the keys it holds and is not throttled
+	if allowed, reason := guard.AllowPrekeyClaim("https://remote.example/ap/users/mallory0", "remote.example", "device-0", target); !allowed {
+		t.Fatalf("expected a retry by a device that already claimed to be allowed, got %s", reason)
+	}
+
+	// Other users and other servers are limited separately
+	if allowed, reason := guard.AllowPrekeyClaim("https://remote.example/ap/users/mallory0", "remote.example", "device-new", "did:key:carol"); !allowed {
+		t.Fatalf("expected claims for another user to be allowed, got %s", reason)
+	}
+	if allowed, reason := guard.AllowPrekeyClaim("https://other.example/ap/users/alice", "other.example", "phone", target); !allowed {
+		t.Fatalf("expected claims from another server to be allowed, got %s", reason)
+	}
+}
@@ -0,0 +1,51 @@
+package security_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"splitter/internal/federation"
+	"splitter/internal/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+/*
+WHY THIS TEST EXISTS:
+- With FEDERATION_SECURE_MODE on, actors, outboxes, collections and notes must only be
+  served to servers that sign their fetches, so blocked or anonymous servers cannot read them.
+
+EXPECTED BEHAVIOR:
+- Outside secure mode every GET is served.
+- In secure mode an unsigned GET is refused with 401 and never reaches the handler.
+*/
+
+func TestRequireSignedFetch(t *testing.T) {
+	defer federation.SetSecureMode(federation.IsSecureMode())
+
+	e := echo.New()
+	e.GET("/ap/users/:username", func(c echo.Context) error {
+		return c.String(http.StatusOK, "actor")
+	}, middleware.RequireSignedFetch())
+
+	tests := []struct {
+		name       string
+		secureMode bool
+		wantStatus int
+	}{
+		{"secure mode off", false, http.StatusOK},
+		{"unsigned fetch in secure mode", true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			federation.SetSecureMode(tt.secureMode)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ap/users/alice", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -82,3 +82,43 @@ func TestUserCreateValidation(t *testing.T) {
 		})
 	}
 }
+
+/*
+WHY THIS TEST EXISTS:
+- Cached remote users share the users table with local accounts. Anything served under
+  /ap/users/:username (actors, WebFinger, inboxes, collections) must only ever resolve to
+  a local account, never to a remote user that happens to have the same username.
+
+EXPECTED BEHAVIOR:
+- Accounts of the configured domain, and older ones stored as "localhost" or without a
+  domain, are local.
+- A cached remote user is not local, whatever its username.
+*/
+
+func TestUserIsLocalTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		want   bool
+	}{
+		{"account of this instance", "splitter.test", true},
+		{"account created before the domain was set", "", true},
+		{"account created on localhost", "localhost", true},
+		{"cached remote user with the same username", "mastodon.test", false},
+		{"remote user on a look-alike domain", "splitter.test.evil", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Username: "alice", InstanceDomain: tt.domain}
+			if got := user.IsLocalTo("splitter.test"); got != tt.want {
+				t.Fatalf("IsLocalTo(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+
+	domains := models.LocalInstanceDomains("splitter.test")
+	if len(domains) != 3 || domains[0] != "splitter.test" {
+		t.Fatalf("expected the configured domain first among local domains, got %v", domains)
+	}
+}